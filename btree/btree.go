@@ -0,0 +1,367 @@
+// Package btree is a copy-on-write B+tree over byte-string keys and values.
+//
+// Every node is one fixed-size page. An update never modifies a page: it
+// builds new pages for the nodes on the path from the leaf to the root and
+// frees the old ones, so the tree as it stood before the update stays
+// intact until its pages are reused. Where pages come from is up to the
+// Pager; MemPager keeps them in memory.
+package btree
+
+import (
+	"errors"
+	"io"
+)
+
+// DefaultPageSize is the page size of a BTree that does not set one.
+const DefaultPageSize = 4096
+
+// DefaultValueLimit is the largest value a BTree that does not set a
+// ValueLimit accepts.
+const DefaultValueLimit = 1 << 30
+
+// MinPageSize and MaxPageSize bound the page size a BTree accepts. The
+// upper bound keeps the offsets in a node within 16 bits.
+const (
+	MinPageSize = 128
+	MaxPageSize = 1 << 15
+)
+
+var (
+	ErrEmptyKey      = errors.New("btree: empty key")
+	ErrKeyTooLarge   = errors.New("btree: key larger than the page allows")
+	ErrValueTooLarge = errors.New("btree: value larger than the tree allows")
+	ErrPageSize      = errors.New("btree: page size too small")
+)
+
+// Pager is where a BTree keeps its pages.
+type Pager interface {
+	// Page returns the page at ptr. The tree never modifies it.
+	Page(ptr uint64) []byte
+	// Alloc stores a new page and returns its pointer, which must not be
+	// zero. The pager may keep page; the tree does not touch it again.
+	Alloc(page []byte) uint64
+	// Free releases the page at ptr, which the tree will not use again.
+	Free(ptr uint64)
+}
+
+// EmptyLeaf returns a page of the given size holding a leaf without keys.
+// A Pager that finds a page damaged can return it instead, for reads to go
+// on without what the page held; updating a tree through it is not safe.
+func EmptyLeaf(pageSize int) []byte {
+	n := make(node, pageSize)
+	n.setHeader(nodeLeaf, 0, nil)
+	return n
+}
+
+// BTree is a B+tree. The zero value is an empty tree with DefaultPageSize
+// pages held in a MemPager.
+type BTree struct {
+	// Root points to the root page; zero means the tree is empty.
+	Root uint64
+
+	// Pager stores the pages; nil means a MemPager, created on first use.
+	Pager Pager
+
+	// PageSize is the size of every node in bytes; zero means
+	// DefaultPageSize. It must not change once the tree has pages.
+	PageSize int
+
+	// ValueLimit is the largest value Insert and BulkLoad accept; zero
+	// means DefaultValueLimit. Values too large for a leaf are kept on
+	// overflow pages, so it may be much more than a page.
+	ValueLimit int
+}
+
+func (t *BTree) pager() Pager {
+	if t.Pager == nil {
+		t.Pager = &MemPager{}
+	}
+	return t.Pager
+}
+
+func (t *BTree) pageSize() int {
+	if t.PageSize == 0 {
+		return DefaultPageSize
+	}
+	return t.PageSize
+}
+
+// MaxKeySize is the largest key the tree accepts: a quarter of a page,
+// minus some room for the node header.
+func (t *BTree) MaxKeySize() int { return t.pageSize()/4 - 24 }
+
+// MaxValueSize is the largest value the tree accepts: its ValueLimit.
+func (t *BTree) MaxValueSize() int {
+	if t.ValueLimit == 0 {
+		return DefaultValueLimit
+	}
+	return t.ValueLimit
+}
+
+func (t *BTree) page(ptr uint64) node { return node(t.pager().Page(ptr)) }
+
+// Depth returns the number of levels of nodes, 0 for an empty tree: how
+// many pages a lookup reads. It reads the leftmost path only; every leaf
+// is at the same depth (see Check).
+func (t *BTree) Depth() int {
+	depth := 0
+	for ptr := t.Root; ptr != 0; {
+		depth++
+		n := t.page(ptr)
+		if n.btype() != nodeInternal {
+			break
+		}
+		ptr = n.ptr(0)
+	}
+	return depth
+}
+
+// Get returns the value stored under key. The value may alias the page it
+// is stored in: it must not be modified, and is only good until the page
+// is freed and reused (see Pager). A value on overflow pages is read into
+// a new slice; GetReader reads it bit by bit instead.
+func (t *BTree) Get(key []byte) ([]byte, bool) {
+	leaf, idx, ok := t.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	return t.value(leaf, idx), true
+}
+
+// GetReader returns a reader of the value stored under key, which reads a
+// value on overflow pages one page at a time. Like the tree's pages, it is
+// only good until the tree is updated. It fails with a *CorruptError if it
+// runs into a damaged page.
+func (t *BTree) GetReader(key []byte) (io.Reader, bool) {
+	leaf, idx, ok := t.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	return t.reader(leaf, idx), true
+}
+
+// lookup returns the leaf holding key and its index there.
+func (t *BTree) lookup(key []byte) (node, uint16, bool) {
+	if t.Root == 0 {
+		return nil, 0, false
+	}
+	n := t.page(t.Root)
+	for {
+		idx := n.lookupLE(key)
+		if n.btype() == nodeLeaf {
+			return n, idx, n.compare(idx, key) == 0
+		}
+		n = t.page(n.ptr(idx))
+	}
+}
+
+// check validates a key-value before it goes into the tree.
+func (t *BTree) check(key, val []byte) error {
+	switch {
+	case t.pageSize() < MinPageSize || t.pageSize() > MaxPageSize:
+		return ErrPageSize
+	case len(key) == 0:
+		return ErrEmptyKey
+	case len(key) > t.MaxKeySize():
+		return ErrKeyTooLarge
+	case len(val) > t.MaxValueSize():
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// Insert stores val under key, replacing any value already there.
+func (t *BTree) Insert(key, val []byte) error {
+	if err := t.check(key, val); err != nil {
+		return err
+	}
+	if t.Root == 0 {
+		// The first leaf starts with the empty key, which no real key can
+		// be. It makes every key greater than or equal to some key in the
+		// tree, so lookups always land somewhere.
+		root := make(node, t.pageSize())
+		root.build(nodeLeaf, []entry{{}, t.newEntry(key, val, t.pager().Alloc)})
+		t.Root = t.pager().Alloc(root)
+		return nil
+	}
+	root := t.page(t.Root)
+	kids := t.split(root.btype(), t.insert(root, t.newEntry(key, val, t.pager().Alloc)))
+	t.pager().Free(t.Root)
+	for len(kids) > 1 {
+		// The root split: grow the tree by one level, or more if the
+		// keys of the new root do not fit in a page either.
+		kids = t.split(nodeInternal, t.kidEntries(kids))
+	}
+	t.Root = t.pager().Alloc(kids[0])
+	return nil
+}
+
+// insert returns the key-values of n with e inserted, for split to lay out
+// in nodes.
+func (t *BTree) insert(n node, e entry) []entry {
+	es := n.entries()
+	idx := n.lookupLE(e.key)
+	switch n.btype() {
+	case nodeLeaf:
+		switch n.compare(idx, e.key) {
+		case 0:
+			if es[idx].overflow {
+				t.freeOverflow(es[idx].val)
+			}
+			es[idx] = e
+			return es
+		case -1:
+			idx++
+		} // else smaller than the whole leaf
+		return append(es[:idx], append([]entry{e}, es[idx:]...)...)
+	case nodeInternal:
+		kptr := n.ptr(idx)
+		kid := t.page(kptr)
+		kids := t.split(kid.btype(), t.insert(kid, e))
+		t.pager().Free(kptr)
+		new := t.kidEntries(kids)
+		if idx > 0 {
+			// The old key still separates the first kid from its left
+			// sibling, and may be shorter.
+			new[0].key = es[idx].key
+		}
+		return append(es[:idx], append(new, es[idx+1:]...)...)
+	}
+	panic("btree: bad node type")
+}
+
+// kidEntries allocates kids, the nodes of a level in order, and returns
+// the key-values of their parent. Leaves are told apart by the shortest
+// key that separates them (suffix truncation); above, a node's first key
+// is already as short as it gets.
+func (t *BTree) kidEntries(kids []node) []entry {
+	es := make([]entry, len(kids))
+	for i, kid := range kids {
+		es[i] = entry{key: kid.key(0), ptr: t.pager().Alloc(kid)}
+		if i > 0 && kid.btype() == nodeLeaf {
+			prev := kids[i-1]
+			es[i].key = separator(prev.key(prev.nkeys()-1), es[i].key)
+		}
+	}
+	return es
+}
+
+// split lays out es, in order, in as many nodes of the given type as it
+// takes for each to fit in a page: one if they fit, else by halves.
+func (t *BTree) split(btype uint16, es []entry) []node {
+	if nodeBytes(es) <= t.pageSize() {
+		n := make(node, t.pageSize())
+		n.build(btype, es)
+		return []node{n}
+	}
+	if len(es) < 2 {
+		panic("btree: cannot split node")
+	}
+	half := len(es) / 2
+	return append(t.split(btype, es[:half]), t.split(btype, es[half:])...)
+}
+
+// Delete removes key and reports whether it was there.
+func (t *BTree) Delete(key []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrEmptyKey
+	}
+	if len(key) > t.MaxKeySize() {
+		return false, ErrKeyTooLarge
+	}
+	if t.Root == 0 {
+		return false, nil
+	}
+	updated := t.delete(t.page(t.Root), key)
+	if updated == nil {
+		return false, nil
+	}
+	t.pager().Free(t.Root)
+	if updated.btype() == nodeInternal && updated.nkeys() == 1 {
+		// A root with a single child is a wasted level.
+		t.Root = updated.ptr(0)
+	} else {
+		t.Root = t.pager().Alloc(updated)
+	}
+	return true, nil
+}
+
+// delete returns n with key removed, or nil if key is not in it.
+func (t *BTree) delete(n node, key []byte) node {
+	idx := n.lookupLE(key)
+	switch n.btype() {
+	case nodeLeaf:
+		if n.compare(idx, key) != 0 {
+			return nil
+		}
+		if n.overflow(idx) {
+			t.freeOverflow(n.val(idx))
+		}
+		updated := make(node, t.pageSize())
+		updated.leafDelete(n, idx)
+		return updated
+	case nodeInternal:
+		return t.deleteKid(n, idx, key)
+	}
+	panic("btree: bad node type")
+}
+
+// deleteKid deletes key from the child at idx of n and returns the updated
+// n, merging the child with a sibling when it got too small.
+//
+// The keys of n are left as they were even when the child's first key goes
+// away: an old key still separates the children, and replacing it with a
+// longer one could overflow n, which a delete has no way to split.
+func (t *BTree) deleteKid(n node, idx uint16, key []byte) node {
+	kptr := n.ptr(idx)
+	kid := t.delete(t.page(kptr), key)
+	if kid == nil {
+		return nil
+	}
+	t.pager().Free(kptr)
+
+	updated := make(node, t.pageSize())
+	dir, sibling := t.shouldMerge(n, idx, kid)
+	switch {
+	case dir < 0:
+		merged := make(node, t.pageSize())
+		merged.merge(sibling, kid)
+		t.pager().Free(n.ptr(idx - 1))
+		updated.replace2Kids(n, idx-1, t.pager().Alloc(merged), n.key(idx-1))
+	case dir > 0:
+		merged := make(node, t.pageSize())
+		merged.merge(kid, sibling)
+		t.pager().Free(n.ptr(idx + 1))
+		updated.replace2Kids(n, idx, t.pager().Alloc(merged), n.key(idx))
+	case kid.nkeys() == 0:
+		// An empty only child: n is left empty too, and its own parent
+		// merges it away.
+		updated.setHeader(nodeInternal, 0, nil)
+	default:
+		updated.replaceKid(n, idx, t.pager().Alloc(kid))
+	}
+	return updated
+}
+
+// shouldMerge decides whether kid, the updated child at idx of n, should
+// be merged into its left (-1) or right (+1) sibling, which it returns. A
+// child is merged once it is under a quarter page and the result fits.
+func (t *BTree) shouldMerge(n node, idx uint16, kid node) (int, node) {
+	size := t.pageSize()
+	if kid.nbytes() > size/4 {
+		return 0, nil
+	}
+	if idx > 0 {
+		sibling := t.page(n.ptr(idx - 1))
+		if mergedBytes(sibling, kid) <= size {
+			return -1, sibling
+		}
+	}
+	if idx+1 < n.nkeys() {
+		sibling := t.page(n.ptr(idx + 1))
+		if mergedBytes(kid, sibling) <= size {
+			return +1, sibling
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,221 @@
+package btree_test
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// check fails the test if t does not pass Check, or if its pager holds
+// pages the tree does not reach, and returns the statistics of the tree.
+func check(tb testing.TB, t *btree.BTree) btree.CheckStats {
+	tb.Helper()
+	stats, err := t.Check(nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if m, ok := t.Pager.(*btree.MemPager); ok && m.Len() != stats.Nodes+stats.Overflow {
+		tb.Fatalf("pager holds %d pages, the tree reaches %d", m.Len(), stats.Nodes+stats.Overflow)
+	}
+	return stats
+}
+
+// same fails the test if t does not hold exactly the key-values of ref.
+func same(tb testing.TB, t *btree.BTree, ref map[string]string) {
+	tb.Helper()
+	for k, v := range ref {
+		if got, ok := t.Get([]byte(k)); !ok || string(got) != v {
+			tb.Fatalf("Get(%q) = %q, %v; want %q", k, got, ok, v)
+		}
+	}
+	keys := slices.Sorted(maps.Keys(ref))
+	i := 0
+	for k, v := range t.All() {
+		if i >= len(keys) || string(k) != keys[i] || string(v) != ref[keys[i]] {
+			tb.Fatalf("key-value %d of the tree is %q=%q, not the reference's", i, k, v)
+		}
+		i++
+	}
+	if i != len(keys) {
+		tb.Fatalf("tree holds %d keys, want %d", i, len(keys))
+	}
+}
+
+func randKey(r *rand.Rand, n int) []byte {
+	// Keys share prefixes often, to put the prefix compression to work.
+	return fmt.Appendf(nil, "key%0*d", r.IntN(8)+1, r.IntN(n))
+}
+
+func TestAgainstMap(t *testing.T) {
+	for _, pageSize := range []int{btree.MinPageSize * 2, 512, btree.DefaultPageSize} {
+		t.Run(fmt.Sprint(pageSize), func(t *testing.T) {
+			r := rand.New(rand.NewPCG(uint64(pageSize), 1))
+			tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: pageSize}
+			ref := map[string]string{}
+			for round := range 20 {
+				for range 300 {
+					key := randKey(r, 2000)
+					switch op := r.IntN(10); {
+					case op < 6 || round < 3:
+						val := bytes.Repeat([]byte{byte(r.Uint32())}, r.IntN(pageSize/4))
+						if err := tree.Insert(key, val); err != nil {
+							t.Fatal(err)
+						}
+						ref[string(key)] = string(val)
+					case op < 9:
+						_, want := ref[string(key)]
+						ok, err := tree.Delete(key)
+						if err != nil || ok != want {
+							t.Fatalf("Delete(%q) = %v, %v; want %v", key, ok, err, want)
+						}
+						delete(ref, string(key))
+					default:
+						got, ok := tree.Get(key)
+						want, present := ref[string(key)]
+						if ok != present || string(got) != want {
+							t.Fatalf("Get(%q) = %q, %v; want %q, %v", key, got, ok, want, present)
+						}
+					}
+				}
+				check(t, tree)
+				same(t, tree, ref)
+			}
+			if stats := check(t, tree); stats.Depth < 2 {
+				t.Errorf("tree of %d keys has depth %d: no node split", len(ref), stats.Depth)
+			}
+
+			// Deleting everything merges the tree back into a single
+			// leaf, the sentinel alone.
+			for _, k := range slices.Collect(maps.Keys(ref)) {
+				if ok, err := tree.Delete([]byte(k)); !ok || err != nil {
+					t.Fatalf("Delete(%q) = %v, %v", k, ok, err)
+				}
+			}
+			if stats := check(t, tree); stats.Depth != 1 || stats.Nodes != 1 || stats.Keys != 1 {
+				t.Errorf("emptied tree: %+v, want one leaf with the sentinel", stats)
+			}
+			same(t, tree, nil)
+		})
+	}
+}
+
+func TestSequentialSplitMerge(t *testing.T) {
+	tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 256}
+	const n = 3000
+	key := func(i int) []byte { return fmt.Appendf(nil, "%08d", i) }
+	for i := range n {
+		if err := tree.Insert(key(i), key(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	full := check(t, tree)
+	if full.Keys != n+1 || full.Depth < 3 {
+		t.Errorf("after %d inserts: %+v", n, full)
+	}
+	if tree.Depth() != full.Depth {
+		t.Errorf("Depth() = %d, Check says %d", tree.Depth(), full.Depth)
+	}
+	// Delete from the middle outwards, which merges nodes on both sides.
+	for i := range n / 2 {
+		for _, j := range []int{n/2 - 1 - i, n/2 + i} {
+			if ok, err := tree.Delete(key(j)); !ok || err != nil {
+				t.Fatalf("Delete(%d) = %v, %v", j, ok, err)
+			}
+		}
+		if i%100 == 0 {
+			check(t, tree)
+		}
+	}
+	if stats := check(t, tree); stats.Nodes != 1 {
+		t.Errorf("emptied tree has %d nodes", stats.Nodes)
+	}
+}
+
+func TestPageSizeBound(t *testing.T) {
+	// Every node must fit its page, whatever the mix of key and value
+	// sizes; Check fails a node that does not.
+	r := rand.New(rand.NewPCG(7, 7))
+	tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: btree.MinPageSize}
+	for range 2000 {
+		key := make([]byte, 1+r.IntN(tree.MaxKeySize()))
+		for i := range key {
+			key[i] = byte(r.IntN(4))
+		}
+		val := make([]byte, r.IntN(btree.MinPageSize))
+		if err := tree.Insert(key, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(t, tree)
+}
+
+func TestErrors(t *testing.T) {
+	tree := &btree.BTree{ValueLimit: 100}
+	for _, tc := range []struct {
+		key, val []byte
+		want     error
+	}{
+		{nil, []byte("v"), btree.ErrEmptyKey},
+		{make([]byte, tree.MaxKeySize()+1), nil, btree.ErrKeyTooLarge},
+		{[]byte("k"), make([]byte, 101), btree.ErrValueTooLarge},
+	} {
+		if err := tree.Insert(tc.key, tc.val); err != tc.want {
+			t.Errorf("Insert of a %d-byte key, %d-byte value: %v, want %v", len(tc.key), len(tc.val), err, tc.want)
+		}
+	}
+	if _, err := tree.Delete(nil); err != btree.ErrEmptyKey {
+		t.Errorf("Delete(nil): %v, want ErrEmptyKey", err)
+	}
+	if err := (&btree.BTree{PageSize: 64}).Insert([]byte("k"), nil); err != btree.ErrPageSize {
+		t.Errorf("Insert into a tree of 64-byte pages: %v, want ErrPageSize", err)
+	}
+	if tree.Root != 0 {
+		t.Error("a failed insert gave the tree a root")
+	}
+	if ok, err := tree.Delete([]byte("k")); ok || err != nil {
+		t.Errorf("Delete in an empty tree = %v, %v", ok, err)
+	}
+	if _, ok := tree.Get([]byte("k")); ok {
+		t.Error("Get in an empty tree found a key")
+	}
+}
+
+func TestCopyOnWrite(t *testing.T) {
+	// An update leaves the pages of the tree before it as they were, until
+	// they are freed; a tree at the old root still reads the old keys.
+	pager := &keepPager{}
+	tree := &btree.BTree{Pager: pager, PageSize: 256}
+	for i := range 500 {
+		tree.Insert(fmt.Appendf(nil, "%04d", i), []byte("old"))
+	}
+	old := btree.BTree{Root: tree.Root, Pager: pager, PageSize: 256}
+	for i := range 500 {
+		tree.Insert(fmt.Appendf(nil, "%04d", i), []byte("new"))
+		if i%2 == 0 {
+			tree.Delete(fmt.Appendf(nil, "%04d", i))
+		}
+	}
+	if _, err := old.Check(nil); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, v := range old.All() {
+		if string(v) != "old" {
+			t.Fatalf("old tree reads %q", v)
+		}
+		n++
+	}
+	if n != 500 {
+		t.Errorf("old tree holds %d keys, want 500", n)
+	}
+}
+
+// keepPager is a MemPager that never frees a page.
+type keepPager struct{ btree.MemPager }
+
+func (*keepPager) Free(uint64) {}
@@ -0,0 +1,129 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"iter"
+)
+
+var (
+	ErrNotEmpty = errors.New("btree: bulk load into a tree that has keys")
+	ErrUnsorted = errors.New("btree: bulk load keys not in increasing order")
+)
+
+// BulkLoad fills an empty tree with the key-values of seq, which must come
+// in strictly increasing key order. Rather than inserting them one by one,
+// it builds the tree bottom-up: it fills each leaf as full as it goes,
+// then the nodes above them the same way, so every page is read and
+// written once and the tree comes out compact.
+//
+// On an error, from a key-value the tree does not accept or out of order,
+// BulkLoad frees the pages it allocated and leaves the tree empty.
+func (t *BTree) BulkLoad(seq iter.Seq2[[]byte, []byte]) error {
+	if t.Root != 0 {
+		return ErrNotEmpty
+	}
+	b := builder{t: t}
+	var err error
+	for key, val := range seq {
+		if err = t.check(key, val); err != nil {
+			break
+		}
+		if b.levels == nil {
+			// The leftmost leaf starts with the empty sentinel key; see
+			// Insert.
+			b.add(0, entry{})
+		} else if bytes.Compare(b.last, key) >= 0 {
+			err = ErrUnsorted
+			break
+		}
+		b.last = bytes.Clone(key)
+		e := t.newEntry(b.last, val, b.alloc)
+		if !e.overflow {
+			e.val = bytes.Clone(val)
+		}
+		b.add(0, e)
+	}
+	if err != nil {
+		for _, ptr := range b.pages {
+			t.pager().Free(ptr)
+		}
+		return err
+	}
+	t.Root = b.finish()
+	return nil
+}
+
+// builder keeps the node being filled at every level of a tree built
+// bottom-up, leaves first.
+type builder struct {
+	t       *BTree
+	levels  [][]entry // the key-values of each open node
+	sums    []int     // the bytes their key-values take, whole keys and all
+	pages   []uint64  // every page allocated, overflow pages included
+	last    []byte    // the last key added
+	leafEnd []byte    // the last key of the last leaf written
+}
+
+// add appends e to the open node at level, after writing the node out if
+// e does not fit.
+func (b *builder) add(level int, e entry) {
+	if level == len(b.levels) {
+		b.levels = append(b.levels, nil)
+		b.sums = append(b.sums, 0)
+	}
+	kv := 4 + len(e.key) + len(e.val)
+	if es := b.levels[level]; len(es) > 0 {
+		// e is the last key of the node, so the prefix of the node with
+		// it is what the first and e share.
+		plen := commonPrefix(es[0].key, e.key)
+		n := len(es) + 1
+		if headerSize+plen+10*n+b.sums[level]+kv-n*plen > b.t.pageSize() {
+			b.emit(level)
+		}
+	}
+	b.levels[level] = append(b.levels[level], e)
+	b.sums[level] += kv
+}
+
+// emit writes out the open node at level and adds it to its parent.
+func (b *builder) emit(level int) {
+	es := b.levels[level]
+	b.levels[level], b.sums[level] = nil, 0
+	n := make(node, b.t.pageSize())
+	btype := uint16(nodeLeaf)
+	if level > 0 {
+		btype = nodeInternal
+	}
+	n.build(btype, es)
+	ptr := b.alloc(n)
+	key := es[0].key
+	if level == 0 {
+		// See BTree.kidEntries.
+		if b.leafEnd != nil {
+			key = separator(b.leafEnd, key)
+		}
+		b.leafEnd = es[len(es)-1].key
+	}
+	b.add(level+1, entry{key: key, ptr: ptr})
+}
+
+func (b *builder) alloc(page []byte) uint64 {
+	ptr := b.t.pager().Alloc(page)
+	b.pages = append(b.pages, ptr)
+	return ptr
+}
+
+// finish writes out the open nodes from the leaves up and returns the
+// root, which is zero if nothing was added.
+func (b *builder) finish() uint64 {
+	for level := 0; level < len(b.levels); level++ {
+		if level > 0 && level == len(b.levels)-1 && len(b.levels[level]) == 1 {
+			return b.levels[level][0].ptr
+		}
+		if len(b.levels[level]) > 0 {
+			b.emit(level)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+package btree_test
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// pairs yields the key-values of keys, each key its own value.
+func pairs(keys ...string) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		for _, k := range keys {
+			if !yield([]byte(k), []byte(k)) {
+				return
+			}
+		}
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 5000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			ref := map[string]string{}
+			keys := make([]string, n)
+			for i := range keys {
+				keys[i] = fmt.Sprintf("key%06d", i)
+				ref[keys[i]] = keys[i]
+			}
+			tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 512}
+			if err := tree.BulkLoad(pairs(keys...)); err != nil {
+				t.Fatal(err)
+			}
+			check(t, tree)
+			same(t, tree, ref)
+
+			// The tree takes inserts and deletes as any other.
+			if err := tree.Insert([]byte("key"), []byte("first")); err != nil {
+				t.Fatal(err)
+			}
+			ref["key"] = "first"
+			for i := 0; i < n; i += 3 {
+				tree.Delete([]byte(keys[i]))
+				delete(ref, keys[i])
+			}
+			check(t, tree)
+			same(t, tree, ref)
+		})
+	}
+}
+
+func TestBulkLoadCompact(t *testing.T) {
+	loaded := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 512}
+	inserted := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 512}
+	var keys []string
+	for i := range 5000 {
+		keys = append(keys, fmt.Sprintf("key%06d", i))
+	}
+	if err := loaded.BulkLoad(pairs(keys...)); err != nil {
+		t.Fatal(err)
+	}
+	// Random order leaves the pages of an inserted tree half full or so.
+	for i := range keys {
+		k := keys[i*7919%len(keys)]
+		if err := inserted.Insert([]byte(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ls, is := check(t, loaded), check(t, inserted)
+	if ls.Keys != is.Keys {
+		t.Fatalf("%d keys loaded, %d inserted", ls.Keys, is.Keys)
+	}
+	if fill := float64(ls.Bytes) / float64(ls.Nodes*512); fill < 0.9 {
+		t.Errorf("loaded pages %.0f%% full, want 90%% or more", fill*100)
+	}
+	if ls.Nodes >= is.Nodes || ls.Depth > is.Depth {
+		t.Errorf("loaded tree of %d pages at depth %d, inserted one of %d at depth %d", ls.Nodes, ls.Depth, is.Nodes, is.Depth)
+	}
+}
+
+func TestBulkLoadErrors(t *testing.T) {
+	tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 512}
+	if err := tree.Insert([]byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.BulkLoad(pairs("a")); !errors.Is(err, btree.ErrNotEmpty) {
+		t.Errorf("BulkLoad into a tree with keys: %v, want ErrNotEmpty", err)
+	}
+
+	var many []string
+	for i := range 1000 {
+		many = append(many, fmt.Sprintf("key%06d", i))
+	}
+	big := string(make([]byte, 1000))
+	for _, tc := range []struct {
+		name string
+		keys []string
+		want error
+	}{
+		{"unsorted", slices.Concat(many, []string{"a"}), btree.ErrUnsorted},
+		{"duplicate", slices.Concat(many, []string{many[len(many)-1]}), btree.ErrUnsorted},
+		{"empty key", slices.Concat(many, []string{""}), btree.ErrEmptyKey},
+		{"key too large", slices.Concat(many, []string{"z" + big}), btree.ErrKeyTooLarge},
+	} {
+		m := &btree.MemPager{}
+		tree := &btree.BTree{Pager: m, PageSize: 512}
+		if err := tree.BulkLoad(pairs(tc.keys...)); !errors.Is(err, tc.want) {
+			t.Errorf("%s: %v, want %v", tc.name, err, tc.want)
+		}
+		if tree.Root != 0 || m.Len() != 0 {
+			t.Errorf("%s: failed load left root %d and %d pages", tc.name, tree.Root, m.Len())
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrCorrupt is what a *CorruptError matches with errors.Is.
+var ErrCorrupt = errors.New("btree: corrupt page")
+
+// CorruptError is a problem found with a page, by Check or by a Pager
+// reading its own structures.
+type CorruptError struct {
+	Page   uint64
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("corrupt page %d: %s", e.Page, e.Reason)
+}
+
+func (e *CorruptError) Unwrap() error { return ErrCorrupt }
+
+// CheckStats describes the tree Check walked.
+type CheckStats struct {
+	Depth  int // levels of nodes; 0 for an empty tree
+	Nodes  int // pages in the tree
+	Leaves int
+	Keys   int // keys in the leaves, the sentinel included
+	Bytes  int // bytes the nodes use of their pages
+
+	Overflow int // pages holding values too large for a leaf
+}
+
+// Check walks the whole tree and checks every node: its layout fits the
+// page, its keys are in order and within the range its parent gives it,
+// and every leaf is at the same depth. It follows the overflow pages of
+// large values as well, and checks they hold the whole value. It calls
+// visit, if not nil, with each page pointer before reading the page; an
+// error from visit, such as for a pointer past the end of the file, a page
+// reached twice or a checksum that does not match, is reported for that
+// page, which is then skipped. A *CorruptError from visit is reported as
+// it is.
+//
+// Check does not stop at the first problem. It returns them all, joined,
+// each a *CorruptError, along with statistics on the tree.
+func (t *BTree) Check(visit func(ptr uint64) error) (CheckStats, error) {
+	c := checker{t: t, visit: visit, leafDepth: -1}
+	if t.Root != 0 {
+		c.node(t.Root, 1, nil, nil, true)
+	}
+	c.stats.Depth = max(c.leafDepth, 0)
+	return c.stats, errors.Join(c.errs...)
+}
+
+type checker struct {
+	t         *BTree
+	visit     func(ptr uint64) error
+	stats     CheckStats
+	leafDepth int
+	errs      []error
+}
+
+func (c *checker) fail(ptr uint64, format string, args ...any) {
+	c.errs = append(c.errs, &CorruptError{Page: ptr, Reason: fmt.Sprintf(format, args...)})
+}
+
+// visitErr calls visit with ptr and records the error it returns, if any,
+// as a *CorruptError for the page.
+func (c *checker) visitErr(ptr uint64) error {
+	if c.visit == nil {
+		return nil
+	}
+	err := c.visit(ptr)
+	if err != nil {
+		var ce *CorruptError
+		if errors.As(err, &ce) {
+			c.errs = append(c.errs, err)
+		} else {
+			c.fail(ptr, "%v", err)
+		}
+	}
+	return err
+}
+
+// node checks the node at ptr, depth levels down, whose keys must be in
+// [lo, hi) (nil hi: no bound). The leftmost node of the tree must start
+// with the empty sentinel key.
+func (c *checker) node(ptr uint64, depth int, lo, hi []byte, leftmost bool) {
+	if c.visitErr(ptr) != nil {
+		return
+	}
+	n := c.t.page(ptr)
+	if !c.layout(ptr, n) {
+		return
+	}
+	c.stats.Nodes++
+	c.stats.Bytes += n.nbytes()
+	nkeys := n.nkeys()
+	for i := uint16(0); i < nkeys; i++ {
+		key := n.key(i)
+		if i > 0 && bytes.Compare(n.key(i-1), key) >= 0 {
+			c.fail(ptr, "key %d out of order", i)
+		}
+		// Above the leaves key 0 may be smaller than the keys below it,
+		// and than lo (see BTree.deleteKid).
+		if (n.btype() == nodeLeaf || i > 0) && bytes.Compare(key, lo) < 0 {
+			c.fail(ptr, "key %d below the range of the node", i)
+		}
+		if hi != nil && bytes.Compare(key, hi) >= 0 {
+			c.fail(ptr, "key %d above the range of the node", i)
+		}
+		if len(key) > c.t.MaxKeySize() {
+			c.fail(ptr, "key %d is %d bytes, more than the page size allows", i, len(key))
+		}
+		switch {
+		case n.btype() == nodeLeaf && n.overflow(i):
+			c.overflow(ptr, i, n.val(i))
+		case len(n.val(i)) > c.t.maxInline():
+			c.fail(ptr, "value %d is %d bytes, more than a leaf holds", i, len(n.val(i)))
+		}
+	}
+	if leftmost && nkeys > 0 && n.btype() == nodeLeaf && len(n.key(0)) != 0 {
+		c.fail(ptr, "first leaf does not start with the empty key")
+	}
+	if n.btype() == nodeLeaf {
+		c.stats.Leaves++
+		c.stats.Keys += int(nkeys)
+		if c.leafDepth < 0 {
+			c.leafDepth = depth
+		} else if depth != c.leafDepth {
+			c.fail(ptr, "leaf at depth %d, others at %d", depth, c.leafDepth)
+		}
+		return
+	}
+	for i := uint16(0); i < nkeys; i++ {
+		if len(n.val(i)) != 0 {
+			c.fail(ptr, "internal node with a value at %d", i)
+		}
+		klo, khi := lo, hi
+		if i > 0 {
+			klo = n.key(i)
+		}
+		if i+1 < nkeys {
+			khi = n.key(i + 1)
+		}
+		c.node(n.ptr(i), depth+1, klo, khi, leftmost && i == 0)
+	}
+}
+
+// overflow checks the overflow pages of value i of the leaf at ptr, which
+// the leaf says are at ref.
+func (c *checker) overflow(ptr uint64, i uint16, ref []byte) {
+	if len(ref) != overflowRef {
+		c.fail(ptr, "value %d on overflow pages, with a %d-byte reference", i, len(ref))
+		return
+	}
+	left, next := parseRef(ref)
+	for left > 0 {
+		if err := c.visitErr(next); err != nil {
+			return
+		}
+		data, after, err := c.t.overflowPage(next, left)
+		if err != nil {
+			c.errs = append(c.errs, err)
+			return
+		}
+		c.stats.Overflow++
+		left -= int64(len(data))
+		next = after
+	}
+}
+
+// layout checks that n's header, offsets and key-values fit in the page,
+// so that the node can be read at all.
+func (c *checker) layout(ptr uint64, n node) bool {
+	size := c.t.pageSize()
+	if len(n) != size {
+		c.fail(ptr, "page is %d bytes, not %d", len(n), size)
+		return false
+	}
+	if t := n.btype(); t != nodeInternal && t != nodeLeaf {
+		c.fail(ptr, "bad node type %d", t)
+		return false
+	}
+	nkeys := int(n.nkeys())
+	base := headerSize + 10*nkeys + int(n.plen())
+	if base > size {
+		c.fail(ptr, "%d keys and a %d-byte prefix do not fit in a page", nkeys, n.plen())
+		return false
+	}
+	prev := 0
+	for i := 1; i <= nkeys; i++ {
+		off := int(n.offset(uint16(i)))
+		if off < prev+4 {
+			c.fail(ptr, "offset %d out of order", i)
+			return false
+		}
+		prev = off
+		if base+off > size {
+			c.fail(ptr, "key-value %d runs past the page", i-1)
+			return false
+		}
+		pos := n.kvPos(uint16(i - 1))
+		klen := int(binary.LittleEndian.Uint16(n[pos:]))
+		vlen := int(binary.LittleEndian.Uint16(n[pos+2:]) &^ overflowFlag)
+		if pos+4+klen+vlen != n.kvPos(uint16(i)) {
+			c.fail(ptr, "key-value %d does not match its offsets", i-1)
+			return false
+		}
+	}
+	return true
+}
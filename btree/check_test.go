@@ -0,0 +1,116 @@
+package btree_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// sequential returns a tree of n keys over 256-byte pages.
+func sequential(tb testing.TB, n int) *btree.BTree {
+	tb.Helper()
+	tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 256}
+	for i := range n {
+		if err := tree.Insert(fmt.Appendf(nil, "%05d", i), []byte("value")); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return tree
+}
+
+func TestCheckStats(t *testing.T) {
+	var empty btree.BTree
+	if stats, err := empty.Check(nil); err != nil || stats != (btree.CheckStats{}) {
+		t.Errorf("Check of an empty tree = %+v, %v", stats, err)
+	}
+	tree := sequential(t, 2000)
+	stats := check(t, tree)
+	if stats.Keys != 2001 || stats.Depth != tree.Depth() || stats.Leaves >= stats.Nodes || stats.Overflow != 0 {
+		t.Errorf("stats %+v for 2000 keys at depth %d", stats, tree.Depth())
+	}
+	if stats.Bytes <= 0 || stats.Bytes > stats.Nodes*256 {
+		t.Errorf("nodes of %d pages use %d bytes", stats.Nodes, stats.Bytes)
+	}
+
+	visited := map[uint64]int{}
+	if _, err := tree.Check(func(ptr uint64) error { visited[ptr]++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(visited) != stats.Nodes {
+		t.Errorf("visit saw %d pages, the tree has %d", len(visited), stats.Nodes)
+	}
+	for ptr, n := range visited {
+		if n != 1 {
+			t.Errorf("visit saw page %d %d times", ptr, n)
+		}
+	}
+}
+
+func TestCheckVisitErrors(t *testing.T) {
+	tree := sequential(t, 2000)
+	full := check(t, tree)
+	bad := errors.New("past the end of the file")
+	reported := &btree.CorruptError{Page: 42, Reason: "my own"}
+	// The first two children of the root; see the node layout.
+	root := tree.Pager.Page(tree.Root)
+	first, second := binary.LittleEndian.Uint64(root[10:]), binary.LittleEndian.Uint64(root[18:])
+	stats, err := tree.Check(func(ptr uint64) error {
+		switch ptr {
+		case first:
+			return bad
+		case second:
+			return reported
+		}
+		return nil
+	})
+	var errs []*btree.CorruptError
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var ce *btree.CorruptError
+		if !errors.As(e, &ce) {
+			t.Fatalf("%v is not a *CorruptError", e)
+		}
+		errs = append(errs, ce)
+	}
+	if len(errs) != 2 || !errors.Is(err, btree.ErrCorrupt) {
+		t.Fatalf("Check = %v, want the two visit errors", err)
+	}
+	if errs[0].Page != first || errs[0].Reason != bad.Error() {
+		t.Errorf("visit error reported as %v, want it for page %d", errs[0], first)
+	}
+	if errs[1] != reported {
+		t.Errorf("a *CorruptError from visit reported as %v", errs[1])
+	}
+	// The subtrees under the pages visit refused were skipped.
+	if stats.Nodes >= full.Nodes || stats.Keys >= full.Keys {
+		t.Errorf("Check read %+v of %+v", stats, full)
+	}
+}
+
+func TestCheckFindsDisorder(t *testing.T) {
+	tree := sequential(t, 2000)
+	// Swap the first two children of the root: their keys are then each
+	// out of the range the root gives them, and the first leaf no longer
+	// starts with the sentinel.
+	root := tree.Pager.Page(tree.Root)
+	a, b := binary.LittleEndian.Uint64(root[10:]), binary.LittleEndian.Uint64(root[18:])
+	binary.LittleEndian.PutUint64(root[10:], b)
+	binary.LittleEndian.PutUint64(root[18:], a)
+	_, err := tree.Check(nil)
+	if !errors.Is(err, btree.ErrCorrupt) {
+		t.Fatalf("Check of a tree with swapped children: %v", err)
+	}
+	var ce *btree.CorruptError
+	if errors.As(err, &ce); ce.Page != a && ce.Page != b {
+		t.Errorf("first problem %v is not on a swapped child", ce)
+	}
+
+	// A page that claims more keys than it holds.
+	tree = sequential(t, 10)
+	binary.LittleEndian.PutUint16(tree.Pager.Page(tree.Root)[2:], 1000)
+	if _, err = tree.Check(nil); !errors.Is(err, btree.ErrCorrupt) {
+		t.Errorf("Check of a leaf with a bad key count: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package btree
+
+import (
+	"bytes"
+	"iter"
+)
+
+// Iter is a position in a tree, for walking its keys in order. It reads
+// the pages as they were when it was made: the tree must not be updated
+// while it is in use (or at least, its pages must not be freed and
+// reused).
+type Iter struct {
+	t    *BTree
+	path []node   // from the root down to a leaf
+	pos  []uint16 // index into each node of path
+	ok   bool
+}
+
+// All returns the key-values of the tree in order, to range over. Like
+// those of an Iter, they alias the pages they are stored in.
+func (t *BTree) All() iter.Seq2[[]byte, []byte] {
+	return func(yield func(key, val []byte) bool) {
+		for it := t.SeekGE(nil); it.Valid(); it.Next() {
+			if !yield(it.Key(), it.Val()) {
+				return
+			}
+		}
+	}
+}
+
+// SeekLE returns an iterator at the last key less than or equal to key.
+func (t *BTree) SeekLE(key []byte) *Iter {
+	it := t.seek(key)
+	// Above the leaves a stale key 0 can land the search on a key that is
+	// greater than key; see lookupLE.
+	if it.ok && (it.onSentinel() || bytes.Compare(it.Key(), key) > 0) {
+		it.Prev()
+	}
+	return it
+}
+
+// SeekGE returns an iterator at the first key greater than or equal to key.
+func (t *BTree) SeekGE(key []byte) *Iter {
+	it := t.seek(key)
+	// The search lands on the last key less than or equal to key, or on
+	// the first key past a stale key 0, which is then the one wanted.
+	if it.ok && (it.onSentinel() || bytes.Compare(it.Key(), key) < 0) {
+		it.Next()
+	}
+	return it
+}
+
+// seek descends to the leaf position lookupLE picks for key.
+func (t *BTree) seek(key []byte) *Iter {
+	it := &Iter{t: t}
+	if t.Root == 0 {
+		return it
+	}
+	for ptr := t.Root; ; {
+		n := t.page(ptr)
+		idx := n.lookupLE(key)
+		it.path = append(it.path, n)
+		it.pos = append(it.pos, idx)
+		if n.btype() == nodeLeaf {
+			break
+		}
+		ptr = n.ptr(idx)
+	}
+	it.ok = true
+	return it
+}
+
+// Valid reports whether the iterator is at a key. An iterator that went
+// past either end stays invalid.
+func (it *Iter) Valid() bool { return it.ok }
+
+// Key returns the key the iterator is at. Like the value, it aliases the
+// page it is stored in.
+func (it *Iter) Key() []byte {
+	leaf := len(it.path) - 1
+	return it.path[leaf].key(it.pos[leaf])
+}
+
+// Val returns the value the iterator is at. A value on overflow pages is
+// read into a new slice, as by Get.
+func (it *Iter) Val() []byte {
+	leaf := len(it.path) - 1
+	return it.t.value(it.path[leaf], it.pos[leaf])
+}
+
+// onSentinel reports whether the iterator is at the empty first key, which
+// is not a key of the tree.
+func (it *Iter) onSentinel() bool { return len(it.Key()) == 0 }
+
+// Next moves to the following key.
+func (it *Iter) Next() {
+	if it.ok {
+		it.ok = it.next(len(it.path) - 1)
+	}
+}
+
+// Prev moves to the preceding key.
+func (it *Iter) Prev() {
+	if it.ok {
+		it.ok = it.prev(len(it.path)-1) && !it.onSentinel()
+	}
+}
+
+// next moves one position forward at level, reporting false at the end.
+func (it *Iter) next(level int) bool {
+	if it.pos[level]+1 < it.path[level].nkeys() {
+		it.pos[level]++
+	} else if level == 0 || !it.next(level-1) {
+		return false
+	} else {
+		it.path[level] = it.t.page(it.path[level-1].ptr(it.pos[level-1]))
+		it.pos[level] = 0
+	}
+	return true
+}
+
+// prev moves one position back at level, reporting false at the start.
+func (it *Iter) prev(level int) bool {
+	if it.pos[level] > 0 {
+		it.pos[level]--
+	} else if level == 0 || !it.prev(level-1) {
+		return false
+	} else {
+		it.path[level] = it.t.page(it.path[level-1].ptr(it.pos[level-1]))
+		it.pos[level] = it.path[level].nkeys() - 1
+	}
+	return true
+}
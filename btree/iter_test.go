@@ -0,0 +1,121 @@
+package btree_test
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+func TestSeek(t *testing.T) {
+	// Even keys only, over many small pages, with some deleted to leave
+	// stale separators above the leaves.
+	tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 256}
+	key := func(i int) []byte { return fmt.Appendf(nil, "%05d", i) }
+	var keys []string
+	for i := 0; i < 2000; i += 2 {
+		tree.Insert(key(i), nil)
+	}
+	for i := 0; i < 2000; i += 2 {
+		if i%10 == 0 {
+			tree.Delete(key(i))
+		} else {
+			keys = append(keys, string(key(i)))
+		}
+	}
+	check(t, tree)
+
+	for i := -1; i <= 2001; i++ {
+		k := string(key(i))
+		ge, _ := slices.BinarySearch(keys, k)
+		it := tree.SeekGE([]byte(k))
+		if ge == len(keys) {
+			if it.Valid() {
+				t.Errorf("SeekGE(%s) at %s, want past the end", k, it.Key())
+			}
+		} else if !it.Valid() || string(it.Key()) != keys[ge] {
+			t.Errorf("SeekGE(%s) at %q, want %s", k, it.Key(), keys[ge])
+		}
+
+		le := ge
+		if le == len(keys) || keys[le] != k {
+			le--
+		}
+		it = tree.SeekLE([]byte(k))
+		if le < 0 {
+			if it.Valid() {
+				t.Errorf("SeekLE(%s) at %s, want before the start", k, it.Key())
+			}
+		} else if !it.Valid() || string(it.Key()) != keys[le] {
+			t.Errorf("SeekLE(%s) at %q, want %s", k, it.Key(), keys[le])
+		}
+	}
+}
+
+func TestIterNextPrev(t *testing.T) {
+	tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 256}
+	const n = 1000
+	for i := range n {
+		tree.Insert(fmt.Appendf(nil, "%04d", i), fmt.Appendf(nil, "v%d", i))
+	}
+	it := tree.SeekGE(nil)
+	for i := range n {
+		if !it.Valid() || string(it.Key()) != fmt.Sprintf("%04d", i) || string(it.Val()) != fmt.Sprint("v", i) {
+			t.Fatalf("step %d forward: at %q=%q", i, it.Key(), it.Val())
+		}
+		it.Next()
+	}
+	if it.Valid() {
+		t.Fatal("iterator valid past the last key")
+	}
+	it.Prev()
+	if it.Valid() {
+		t.Error("Prev brought an iterator back from past the end")
+	}
+
+	it = tree.SeekLE([]byte("9999"))
+	for i := n - 1; i >= 0; i-- {
+		if !it.Valid() || string(it.Key()) != fmt.Sprintf("%04d", i) {
+			t.Fatalf("step %d back: at %q", n-1-i, it.Key())
+		}
+		it.Prev()
+	}
+	if it.Valid() {
+		t.Errorf("iterator valid before the first key, at %q: the sentinel", it.Key())
+	}
+
+	// Turning round mid-way.
+	it = tree.SeekGE([]byte("0500"))
+	it.Next()
+	it.Prev()
+	it.Prev()
+	if string(it.Key()) != "0499" {
+		t.Errorf("at %q after Next, Prev, Prev from 0500", it.Key())
+	}
+
+	var seen int
+	for range tree.All() {
+		if seen++; seen == 10 {
+			break
+		}
+	}
+	if seen != 10 {
+		t.Errorf("All went on after the break")
+	}
+}
+
+func TestSeekEmpty(t *testing.T) {
+	var tree btree.BTree
+	if tree.SeekGE(nil).Valid() || tree.SeekLE([]byte("z")).Valid() {
+		t.Error("iterator of an empty tree is valid")
+	}
+	for range tree.All() {
+		t.Error("All of an empty tree yields a key")
+	}
+	tree.Insert([]byte("a"), nil)
+	tree.Delete([]byte("a"))
+	if it := tree.SeekGE(nil); it.Valid() {
+		t.Errorf("emptied tree yields %q", it.Key())
+	}
+}
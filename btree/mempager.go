@@ -0,0 +1,35 @@
+package btree
+
+// MemPager is a Pager that keeps pages in memory. The zero value is ready
+// to use. It is what a BTree without a Pager uses.
+type MemPager struct {
+	pages map[uint64][]byte
+	next  uint64
+}
+
+// Page returns the page at ptr. It panics if there is none.
+func (m *MemPager) Page(ptr uint64) []byte {
+	page, ok := m.pages[ptr]
+	if !ok {
+		panic("btree: MemPager: bad page pointer")
+	}
+	return page
+}
+
+// Alloc stores page, which it keeps, and returns its pointer.
+func (m *MemPager) Alloc(page []byte) uint64 {
+	if m.pages == nil {
+		m.pages = make(map[uint64][]byte)
+	}
+	m.next++ // pointer 0 means "no page"
+	m.pages[m.next] = page
+	return m.next
+}
+
+// Free drops the page at ptr.
+func (m *MemPager) Free(ptr uint64) {
+	delete(m.pages, ptr)
+}
+
+// Len returns the number of pages in use.
+func (m *MemPager) Len() int { return len(m.pages) }
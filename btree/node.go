@@ -0,0 +1,305 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// A node is one page of the tree, laid out as
+//
+//	| type | nkeys | reserved | plen |  pointers  |  offsets   | prefix | key-values
+//	|  2B  |  2B   |    4B    |  2B  | nkeys * 8B | nkeys * 2B |  plen  | ...
+//
+// and each key-value as
+//
+//	| klen | vlen | key | val |
+//	|  2B  |  2B  | ... | ... |
+//
+// Internal nodes use the pointers and leave the values empty; leaves use
+// the values, or say where a large one is (see overflow.go), and leave the
+// pointers zero. Offsets are relative to the
+// first key-value and give where key-value i+1 starts, so the last one
+// doubles as the size of the key-value area. All integers little-endian.
+//
+// Every key of the node starts with the prefix, which is stored once: the
+// key-values only hold the rest of each key, and klen is its length. Keys
+// with a long common prefix, such as paths, take that much less room, so
+// more of them fit in a node.
+//
+// The tree never reads or writes the reserved bytes; they belong to the
+// Pager, which may keep a checksum of the page there (package pager does).
+type node []byte
+
+const (
+	nodeInternal = 1 // internal node: keys and child pointers
+	nodeLeaf     = 2 // leaf: keys and values
+)
+
+const headerSize = 10
+
+func (n node) btype() uint16 { return binary.LittleEndian.Uint16(n[0:2]) }
+func (n node) nkeys() uint16 { return binary.LittleEndian.Uint16(n[2:4]) }
+func (n node) plen() uint16  { return binary.LittleEndian.Uint16(n[8:10]) }
+
+// setHeader starts a node of nkeys keys that all start with prefix.
+func (n node) setHeader(btype, nkeys uint16, prefix []byte) {
+	binary.LittleEndian.PutUint16(n[0:2], btype)
+	binary.LittleEndian.PutUint16(n[2:4], nkeys)
+	binary.LittleEndian.PutUint16(n[8:10], uint16(len(prefix)))
+	copy(n[n.prefixPos():], prefix)
+}
+
+func (n node) prefixPos() int { return headerSize + 10*int(n.nkeys()) }
+
+// prefix is what every key of n starts with.
+func (n node) prefix() []byte {
+	plen := int(n.plen())
+	return n[n.prefixPos():][:plen:plen]
+}
+
+func (n node) ptr(i uint16) uint64 {
+	pos := headerSize + 8*int(i)
+	return binary.LittleEndian.Uint64(n[pos:])
+}
+
+func (n node) setPtr(i uint16, ptr uint64) {
+	pos := headerSize + 8*int(i)
+	binary.LittleEndian.PutUint64(n[pos:], ptr)
+}
+
+func (n node) offsetPos(i uint16) int {
+	return headerSize + 8*int(n.nkeys()) + 2*int(i-1)
+}
+
+// offset is where key-value i starts, relative to the first one.
+func (n node) offset(i uint16) uint16 {
+	if i == 0 {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(n[n.offsetPos(i):])
+}
+
+func (n node) setOffset(i uint16, off uint16) {
+	binary.LittleEndian.PutUint16(n[n.offsetPos(i):], off)
+}
+
+// kvPos is the position of key-value i in the node.
+func (n node) kvPos(i uint16) int {
+	return n.prefixPos() + int(n.plen()) + int(n.offset(i))
+}
+
+// suffix is key i without the node's prefix, as stored.
+func (n node) suffix(i uint16) []byte {
+	pos := n.kvPos(i)
+	klen := binary.LittleEndian.Uint16(n[pos:])
+	return n[pos+4:][:klen:klen]
+}
+
+// key returns key i. It aliases the page only if the node has no prefix.
+func (n node) key(i uint16) []byte {
+	if n.plen() == 0 {
+		return n.suffix(i)
+	}
+	return append(bytes.Clone(n.prefix()), n.suffix(i)...)
+}
+
+// compare compares key i with key, like bytes.Compare(n.key(i), key).
+func (n node) compare(i uint16, key []byte) int {
+	prefix := n.prefix()
+	common := min(len(prefix), len(key))
+	if c := bytes.Compare(prefix, key[:common]); c != 0 || len(key) < len(prefix) {
+		return c
+	}
+	return bytes.Compare(n.suffix(i), key[len(prefix):])
+}
+
+// val returns value i as stored: for a value on overflow pages, where to
+// find it (see overflow.go).
+func (n node) val(i uint16) []byte {
+	pos := n.kvPos(i)
+	klen := binary.LittleEndian.Uint16(n[pos:])
+	vlen := binary.LittleEndian.Uint16(n[pos+2:]) &^ overflowFlag
+	return n[pos+4+int(klen):][:vlen:vlen]
+}
+
+// overflow reports whether value i is on overflow pages.
+func (n node) overflow(i uint16) bool {
+	return binary.LittleEndian.Uint16(n[n.kvPos(i)+2:])&overflowFlag != 0
+}
+
+// setOverflow marks value i, once appended, as on overflow pages.
+func (n node) setOverflow(i uint16) {
+	pos := n.kvPos(i) + 2
+	binary.LittleEndian.PutUint16(n[pos:], binary.LittleEndian.Uint16(n[pos:])|overflowFlag)
+}
+
+// nbytes is the size the node actually uses.
+func (n node) nbytes() int { return n.kvPos(n.nkeys()) }
+
+// lookupLE returns the index of the last key less than or equal to key, or
+// 0 if there is none. Above the leaves key 0 can be smaller than the keys
+// actually stored below it (see BTree.deleteKid), so a key less than key 0
+// still belongs under child 0.
+func (n node) lookupLE(key []byte) uint16 {
+	nkeys := int(n.nkeys())
+	i := sort.Search(nkeys-1, func(i int) bool {
+		return n.compare(uint16(i+1), key) > 0
+	})
+	return uint16(i)
+}
+
+// appendKV writes key-value i. Key-values must be appended in order, after
+// the header has been set; key must start with the node's prefix.
+func (n node) appendKV(i uint16, ptr uint64, key, val []byte) {
+	n.appendParts(i, ptr, nil, key, val)
+}
+
+// appendParts is appendKV for the key made of head followed by tail.
+func (n node) appendParts(i uint16, ptr uint64, head, tail, val []byte) {
+	if skip := int(n.plen()); skip <= len(head) {
+		head = head[skip:]
+	} else {
+		head, tail = nil, tail[skip-len(head):]
+	}
+	klen := len(head) + len(tail)
+	n.setPtr(i, ptr)
+	pos := n.kvPos(i)
+	binary.LittleEndian.PutUint16(n[pos:], uint16(klen))
+	binary.LittleEndian.PutUint16(n[pos+2:], uint16(len(val)))
+	copy(n[pos+4:], head)
+	copy(n[pos+4+len(head):], tail)
+	copy(n[pos+4+klen:], val)
+	n.setOffset(i+1, n.offset(i)+4+uint16(klen+len(val)))
+}
+
+// appendRange copies count key-values of old, starting at src, to n
+// starting at dst. n's prefix must be shared by the keys copied.
+func (n node) appendRange(old node, dst, src, count uint16) {
+	for i := uint16(0); i < count; i++ {
+		n.appendParts(dst+i, old.ptr(src+i), old.prefix(), old.suffix(src+i), old.val(src+i))
+		if old.overflow(src + i) {
+			n.setOverflow(dst + i)
+		}
+	}
+}
+
+// replaceKid makes n old with the child at idx replaced by ptr. The key
+// stays: it still separates the child from its siblings.
+func (n node) replaceKid(old node, idx uint16, ptr uint64) {
+	n.setHeader(nodeInternal, old.nkeys(), old.prefix())
+	n.appendRange(old, 0, 0, idx)
+	n.appendParts(idx, ptr, old.prefix(), old.suffix(idx), nil)
+	n.appendRange(old, idx+1, idx+1, old.nkeys()-(idx+1))
+}
+
+// leafDelete makes n old without key-value idx.
+func (n node) leafDelete(old node, idx uint16) {
+	n.setHeader(nodeLeaf, old.nkeys()-1, old.prefix())
+	n.appendRange(old, 0, 0, idx)
+	n.appendRange(old, idx, idx+1, old.nkeys()-(idx+1))
+}
+
+// mergedPrefix is the prefix of left and right merged: what both their
+// prefixes start with. That of an empty node counts for nothing, so an
+// empty node merges into any sibling (see BTree.deleteKid).
+func mergedPrefix(left, right node) []byte {
+	switch {
+	case left.nkeys() == 0:
+		return right.prefix()
+	case right.nkeys() == 0:
+		return left.prefix()
+	}
+	return left.prefix()[:commonPrefix(left.prefix(), right.prefix())]
+}
+
+// mergedBytes is the size of left and right merged.
+func mergedBytes(left, right node) int {
+	plen := len(mergedPrefix(left, right))
+	grow := func(n node) int { return int(n.nkeys()) * (int(n.plen()) - plen) }
+	return left.nbytes() + right.nbytes() - headerSize - int(left.plen()) - int(right.plen()) + plen +
+		grow(left) + grow(right)
+}
+
+// merge makes n the key-values of left followed by those of right.
+func (n node) merge(left, right node) {
+	n.setHeader(left.btype(), left.nkeys()+right.nkeys(), mergedPrefix(left, right))
+	n.appendRange(left, 0, 0, left.nkeys())
+	n.appendRange(right, left.nkeys(), 0, right.nkeys())
+}
+
+// replace2Kids makes n old with the children at idx and idx+1 replaced by
+// the single child ptr whose first key is key.
+func (n node) replace2Kids(old node, idx uint16, ptr uint64, key []byte) {
+	n.setHeader(nodeInternal, old.nkeys()-1, old.prefix())
+	n.appendRange(old, 0, 0, idx)
+	n.appendKV(idx, ptr, key, nil)
+	n.appendRange(old, idx+1, idx+2, old.nkeys()-(idx+2))
+}
+
+// entry is a key-value of a node being built: a value in a leaf, a child
+// pointer above.
+type entry struct {
+	key, val []byte
+	ptr      uint64
+	overflow bool // val is where to find the value; see overflow.go
+}
+
+// entries returns the key-values of n.
+func (n node) entries() []entry {
+	es := make([]entry, n.nkeys())
+	for i := range es {
+		es[i] = entry{key: n.key(uint16(i)), val: n.val(uint16(i)), ptr: n.ptr(uint16(i)), overflow: n.overflow(uint16(i))}
+	}
+	return es
+}
+
+// nodeBytes is the size of a node holding es, which are in order.
+func nodeBytes(es []entry) int {
+	if len(es) == 0 {
+		return headerSize
+	}
+	plen := commonPrefix(es[0].key, es[len(es)-1].key)
+	size := headerSize + plen
+	for _, e := range es {
+		size += 8 + 2 + 4 + len(e.key) - plen + len(e.val)
+	}
+	return size
+}
+
+// build makes n a node of the given type holding es, which are in order,
+// with the longest prefix they share.
+func (n node) build(btype uint16, es []entry) {
+	var prefix []byte
+	if len(es) > 0 {
+		prefix = es[0].key[:commonPrefix(es[0].key, es[len(es)-1].key)]
+	}
+	n.setHeader(btype, uint16(len(es)), prefix)
+	for i, e := range es {
+		n.appendKV(uint16(i), e.ptr, e.key, e.val)
+		if e.overflow {
+			n.setOverflow(uint16(i))
+		}
+	}
+}
+
+// commonPrefix is the length of the longest prefix of both a and b. For
+// keys in order, that of the first and the last is shared by all.
+func commonPrefix(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// separator returns the shortest key greater than left and no greater
+// than right, which must be greater than left: right, cut just past the
+// first byte where the two differ. Between a leaf ending with left and the
+// next one, starting with right, it does as well as right and takes less
+// room in their parent.
+func separator(left, right []byte) []byte {
+	return right[:commonPrefix(left, right)+1]
+}
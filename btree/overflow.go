@@ -0,0 +1,154 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A value too large for a leaf (see maxInline) is kept on a chain of
+// overflow pages, each laid out as
+//
+//	| type | len | reserved | next | data |
+//	|  2B  | 2B  |    4B    |  8B  | len  |
+//
+// where next points to the following page of the chain, zero on the last
+// one, and every page but the last is full. The leaf holds, in place of
+// the value,
+//
+//	| size | first page |
+//	|  8B  |     8B     |
+//
+// with the top bit of vlen set to tell it from a value stored inline. The
+// reserved bytes belong to the Pager, as in a node.
+const (
+	nodeOverflow   = 3
+	overflowHeader = 16
+	overflowRef    = 16
+	overflowFlag   = 0x8000 // in vlen; page sizes keep vlen below it
+)
+
+// maxInline is the largest value kept in a leaf. Larger ones go to
+// overflow pages, so that a leaf always holds a few key-values.
+func (t *BTree) maxInline() int { return t.pageSize() / 4 }
+
+// overflowCap is the data an overflow page holds.
+func (t *BTree) overflowCap() int { return t.pageSize() - overflowHeader }
+
+// newEntry returns the leaf entry for (key, val), writing val to overflow
+// pages, which it allocates with alloc, if it is too large for a leaf.
+func (t *BTree) newEntry(key, val []byte, alloc func(page []byte) uint64) entry {
+	if len(val) <= t.maxInline() {
+		return entry{key: key, val: val}
+	}
+	// Write the chain from its end, so that each page knows the next.
+	var next uint64
+	chunk := t.overflowCap()
+	for end := len(val); end > 0; {
+		start := (end - 1) / chunk * chunk
+		page := make([]byte, t.pageSize())
+		binary.LittleEndian.PutUint16(page[0:2], nodeOverflow)
+		binary.LittleEndian.PutUint16(page[2:4], uint16(end-start))
+		binary.LittleEndian.PutUint64(page[8:16], next)
+		copy(page[overflowHeader:], val[start:end])
+		next = alloc(page)
+		end = start
+	}
+	ref := make([]byte, overflowRef)
+	binary.LittleEndian.PutUint64(ref[0:8], uint64(len(val)))
+	binary.LittleEndian.PutUint64(ref[8:16], next)
+	return entry{key: key, val: ref, overflow: true}
+}
+
+// parseRef returns the size and first page of the value ref points to.
+func parseRef(ref []byte) (int64, uint64) {
+	return int64(binary.LittleEndian.Uint64(ref[0:8])), binary.LittleEndian.Uint64(ref[8:16])
+}
+
+// overflowPage reads the page at ptr of a chain that still has left bytes
+// to give, and returns its data and the next page.
+func (t *BTree) overflowPage(ptr uint64, left int64) ([]byte, uint64, error) {
+	fail := func(format string, args ...any) ([]byte, uint64, error) {
+		return nil, 0, &CorruptError{Page: ptr, Reason: fmt.Sprintf(format, args...)}
+	}
+	page := t.pager().Page(ptr)
+	if len(page) != t.pageSize() {
+		return fail("page is %d bytes, not %d", len(page), t.pageSize())
+	}
+	if typ := binary.LittleEndian.Uint16(page[0:2]); typ != nodeOverflow {
+		return fail("overflow page of type %d", typ)
+	}
+	size := int(binary.LittleEndian.Uint16(page[2:4]))
+	next := binary.LittleEndian.Uint64(page[8:16])
+	if want := min(int64(t.overflowCap()), left); int64(size) != want {
+		return fail("overflow page holds %d bytes, not %d", size, want)
+	}
+	if (next == 0) != (left == int64(size)) {
+		return fail("overflow chain of the wrong length")
+	}
+	return page[overflowHeader:][:size:size], next, nil
+}
+
+// freeOverflow frees the overflow pages of the value ref points to. A
+// damaged page panics with its *CorruptError, as for a Pager.
+func (t *BTree) freeOverflow(ref []byte) {
+	left, ptr := parseRef(ref)
+	for left > 0 {
+		data, next, err := t.overflowPage(ptr, left)
+		if err != nil {
+			panic(err)
+		}
+		t.pager().Free(ptr)
+		left -= int64(len(data))
+		ptr = next
+	}
+}
+
+// value returns value i of leaf n, read from its overflow pages into a
+// new slice if it is on some.
+func (t *BTree) value(n node, i uint16) []byte {
+	if !n.overflow(i) {
+		return n.val(i)
+	}
+	size, _ := parseRef(n.val(i))
+	val := make([]byte, size)
+	if _, err := io.ReadFull(t.reader(n, i), val); err != nil {
+		panic(err)
+	}
+	return val
+}
+
+// reader returns a reader of value i of leaf n.
+func (t *BTree) reader(n node, i uint16) io.Reader {
+	if !n.overflow(i) {
+		return bytes.NewReader(n.val(i))
+	}
+	left, ptr := parseRef(n.val(i))
+	return &overflowReader{t: t, next: ptr, left: left}
+}
+
+// overflowReader reads a value off its overflow pages, one at a time.
+type overflowReader struct {
+	t    *BTree
+	next uint64 // the page to read once data is used up
+	left int64  // the bytes of the value on the pages still to read
+	data []byte // the rest of the page read last
+}
+
+// Read reads the value on. A damaged page fails it with a *CorruptError.
+func (r *overflowReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		if r.left == 0 {
+			return 0, io.EOF
+		}
+		data, next, err := r.t.overflowPage(r.next, r.left)
+		if err != nil {
+			return 0, err
+		}
+		r.data, r.next, r.left = data, next, r.left-int64(len(data))
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
@@ -0,0 +1,114 @@
+package btree_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"testing"
+	"testing/iotest"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// bigValue returns n bytes of noise, the same for the same n.
+func bigValue(n int) []byte {
+	r := rand.New(rand.NewPCG(uint64(n), 5))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(r.Uint32())
+	}
+	return b
+}
+
+func TestOverflow(t *testing.T) {
+	const pageSize = 512
+	// The sizes either side of what a leaf keeps (a quarter of a page) and
+	// of whole overflow pages (the page less a 16-byte header).
+	sizes := []int{0, 127, 128, 129, 496, 497, 992, 993, 100_000}
+	tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: pageSize}
+	ref := map[string]string{}
+	for i, n := range sizes {
+		k := fmt.Sprintf("k%02d", i)
+		if err := tree.Insert([]byte(k), bigValue(n)); err != nil {
+			t.Fatal(err)
+		}
+		ref[k] = string(bigValue(n))
+	}
+	stats := check(t, tree)
+	same(t, tree, ref)
+	want := 0
+	for _, n := range sizes {
+		if n > pageSize/4 {
+			want += (n + pageSize - 17) / (pageSize - 16)
+		}
+	}
+	if stats.Overflow != want {
+		t.Errorf("%d overflow pages, want %d", stats.Overflow, want)
+	}
+
+	for i, n := range sizes {
+		r, ok := tree.GetReader(fmt.Appendf(nil, "k%02d", i))
+		if !ok {
+			t.Fatalf("GetReader of the %d-byte value found nothing", n)
+		}
+		if err := iotest.TestReader(r, bigValue(n)); err != nil {
+			t.Errorf("reader of the %d-byte value: %v", n, err)
+		}
+	}
+	if _, ok := tree.GetReader([]byte("none")); ok {
+		t.Error("GetReader of a missing key found it")
+	}
+
+	// Replacing and deleting the values frees their chains; check counts
+	// the pages left.
+	for i := range sizes {
+		k := fmt.Sprintf("k%02d", i)
+		if i%2 == 0 {
+			if err := tree.Insert([]byte(k), []byte("small")); err != nil {
+				t.Fatal(err)
+			}
+			ref[k] = "small"
+		} else {
+			tree.Delete([]byte(k))
+			delete(ref, k)
+		}
+	}
+	if stats = check(t, tree); stats.Overflow != 0 {
+		t.Errorf("%d overflow pages left after replacing every large value", stats.Overflow)
+	}
+	same(t, tree, ref)
+}
+
+func TestValueLimit(t *testing.T) {
+	tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 512, ValueLimit: 10_000}
+	if err := tree.Insert([]byte("k"), bigValue(10_000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tree.Insert([]byte("k"), bigValue(10_001)); !errors.Is(err, btree.ErrValueTooLarge) {
+		t.Errorf("Insert of a value over the limit: %v, want ErrValueTooLarge", err)
+	}
+	if got, _ := tree.Get([]byte("k")); !bytes.Equal(got, bigValue(10_000)) {
+		t.Error("a failed Insert changed the value")
+	}
+	check(t, tree)
+}
+
+func TestOverflowReaderCorrupt(t *testing.T) {
+	m := &btree.MemPager{}
+	tree := &btree.BTree{Pager: m, PageSize: 512}
+	if err := tree.Insert([]byte("k"), bigValue(5000)); err != nil {
+		t.Fatal(err)
+	}
+	// Break the type of the last page the chain reaches.
+	var last uint64
+	tree.Check(func(ptr uint64) error { last = ptr; return nil })
+	m.Page(last)[0] ^= 0xff
+	r, _ := tree.GetReader([]byte("k"))
+	_, err := io.ReadAll(r)
+	var ce *btree.CorruptError
+	if !errors.As(err, &ce) || ce.Page != last {
+		t.Errorf("reading through a damaged chain: %v, want a CorruptError of page %d", err, last)
+	}
+}
@@ -0,0 +1,101 @@
+package btree_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+func TestPrefixCompression(t *testing.T) {
+	const n = 3000
+	dir := "/home/user/projects/go-database/testdata/fixtures/"
+	tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 512}
+	ref := map[string]string{}
+	for i := range n {
+		k := fmt.Sprintf("%sfile%05d", dir, i*7919%n)
+		if err := tree.Insert([]byte(k), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+		ref[k] = "v"
+	}
+	stats := check(t, tree)
+	same(t, tree, ref)
+	// Whole, the keys alone would take 177 KB; their prefix is stored
+	// once a node.
+	if whole := n * (len(dir) + 9); stats.Bytes > whole/2 {
+		t.Errorf("%d keys of %d bytes take %d bytes of nodes", n, len(dir)+9, stats.Bytes)
+	}
+	if perLeaf := n / stats.Leaves; perLeaf < 15 {
+		t.Errorf("%d keys a leaf, want 15 or more", perLeaf)
+	}
+}
+
+func TestSeparatorTruncation(t *testing.T) {
+	// Keys that differ in their first bytes and share long tails: each
+	// leaf holds few, and the parents tell them apart by a byte or two.
+	tail := strings.Repeat("x", 80)
+	tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: 512}
+	for i := range 2000 {
+		k := fmt.Sprintf("%04d%s", i*7919%2000, tail)
+		if err := tree.Insert([]byte(k), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := check(t, tree)
+	if internal := stats.Nodes - stats.Leaves; internal*8 > stats.Leaves {
+		t.Errorf("%d internal nodes over %d leaves: separators not truncated", internal, stats.Leaves)
+	}
+}
+
+func TestPrefixEdgeCases(t *testing.T) {
+	for name, keys := range map[string][]string{
+		// Each key a prefix of the next.
+		"prefixes": func() []string {
+			var ks []string
+			for i := 1; i <= 40; i++ {
+				ks = append(ks, strings.Repeat("a", i))
+			}
+			return ks
+		}(),
+		"bytes": func() []string {
+			var ks []string
+			for i := range 256 {
+				ks = append(ks, string([]byte{byte(i)}), string([]byte{byte(i), 0}), string([]byte{byte(i), 0xff, 0xff}))
+			}
+			return ks
+		}(),
+		"mixed": func() []string {
+			r := rand.New(rand.NewPCG(7, 7))
+			var ks []string
+			for range 2000 {
+				prefix := []string{"", "p/", "p/q/", "p/q/r/s/t/u/v/"}[r.IntN(4)]
+				ks = append(ks, fmt.Sprintf("%s%x", prefix, r.Uint32()>>r.IntN(32)))
+			}
+			return ks
+		}(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			tree := &btree.BTree{Pager: &btree.MemPager{}, PageSize: btree.MinPageSize * 2}
+			ref := map[string]string{}
+			for i, k := range keys {
+				if err := tree.Insert([]byte(k), fmt.Appendf(nil, "%d", i)); err != nil {
+					t.Fatal(err)
+				}
+				ref[k] = fmt.Sprint(i)
+			}
+			check(t, tree)
+			same(t, tree, ref)
+			for i, k := range keys {
+				if i%2 == 0 {
+					tree.Delete([]byte(k))
+					delete(ref, k)
+				}
+			}
+			check(t, tree)
+			same(t, tree, ref)
+		})
+	}
+}
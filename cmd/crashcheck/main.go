@@ -0,0 +1,185 @@
+// Command crashcheck backs the durability claims of package kv. It runs a
+// write workload on a dbtest.CrashFS, crashes it at each of its writes,
+// truncations and syncs in turn, and checks that the database reopens
+// holding exactly the updates of the last commit acknowledged, or of the
+// one in progress. It then updates the recovered database, to make sure
+// its free list is sound, and checks it again.
+//
+// Usage:
+//
+//	crashcheck [-seed n] [-txs n] [-max n] [-sync always|batch] [-compress] [-encrypt]
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/pager"
+)
+
+var (
+	seed   = flag.Uint64("seed", 1, "seed of the workload and of the crashes")
+	txs    = flag.Int("txs", 40, "transactions in the workload")
+	maxRun = flag.Int("max", 0, "crash points to try, spread over the workload; 0 means all")
+	policy = flag.String("sync", "always", "sync policy: always or batch")
+	flate  = flag.Bool("compress", false, "compress the pages with pager.Flate")
+	crypt  = flag.Bool("encrypt", false, "encrypt the pages, with a fixed key")
+)
+
+// state is the content of the database.
+type state map[string]string
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	opts := kv.Options{PageSize: 512}
+	switch *policy {
+	case "always":
+	case "batch":
+		opts.Sync, opts.SyncDelay = pager.SyncBatch, time.Millisecond
+	default:
+		log.Fatalf("crashcheck: unknown sync policy %q", *policy)
+	}
+	if *flate {
+		opts.Compressor = pager.Flate
+	}
+	if *crypt {
+		opts.Key = bytes.Repeat([]byte{0x5a}, 32)
+	}
+	dir, err := os.MkdirTemp("", "crashcheck")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A run without a crash gives the states after each commit, and how
+	// many calls there are to crash at.
+	states := []state{{}}
+	cfs := &dbtest.CrashFS{}
+	if _, err := run(filepath.Join(dir, "ref"), opts, cfs, func(s state) { states = append(states, maps.Clone(s)) }); err != nil {
+		log.Fatal("crashcheck: run without crash: ", err)
+	}
+	calls := cfs.Calls()
+	step := 1
+	if *maxRun > 0 && calls > *maxRun {
+		step = calls / *maxRun
+	}
+	failed := 0
+	for at := 1; at <= calls; at += step {
+		path := filepath.Join(dir, fmt.Sprint("db", at))
+		if err := check(path, opts, at, states); err != nil {
+			log.Printf("crash at call %d of %d: %v", at, calls, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("crashcheck: %d of %d crash points failed", failed, (calls+step-1)/step)
+	}
+	log.Printf("crashcheck: %d crash points over %d calls passed", (calls+step-1)/step, calls)
+}
+
+// run applies the workload to the database at path until it is done or a
+// commit fails, calling committed with the state after each acknowledged
+// commit. It returns how many commits were acknowledged.
+func run(path string, opts kv.Options, cfs *dbtest.CrashFS, committed func(state)) (int, error) {
+	opts.FS = cfs
+	db, err := opts.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	rng := rand.New(rand.NewPCG(*seed, 0))
+	s := state{}
+	for n := 0; n < *txs; n++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return n, err
+		}
+		next := maps.Clone(s)
+		for range 1 + rng.IntN(8) {
+			key := fmt.Sprintf("key%03d", rng.IntN(200))
+			if rng.IntN(4) == 0 {
+				if _, err = tx.Del([]byte(key)); err != nil {
+					break
+				}
+				delete(next, key)
+				continue
+			}
+			val := bytes.Repeat([]byte{byte('a' + rng.IntN(26))}, rng.IntN(100))
+			if err = tx.Set([]byte(key), val); err != nil {
+				break
+			}
+			next[key] = string(val)
+		}
+		if err != nil {
+			tx.Rollback()
+			return n, err
+		}
+		if err = tx.Commit(); err != nil {
+			return n, err
+		}
+		s = next
+		committed(s)
+	}
+	return *txs, db.Close()
+}
+
+// check crashes the workload at the given call and checks what the file
+// holds after.
+func check(path string, opts kv.Options, at int, states []state) error {
+	cfs := &dbtest.CrashFS{CrashAt: at, Rand: rand.New(rand.NewPCG(*seed, uint64(at)))}
+	acked, err := run(path, opts, cfs, func(state) {})
+	if err == nil {
+		return nil // the crash came as the database closed
+	}
+	if cfs.Crashes() == 0 {
+		return fmt.Errorf("workload failed without a crash: %v", err)
+	}
+	opts.FS = nil
+	db, err := opts.Open(path)
+	if err != nil {
+		return fmt.Errorf("reopen: %v", err)
+	}
+	defer db.Close()
+	got, err := dump(db)
+	if err != nil {
+		return err
+	}
+	if !maps.Equal(got, states[acked]) && (acked+1 >= len(states) || !maps.Equal(got, states[acked+1])) {
+		return fmt.Errorf("reopened with %d keys, none of the states of commits %d and %d", len(got), acked, acked+1)
+	}
+	// Churn the recovered file, so that its free list gets reused.
+	for i := range 50 {
+		key := []byte(fmt.Sprintf("key%03d", i*7%200))
+		if err = db.Set(key, bytes.Repeat([]byte{'z'}, i)); err != nil {
+			return fmt.Errorf("update after reopen: %v", err)
+		}
+		got[string(key)] = string(bytes.Repeat([]byte{'z'}, i))
+	}
+	after, err := dump(db)
+	if err != nil {
+		return err
+	}
+	if !maps.Equal(after, got) {
+		return fmt.Errorf("updates after reopen read back wrong")
+	}
+	return nil
+}
+
+func dump(db *kv.DB) (state, error) {
+	s := state{}
+	err := db.Scan(nil, nil, func(key, val []byte) bool {
+		s[string(key)] = string(val)
+		return true
+	})
+	return s, err
+}
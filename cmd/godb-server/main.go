@@ -0,0 +1,88 @@
+// Command godb-server serves a database file of package kv on the network,
+// for the clients of package remote, so that several processes or
+// machines can share it.
+//
+// Usage:
+//
+//	godb-server [-addr host:port] [-readonly] [-metrics host:port] FILE
+//
+// It opens FILE, creating it if needed, or only reads it with -readonly,
+// and serves it on addr, localhost:7070 by default, until interrupted,
+// when it closes the database. The protocol has no authentication or
+// encryption: serve it on a trusted network only.
+//
+// With -metrics, it also serves the statistics of the database over HTTP
+// on that address: at /metrics for Prometheus (see kv.DB.WriteMetrics)
+// and as the expvar variable "godb" at /debug/vars.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/remote"
+)
+
+var (
+	addr     = flag.String("addr", "localhost:7070", "address to listen on")
+	readOnly = flag.Bool("readonly", false, "open the database read-only")
+	metrics  = flag.String("metrics", "", "address to serve /metrics and /debug/vars on")
+	maxMsg   = flag.Int("maxmessage", remote.DefaultMaxMessage, "longest request or response to take or send, in bytes")
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: godb-server [-addr host:port] [-readonly] [-metrics host:port] [-maxmessage n] FILE")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	db, err := kv.Options{ReadOnly: *readOnly}.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("godb-server: %v", err)
+	}
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		db.Close()
+		log.Fatalf("godb-server: %v", err)
+	}
+	log.Printf("godb-server: serving %s on %s", flag.Arg(0), l.Addr())
+	if *metrics != "" {
+		db.PublishExpvar("godb")
+		http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+			db.WriteMetrics(w)
+		})
+		go func() {
+			// expvar serves /debug/vars on the default mux.
+			log.Fatalf("godb-server: %v", http.ListenAndServe(*metrics, nil))
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	go func() {
+		<-stop
+		l.Close()
+	}()
+	err = remote.Options{MaxMessage: *maxMsg}.Serve(l, db)
+	// Close waits for the write transaction open, if any; the requests of
+	// connections still open fail with kv.ErrClosed from then on.
+	if cerr := db.Close(); cerr != nil {
+		log.Fatalf("godb-server: %v", cerr)
+	}
+	if !errors.Is(err, net.ErrClosed) {
+		log.Fatalf("godb-server: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/pager"
+)
+
+// benchConfig is what the flags of bench set.
+type benchConfig struct {
+	w        dbtest.Workload
+	dist     string
+	sync     string
+	compress bool
+}
+
+// flags registers the flags of bench on fs.
+func (c *benchConfig) flags(fs *flag.FlagSet) {
+	w := &c.w
+	fs.IntVar(&w.Ops, "ops", 10000, "run `N` operations")
+	fs.DurationVar(&w.Duration, "duration", 0, "run for `D` instead of a number of operations")
+	fs.IntVar(&w.Keys, "keys", 10000, "load and use `N` keys")
+	fs.IntVar(&w.KeySize, "keysize", 16, "make the keys `N` bytes")
+	fs.IntVar(&w.ValueSize, "valuesize", 100, "make the values `N` bytes")
+	fs.Float64Var(&w.Reads, "reads", 0.5, "make the share `F` of the operations reads, the others writes")
+	fs.IntVar(&w.Batch, "batch", 1, "write `N` keys per transaction")
+	fs.IntVar(&w.Workers, "workers", 1, "run the operations on `N` goroutines")
+	fs.Uint64Var(&w.Seed, "seed", 1, "seed of the keys and values")
+	fs.StringVar(&c.dist, "dist", "uniform", "pick the keys `D`: uniform, zipf or sequential")
+	fs.StringVar(&c.sync, "sync", "always", "sync policy: always, batch or off")
+	fs.BoolVar(&c.compress, "compress", false, "compress the pages with pager.Flate")
+}
+
+// bench runs the workload of c on a new database at path, or in a
+// temporary file if path is empty, and writes what it measured to out.
+func bench(out io.Writer, path string, c benchConfig) error {
+	w := c.w
+	var err error
+	if w.Dist, err = dbtest.ParseDistribution(c.dist); err != nil {
+		return err
+	}
+	w.NoReads = w.Reads == 0
+	var opts kv.Options
+	switch c.sync {
+	case "always":
+	case "batch":
+		opts.Sync = pager.SyncBatch
+	case "off":
+		opts.Sync = pager.SyncOff
+	default:
+		return fmt.Errorf("unknown sync policy %q", c.sync)
+	}
+	if c.compress {
+		opts.Compressor = pager.Flate
+	}
+	if path == "" {
+		dir, err := os.MkdirTemp("", "godb-bench")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		path = filepath.Join(dir, "bench.db")
+	} else if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		// The workload overwrites keys: it is no way to treat data.
+		return fmt.Errorf("%s: the database of a benchmark must be new", path)
+	}
+	db, err := opts.Open(path)
+	if err != nil {
+		return err
+	}
+	res, err := w.Run(db)
+	st := db.Stats()
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	ops := res.Ops()
+	fmt.Fprintf(out, "loaded %d keys in %v\n", w.Keys, res.Load.Round(time.Millisecond))
+	fmt.Fprintf(out, "ran %d operations in %v: %.0f ops/s\n", ops, res.Elapsed.Round(time.Millisecond),
+		float64(ops)/res.Elapsed.Seconds())
+	fmt.Fprintf(out, "%-6s %8s %10s %10s %10s %10s %10s\n", "", "count", "mean", "p50", "p90", "p99", "max")
+	for _, l := range []struct {
+		name string
+		lat  dbtest.Latencies
+	}{{"get", res.Reads}, {"commit", res.Writes}} {
+		if len(l.lat) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "%-6s %8d %10v %10v %10v %10v %10v\n", l.name, len(l.lat), round(l.lat.Mean()),
+			round(l.lat.Percentile(0.5)), round(l.lat.Percentile(0.9)), round(l.lat.Percentile(0.99)),
+			round(l.lat[len(l.lat)-1]))
+	}
+	fmt.Fprintf(out, "pages %d, depth %d, syncs %d", st.Pages, st.Depth, st.Syncs)
+	if st.Cache.Hits+st.Cache.Misses > 0 {
+		fmt.Fprintf(out, ", cache hit rate %.1f%%", 100*st.Cache.HitRate())
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+// round rounds a latency to three or so significant digits.
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond)
+	case d >= time.Microsecond:
+		return d.Round(100 * time.Nanosecond)
+	}
+	return d
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	out := mustGodb(t, "", "bench", "-ops", "500", "-keys", "200", "-reads", "0.5", "-dist", "zipf",
+		"-workers", "2", "-sync", "off", path)
+	for _, re := range []string{
+		`(?m)^loaded 200 keys in `,
+		`(?m)^ran 500 operations in .*: \d+ ops/s$`,
+		`(?m)^ +count +mean +p50 +p90 +p99 +max$`,
+		`(?m)^get +\d+ `,
+		`(?m)^commit +\d+ `,
+		`(?m)^pages \d+, depth \d+, syncs \d+`,
+	} {
+		if !regexp.MustCompile(re).MatchString(out) {
+			t.Errorf("bench output does not match %s:\n%s", re, out)
+		}
+	}
+	// The database stays behind, with the keys.
+	if got := mustGodb(t, "", "scan", path); strings.Count(got, "\n") != 200 {
+		t.Errorf("scan after bench:\n%s", got)
+	}
+
+	// Only writes leave out the line of the Gets; a temporary file
+	// goes.
+	out = mustGodb(t, "", "bench", "-ops", "50", "-keys", "10", "-reads", "0", "-sync", "batch", "-compress")
+	if strings.Contains(out, "\nget ") || !strings.Contains(out, "\ncommit ") {
+		t.Errorf("bench output without reads:\n%s", out)
+	}
+	if m, _ := filepath.Glob(filepath.Join(os.TempDir(), "godb-bench*")); len(m) != 0 {
+		t.Errorf("bench left %v", m)
+	}
+}
+
+func TestBenchErrors(t *testing.T) {
+	existing := fill(t, "k", "v")
+	for name, args := range map[string][]string{
+		"existing file": {existing},
+		"unknown dist":  {"-dist", "normal"},
+		"unknown sync":  {"-sync", "never"},
+		"share over 1":  {"-reads", "2"},
+		"negative size": {"-valuesize", "-1"},
+	} {
+		if _, errOut, status := godb(t, "", append([]string{"bench", "-ops", "10", "-keys", "10"}, args...)...); status != 1 || errOut == "" {
+			t.Errorf("bench with %s: status %d, %q", name, status, errOut)
+		}
+	}
+	if got := mustGodb(t, "", "get", existing, "k"); got != "v" {
+		t.Errorf("bench of an existing database changed k to %q", got)
+	}
+}
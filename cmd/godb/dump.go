@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// A dump is JSON lines: a header line
+//
+//	{"format":"godb-dump","version":1}
+//
+// then a line for each key-value, in key order,
+//
+//	{"key":"user/1","value":"ann"}
+//
+// where a key or value that is not valid UTF-8 goes in "key64" or
+// "value64" instead, in standard base64:
+//
+//	{"key64":"AHQAAAAA","value":"..."}
+//
+// scan prints its key-values as the lines of a dump, without the header.
+const (
+	dumpFormat  = "godb-dump"
+	dumpVersion = 1
+)
+
+type header struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+type record struct {
+	Key     *string `json:"key,omitempty"`
+	Key64   []byte  `json:"key64,omitempty"`
+	Value   *string `json:"value,omitempty"`
+	Value64 []byte  `json:"value64,omitempty"`
+}
+
+func newRecord(key, val []byte) record {
+	var r record
+	if utf8.Valid(key) {
+		s := string(key)
+		r.Key = &s
+	} else {
+		r.Key64 = key
+	}
+	if utf8.Valid(val) {
+		s := string(val)
+		r.Value = &s
+	} else {
+		r.Value64 = val
+	}
+	return r
+}
+
+// keyValue returns the key-value of r.
+func (r record) keyValue() (key, val []byte, err error) {
+	switch {
+	case (r.Key == nil) == (r.Key64 == nil):
+		return nil, nil, errors.New("need one of key and key64")
+	case (r.Value == nil) == (r.Value64 == nil):
+		return nil, nil, errors.New("need one of value and value64")
+	}
+	key, val = r.Key64, r.Value64
+	if r.Key != nil {
+		key = []byte(*r.Key)
+	}
+	if r.Value != nil {
+		val = []byte(*r.Value)
+	}
+	return key, val, nil
+}
+
+// scanFunc is the Scan method of a kv.DB or kv.Tx.
+type scanFunc func(lo, hi []byte, fn func(key, val []byte) bool) error
+
+// writeRecords writes the key-values in [lo, hi) that scan finds to w as
+// dump lines, at most limit of them if limit > 0.
+func writeRecords(w io.Writer, scan scanFunc, lo, hi []byte, limit int) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	var werr error
+	n := 0
+	err := scan(lo, hi, func(key, val []byte) bool {
+		werr = enc.Encode(newRecord(key, val))
+		n++
+		return werr == nil && (limit <= 0 || n < limit)
+	})
+	if err == nil {
+		err = werr
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	return err
+}
+
+// dump writes a dump of db to w.
+func dump(w io.Writer, db *kv.DB) error {
+	line, _ := json.Marshal(header{Format: dumpFormat, Version: dumpVersion})
+	if _, err := fmt.Fprintf(w, "%s\n", line); err != nil {
+		return err
+	}
+	return writeRecords(w, db.Scan, nil, nil, 0)
+}
+
+// restore sets the key-values of the dump r in db, in one transaction, and
+// returns how many there were. On an error nothing is set. The records of
+// TTLs (see kv.TTLPrefix) are restored last, since setting their keys
+// clears them.
+func restore(db *kv.DB, r io.Reader) (int, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var h header
+	if err := dec.Decode(&h); err != nil {
+		return 0, fmt.Errorf("dump header: %v", err)
+	}
+	if h.Format != dumpFormat || h.Version != dumpVersion {
+		return 0, fmt.Errorf("not a dump of version %d: %q version %d", dumpVersion, h.Format, h.Version)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	n := 0
+	var ttls [][2][]byte
+	for {
+		var rec record
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("record %d: %v", n+1, err)
+		}
+		key, val, err := rec.keyValue()
+		if err != nil {
+			return 0, fmt.Errorf("record %d: %v", n+1, err)
+		}
+		n++
+		if bytes.HasPrefix(key, []byte(kv.TTLPrefix)) {
+			ttls = append(ttls, [2][]byte{key, val})
+			continue
+		}
+		if err = tx.Set(key, val); err != nil {
+			return 0, fmt.Errorf("record %d: %w", n, err)
+		}
+	}
+	for _, r := range ttls {
+		if err = tx.RestoreTTL(r[0], r[1]); err != nil {
+			return 0, fmt.Errorf("key %q: %w", r[0], err)
+		}
+	}
+	return n, tx.Commit()
+}
@@ -0,0 +1,292 @@
+// Command godb works with database files of package kv.
+//
+// Usage:
+//
+//	godb inspect FILE
+//	godb get FILE KEY
+//	godb set FILE KEY [VALUE]
+//	godb del FILE KEY
+//	godb scan [-prefix P] [-limit N] FILE
+//	godb dump FILE > dump.jsonl
+//	godb restore FILE < dump.jsonl
+//	godb export [-format csv|json] FILE TABLE > rows
+//	godb import [-format csv|json] FILE TABLE < rows
+//	godb import -format sqlite FILE < dump.sql
+//	godb shell FILE
+//	godb bench [flags] [FILE]
+//
+// inspect opens FILE read-only, reading on past damage, prints what it
+// holds and checks it for corruption (see kv.DB.Verify), listing every
+// problem with its page. It exits with status 1 if it finds any.
+//
+// get writes the value of KEY to standard output as it is, and exits with
+// status 1 if there is none. set sets KEY to VALUE, or to what it reads
+// from standard input without one. del deletes KEY. scan prints the
+// key-values, of those starting with P if given, in order.
+//
+// dump writes every key-value of FILE to standard output, and restore sets
+// the key-values of such a dump in FILE, creating it if needed, in one
+// transaction. The format is JSON lines, described in dump.go; scan prints
+// the same lines.
+//
+// export writes the rows of TABLE as CSV, the default, or JSON lines, and
+// import inserts such rows into TABLE, which must exist, in one
+// transaction; with -format sqlite it runs the output of the .dump of the
+// sqlite3 shell instead, creating the tables and indexes and inserting
+// their rows. Package migrate describes the formats.
+//
+// shell runs commands on FILE, creating it if needed, as they are typed:
+// statements of package ql, which end with a semicolon and may take
+// several lines, key-value commands like get and set, and meta commands
+// like .tables and .schema; .help lists them. An ALTER TABLE or CREATE
+// INDEX returns once the rows have been through the change, in
+// transactions of a batch of rows each, and the shell finishes any change
+// left under way when it starts.
+//
+// bench measures a synthetic workload: it loads keys into a new database
+// at FILE, or in a temporary file it removes after, then runs a mix of
+// Gets and write transactions of Sets on them, and prints the throughput
+// and the latency percentiles of each. Its flags set the mix, the sizes of
+// the keys and values, how the keys are picked, and the options of the
+// database; godb bench -h lists them. See dbtest.Workload.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/pager"
+)
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: godb inspect FILE
+       godb get FILE KEY
+       godb set FILE KEY [VALUE]
+       godb del FILE KEY
+       godb scan [-prefix P] [-limit N] FILE
+       godb dump FILE
+       godb restore FILE
+       godb export [-format csv|json] FILE TABLE
+       godb import [-format csv|json] FILE TABLE
+       godb import -format sqlite FILE
+       godb shell FILE
+       godb bench [flags] [FILE]
+`)
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "inspect":
+		if len(args) != 1 {
+			usage()
+		}
+		err = inspect(args[0])
+	case "get":
+		if len(args) != 2 {
+			usage()
+		}
+		err = get(args[0], args[1])
+	case "set":
+		if len(args) != 2 && len(args) != 3 {
+			usage()
+		}
+		err = set(args[0], args[1], args[2:])
+	case "del":
+		if len(args) != 2 {
+			usage()
+		}
+		err = del(args[0], args[1])
+	case "scan":
+		fs := flag.NewFlagSet("scan", flag.ExitOnError)
+		prefix := fs.String("prefix", "", "print only the keys starting with `P`")
+		limit := fs.Int("limit", 0, "print at most `N` key-values; 0 means all")
+		fs.Usage = usage
+		fs.Parse(args)
+		if fs.NArg() != 1 {
+			usage()
+		}
+		err = scan(fs.Arg(0), *prefix, *limit)
+	case "dump":
+		if len(args) != 1 {
+			usage()
+		}
+		err = withDB(args[0], true, func(db *kv.DB) error { return dump(os.Stdout, db) })
+	case "restore":
+		if len(args) != 1 {
+			usage()
+		}
+		err = withDB(args[0], false, func(db *kv.DB) error {
+			n, err := restore(db, os.Stdin)
+			if err == nil {
+				fmt.Fprintf(os.Stderr, "restored %d keys\n", n)
+			}
+			return err
+		})
+	case "export", "import":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		format := fs.String("format", "csv", "format of the rows: csv or json, or sqlite for import")
+		fs.Usage = usage
+		fs.Parse(args)
+		if *format == "sqlite" && cmd == "import" {
+			if fs.NArg() != 1 {
+				usage()
+			}
+			err = importRows(os.Stdin, fs.Arg(0), "", *format)
+			break
+		}
+		if fs.NArg() != 2 {
+			usage()
+		}
+		if cmd == "export" {
+			err = export(os.Stdout, fs.Arg(0), fs.Arg(1), *format)
+		} else {
+			err = importRows(os.Stdin, fs.Arg(0), fs.Arg(1), *format)
+		}
+	case "shell":
+		if len(args) != 1 {
+			usage()
+		}
+		err = runShell(args[0])
+	case "bench":
+		var c benchConfig
+		fs := flag.NewFlagSet("bench", flag.ExitOnError)
+		c.flags(fs)
+		fs.Parse(args)
+		if fs.NArg() > 1 {
+			usage()
+		}
+		err = bench(os.Stdout, fs.Arg(0), c)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "godb:", err)
+		os.Exit(1)
+	}
+}
+
+// withDB calls fn with the database at path, open read-only if readOnly.
+func withDB(path string, readOnly bool, fn func(db *kv.DB) error) error {
+	if readOnly {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+	db, err := kv.Options{ReadOnly: readOnly}.Open(path)
+	if err != nil {
+		return err
+	}
+	err = fn(db)
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func get(path, key string) error {
+	return withDB(path, true, func(db *kv.DB) error {
+		val, err := db.Get([]byte(key))
+		if err != nil {
+			return fmt.Errorf("%q: %w", key, err)
+		}
+		_, err = os.Stdout.Write(val)
+		return err
+	})
+}
+
+func set(path, key string, value []string) error {
+	var val []byte
+	if len(value) == 1 {
+		val = []byte(value[0])
+	} else {
+		var err error
+		if val, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	}
+	return withDB(path, false, func(db *kv.DB) error { return db.Set([]byte(key), val) })
+}
+
+func del(path, key string) error {
+	return withDB(path, false, func(db *kv.DB) error {
+		found, err := db.Del([]byte(key))
+		if err == nil && !found {
+			err = fmt.Errorf("%q: %w", key, kv.ErrKeyNotFound)
+		}
+		return err
+	})
+}
+
+func scan(path, prefix string, limit int) error {
+	return withDB(path, true, func(db *kv.DB) error {
+		lo := []byte(prefix)
+		return writeRecords(os.Stdout, db.Scan, lo, prefixEnd(lo), limit)
+	})
+}
+
+// prefixEnd returns the first key after all the keys starting with prefix,
+// or nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for len(end) > 0 && end[len(end)-1] == 0xff {
+		end = end[:len(end)-1]
+	}
+	if len(end) == 0 {
+		return nil
+	}
+	end[len(end)-1]++
+	return end
+}
+
+func inspect(path string) error {
+	p, err := pager.Options{ContinueOnError: true}.Open(path)
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	stats, err := p.Verify()
+	fmt.Printf("commit     %d\n", stats.Commit)
+	fmt.Printf("page size  %d\n", stats.PageSize)
+	fmt.Printf("pages      %d (%d free, %d holding the free list)\n", stats.Pages, stats.FreePages, stats.ListPages)
+	t := stats.Tree
+	fmt.Printf("tree       %d keys in %d leaves, %d nodes, depth %d\n", max(t.Keys-1, 0), t.Leaves, t.Nodes, t.Depth)
+	if t.Nodes > 0 {
+		fmt.Printf("fill       %.0f%%\n", 100*float64(t.Bytes)/float64(t.Nodes*stats.PageSize))
+	}
+	if t.Overflow > 0 {
+		fmt.Printf("overflow   %d pages\n", t.Overflow)
+	}
+	if err == nil {
+		fmt.Println("ok")
+		return nil
+	}
+	problems := flatten(err)
+	for _, e := range problems {
+		fmt.Println(e)
+	}
+	if len(problems) == 1 {
+		return fmt.Errorf("%s: 1 problem found", path)
+	}
+	return fmt.Errorf("%s: %d problems found", path, len(problems))
+}
+
+// flatten lists the errors joined in err.
+func flatten(err error) []error {
+	j, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var all []error
+	for _, e := range j.Unwrap() {
+		all = append(all, flatten(e)...)
+	}
+	return all
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/pager"
+)
+
+// The tests run the command as the test binary itself, with runMain set
+// in its environment.
+const runMain = "GODB_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMain) != "" {
+		os.Args = append([]string{"godb"}, os.Args[1:]...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// godb runs godb with args and stdin, and returns its output and exit
+// status. Its home directory, for the history of the shell, is a new one.
+func godb(t *testing.T, stdin string, args ...string) (stdout, stderr string, status int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMain+"=1", "HOME="+t.TempDir())
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		status = ee.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return out.String(), errOut.String(), status
+}
+
+// mustGodb is godb, failing the test if it does not exit with status 0.
+func mustGodb(t *testing.T, stdin string, args ...string) string {
+	t.Helper()
+	out, errOut, status := godb(t, stdin, args...)
+	if status != 0 {
+		t.Fatalf("godb %s: status %d: %s", strings.Join(args, " "), status, errOut)
+	}
+	return out
+}
+
+func TestGetSetDel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	mustGodb(t, "", "set", path, "k", "v")
+	mustGodb(t, "from\x00stdin\n", "set", path, "bin")
+	if out := mustGodb(t, "", "get", path, "k"); out != "v" {
+		t.Errorf("get k = %q, want %q", out, "v")
+	}
+	if out := mustGodb(t, "", "get", path, "bin"); out != "from\x00stdin\n" {
+		t.Errorf("get bin = %q, want what set read", out)
+	}
+	mustGodb(t, "", "del", path, "k")
+	if _, errOut, status := godb(t, "", "get", path, "k"); status != 1 || !strings.Contains(errOut, "not found") {
+		t.Errorf("get of a deleted key: status %d, %q", status, errOut)
+	}
+	if _, _, status := godb(t, "", "del", path, "k"); status != 1 {
+		t.Errorf("del of a missing key: status %d, want 1", status)
+	}
+	if _, _, status := godb(t, "", "get", filepath.Join(t.TempDir(), "none"), "k"); status != 1 {
+		t.Errorf("get in a missing file: status %d, want 1", status)
+	}
+	if _, _, status := godb(t, "", "get", path); status != 2 {
+		t.Errorf("get without a key: status %d, want 2", status)
+	}
+	if _, _, status := godb(t, "", "frob"); status != 2 {
+		t.Errorf("an unknown command: status %d, want 2", status)
+	}
+}
+
+// fill sets the key-values of kvs, key then value, in a new database and
+// returns its path.
+func fill(t *testing.T, kvs ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < len(kvs); i += 2 {
+		if err = db.Set([]byte(kvs[i]), []byte(kvs[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func TestScan(t *testing.T) {
+	path := fill(t, "a/1", "x", "a/2", "y", "b/1", "z", "a", "w")
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, `{"key":"a","value":"w"}` + "\n" + `{"key":"a/1","value":"x"}` + "\n" + `{"key":"a/2","value":"y"}` + "\n" + `{"key":"b/1","value":"z"}` + "\n"},
+		{[]string{"-prefix", "a/"}, `{"key":"a/1","value":"x"}` + "\n" + `{"key":"a/2","value":"y"}` + "\n"},
+		{[]string{"-prefix", "a", "-limit", "2"}, `{"key":"a","value":"w"}` + "\n" + `{"key":"a/1","value":"x"}` + "\n"},
+		{[]string{"-prefix", "c"}, ""},
+	} {
+		args := append(append([]string{"scan"}, tc.args...), path)
+		if out := mustGodb(t, "", args...); out != tc.want {
+			t.Errorf("godb %s =\n%s\nwant\n%s", strings.Join(args, " "), out, tc.want)
+		}
+	}
+}
+
+func TestDumpRestore(t *testing.T) {
+	path := fill(t, "text", "<html> & \"quotes\"", "\x00bin\xff", "value", "k", "\xfe\xff", "empty", "")
+	out := mustGodb(t, "", "dump", path)
+	want := `{"format":"godb-dump","version":1}
+{"key64":"AGJpbv8=","value":"value"}
+{"key":"empty","value":""}
+{"key":"k","value64":"/v8="}
+{"key":"text","value":"<html> & \"quotes\""}
+`
+	if out != want {
+		t.Errorf("dump =\n%s\nwant\n%s", out, want)
+	}
+
+	copyPath := filepath.Join(t.TempDir(), "copy")
+	if _, errOut, status := godb(t, out, "restore", copyPath); status != 0 || errOut != "restored 4 keys\n" {
+		t.Fatalf("restore: status %d, %q", status, errOut)
+	}
+	if again := mustGodb(t, "", "dump", copyPath); again != out {
+		t.Errorf("dump of the restored database =\n%s\nwant\n%s", again, out)
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	const header = `{"format":"godb-dump","version":1}` + "\n"
+	for _, dump := range []string{
+		"",
+		`{"format":"godb-dump","version":2}` + "\n",
+		`{"format":"other","version":1}` + "\n",
+		header + `{"key":"a","value":"1"}` + "\n" + `{"key":"b"}` + "\n",
+		header + `{"key":"a","value":"1"}` + "\n" + `{"key":"b","key64":"Yg==","value":"2"}` + "\n",
+		header + `{"key":"a","value":"1"}` + "\n" + `{"key":"b","value64":"!!"}` + "\n",
+		header + `{"key":"a","value":"1"}` + "\n" + `{"key":"","value":"2"}` + "\n",
+		header + `{"key":"a","value":"1"}` + "\n" + `not json`,
+	} {
+		path := fill(t, "kept", "yes")
+		if _, _, status := godb(t, dump, "restore", path); status != 1 {
+			t.Errorf("restore of %q: status %d, want 1", dump, status)
+		}
+		// Nothing of a failed restore is set.
+		if out, _, status := godb(t, "", "get", path, "a"); status != 1 {
+			t.Errorf("restore of %q failed but set a to %q", dump, out)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Options{PageSize: 512}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 500 {
+		if err = db.Set(fmt.Appendf(nil, "key%03d", i), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+	out := mustGodb(t, "", "inspect", path)
+	for _, want := range []string{"page size  512\n", "tree       500 keys in ", "\nok\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("inspect output lacks %q:\n%s", want, out)
+		}
+	}
+
+	// Flip a bit in the last leaf.
+	p, err := pager.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last uint64
+	if _, err = p.Tree().Check(func(ptr uint64) error { last = ptr; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[int(last)*512+300] ^= 0x10
+	if err = os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, errOut, status := godb(t, "", "inspect", path)
+	if status != 1 || !strings.Contains(errOut, "1 problem found") {
+		t.Errorf("inspect of a damaged file: status %d, %q", status, errOut)
+	}
+	if !strings.Contains(out, fmt.Sprintf("page %d", last)) {
+		t.Errorf("inspect of a damaged file does not name page %d:\n%s", last, out)
+	}
+}
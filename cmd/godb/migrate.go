@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/migrate"
+	"github.com/adcondev/go-database/table"
+)
+
+// export writes the rows of the table name of the database at path to w,
+// in format: csv or json.
+func export(w io.Writer, path, name, format string) error {
+	write := migrate.ExportCSV
+	switch format {
+	case "csv":
+	case "json":
+		write = migrate.ExportJSON
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+	return withDB(path, true, func(db *kv.DB) error {
+		tx, err := db.BeginRead()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		t, err := table.Open(tx, name)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(w)
+		if err = write(bw, tx, t); err != nil {
+			return err
+		}
+		return bw.Flush()
+	})
+}
+
+// importRows imports r into the database at path, in one transaction: the
+// rows of the table name in format csv or json, or the SQLite dump r with
+// format sqlite, without a name.
+func importRows(r io.Reader, path, name, format string) error {
+	var read func(tx *kv.Tx, t *table.Table, r io.Reader) (int, error)
+	switch format {
+	case "csv":
+		read = migrate.ImportCSV
+	case "json":
+		read = migrate.ImportJSON
+	case "sqlite":
+	default:
+		return fmt.Errorf("unknown import format %q", format)
+	}
+	return withDB(path, false, func(db *kv.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if read == nil {
+			res, err := migrate.ImportSQLite(tx, r)
+			if err != nil {
+				return err
+			}
+			for _, s := range res.Skipped {
+				fmt.Fprintf(os.Stderr, "skipped %s\n", s)
+			}
+			fmt.Fprintf(os.Stderr, "imported %d tables, %d rows\n", len(res.Tables), res.Rows)
+			return tx.Commit()
+		}
+		t, err := table.Open(tx, name)
+		if err != nil {
+			return err
+		}
+		n, err := read(tx, t, r)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "imported %d rows\n", n)
+		return tx.Commit()
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "db")
+	mustGodb(t, "CREATE TABLE t (id INT PRIMARY KEY, name TEXT, data BLOB);\n"+
+		"INSERT INTO t VALUES (1, 'a, b', x'00ff'), (2, 'c', x'');\n", "shell", src)
+	csv := mustGodb(t, "", "export", src, "t")
+	if want := "id,name,data\n1,\"a, b\",AP8=\n2,c,\n"; csv != want {
+		t.Errorf("export as CSV:\n%s\nwant\n%s", csv, want)
+	}
+	json := mustGodb(t, "", "export", "-format", "json", src, "t")
+	if want := `{"id":1,"name":"a, b","data":"AP8="}` + "\n" + `{"id":2,"name":"c","data":""}` + "\n"; json != want {
+		t.Errorf("export as JSON:\n%s\nwant\n%s", json, want)
+	}
+
+	for format, rows := range map[string]string{"csv": csv, "json": json} {
+		dst := filepath.Join(t.TempDir(), "db")
+		mustGodb(t, "CREATE TABLE t (id INT PRIMARY KEY, name TEXT, data BLOB);\n", "shell", dst)
+		_, errOut, status := godb(t, rows, "import", "-format", format, dst, "t")
+		if status != 0 || errOut != "imported 2 rows\n" {
+			t.Errorf("import as %s: status %d, %q", format, status, errOut)
+		}
+		if got := mustGodb(t, "", "export", "-format", format, dst, "t"); got != rows {
+			t.Errorf("export after import as %s:\n%s\nwant\n%s", format, got, rows)
+		}
+		// An import that fails part way sets nothing.
+		if _, _, status = godb(t, "id,name,data\n3,d,\n1,again,\n", "import", dst, "t"); status != 1 {
+			t.Errorf("import of a row already there: status %d", status)
+		}
+		if got := mustGodb(t, "", "export", "-format", format, dst, "t"); got != rows {
+			t.Errorf("the failed import left\n%s", got)
+		}
+	}
+}
+
+func TestImportSQLiteDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	dump := "BEGIN TRANSACTION;\n" +
+		"CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT);\n" +
+		"INSERT INTO t VALUES(1,'a');\n" +
+		"CREATE VIEW v AS SELECT * FROM t;\n" +
+		"COMMIT;\n"
+	_, errOut, status := godb(t, dump, "import", "-format", "sqlite", path)
+	if status != 0 || errOut != "skipped CREATE VIEW v\nimported 1 tables, 1 rows\n" {
+		t.Errorf("import of a SQLite dump: status %d, %q", status, errOut)
+	}
+	if got := mustGodb(t, "", "export", path, "t"); got != "id,name\n1,a\n" {
+		t.Errorf("export of the imported table:\n%s", got)
+	}
+}
+
+func TestExportImportErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	mustGodb(t, "CREATE TABLE t (id INT PRIMARY KEY);\n", "shell", path)
+	for name, args := range map[string][]string{
+		"export of an unknown format": {"export", "-format", "xml", path, "t"},
+		"import of an unknown format": {"import", "-format", "xml", path, "t"},
+		"export of no table":          {"export", path, "none"},
+		"import into no table":        {"import", path, "none"},
+		"import of bad CSV":           {"import", path, "t"},
+	} {
+		if _, errOut, status := godb(t, "nope\n1\n", args...); status != 1 || errOut == "" {
+			t.Errorf("%s: status %d, %q", name, status, errOut)
+		}
+	}
+	if _, _, status := godb(t, "", "export", path); status != 2 {
+		t.Errorf("export without a table: status %d, want 2", status)
+	}
+	if _, errOut, status := godb(t, "", "export", filepath.Join(t.TempDir(), "none"), "t"); status != 1 || !strings.Contains(errOut, "none") {
+		t.Errorf("export of a missing file: status %d, %q", status, errOut)
+	}
+}
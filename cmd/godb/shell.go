@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/pager"
+	"github.com/adcondev/go-database/ql"
+	"github.com/adcondev/go-database/table"
+)
+
+const shellHelp = `Statements of package ql end with a semicolon and may span lines:
+  CREATE TABLE, DROP TABLE, INSERT, SELECT, UPDATE, DELETE,
+  ALTER TABLE, CREATE INDEX, DROP INDEX
+  BEGIN; COMMIT; ROLLBACK;    group statements in one transaction
+  SAVEPOINT S; ROLLBACK TO S; RELEASE S;
+                              undo part of the transaction, or keep it
+Key-value commands take one line:
+  get KEY                     print the value of KEY
+  set KEY VALUE               set KEY to VALUE
+  del KEY                     delete KEY
+  scan [PREFIX]               print the key-values starting with PREFIX
+Meta commands:
+  .tables                     list the tables
+  .schema [TABLE]             print the schema of TABLE, or of every table
+  .stats                      print the size of the database
+  .history                    list the commands entered
+  .help                       print this
+  .quit                       leave
+`
+
+// shell is an interactive shell on a database. It keeps the commands
+// entered in ~/.godb_history, across runs.
+type shell struct {
+	path    string
+	db      *kv.DB
+	tx      *kv.Tx // the transaction of BEGIN, or nil
+	out     io.Writer
+	history []string
+	histf   *os.File // nil if the history file cannot be written
+}
+
+// runShell runs a shell on the database at path, on the standard input
+// and output. It prompts only if the input is a terminal.
+func runShell(path string) error {
+	db, err := kv.Open(path)
+	if err != nil {
+		return err
+	}
+	sh := &shell{path: path, db: db, out: os.Stdout}
+	sh.openHistory()
+	// A schema change is left under way by a crash, or a shell that was
+	// stopped during it.
+	sh.report(table.CompleteAll(db))
+	prompt := false
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		prompt = true
+		fmt.Fprintf(sh.out, "godb shell on %s; .help for help\n", path)
+	}
+	err = sh.run(os.Stdin, prompt)
+	if sh.tx != nil {
+		sh.tx.Rollback()
+	}
+	if sh.histf != nil {
+		sh.histf.Close()
+	}
+	if cerr := db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (sh *shell) openHistory() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	name := filepath.Join(home, ".godb_history")
+	if data, err := os.ReadFile(name); err == nil {
+		for line := range strings.Lines(string(data)) {
+			// A command of several lines is kept on one, with its
+			// newlines escaped.
+			line = strings.TrimSuffix(line, "\n")
+			sh.history = append(sh.history, strings.ReplaceAll(line, `\n`, "\n"))
+		}
+	}
+	sh.histf, _ = os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+}
+
+func (sh *shell) remember(cmd string) {
+	sh.history = append(sh.history, cmd)
+	if sh.histf != nil {
+		fmt.Fprintln(sh.histf, strings.ReplaceAll(cmd, "\n", `\n`))
+	}
+}
+
+// run reads and runs commands until the end of in or .quit. A failed
+// command prints its error and the shell goes on.
+func (sh *shell) run(in io.Reader, prompt bool) error {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(nil, 1<<20)
+	var stmt strings.Builder // the lines of a statement not ended yet
+	for {
+		if prompt {
+			if stmt.Len() == 0 {
+				fmt.Fprint(sh.out, "godb> ")
+			} else {
+				fmt.Fprint(sh.out, "  ...> ")
+			}
+		}
+		if !sc.Scan() {
+			if stmt.Len() > 0 {
+				return fmt.Errorf("statement without a semicolon at the end of the input")
+			}
+			return sc.Err()
+		}
+		line := sc.Text()
+		if stmt.Len() == 0 {
+			cmd := strings.TrimSpace(line)
+			if cmd == "" {
+				continue
+			}
+			if word, _, _ := strings.Cut(cmd, " "); strings.HasPrefix(cmd, ".") || kvCommands[word] {
+				sh.remember(cmd)
+				if cmd == ".quit" || cmd == ".exit" {
+					return nil
+				}
+				sh.report(sh.command(cmd))
+				continue
+			}
+		} else {
+			stmt.WriteByte('\n')
+		}
+		stmt.WriteString(line)
+		if !strings.HasSuffix(strings.TrimSpace(line), ";") {
+			continue
+		}
+		cmd := strings.TrimSpace(stmt.String())
+		stmt.Reset()
+		sh.remember(cmd)
+		sh.report(sh.statement(cmd))
+	}
+}
+
+func (sh *shell) report(err error) {
+	if err != nil {
+		fmt.Fprintln(sh.out, "error:", err)
+	}
+}
+
+var kvCommands = map[string]bool{"get": true, "set": true, "del": true, "scan": true}
+
+// command runs a key-value or meta command.
+func (sh *shell) command(cmd string) error {
+	word, rest, _ := strings.Cut(cmd, " ")
+	rest = strings.TrimSpace(rest)
+	switch word {
+	case "get":
+		return sh.view(func(tx *kv.Tx) error {
+			val, err := tx.Get([]byte(rest))
+			if err == nil {
+				fmt.Fprintf(sh.out, "%q\n", val)
+			}
+			return err
+		})
+	case "set":
+		key, val, ok := strings.Cut(rest, " ")
+		if !ok {
+			return errors.New("usage: set KEY VALUE")
+		}
+		return sh.update(func(tx *kv.Tx) error {
+			return tx.Set([]byte(key), []byte(strings.TrimSpace(val)))
+		})
+	case "del":
+		return sh.update(func(tx *kv.Tx) error {
+			found, err := tx.Del([]byte(rest))
+			if err == nil && !found {
+				err = kv.ErrKeyNotFound
+			}
+			return err
+		})
+	case "scan":
+		return sh.view(func(tx *kv.Tx) error {
+			lo := []byte(rest)
+			return writeRecords(sh.out, tx.Scan, lo, prefixEnd(lo), 0)
+		})
+	case ".tables":
+		return sh.view(func(tx *kv.Tx) error {
+			names, err := table.Tables(tx)
+			for _, name := range names {
+				fmt.Fprintln(sh.out, name)
+			}
+			return err
+		})
+	case ".schema":
+		return sh.view(func(tx *kv.Tx) error { return sh.schema(tx, rest) })
+	case ".stats":
+		return sh.stats()
+	case ".history":
+		for i, h := range sh.history {
+			fmt.Fprintf(sh.out, "%5d  %s\n", i+1, strings.ReplaceAll(h, "\n", "\n       "))
+		}
+	case ".help":
+		fmt.Fprint(sh.out, shellHelp)
+	default:
+		return fmt.Errorf("unknown command %s; .help for help", word)
+	}
+	return nil
+}
+
+// view calls fn in the open transaction, or a read transaction.
+func (sh *shell) view(fn func(tx *kv.Tx) error) error {
+	if sh.tx != nil {
+		return fn(sh.tx)
+	}
+	tx, err := sh.db.BeginRead()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// update calls fn in the open transaction, or a write transaction that
+// commits if fn succeeds.
+func (sh *shell) update(fn func(tx *kv.Tx) error) error {
+	if sh.tx != nil {
+		return fn(sh.tx)
+	}
+	tx, err := sh.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// schema prints the table called name, or every table, as CREATE TABLE
+// statements.
+func (sh *shell) schema(tx *kv.Tx, name string) error {
+	names := []string{name}
+	if name == "" {
+		var err error
+		if names, err = table.Tables(tx); err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		t, err := table.Open(tx, name)
+		if err != nil {
+			return err
+		}
+		var lines []string
+		for _, c := range t.Columns {
+			lines = append(lines, fmt.Sprintf("%s %s", c.Name, sqlTypes[c.Type]))
+		}
+		lines = append(lines, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(t.PrimaryKey, ", ")))
+		for _, x := range t.Indexes {
+			unique := ""
+			if x.Unique {
+				unique = "UNIQUE "
+			}
+			lines = append(lines, fmt.Sprintf("%sINDEX %s (%s)", unique, x.Name, strings.Join(x.Columns, ", ")))
+		}
+		fmt.Fprintf(sh.out, "CREATE TABLE %s (\n\t%s\n);\n", t.Name, strings.Join(lines, ",\n\t"))
+		if c := t.SchemaChange(); c != "" {
+			fmt.Fprintf(sh.out, "-- under way: %s\n", c)
+		}
+	}
+	return nil
+}
+
+var sqlTypes = map[table.Type]string{table.Int: "INT", table.String: "TEXT", table.Bytes: "BLOB"}
+
+func (sh *shell) stats() error {
+	file := "in memory"
+	if sh.path != pager.Memory {
+		fi, err := os.Stat(sh.path)
+		if err != nil {
+			return err
+		}
+		file = fmt.Sprintf("%s, %d bytes", sh.path, fi.Size())
+	}
+	keys := 0
+	err := sh.view(func(tx *kv.Tx) error {
+		return tx.Scan(nil, nil, func(key, val []byte) bool {
+			keys++
+			return true
+		})
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sh.out, "file    %s\n", file)
+	fmt.Fprintf(sh.out, "commit  %d\n", sh.db.LastCommit())
+	fmt.Fprintf(sh.out, "keys    %d\n", keys)
+	st := sh.db.Stats()
+	fmt.Fprintf(sh.out, "pages   %d, %d free, %d dirty\n", st.Pages, st.FreePages, st.Dirty)
+	fmt.Fprintf(sh.out, "depth   %d\n", st.Depth)
+	fmt.Fprintf(sh.out, "io      %d pages read, %d written, %d syncs\n", st.Reads, st.Writes, st.Syncs)
+	if c := st.Cache; c.Mapped {
+		fmt.Fprintln(sh.out, "cache   memory-mapped")
+	} else {
+		fmt.Fprintf(sh.out, "cache   %d of %d pages, %d hits, %d misses (%.0f%% hits), %d evictions\n",
+			c.Pages, c.Capacity, c.Hits, c.Misses, 100*c.HitRate(), c.Evictions)
+	}
+	if h := st.CommitLatency; h.Count > 0 {
+		fmt.Fprintf(sh.out, "commits %d, %v each on average\n", h.Count, h.Sum/time.Duration(h.Count))
+	}
+	return nil
+}
+
+// statement runs a statement of package ql, or BEGIN, COMMIT or ROLLBACK.
+func (sh *shell) statement(cmd string) error {
+	word := strings.ToUpper(strings.TrimSpace(strings.TrimSuffix(cmd, ";")))
+	switch word {
+	case "BEGIN":
+		if sh.tx != nil {
+			return errors.New("a transaction is open already")
+		}
+		tx, err := sh.db.Begin()
+		sh.tx = tx
+		return err
+	case "COMMIT", "ROLLBACK":
+		if sh.tx == nil {
+			return errors.New("no transaction is open")
+		}
+		tx := sh.tx
+		sh.tx = nil
+		if word == "COMMIT" {
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			return table.CompleteAll(sh.db)
+		}
+		return tx.Rollback()
+	}
+	s, err := ql.Parse(cmd)
+	if err != nil {
+		return err
+	}
+	var res *ql.Result
+	run := func(tx *kv.Tx) error {
+		res, err = s.Exec(tx)
+		return err
+	}
+	if s.ReadOnly() {
+		err = sh.view(run)
+	} else {
+		err = sh.update(run)
+	}
+	if err != nil {
+		return err
+	}
+	if s.SchemaChange() != "" && sh.tx == nil {
+		// The rows go through the change in transactions of their own.
+		if err = table.Complete(sh.db, s.SchemaChange()); err != nil {
+			return err
+		}
+	}
+	if !s.ReadOnly() {
+		fmt.Fprintf(sh.out, "%d rows affected\n", res.RowsAffected)
+		return nil
+	}
+	tw := tabwriter.NewWriter(sh.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(res.Columns, "\t"))
+	for _, row := range res.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			if b, ok := v.([]byte); ok {
+				cells[i] = fmt.Sprintf("x'%x'", b)
+			} else {
+				cells[i] = fmt.Sprint(v)
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	fmt.Fprintf(tw, "(%d rows)\n", len(res.Rows))
+	return tw.Flush()
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/ql"
+)
+
+// runScript runs the shell on a new database with script as its input,
+// and returns what it printed.
+func runScript(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var out bytes.Buffer
+	sh := &shell{path: path, db: db, out: &out}
+	if err = sh.run(strings.NewReader(script), false); err != nil {
+		t.Fatal(err)
+	}
+	if sh.tx != nil {
+		sh.tx.Rollback()
+	}
+	return out.String()
+}
+
+func TestShellStatements(t *testing.T) {
+	out := runScript(t, `
+CREATE TABLE people (
+	id INT PRIMARY KEY,
+	name TEXT,
+	photo BLOB,
+	INDEX by_name (name)
+);
+INSERT INTO people VALUES (1, 'Ann', x'00ff'),
+	(2, 'Bob', x'');
+SELECT * FROM people WHERE
+	id > 0;
+.tables
+.schema people
+SELECT nope FROM people;
+SELECT * FROM people; DELETE FROM people;
+`)
+	want := `0 rows affected
+2 rows affected
+id  name  photo
+1   Ann   x'00ff'
+2   Bob   x''
+(2 rows)
+people
+CREATE TABLE people (
+	id INT,
+	name TEXT,
+	photo BLOB,
+	PRIMARY KEY (id),
+	INDEX by_name (name)
+);
+error: ql: no such column "nope" in people
+error: ql: syntax error at offset 22: unexpected "DELETE" after the statement
+`
+	// The last line of the script is one statement to the shell and two
+	// to ql, which refuses it.
+	if out != want {
+		t.Errorf("output\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestShellTransaction(t *testing.T) {
+	out := runScript(t, `set a 1
+BEGIN;
+set a 2
+set b two words
+get a
+ROLLBACK;
+get a
+get b
+BEGIN;
+del a
+COMMIT;
+get a
+COMMIT;
+`)
+	want := `"2"
+"1"
+error: kv: key not found
+error: kv: key not found
+error: no transaction is open
+`
+	if out != want {
+		t.Errorf("output\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestShellCommands(t *testing.T) {
+	out := runScript(t, `set k/1 one
+set k/2 two
+set l x
+scan k/
+.frob
+set lonely
+.history
+.quit
+get k/1
+`)
+	want := `{"key":"k/1","value":"one"}
+{"key":"k/2","value":"two"}
+error: unknown command .frob; .help for help
+error: usage: set KEY VALUE
+    1  set k/1 one
+    2  set k/2 two
+    3  set l x
+    4  scan k/
+    5  .frob
+    6  set lonely
+    7  .history
+`
+	if out != want {
+		t.Errorf("output\n%s\nwant\n%s", out, want)
+	}
+	if out = runScript(t, ".help\n"); out != shellHelp {
+		t.Errorf(".help printed\n%s", out)
+	}
+	if out = runScript(t, ".stats\n"); !strings.Contains(out, "keys    0\n") {
+		t.Errorf(".stats printed\n%s", out)
+	}
+}
+
+func TestShellUnterminated(t *testing.T) {
+	db, err := kv.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	sh := &shell{db: db, out: &bytes.Buffer{}}
+	if err = sh.run(strings.NewReader("SELECT * FROM\n"), false); err == nil {
+		t.Error("a statement without its semicolon at the end went unremarked")
+	}
+}
+
+func TestShellHistory(t *testing.T) {
+	home, path := t.TempDir(), filepath.Join(t.TempDir(), "db")
+	shell := func(script string) string {
+		cmd := exec.Command(os.Args[0], "shell", path)
+		cmd.Env = append(os.Environ(), runMain+"=1", "HOME="+home)
+		cmd.Stdin = strings.NewReader(script)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	shell("set a 1\nCREATE TABLE t (\n\tk INT PRIMARY KEY\n);\n")
+	out := shell(".history\n")
+	want := "    1  set a 1\n    2  CREATE TABLE t (\n       \tk INT PRIMARY KEY\n       );\n    3  .history\n"
+	if out != want {
+		t.Errorf("history of the second run\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestShellSchemaChange(t *testing.T) {
+	out := runScript(t, `CREATE TABLE t (k INT PRIMARY KEY);
+INSERT INTO t VALUES (1), (2);
+ALTER TABLE t ADD v TEXT DEFAULT 'x';
+BEGIN;
+CREATE INDEX by_v ON t (v);
+.schema t
+COMMIT;
+.schema t
+SELECT * FROM t WHERE v = 'x';
+`)
+	want := `0 rows affected
+2 rows affected
+0 rows affected
+0 rows affected
+CREATE TABLE t (
+	k INT,
+	v TEXT,
+	PRIMARY KEY (k)
+);
+-- under way: create index by_v
+CREATE TABLE t (
+	k INT,
+	v TEXT,
+	PRIMARY KEY (k),
+	INDEX by_v (v)
+);
+k  v
+1  x
+2  x
+(2 rows)
+`
+	if out != want {
+		t.Errorf("output\n%s\nwant\n%s", out, want)
+	}
+
+	// A change left under way is done when the shell starts.
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ql.Exec(tx, "CREATE TABLE t (k INT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ql.Exec(tx, "ALTER TABLE t ADD v INT DEFAULT 7"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if out := mustGodb(t, ".schema t\n", "shell", path); strings.Contains(out, "under way") {
+		t.Errorf("the shell left the change under way:\n%s", out)
+	}
+}
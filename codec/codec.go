@@ -0,0 +1,214 @@
+// Package codec encodes tuples of values as byte strings that sort as the
+// tuples do, for composite keys: comparing two encodings with bytes.Compare
+// compares the tuples, value by value. No encoded value is a prefix of the
+// encoding of a different value, so a tuple's encoding is a prefix of
+// another's only when the tuple is a prefix of the other: the keys
+// starting with the encoding of some values are exactly the tuples that
+// start with those values, and a prefix scan finds them.
+//
+// A value is nil (NULL), a bool, an int64 (or int), a uint64, a float64, a
+// string or a []byte. Each encodes as a tag byte giving its type, then
+//
+//   - NULL, false and true as no more bytes: their tags order them;
+//   - an int64 as 8 bytes big-endian with the sign bit flipped, so that
+//     negative numbers come first;
+//   - a uint64 as 8 bytes big-endian;
+//   - a float64 as its 8 IEEE 754 bytes big-endian, with the sign bit
+//     flipped if it is clear and every bit flipped if it is set, so that
+//     -Inf comes first, then -0 before 0, +Inf, and math.NaN() last;
+//   - bytes and strings as their bytes with every 0x00 written 0x00 0xff,
+//     then 0x00 0x01 to end them.
+//
+// Values of different types sort by type, in the order above.
+//
+// A value wrapped with Desc encodes with every byte flipped, so it sorts
+// the other way round, with its type too. Decoding tells the two apart.
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrType    = errors.New("codec: value of an unsupported type")
+	ErrCorrupt = errors.New("codec: invalid encoding")
+)
+
+// The tags of the types. Package table keeps its keys in this encoding,
+// so they do not change.
+const (
+	tagNull   = 0x05
+	tagFalse  = 0x06
+	tagTrue   = 0x07
+	tagInt    = 0x10
+	tagUint   = 0x11
+	tagFloat  = 0x12
+	tagBytes  = 0x20
+	tagString = 0x21
+)
+
+type desc struct{ v any }
+
+// Desc returns v to encode in descending order. Only Append and Encode
+// take it.
+func Desc(v any) any { return desc{v} }
+
+// Append appends the encoding of the tuple vals to b.
+func Append(b []byte, vals ...any) ([]byte, error) {
+	for _, v := range vals {
+		var flip byte
+		if d, ok := v.(desc); ok {
+			v, flip = d.v, 0xff
+		}
+		start := len(b)
+		switch v := v.(type) {
+		case nil:
+			b = append(b, tagNull)
+		case bool:
+			if v {
+				b = append(b, tagTrue)
+			} else {
+				b = append(b, tagFalse)
+			}
+		case int:
+			b = binary.BigEndian.AppendUint64(append(b, tagInt), uint64(v)^1<<63)
+		case int64:
+			b = binary.BigEndian.AppendUint64(append(b, tagInt), uint64(v)^1<<63)
+		case uint64:
+			b = binary.BigEndian.AppendUint64(append(b, tagUint), v)
+		case float64:
+			bits := math.Float64bits(v)
+			if bits&(1<<63) != 0 {
+				bits = ^bits
+			} else {
+				bits ^= 1 << 63
+			}
+			b = binary.BigEndian.AppendUint64(append(b, tagFloat), bits)
+		case []byte:
+			b = appendEscaped(append(b, tagBytes), v)
+		case string:
+			b = appendEscaped(append(b, tagString), []byte(v))
+		default:
+			return nil, fmt.Errorf("%w: %T", ErrType, v)
+		}
+		if flip != 0 {
+			for i := start; i < len(b); i++ {
+				b[i] ^= flip
+			}
+		}
+	}
+	return b, nil
+}
+
+func appendEscaped(b, s []byte) []byte {
+	for {
+		i := bytes.IndexByte(s, 0)
+		if i < 0 {
+			break
+		}
+		b = append(append(b, s[:i]...), 0x00, 0xff)
+		s = s[i+1:]
+	}
+	return append(append(b, s...), 0x00, 0x01)
+}
+
+// Encode returns the encoding of the tuple vals.
+func Encode(vals ...any) ([]byte, error) { return Append(nil, vals...) }
+
+// Decode returns the tuple that b encodes, with plain values for those
+// encoded with Desc. An int comes back as an int64.
+func Decode(b []byte) ([]any, error) {
+	var vals []any
+	for len(b) > 0 {
+		v, rest, err := Next(b)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+		b = rest
+	}
+	return vals, nil
+}
+
+// Next decodes the first value of the tuple b encodes, and returns it and
+// the rest of b. For a key made of an encoded tuple after some prefix,
+// Next reads the values one by one.
+func Next(b []byte) (v any, rest []byte, err error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("%w: no value", ErrCorrupt)
+	}
+	var flip byte
+	if b[0] > tagString {
+		flip = 0xff
+	}
+	fixed := func() (uint64, error) {
+		if len(b) < 9 {
+			return 0, fmt.Errorf("%w: short number", ErrCorrupt)
+		}
+		var n [8]byte
+		for i := range n {
+			n[i] = b[1+i] ^ flip
+		}
+		rest = b[9:]
+		return binary.BigEndian.Uint64(n[:]), nil
+	}
+	switch tag := b[0] ^ flip; tag {
+	case tagNull:
+		return nil, b[1:], nil
+	case tagFalse, tagTrue:
+		return tag == tagTrue, b[1:], nil
+	case tagInt:
+		n, err := fixed()
+		return int64(n ^ 1<<63), rest, err
+	case tagUint:
+		n, err := fixed()
+		return n, rest, err
+	case tagFloat:
+		bits, err := fixed()
+		if bits&(1<<63) != 0 {
+			bits ^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		return math.Float64frombits(bits), rest, err
+	case tagBytes, tagString:
+		s, rest, err := readEscaped(b[1:], flip)
+		if err != nil {
+			return nil, nil, err
+		}
+		if tag == tagString {
+			return string(s), rest, nil
+		}
+		return s, rest, nil
+	}
+	return nil, nil, fmt.Errorf("%w: tag %#x", ErrCorrupt, b[0])
+}
+
+// readEscaped reads escaped bytes, with every byte flipped by flip, off
+// the start of b. It never returns nil bytes.
+func readEscaped(b []byte, flip byte) ([]byte, []byte, error) {
+	s := []byte{}
+	for {
+		i := bytes.IndexByte(b, flip)
+		if i < 0 || i+1 == len(b) {
+			return nil, nil, fmt.Errorf("%w: unterminated bytes", ErrCorrupt)
+		}
+		for _, c := range b[:i] {
+			s = append(s, c^flip)
+		}
+		esc := b[i+1] ^ flip
+		b = b[i+2:]
+		switch esc {
+		case 0x01:
+			return s, b, nil
+		case 0xff:
+			s = append(s, 0)
+		default:
+			return nil, nil, fmt.Errorf("%w: bad escape %#x", ErrCorrupt, esc)
+		}
+	}
+}
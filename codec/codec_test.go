@@ -0,0 +1,181 @@
+package codec_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+
+	"github.com/adcondev/go-database/codec"
+)
+
+// ordered are values in the order their encodings sort in.
+var ordered = []any{
+	nil,
+	false, true,
+	int64(math.MinInt64), int64(-256), int64(-1), int64(0), int64(1), int64(255), int64(256), int64(math.MaxInt64),
+	uint64(0), uint64(1), uint64(1 << 63), uint64(math.MaxUint64),
+	math.Inf(-1), -math.MaxFloat64, -1.5, -math.SmallestNonzeroFloat64, math.Copysign(0, -1), 0.0,
+	math.SmallestNonzeroFloat64, 1.5, math.MaxFloat64, math.Inf(1), math.NaN(),
+	[]byte{}, []byte{0}, []byte{0, 0}, []byte{0, 1}, []byte{0, 0xff}, []byte{1}, []byte("a"), []byte{0xff}, []byte{0xff, 0},
+	"", "\x00", "\x00\x00", "\x00\xff", "A", "a", "a\x00", "a\x00b", "ab", "b", "\xff",
+}
+
+func mustEncode(tb testing.TB, vals ...any) []byte {
+	tb.Helper()
+	b, err := codec.Encode(vals...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+// same reports whether a and b are the same value, NaN being itself.
+func same(a, b any) bool {
+	if fa, ok := a.(float64); ok {
+		fb, ok := b.(float64)
+		if !ok {
+			return false
+		}
+		return math.Float64bits(fa) == math.Float64bits(fb) || math.IsNaN(fa) && math.IsNaN(fb)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func TestOrder(t *testing.T) {
+	for i := range ordered {
+		for j := range ordered {
+			a, b := mustEncode(t, ordered[i]), mustEncode(t, ordered[j])
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := bytes.Compare(a, b); got != want {
+				t.Errorf("Compare(%#v, %#v) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+			// Desc turns it round.
+			da, db := mustEncode(t, codec.Desc(ordered[i])), mustEncode(t, codec.Desc(ordered[j]))
+			if got := bytes.Compare(da, db); got != -want {
+				t.Errorf("Compare(Desc(%#v), Desc(%#v)) = %d, want %d", ordered[i], ordered[j], got, -want)
+			}
+		}
+	}
+}
+
+func TestTupleOrder(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	pick := func() []any {
+		tuple := make([]any, r.IntN(4))
+		for i := range tuple {
+			tuple[i] = r.IntN(6) // a position in small
+		}
+		return tuple
+	}
+	small := []any{int64(-1), int64(0), "", "\x00", "a", "a\x00"}
+	// The reference compares the positions, value by value, then length.
+	ref := func(a, b []any) int {
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if x, y := a[i].(int), b[i].(int); x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+		}
+		switch {
+		case len(a) < len(b):
+			return -1
+		case len(a) > len(b):
+			return 1
+		}
+		return 0
+	}
+	values := func(tuple []any, descAt int) []any {
+		vals := make([]any, len(tuple))
+		for i, p := range tuple {
+			vals[i] = small[p.(int)]
+			if i == descAt {
+				vals[i] = codec.Desc(vals[i])
+			}
+		}
+		return vals
+	}
+	for range 20000 {
+		a, b := pick(), pick()
+		ea, eb := mustEncode(t, values(a, -1)...), mustEncode(t, values(b, -1)...)
+		if got, want := bytes.Compare(ea, eb), ref(a, b); got != want {
+			t.Fatalf("Compare of %v and %v = %d, want %d", values(a, -1), values(b, -1), got, want)
+		}
+		// The prefix property: a's encoding starts b's only if a starts b.
+		isPrefix := len(a) <= len(b) && ref(a, b[:len(a)]) == 0
+		if got := bytes.HasPrefix(eb, ea); got != isPrefix {
+			t.Fatalf("encoding of %v a prefix of %v's: %v", values(a, -1), values(b, -1), got)
+		}
+		// Descending in the first column: the tuples that differ there
+		// sort the other way, and the others as before.
+		da, db := mustEncode(t, values(a, 0)...), mustEncode(t, values(b, 0)...)
+		want := ref(a, b)
+		if len(a) > 0 && len(b) > 0 && a[0] != b[0] {
+			want = -want
+		}
+		if got := bytes.Compare(da, db); got != want {
+			t.Fatalf("Compare of %v and %v = %d, want %d", values(a, 0), values(b, 0), got, want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, v := range ordered {
+		for _, enc := range []any{v, codec.Desc(v)} {
+			b := mustEncode(t, "before", enc, int64(7))
+			got, err := codec.Decode(b)
+			if err != nil {
+				t.Fatalf("Decode of %#v: %v", v, err)
+			}
+			if len(got) != 3 || got[0] != "before" || !same(got[1], v) || got[2] != int64(7) {
+				t.Errorf("Decode of (before, %#v, 7) = %#v", v, got)
+			}
+		}
+	}
+	// An int comes back an int64, and empty bytes not nil.
+	if got, err := codec.Decode(mustEncode(t, 5, []byte(nil))); err != nil || !reflect.DeepEqual(got, []any{int64(5), []byte{}}) {
+		t.Errorf("Decode of (5, nil bytes) = %#v, %v", got, err)
+	}
+	if got, err := codec.Decode(nil); err != nil || len(got) != 0 {
+		t.Errorf("Decode of nothing = %#v, %v", got, err)
+	}
+
+	b := mustEncode(t, int64(1), "x", true)
+	v, rest, err := codec.Next(b)
+	if err != nil || v != int64(1) || !bytes.Equal(rest, mustEncode(t, "x", true)) {
+		t.Errorf("Next = %#v, %x, %v", v, rest, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, v := range []any{int32(1), 1.5 + 2i, struct{}{}, []int{1}, codec.Desc(int8(1))} {
+		if _, err := codec.Encode(v); !errors.Is(err, codec.ErrType) {
+			t.Errorf("Encode(%#v): %v, want ErrType", v, err)
+		}
+	}
+	// Every value cut short is corrupt.
+	for _, v := range ordered {
+		for _, enc := range []any{v, codec.Desc(v)} {
+			b := mustEncode(t, enc)
+			for n := 1; n < len(b); n++ {
+				if _, err := codec.Decode(b[:n]); !errors.Is(err, codec.ErrCorrupt) {
+					t.Errorf("Decode of %d bytes of the %d of %#v: %v, want ErrCorrupt", n, len(b), enc, err)
+				}
+			}
+		}
+	}
+	for _, b := range [][]byte{{0x01}, {0x30}, {0x20, 0x00, 0x02}} {
+		if _, err := codec.Decode(b); !errors.Is(err, codec.ErrCorrupt) {
+			t.Errorf("Decode(%x): %v, want ErrCorrupt", b, err)
+		}
+	}
+}
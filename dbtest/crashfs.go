@@ -0,0 +1,341 @@
+package dbtest
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// ErrCrashed is what the files of a CrashFS fail with once it has crashed.
+var ErrCrashed = errors.New("dbtest: simulated power loss")
+
+// sectorSize is the unit a disk writes atomically, or so CrashFS assumes.
+const sectorSize = 512
+
+// CrashFS is a vfs.FileSystem that delegates to FS and simulates power
+// loss. For every file it opened, it keeps the content the file had at its
+// last Sync (or when CrashFS first saw it) and the writes and truncations
+// made since. Crash then drops a random part of these: each truncation is
+// kept or lost, and each 512-byte sector of a write reaches the disk or
+// not, so a write can be torn or land after a later one was lost. The
+// files are left holding what a disk caching those writes might hold
+// once the power comes back, and every write, truncation and sync on a
+// file opened before fails with ErrCrashed. Reads and Close still work.
+//
+// Crashing on command only catches what the code had written when Crash
+// was called. CrashAt crashes in the middle of things instead: the n-th
+// write, truncation or sync crashes the file system and fails, the way a
+// machine dies halfway through a commit. Running a workload once to count
+// its Calls, then again with every CrashAt up to that count, crashes it
+// at every step.
+//
+// Only file contents are lost: directory changes (creating, renaming and
+// removing files) are taken to be durable at once, and a directory's Sync
+// just counts as a call. A file must not be reached through two names.
+// A CrashFS must not be copied after first use.
+type CrashFS struct {
+	FS      vfs.FileSystem // the file system to delegate to; nil means vfs.OS
+	CrashAt int            // crash on this 1-based call; 0 means only on Crash
+	Rand    *rand.Rand     // what a crash keeps; nil uses the global source
+
+	mu      sync.Mutex
+	calls   int
+	crashes int // files opened before the last crash are dead
+	files   map[string]*crashState
+}
+
+// crashState is what CrashFS knows of a file's content.
+type crashState struct {
+	synced  []byte    // as of the last sync
+	pending []crashOp // since then, in order
+}
+
+// crashOp is a write of data at off, or, with a nil data, a truncation to
+// off.
+type crashOp struct {
+	off  int64
+	data []byte
+}
+
+// Calls returns how many writes, truncations and syncs f has seen.
+func (f *CrashFS) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// Crashes returns how many times f has crashed.
+func (f *CrashFS) Crashes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.crashes
+}
+
+// Crash simulates a power loss now.
+func (f *CrashFS) Crash() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.crash()
+}
+
+// crash rewrites every file as a crash might leave it. The caller holds mu.
+func (f *CrashFS) crash() error {
+	f.crashes++
+	var err error
+	for name, st := range f.files {
+		st.synced, st.pending = f.survivors(st), nil
+		if werr := f.rewrite(name, st.synced); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// survivors returns the content st has after a crash.
+func (f *CrashFS) survivors(st *crashState) []byte {
+	img := append([]byte(nil), st.synced...)
+	for _, op := range st.pending {
+		if op.data == nil {
+			if f.intN(2) == 0 {
+				img = resize(img, op.off)
+			}
+			continue
+		}
+		for start := int64(0); start < int64(len(op.data)); {
+			// The rest of the sector the write is in.
+			end := min(int64(len(op.data)), start+sectorSize-(op.off+start)%sectorSize)
+			if f.intN(2) == 0 {
+				img = resize(img, max(int64(len(img)), op.off+end))
+				copy(img[op.off+start:], op.data[start:end])
+			}
+			start = end
+		}
+	}
+	return img
+}
+
+func resize(b []byte, size int64) []byte {
+	if size <= int64(len(b)) {
+		return b[:size]
+	}
+	return append(b, make([]byte, size-int64(len(b)))...)
+}
+
+func (f *CrashFS) intN(n int) int {
+	if f.Rand != nil {
+		return f.Rand.IntN(n)
+	}
+	return rand.IntN(n)
+}
+
+// rewrite replaces the content of name with data.
+func (f *CrashFS) rewrite(name string, data []byte) error {
+	fp, err := f.fs().OpenFile(name, os.O_WRONLY|os.O_TRUNC, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil // removed behind f's back
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fp.Write(data)
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// call counts a write, truncation or sync and returns ErrCrashed if it
+// crashes. The caller holds mu.
+func (f *CrashFS) call() error {
+	f.calls++
+	if f.calls == f.CrashAt {
+		f.crash()
+		return ErrCrashed
+	}
+	return nil
+}
+
+func (f *CrashFS) fs() vfs.FileSystem {
+	if f.FS == nil {
+		return vfs.OS{}
+	}
+	return f.FS
+}
+
+func (f *CrashFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name = filepath.Clean(name)
+	// The content of a file f has not seen, as found before this open,
+	// counts as durable. It is read on its own: the open may truncate the
+	// file, or not be for reading.
+	var data []byte
+	var readErr error
+	if f.files[name] == nil {
+		data, readErr = vfs.ReadFile(f.fs(), name)
+		if errors.Is(readErr, fs.ErrNotExist) {
+			readErr = nil
+		}
+	}
+	fp, err := f.fs().OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	cf := &crashFile{File: fp, fs: f, epoch: f.crashes, appending: flag&os.O_APPEND != 0}
+	if fi, err := fp.Stat(); err == nil && fi.IsDir() {
+		return cf, nil
+	}
+	cf.st = f.files[name]
+	if cf.st == nil {
+		if readErr != nil {
+			fp.Close()
+			return nil, readErr
+		}
+		if flag&os.O_TRUNC != 0 {
+			cf.st = &crashState{synced: data, pending: []crashOp{{off: 0}}}
+		} else {
+			cf.st = &crashState{synced: data}
+		}
+		if f.files == nil {
+			f.files = make(map[string]*crashState)
+		}
+		f.files[name] = cf.st
+	} else if flag&os.O_TRUNC != 0 {
+		cf.st.pending = append(cf.st.pending, crashOp{off: 0})
+	}
+	return cf, nil
+}
+
+func (f *CrashFS) Rename(oldpath, newpath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fs().Rename(oldpath, newpath); err != nil {
+		return err
+	}
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	if st, ok := f.files[oldpath]; ok {
+		f.files[newpath] = st
+		delete(f.files, oldpath)
+	} else {
+		delete(f.files, newpath)
+	}
+	return nil
+}
+
+func (f *CrashFS) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.fs().Remove(name); err != nil {
+		return err
+	}
+	delete(f.files, filepath.Clean(name))
+	return nil
+}
+
+func (f *CrashFS) MkdirAll(path string, perm fs.FileMode) error { return f.fs().MkdirAll(path, perm) }
+func (f *CrashFS) Stat(name string) (fs.FileInfo, error)        { return f.fs().Stat(name) }
+func (f *CrashFS) Lstat(name string) (fs.FileInfo, error)       { return f.fs().Lstat(name) }
+
+// crashFile records its writes with its CrashFS. st is nil for a
+// directory.
+type crashFile struct {
+	vfs.File
+	fs        *CrashFS
+	st        *crashState
+	epoch     int
+	appending bool
+}
+
+// begin locks the file system and counts a call, failing if the file is
+// dead or the call crashes. On success the caller must unlock fs.mu.
+func (cf *crashFile) begin(op string) error {
+	cf.fs.mu.Lock()
+	err := ErrCrashed
+	if cf.epoch == cf.fs.crashes {
+		err = cf.fs.call()
+	}
+	if err != nil {
+		cf.fs.mu.Unlock()
+		return &fs.PathError{Op: op, Path: cf.Name(), Err: err}
+	}
+	return nil
+}
+
+func (cf *crashFile) record(op crashOp) {
+	if cf.st != nil {
+		cf.st.pending = append(cf.st.pending, op)
+	}
+}
+
+func (cf *crashFile) Write(p []byte) (int, error) {
+	if err := cf.begin("write"); err != nil {
+		return 0, err
+	}
+	defer cf.fs.mu.Unlock()
+	var off int64
+	var err error
+	if cf.appending {
+		var fi fs.FileInfo
+		if fi, err = cf.File.Stat(); err == nil {
+			off = fi.Size()
+		}
+	} else {
+		off, err = cf.File.Seek(0, io.SeekCurrent)
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := cf.File.Write(p)
+	cf.record(crashOp{off: off, data: append([]byte{}, p[:n]...)})
+	return n, err
+}
+
+func (cf *crashFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := cf.begin("write"); err != nil {
+		return 0, err
+	}
+	defer cf.fs.mu.Unlock()
+	n, err := cf.File.WriteAt(p, off)
+	cf.record(crashOp{off: off, data: append([]byte{}, p[:n]...)})
+	return n, err
+}
+
+func (cf *crashFile) Truncate(size int64) error {
+	if err := cf.begin("truncate"); err != nil {
+		return err
+	}
+	defer cf.fs.mu.Unlock()
+	err := cf.File.Truncate(size)
+	if err == nil {
+		cf.record(crashOp{off: size})
+	}
+	return err
+}
+
+func (cf *crashFile) Sync() error {
+	if err := cf.begin("sync"); err != nil {
+		return err
+	}
+	defer cf.fs.mu.Unlock()
+	err := cf.File.Sync()
+	if err == nil && cf.st != nil {
+		// Everything written so far is durable now.
+		img := cf.st.synced
+		for _, op := range cf.st.pending {
+			if op.data == nil {
+				img = resize(img, op.off)
+			} else {
+				img = resize(img, max(int64(len(img)), op.off+int64(len(op.data))))
+				copy(img[op.off:], op.data)
+			}
+		}
+		cf.st.synced, cf.st.pending = img, nil
+	}
+	return err
+}
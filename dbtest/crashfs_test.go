@@ -0,0 +1,187 @@
+package dbtest_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// sectors returns n 512-byte sectors, the i-th filled with byte c+i.
+func sectors(c byte, n int) []byte {
+	var b []byte
+	for i := range n {
+		b = append(b, bytes.Repeat([]byte{c + byte(i)}, 512)...)
+	}
+	return b
+}
+
+func TestCrashFSKeepsSynced(t *testing.T) {
+	for seed := range uint64(50) {
+		mem := &vfs.Mem{}
+		f := &dbtest.CrashFS{FS: mem, Rand: rand.New(rand.NewPCG(seed, 0))}
+		fp, err := f.OpenFile("f", os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		synced := sectors('a', 2)
+		fp.Write(synced)
+		if err = fp.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		pending := sectors('A', 4)
+		fp.WriteAt(pending, 512)
+		if err = f.Crash(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = fp.Write([]byte("x")); !errors.Is(err, dbtest.ErrCrashed) {
+			t.Errorf("write after the crash: %v, want ErrCrashed", err)
+		}
+		if err = fp.Sync(); !errors.Is(err, dbtest.ErrCrashed) {
+			t.Errorf("sync after the crash: %v, want ErrCrashed", err)
+		}
+		fp.Close()
+
+		got, err := vfs.ReadFile(mem, "f")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Sector 0 was synced and not written since; each of the others
+		// holds either its synced content, the write's or, past the
+		// synced end, zeros for a later sector that landed.
+		if !bytes.Equal(got[:512], synced[:512]) {
+			t.Fatalf("seed %d: synced sector 0 lost", seed)
+		}
+		if len(got) < len(synced) || len(got) > 5*512 || len(got)%512 != 0 {
+			t.Fatalf("seed %d: %d bytes after the crash", seed, len(got))
+		}
+		for s := 1; s < len(got)/512; s++ {
+			sec := got[s*512 : (s+1)*512]
+			ok := bytes.Equal(sec, pending[(s-1)*512:s*512]) ||
+				s < 2 && bytes.Equal(sec, synced[s*512:(s+1)*512]) ||
+				s >= 2 && bytes.Equal(sec, make([]byte, 512))
+			if !ok {
+				t.Fatalf("seed %d: sector %d holds %q...", seed, s, sec[:4])
+			}
+		}
+	}
+}
+
+func TestCrashFSTearsWrites(t *testing.T) {
+	// Over enough seeds, a multi-sector write is seen whole, lost whole
+	// and torn.
+	whole, lost, torn := false, false, false
+	for seed := range uint64(100) {
+		mem := &vfs.Mem{}
+		f := &dbtest.CrashFS{FS: mem, Rand: rand.New(rand.NewPCG(seed, 1))}
+		fp, _ := f.OpenFile("f", os.O_RDWR|os.O_CREATE, 0644)
+		data := sectors('a', 3)
+		fp.Write(data)
+		f.Crash()
+		fp.Close()
+		got, _ := vfs.ReadFile(mem, "f")
+		switch {
+		case bytes.Equal(got, data):
+			whole = true
+		case len(got) == 0:
+			lost = true
+		default:
+			torn = true
+		}
+	}
+	if !whole || !lost || !torn {
+		t.Errorf("whole %v, lost %v, torn %v; want each in 100 crashes", whole, lost, torn)
+	}
+}
+
+func TestCrashFSCrashAt(t *testing.T) {
+	mem := &vfs.Mem{}
+	f := &dbtest.CrashFS{FS: mem, CrashAt: 3}
+	fp, err := f.OpenFile("f", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	fp.Write([]byte("one"))
+	if err = fp.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fp.Write([]byte("two")); !errors.Is(err, dbtest.ErrCrashed) {
+		t.Fatalf("call 3: %v, want ErrCrashed", err)
+	}
+	if f.Calls() != 3 || f.Crashes() != 1 {
+		t.Errorf("%d calls, %d crashes; want 3, 1", f.Calls(), f.Crashes())
+	}
+	if b, _ := vfs.ReadFile(mem, "f"); string(b) != "one" {
+		t.Errorf("file holds %q after the crash, want what was synced", b)
+	}
+
+	// A file opened after the crash works again, from what survived.
+	fp2, err := f.OpenFile("f", os.O_RDWR|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp2.Close()
+	if _, err = fp2.Write([]byte("+")); err != nil {
+		t.Errorf("write on a file opened after the crash: %v", err)
+	}
+	fp2.Sync()
+	if b, _ := vfs.ReadFile(mem, "f"); string(b) != "one+" {
+		t.Errorf("file holds %q", b)
+	}
+}
+
+func TestCrashFSExistingAndWriteOnly(t *testing.T) {
+	// What a file held before CrashFS saw it counts as durable, even when
+	// it is opened write-only, and an O_TRUNC may be lost.
+	mem := &vfs.Mem{}
+	if fp, err := mem.OpenFile("f", os.O_WRONLY|os.O_CREATE, 0644); err == nil {
+		fp.Write([]byte("before"))
+		fp.Close()
+	}
+	truncKept := false
+	for seed := range uint64(20) {
+		f := &dbtest.CrashFS{FS: mem, Rand: rand.New(rand.NewPCG(seed, 2))}
+		fp, err := f.OpenFile("f", os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Crash()
+		fp.Close()
+		b, _ := vfs.ReadFile(mem, "f")
+		switch string(b) {
+		case "before":
+		case "":
+			truncKept = true
+			fp, _ := mem.OpenFile("f", os.O_WRONLY, 0)
+			fp.Write([]byte("before"))
+			fp.Close()
+		default:
+			t.Fatalf("seed %d: file holds %q", seed, b)
+		}
+	}
+	if !truncKept {
+		t.Error("no crash kept the truncation")
+	}
+}
+
+func TestCrashFSRename(t *testing.T) {
+	mem := &vfs.Mem{}
+	f := &dbtest.CrashFS{FS: mem, Rand: rand.New(rand.NewPCG(1, 1))}
+	fp, _ := f.OpenFile("tmp", os.O_RDWR|os.O_CREATE, 0644)
+	fp.Write([]byte("data"))
+	fp.Sync()
+	fp.Close()
+	if err := f.Rename("tmp", "f"); err != nil {
+		t.Fatal(err)
+	}
+	f.Crash()
+	// Renames are durable at once, and the synced content went with it.
+	if b, err := vfs.ReadFile(mem, "f"); err != nil || string(b) != "data" {
+		t.Errorf("renamed file holds %q, %v after a crash", b, err)
+	}
+}
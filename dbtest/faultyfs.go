@@ -0,0 +1,157 @@
+// Package dbtest has helpers for testing code built on this module against
+// storage failures. It is meant for tests, but is a regular package so that
+// other modules can import it too.
+package dbtest
+
+import (
+	"errors"
+	"io/fs"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// Op is a kind of file-system call FaultyFS can fail.
+type Op int
+
+const (
+	OpOpen Op = iota
+	OpWrite
+	OpSync
+	OpRename
+	numOps
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpOpen:
+		return "open"
+	case OpWrite:
+		return "write"
+	case OpSync:
+		return "sync"
+	case OpRename:
+		return "rename"
+	}
+	return "unknown"
+}
+
+// ErrInjected is what FaultyFS returns for a failed call when Err is nil.
+var ErrInjected = errors.New("dbtest: injected fault")
+
+// FaultyFS is a vfs.FileSystem that delegates to FS but fails chosen calls.
+// Open, write, sync and rename calls are counted per Op (writes and syncs on
+// files it opened included) and a call fails when
+//   - its 1-based count for that Op equals FailAt[op], or
+//   - a random draw falls below Rate.
+//
+// Everything else (mkdir, stat, remove, reads) always goes straight to FS.
+// With Short set, a failed write is a short one, as when the disk fills up
+// midway: it writes the first half of its bytes before failing.
+// A FaultyFS must not be copied after first use.
+type FaultyFS struct {
+	FS     vfs.FileSystem // the file system to delegate to; nil means vfs.OS
+	FailAt map[Op]int     // fail exactly the n-th call of each Op
+	Rate   float64        // fail each counted call with this probability
+	Rand   *rand.Rand     // source for Rate; nil uses the global source
+	Err    error          // error to fail with; nil means ErrInjected
+	Short  bool           // a failed write first writes half its bytes
+
+	mu    sync.Mutex
+	calls [numOps]int
+}
+
+// Calls returns how many op calls f has seen, failed ones included.
+func (f *FaultyFS) Calls(op Op) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+// fault counts a call of op and returns the error it should fail with, if any.
+func (f *FaultyFS) fault(op Op) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[op]++
+	fail := f.FailAt[op] == f.calls[op]
+	if !fail && f.Rate > 0 {
+		if f.Rand != nil {
+			fail = f.Rand.Float64() < f.Rate
+		} else {
+			fail = rand.Float64() < f.Rate
+		}
+	}
+	if !fail {
+		return nil
+	}
+	if f.Err != nil {
+		return f.Err
+	}
+	return ErrInjected
+}
+
+func (f *FaultyFS) fs() vfs.FileSystem {
+	if f.FS == nil {
+		return vfs.OS{}
+	}
+	return f.FS
+}
+
+func (f *FaultyFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	if err := f.fault(OpOpen); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	fp, err := f.fs().OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &faultyFile{File: fp, fs: f}, nil
+}
+
+func (f *FaultyFS) Rename(oldpath, newpath string) error {
+	if err := f.fault(OpRename); err != nil {
+		return &fs.PathError{Op: "rename", Path: oldpath, Err: err}
+	}
+	return f.fs().Rename(oldpath, newpath)
+}
+
+func (f *FaultyFS) MkdirAll(path string, perm fs.FileMode) error { return f.fs().MkdirAll(path, perm) }
+func (f *FaultyFS) Stat(name string) (fs.FileInfo, error)        { return f.fs().Stat(name) }
+func (f *FaultyFS) Lstat(name string) (fs.FileInfo, error)       { return f.fs().Lstat(name) }
+func (f *FaultyFS) Remove(name string) error                     { return f.fs().Remove(name) }
+
+// faultyFile fails writes and syncs on behalf of its FaultyFS.
+type faultyFile struct {
+	vfs.File
+	fs *FaultyFS
+}
+
+func (ff *faultyFile) Write(p []byte) (int, error) {
+	if err := ff.fs.fault(OpWrite); err != nil {
+		n := 0
+		if ff.fs.Short {
+			n, _ = ff.File.Write(p[:len(p)/2])
+		}
+		return n, &fs.PathError{Op: "write", Path: ff.Name(), Err: err}
+	}
+	return ff.File.Write(p)
+}
+
+func (ff *faultyFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := ff.fs.fault(OpWrite); err != nil {
+		n := 0
+		if ff.fs.Short {
+			n, _ = ff.File.WriteAt(p[:len(p)/2], off)
+		}
+		return n, &fs.PathError{Op: "write", Path: ff.Name(), Err: err}
+	}
+	return ff.File.WriteAt(p, off)
+}
+
+func (ff *faultyFile) Sync() error {
+	if err := ff.fs.fault(OpSync); err != nil {
+		return &fs.PathError{Op: "sync", Path: ff.Name(), Err: err}
+	}
+	return ff.File.Sync()
+}
@@ -0,0 +1,116 @@
+package dbtest_test
+
+import (
+	"errors"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/vfs"
+)
+
+func TestFaultyFSFailAt(t *testing.T) {
+	d := t.TempDir()
+	f := &dbtest.FaultyFS{FailAt: map[dbtest.Op]int{dbtest.OpWrite: 2, dbtest.OpSync: 1}}
+	fp, err := f.OpenFile(filepath.Join(d, "f"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	if _, err = fp.Write([]byte("one")); err != nil {
+		t.Errorf("write 1: %v", err)
+	}
+	if _, err = fp.Write([]byte("two")); !errors.Is(err, dbtest.ErrInjected) {
+		t.Errorf("write 2: %v, want ErrInjected", err)
+	}
+	if _, err = fp.Write([]byte("six")); err != nil {
+		t.Errorf("write 3: %v", err)
+	}
+	if err = fp.Sync(); !errors.Is(err, dbtest.ErrInjected) {
+		t.Errorf("sync 1: %v, want ErrInjected", err)
+	}
+	if err = fp.Sync(); err != nil {
+		t.Errorf("sync 2: %v", err)
+	}
+	for op, want := range map[dbtest.Op]int{dbtest.OpOpen: 1, dbtest.OpWrite: 3, dbtest.OpSync: 2, dbtest.OpRename: 0} {
+		if got := f.Calls(op); got != want {
+			t.Errorf("Calls(%v) = %d, want %d", op, got, want)
+		}
+	}
+	// The calls that did not fail reached the disk, and the failed one
+	// did not.
+	if b, _ := os.ReadFile(filepath.Join(d, "f")); string(b) != "onesix" {
+		t.Errorf("file holds %q, want %q", b, "onesix")
+	}
+}
+
+func TestFaultyFSOpenRename(t *testing.T) {
+	d := t.TempDir()
+	myErr := errors.New("mine")
+	f := &dbtest.FaultyFS{FailAt: map[dbtest.Op]int{dbtest.OpOpen: 1, dbtest.OpRename: 1}, Err: myErr}
+	name := filepath.Join(d, "f")
+	if _, err := f.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644); !errors.Is(err, myErr) {
+		t.Errorf("open 1: %v, want the configured error", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("a failed open created the file: %v", err)
+	}
+	fp, err := f.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatalf("open 2: %v", err)
+	}
+	fp.Close()
+	if err = f.Rename(name, name+"2"); !errors.Is(err, myErr) {
+		t.Errorf("rename 1: %v, want the configured error", err)
+	}
+	if err = f.Rename(name, name+"2"); err != nil {
+		t.Errorf("rename 2: %v", err)
+	}
+	if _, err = f.Stat(name + "2"); err != nil {
+		t.Errorf("renamed file: %v", err)
+	}
+}
+
+func TestFaultyFSShort(t *testing.T) {
+	mem := &vfs.Mem{}
+	f := &dbtest.FaultyFS{FS: mem, FailAt: map[dbtest.Op]int{dbtest.OpWrite: 1}, Short: true}
+	fp, err := f.OpenFile("f", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := fp.Write([]byte("abcdef"))
+	if n != 3 || !errors.Is(err, dbtest.ErrInjected) {
+		t.Errorf("short write = %d, %v; want 3, ErrInjected", n, err)
+	}
+	fp.Close()
+	if b, _ := vfs.ReadFile(mem, "f"); string(b) != "abc" {
+		t.Errorf("file holds %q, want the first half", b)
+	}
+}
+
+func TestFaultyFSRate(t *testing.T) {
+	run := func(seed uint64) (fails int) {
+		f := &dbtest.FaultyFS{FS: &vfs.Mem{}, Rate: 0.5, Rand: rand.New(rand.NewPCG(seed, 0))}
+		for range 200 {
+			if _, err := f.OpenFile("f", os.O_RDWR|os.O_CREATE, 0644); err != nil {
+				fails++
+			}
+		}
+		return fails
+	}
+	fails := run(1)
+	if fails < 50 || fails > 150 {
+		t.Errorf("%d of 200 opens failed at rate 0.5", fails)
+	}
+	if again := run(1); again != fails {
+		t.Errorf("the same seed failed %d then %d opens", fails, again)
+	}
+	f := &dbtest.FaultyFS{FS: &vfs.Mem{}}
+	for range 100 {
+		if _, err := f.OpenFile("f", os.O_RDWR|os.O_CREATE, 0644); err != nil {
+			t.Fatalf("open with no faults configured: %v", err)
+		}
+	}
+}
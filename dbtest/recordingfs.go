@@ -0,0 +1,81 @@
+package dbtest
+
+import (
+	"io/fs"
+	"sync"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// SyncRecord is one fsync seen by a RecordingFS.
+type SyncRecord struct {
+	Name string // the path the file was opened with
+	Dir  bool   // whether it was a directory
+}
+
+// RecordingFS is a vfs.FileSystem that delegates to FS and remembers every
+// Sync made on the files it opened, in order, so tests can assert that an
+// operation made exactly the fsyncs its durability story depends on.
+// A RecordingFS must not be copied after first use.
+type RecordingFS struct {
+	FS vfs.FileSystem // the file system to delegate to; nil means vfs.OS
+
+	mu    sync.Mutex
+	syncs []SyncRecord
+}
+
+// Syncs returns the fsyncs recorded so far, oldest first.
+func (r *RecordingFS) Syncs() []SyncRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SyncRecord(nil), r.syncs...)
+}
+
+// Reset forgets the recorded fsyncs.
+func (r *RecordingFS) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.syncs = nil
+}
+
+func (r *RecordingFS) fs() vfs.FileSystem {
+	if r.FS == nil {
+		return vfs.OS{}
+	}
+	return r.FS
+}
+
+func (r *RecordingFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	fp, err := r.fs().OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingFile{File: fp, fs: r, name: name}, nil
+}
+
+func (r *RecordingFS) MkdirAll(path string, perm fs.FileMode) error {
+	return r.fs().MkdirAll(path, perm)
+}
+func (r *RecordingFS) Stat(name string) (fs.FileInfo, error)  { return r.fs().Stat(name) }
+func (r *RecordingFS) Lstat(name string) (fs.FileInfo, error) { return r.fs().Lstat(name) }
+func (r *RecordingFS) Rename(oldpath, newpath string) error   { return r.fs().Rename(oldpath, newpath) }
+func (r *RecordingFS) Remove(name string) error               { return r.fs().Remove(name) }
+
+// recordingFile reports its syncs to its RecordingFS.
+type recordingFile struct {
+	vfs.File
+	fs   *RecordingFS
+	name string
+}
+
+func (rf *recordingFile) Sync() error {
+	err := rf.File.Sync()
+	if err == nil {
+		fi, statErr := rf.Stat()
+		rec := SyncRecord{Name: rf.name, Dir: statErr == nil && fi.IsDir()}
+		rf.fs.mu.Lock()
+		rf.fs.syncs = append(rf.fs.syncs, rec)
+		rf.fs.mu.Unlock()
+	}
+	return err
+}
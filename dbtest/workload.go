@@ -0,0 +1,287 @@
+package dbtest
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// Distribution is how a Workload picks the keys it reads and writes.
+type Distribution int
+
+const (
+	// Uniform picks every key as often as any other.
+	Uniform Distribution = iota
+
+	// Zipf picks a few keys most of the time, key 0 the most, as caches
+	// see in practice.
+	Zipf
+
+	// Sequential goes through the keys in order, each worker from a
+	// place of its own, and around again.
+	Sequential
+)
+
+func (d Distribution) String() string {
+	switch d {
+	case Uniform:
+		return "uniform"
+	case Zipf:
+		return "zipf"
+	case Sequential:
+		return "sequential"
+	}
+	return "unknown"
+}
+
+// ParseDistribution returns the Distribution named s, as String names it.
+func ParseDistribution(s string) (Distribution, error) {
+	for d := Uniform; d <= Sequential; d++ {
+		if d.String() == s {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("dbtest: unknown key distribution %q", s)
+}
+
+// Workload is a synthetic load of reads and writes on a kv.DB, for
+// measuring it: Run loads its keys, then runs its operations, and times
+// each. The zero value of a field means the default it lists.
+type Workload struct {
+	Ops      int           // Gets and write transactions to run; 10000
+	Duration time.Duration // if set, run for this long instead of Ops
+
+	Keys      int // keys to load and then read and write; 10000
+	KeySize   int // bytes of a key, at least the digits of Keys; 16
+	ValueSize int // bytes of a value; 100
+
+	// Reads is the share of operations that are Gets, from 0 to 1; the
+	// others are Sets. NoReads makes the share 0, since a zero Reads
+	// means the default, 0.5.
+	Reads   float64
+	NoReads bool
+
+	Batch   int          // Sets per write transaction; 1
+	Dist    Distribution // Uniform
+	Workers int          // goroutines running the operations; 1
+	Seed    uint64       // of the keys picked and the values written
+}
+
+// Result is what Run measured.
+type Result struct {
+	Load    time.Duration // loading the keys
+	Elapsed time.Duration // running the operations
+
+	// The latencies of the Gets and of the write transactions, each of
+	// Workload.Batch Sets, in increasing order.
+	Reads, Writes Latencies
+}
+
+// Ops returns the number of operations run: the Gets and the write
+// transactions.
+func (r Result) Ops() int { return len(r.Reads) + len(r.Writes) }
+
+// Latencies are the durations of operations, in increasing order.
+type Latencies []time.Duration
+
+// Percentile returns the latency that the share p of the operations, from
+// 0 to 1, took at most; 0 if there are none.
+func (l Latencies) Percentile(p float64) time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(l)))
+	return l[min(max(i, 0), len(l)-1)]
+}
+
+// Mean returns the mean latency; 0 if there are none.
+func (l Latencies) Mean() time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, d := range l {
+		sum += d
+	}
+	return sum / time.Duration(len(l))
+}
+
+// defaults returns w with its defaults filled in.
+func (w Workload) defaults() Workload {
+	w.Ops = cmp.Or(w.Ops, 10000)
+	w.Keys = cmp.Or(w.Keys, 10000)
+	w.KeySize = max(cmp.Or(w.KeySize, 16), len(fmt.Sprint(w.Keys-1)))
+	w.ValueSize = cmp.Or(w.ValueSize, 100)
+	switch {
+	case w.NoReads:
+		w.Reads = 0
+	case w.Reads == 0:
+		w.Reads = 0.5
+	}
+	w.Batch = cmp.Or(w.Batch, 1)
+	w.Workers = cmp.Or(w.Workers, 1)
+	return w
+}
+
+// Key returns key i of the workload: i in decimal, padded with zeros to
+// KeySize, so that the keys sort as their numbers do.
+func (w Workload) Key(i int) []byte {
+	w = w.defaults()
+	return fmt.Appendf(nil, "%0*d", w.KeySize, i)
+}
+
+// Run loads the keys of w into db, in transactions of a thousand, then
+// runs its operations and returns what it measured. db should be empty:
+// the keys of w overwrite those of the same names.
+func (w Workload) Run(db *kv.DB) (Result, error) {
+	w = w.defaults()
+	switch {
+	case w.Reads < 0 || w.Reads > 1:
+		return Result{}, fmt.Errorf("dbtest: a share of reads of %v, not within 0 and 1", w.Reads)
+	case w.Keys < 1 || w.Ops < 1 || w.ValueSize < 0 || w.Batch < 1 || w.Workers < 1:
+		return Result{}, errors.New("dbtest: a workload with nothing to do")
+	}
+	var res Result
+	start := time.Now()
+	if err := w.load(db); err != nil {
+		return res, err
+	}
+	res.Load = time.Since(start)
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	left := int64(w.Ops)
+	start = time.Now()
+	deadline := start.Add(w.Duration)
+	for n := range w.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wk := w.worker(n)
+			var reads, writes Latencies
+			var err error
+			for err == nil {
+				mu.Lock()
+				more := left > 0
+				if w.Duration > 0 {
+					more = time.Now().Before(deadline)
+				}
+				left--
+				mu.Unlock()
+				if !more {
+					break
+				}
+				t := time.Now()
+				if wk.rnd.Float64() < w.Reads {
+					if _, err = db.Get(w.Key(wk.key())); err == kv.ErrKeyNotFound {
+						err = nil
+					}
+					reads = append(reads, time.Since(t))
+					continue
+				}
+				err = wk.write(db)
+				writes = append(writes, time.Since(t))
+			}
+			mu.Lock()
+			res.Reads = append(res.Reads, reads...)
+			res.Writes = append(res.Writes, writes...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+	slices.Sort(res.Reads)
+	slices.Sort(res.Writes)
+	return res, errors.Join(errs...)
+}
+
+// load sets every key of w.
+func (w Workload) load(db *kv.DB) error {
+	wk := w.worker(-1)
+	for lo := 0; lo < w.Keys; lo += 1000 {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for i := lo; i < min(lo+1000, w.Keys); i++ {
+			if err = tx.Set(w.Key(i), wk.value()); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// worker is the state of a goroutine of Run.
+type worker struct {
+	w    Workload
+	rnd  *rand.Rand
+	zipf *rand.Zipf
+	next int // of Sequential
+	val  []byte
+}
+
+func (w Workload) worker(n int) *worker {
+	rnd := rand.New(rand.NewPCG(w.Seed, uint64(n+1)))
+	wk := &worker{w: w, rnd: rnd, val: make([]byte, w.ValueSize)}
+	if w.Dist == Zipf {
+		wk.zipf = rand.NewZipf(rnd, 1.1, 1, uint64(w.Keys-1))
+	}
+	if n >= 0 {
+		wk.next = n * w.Keys / w.Workers
+	}
+	return wk
+}
+
+// key picks the number of the key of the next operation.
+func (wk *worker) key() int {
+	switch wk.w.Dist {
+	case Zipf:
+		return int(wk.zipf.Uint64())
+	case Sequential:
+		i := wk.next
+		wk.next = (wk.next + 1) % wk.w.Keys
+		return i
+	}
+	return wk.rnd.IntN(wk.w.Keys)
+}
+
+// value returns a random value, good until the next call. Random bytes
+// keep a Compressor from making the values smaller than they are.
+func (wk *worker) value() []byte {
+	for i := range wk.val {
+		wk.val[i] = byte(wk.rnd.Uint32())
+	}
+	return wk.val
+}
+
+// write sets Batch keys in a transaction.
+func (wk *worker) write(db *kv.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for range wk.w.Batch {
+		if err = tx.Set(wk.w.Key(wk.key()), wk.value()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
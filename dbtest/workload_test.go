@@ -0,0 +1,152 @@
+package dbtest_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/pager"
+)
+
+// newDB returns a new database, unsynced, closed at the end of the test.
+func newDB(tb testing.TB) *kv.DB {
+	tb.Helper()
+	db, err := (kv.Options{Sync: pager.SyncOff}).Open(filepath.Join(tb.TempDir(), "db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestWorkload(t *testing.T) {
+	for _, w := range []dbtest.Workload{
+		{Ops: 1000, Keys: 500, Reads: 0.8},
+		{Ops: 1000, Keys: 500, KeySize: 2, Dist: dbtest.Zipf, Workers: 4},
+		{Ops: 300, Keys: 50, NoReads: true, Batch: 5, Dist: dbtest.Sequential, ValueSize: 7},
+	} {
+		t.Run(fmt.Sprintf("%v×%d", w.Dist, w.Workers), func(t *testing.T) {
+			db := newDB(t)
+			res, err := w.Run(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Ops() != w.Ops {
+				t.Errorf("ran %d operations, want %d", res.Ops(), w.Ops)
+			}
+			if !slices.IsSorted(res.Reads) || !slices.IsSorted(res.Writes) {
+				t.Error("latencies out of order")
+			}
+			reads := float64(len(res.Reads)) / float64(w.Ops)
+			switch {
+			case w.NoReads:
+				if reads != 0 {
+					t.Errorf("%d Gets with NoReads", len(res.Reads))
+				}
+			case w.Reads == 0:
+				w.Reads = 0.5
+				fallthrough
+			default:
+				if reads < w.Reads-0.1 || reads > w.Reads+0.1 {
+					t.Errorf("a share of %.2f Gets, want %.2f", reads, w.Reads)
+				}
+			}
+			// The keys, padded to KeySize or the digits of Keys, and
+			// nothing else.
+			n := 0
+			err = db.Scan(nil, nil, func(k, v []byte) bool {
+				if want := w.Key(n); string(k) != string(want) {
+					t.Errorf("key %d is %q, want %q", n, k, want)
+					return false
+				}
+				if w.ValueSize != 0 && len(v) != w.ValueSize {
+					t.Errorf("value of %d bytes, want %d", len(v), w.ValueSize)
+				}
+				n++
+				return true
+			})
+			if err != nil || n != w.Keys {
+				t.Errorf("%d keys, %v; want %d", n, err, w.Keys)
+			}
+		})
+	}
+}
+
+func TestWorkloadBatch(t *testing.T) {
+	db := newDB(t)
+	w := dbtest.Workload{Ops: 20, Keys: 10, NoReads: true, Batch: 3}
+	commit := db.LastCommit()
+	res, err := w.Run(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One commit for the load, and one for each write transaction.
+	if c := db.LastCommit() - commit; c != 21 || len(res.Writes) != 20 {
+		t.Errorf("%d commits for %d write transactions, want 21 for 20", c, len(res.Writes))
+	}
+}
+
+func TestWorkloadDuration(t *testing.T) {
+	w := dbtest.Workload{Ops: 1, Duration: 50 * time.Millisecond, Keys: 100, Workers: 2}
+	res, err := w.Run(newDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Elapsed < w.Duration || res.Ops() < 2 {
+		t.Errorf("ran %d operations in %v, want more than one in %v", res.Ops(), res.Elapsed, w.Duration)
+	}
+}
+
+func TestWorkloadErrors(t *testing.T) {
+	for _, w := range []dbtest.Workload{
+		{Reads: 1.5},
+		{Reads: -0.5},
+		{Keys: -1},
+		{ValueSize: -1},
+		{Workers: -2},
+	} {
+		if _, err := w.Run(newDB(t)); err == nil {
+			t.Errorf("Run of %+v returned nil", w)
+		}
+	}
+	db := newDB(t)
+	db.Close()
+	if _, err := (dbtest.Workload{Keys: 10}).Run(db); err != kv.ErrClosed {
+		t.Errorf("Run on a closed database: %v, want ErrClosed", err)
+	}
+}
+
+func TestLatencies(t *testing.T) {
+	var l dbtest.Latencies
+	if l.Percentile(0.5) != 0 || l.Mean() != 0 {
+		t.Error("latencies of no operations are not 0")
+	}
+	for i := range 100 {
+		l = append(l, time.Duration(i+1)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{
+		0: time.Millisecond, 0.5: 51 * time.Millisecond, 0.99: 100 * time.Millisecond, 1: 100 * time.Millisecond,
+	} {
+		if got := l.Percentile(p); got != want {
+			t.Errorf("Percentile(%v) = %v, want %v", p, got, want)
+		}
+	}
+	if m := l.Mean(); m != 50500*time.Microsecond {
+		t.Errorf("Mean = %v, want 50.5ms", m)
+	}
+}
+
+func TestParseDistribution(t *testing.T) {
+	for _, d := range []dbtest.Distribution{dbtest.Uniform, dbtest.Zipf, dbtest.Sequential} {
+		if got, err := dbtest.ParseDistribution(d.String()); got != d || err != nil {
+			t.Errorf("ParseDistribution(%q) = %v, %v", d, got, err)
+		}
+	}
+	if _, err := dbtest.ParseDistribution("normal"); err == nil {
+		t.Error("ParseDistribution of an unknown name returned nil")
+	}
+}
@@ -0,0 +1,267 @@
+// Package driver makes the database a database/sql driver, called
+// "godb", that runs the statements of package ql:
+//
+//	import _ "github.com/adcondev/go-database/driver"
+//
+//	db, err := sql.Open("godb", "file.db")
+//
+// The data source name is the path of the database, which is opened with
+// kv.Open when the sql.DB first needs a connection, and closed with it.
+// The connections of a sql.DB share the one kv.DB, so ":memory:" makes a
+// sql.DB of a database in memory; NewConnector makes a sql.DB of an open
+// kv.DB instead, for one opened with kv.Options.
+//
+// A sql.Tx is a kv.Tx: a write transaction, or a read transaction if
+// sql.TxOptions.ReadOnly is set. A statement run outside of one runs in a
+// transaction of its own, a read transaction for a SELECT, committed at
+// once. As with kv.DB.Begin, only one write transaction is open at a time,
+// and starting another waits for it.
+//
+// A transaction that runs an ALTER TABLE or CREATE INDEX takes the rows
+// of the table through the change once it commits, before Commit, or the
+// Exec of the statement on its own, returns: in batches, each a write
+// transaction of its own, between which the other connections go on. See
+// table.Complete.
+//
+// Arguments are int64, string or []byte, and columns come back as those;
+// database/sql converts the other integer types.
+package driver
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/ql"
+	"github.com/adcondev/go-database/table"
+)
+
+var (
+	ErrNoLastInsertID = errors.New("driver: no last insert ID")
+	ErrIsolation      = errors.New("driver: unsupported isolation level")
+)
+
+func init() {
+	sql.Register("godb", Driver{})
+}
+
+// Driver is the "godb" driver.
+type Driver struct{}
+
+// Open opens a connection to the database at path, which has the
+// database to itself and closes it when it closes. sql.DB uses
+// OpenConnector instead, so that its connections share the database.
+func (Driver) Open(path string) (sqldriver.Conn, error) {
+	db, err := kv.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{db: db, owned: true}, nil
+}
+
+// OpenConnector returns a connector for the database at path, which opens
+// it for its first connection and closes it when the sql.DB closes.
+func (d Driver) OpenConnector(path string) (sqldriver.Connector, error) {
+	return &connector{driver: d, path: path}, nil
+}
+
+// NewConnector returns a connector for db, for sql.OpenDB. Closing the
+// sql.DB leaves db open.
+func NewConnector(db *kv.DB) sqldriver.Connector {
+	return &connector{driver: Driver{}, db: db}
+}
+
+type connector struct {
+	driver Driver
+	path   string // "" for a connector of NewConnector
+
+	mu sync.Mutex
+	db *kv.DB // nil until the first connection, for a path
+}
+
+func (c *connector) Connect(context.Context) (sqldriver.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		db, err := kv.Open(c.path)
+		if err != nil {
+			return nil, err
+		}
+		c.db = db
+	}
+	return &conn{db: c.db}, nil
+}
+
+func (c *connector) Driver() sqldriver.Driver { return c.driver }
+
+// Close closes the database the connector opened, which sql.DB.Close
+// calls.
+func (c *connector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path == "" || c.db == nil {
+		return nil
+	}
+	err := c.db.Close()
+	c.db = nil
+	return err
+}
+
+// conn is a connection, which runs its statements in its open transaction,
+// if any.
+type conn struct {
+	db    *kv.DB
+	owned bool   // conn closes db
+	tx    *kv.Tx // the open transaction, or nil
+	alter bool   // tx has started a schema change
+}
+
+func (c *conn) Prepare(query string) (sqldriver.Stmt, error) {
+	s, err := ql.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{conn: c, s: s}, nil
+}
+
+// Close rolls back the open transaction, if any.
+func (c *conn) Close() error {
+	if c.tx != nil {
+		c.tx.Rollback()
+		c.tx, c.alter = nil, false
+	}
+	if c.owned {
+		return c.db.Close()
+	}
+	return nil
+}
+
+func (c *conn) Begin() (sqldriver.Tx, error) {
+	return c.BeginTx(context.Background(), sqldriver.TxOptions{})
+}
+
+// BeginTx starts a transaction. Read transactions see a snapshot, and
+// write transactions run one at a time, so every level up to serializable
+// holds.
+func (c *conn) BeginTx(ctx context.Context, opts sqldriver.TxOptions) (sqldriver.Tx, error) {
+	if sql.IsolationLevel(opts.Isolation) > sql.LevelSerializable {
+		return nil, fmt.Errorf("%w: %v", ErrIsolation, sql.IsolationLevel(opts.Isolation))
+	}
+	if c.tx != nil {
+		return nil, errors.New("driver: transaction already open")
+	}
+	tx, err := c.begin(ctx, opts.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	c.tx = tx
+	return &txn{conn: c}, nil
+}
+
+func (c *conn) begin(ctx context.Context, readOnly bool) (*kv.Tx, error) {
+	if readOnly {
+		return c.db.BeginRead()
+	}
+	return c.db.BeginContext(ctx)
+}
+
+// run runs s with args, in the open transaction or one of its own.
+func (c *conn) run(s *ql.Stmt, args []sqldriver.Value) (*ql.Result, error) {
+	vals := make([]any, len(args))
+	for i, a := range args {
+		vals[i] = a
+	}
+	if c.tx != nil {
+		res, err := s.Exec(c.tx, vals...)
+		if err == nil && s.SchemaChange() != "" {
+			c.alter = true
+		}
+		return res, err
+	}
+	tx, err := c.begin(context.Background(), s.ReadOnly())
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.Exec(tx, vals...)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil || s.SchemaChange() == "" {
+		return res, err
+	}
+	return res, table.CompleteAll(c.db)
+}
+
+// txn is the open transaction of its connection.
+type txn struct{ conn *conn }
+
+func (t *txn) Commit() error {
+	tx, alter := t.conn.tx, t.conn.alter
+	t.conn.tx, t.conn.alter = nil, false
+	if err := tx.Commit(); err != nil || !alter {
+		return err
+	}
+	return table.CompleteAll(t.conn.db)
+}
+
+func (t *txn) Rollback() error {
+	tx := t.conn.tx
+	t.conn.tx, t.conn.alter = nil, false
+	return tx.Rollback()
+}
+
+type stmt struct {
+	conn *conn
+	s    *ql.Stmt
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return s.s.NumParams() }
+
+func (s *stmt) Exec(args []sqldriver.Value) (sqldriver.Result, error) {
+	res, err := s.conn.run(s.s, args)
+	if err != nil {
+		return nil, err
+	}
+	return result(res.RowsAffected), nil
+}
+
+func (s *stmt) Query(args []sqldriver.Value) (sqldriver.Rows, error) {
+	res, err := s.conn.run(s.s, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{res: res}, nil
+}
+
+// result is the number of rows a statement affected.
+type result int64
+
+func (r result) LastInsertId() (int64, error) { return 0, ErrNoLastInsertID }
+func (r result) RowsAffected() (int64, error) { return int64(r), nil }
+
+// rows are the rows of a SELECT, all read already.
+type rows struct {
+	res *ql.Result
+	i   int
+}
+
+func (r *rows) Columns() []string { return r.res.Columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []sqldriver.Value) error {
+	if r.i == len(r.res.Rows) {
+		return io.EOF
+	}
+	for j, v := range r.res.Rows[r.i] {
+		dest[j] = v
+	}
+	r.i++
+	return nil
+}
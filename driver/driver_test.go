@@ -0,0 +1,324 @@
+package driver_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/driver"
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/table"
+)
+
+// open opens the sql.DB of the database at path for a test, which closes
+// it at the end.
+func open(tb testing.TB, path string) *sql.DB {
+	tb.Helper()
+	db, err := sql.Open("godb", path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+func mustExec(tb testing.TB, db interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}, query string, args ...any) sql.Result {
+	tb.Helper()
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		tb.Fatalf("%s: %v", query, err)
+	}
+	return res
+}
+
+// count returns the number of rows of table t.
+func count(tb testing.TB, db *sql.DB) int {
+	tb.Helper()
+	rows, err := db.Query("SELECT id FROM t")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		tb.Fatal(err)
+	}
+	return n
+}
+
+const create = "CREATE TABLE t (id INT PRIMARY KEY, name TEXT, data BLOB)"
+
+func TestStatements(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db := open(t, path)
+	mustExec(t, db, create)
+	ins, err := db.Prepare("INSERT INTO t VALUES (?, ?, ?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ins.Close()
+	for i, name := range []string{"zero", "one", "two"} {
+		res, err := ins.Exec(i, name, []byte(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := res.RowsAffected(); n != 1 || err != nil {
+			t.Errorf("RowsAffected = %d, %v", n, err)
+		}
+		if _, err = res.LastInsertId(); !errors.Is(err, driver.ErrNoLastInsertID) {
+			t.Errorf("LastInsertId: %v, want ErrNoLastInsertID", err)
+		}
+	}
+	// database/sql converts other integer types.
+	mustExec(t, db, "UPDATE t SET name = ? WHERE id = ?", "ONE", uint8(1))
+
+	var (
+		id   int
+		name string
+		data []byte
+	)
+	if err = db.QueryRow("SELECT id, name, data FROM t WHERE id = ?", 1).Scan(&id, &name, &data); err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 || name != "ONE" || string(data) != "one" {
+		t.Errorf("row 1 = %d, %q, %q", id, name, data)
+	}
+	if err = db.QueryRow("SELECT id FROM t WHERE id = 9").Scan(&id); err != sql.ErrNoRows {
+		t.Errorf("QueryRow of no row: %v, want ErrNoRows", err)
+	}
+	if _, err = db.Exec("INSERT INTO t VALUES (1, 'again', x'')"); !errors.Is(err, table.ErrRowExists) {
+		t.Errorf("INSERT of a key taken: %v, want ErrRowExists", err)
+	}
+	if _, err = db.Exec("SELEC"); err == nil {
+		t.Error("a statement that does not parse ran")
+	}
+
+	rows, err := db.Query("SELECT name FROM t ORDER BY name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cols, _ := rows.Columns(); len(cols) != 1 || cols[0] != "name" {
+		t.Errorf("columns %q", cols)
+	}
+	var names []string
+	for rows.Next() {
+		if err = rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if rows.Close(); len(names) != 3 || names[0] != "ONE" || names[2] != "zero" {
+		t.Errorf("names %q", names)
+	}
+
+	// The data is in the file once the sql.DB closes.
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db = open(t, path); count(t, db) != 3 {
+		t.Errorf("%d rows after reopening, want 3", count(t, db))
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	db := open(t, filepath.Join(t.TempDir(), "db"))
+	mustExec(t, db, create)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, tx, "INSERT INTO t VALUES (1, 'a', x'')")
+	var n int
+	if err = tx.QueryRow("SELECT id FROM t WHERE id = 1").Scan(&n); err != nil || n != 1 {
+		t.Errorf("the transaction does not see its own insert: %d, %v", n, err)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if count(t, db) != 0 {
+		t.Error("a rolled back insert is there")
+	}
+
+	if tx, err = db.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, tx, "INSERT INTO t VALUES (1, 'a', x''), (2, 'b', x'')")
+	// A failing statement undoes itself alone.
+	if _, err = tx.Exec("INSERT INTO t VALUES (3, 'c', x''), (1, 'dup', x'')"); !errors.Is(err, table.ErrRowExists) {
+		t.Errorf("INSERT of a key taken: %v, want ErrRowExists", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if count(t, db) != 2 {
+		t.Errorf("%d rows after the commit, want 2", count(t, db))
+	}
+
+	ctx := context.Background()
+	ro, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ro.Exec("DELETE FROM t"); !errors.Is(err, kv.ErrReadOnly) {
+		t.Errorf("DELETE in a read-only transaction: %v, want kv.ErrReadOnly", err)
+	}
+	// It reads a snapshot, while a write goes on beside it.
+	mustExec(t, db, "DELETE FROM t WHERE id = 2")
+	if err = ro.QueryRow("SELECT id FROM t WHERE id = 2").Scan(&n); err != nil || n != 2 {
+		t.Errorf("the read-only transaction lost its snapshot: %d, %v", n, err)
+	}
+	ro.Rollback()
+
+	if _, err = db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelLinearizable}); !errors.Is(err, driver.ErrIsolation) {
+		t.Errorf("BeginTx of LevelLinearizable: %v, want ErrIsolation", err)
+	}
+	if tx, err = db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}); err != nil {
+		t.Errorf("BeginTx of LevelSerializable: %v", err)
+	} else {
+		tx.Rollback()
+	}
+}
+
+func TestConnector(t *testing.T) {
+	kdb, err := kv.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kdb.Close()
+	db := sql.OpenDB(driver.NewConnector(kdb))
+	mustExec(t, db, create)
+	mustExec(t, db, "INSERT INTO t VALUES (1, 'a', x'')")
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The kv.DB stays open, with the rows.
+	tx, err := kdb.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	tt, err := table.Open(tx, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tt.Get(tx, int64(1)); err != nil {
+		t.Errorf("row 1 through the kv.DB: %v", err)
+	}
+}
+
+func TestBeginTxContext(t *testing.T) {
+	kdb, err := kv.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kdb.Close()
+	db := sql.OpenDB(driver.NewConnector(kdb))
+	defer db.Close()
+	mustExec(t, db, create)
+	// A write transaction of the kv.DB keeps BeginTx waiting until its
+	// context is done.
+	ktx, err := kdb.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = db.BeginTx(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("BeginTx with a write transaction open: %v, want DeadlineExceeded", err)
+	}
+	// A read transaction does not wait.
+	rtx, err := db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtx.Rollback()
+	ktx.Rollback()
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, tx, "INSERT INTO t VALUES (1, 'a', x'')")
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSchemaChange(t *testing.T) {
+	kdb, err := kv.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kdb.Close()
+	db := sql.OpenDB(driver.NewConnector(kdb))
+	defer db.Close()
+	mustExec(t, db, create)
+	for i := range 1500 {
+		mustExec(t, db, "INSERT INTO t VALUES (?, 'a', x'')", i)
+	}
+	// The change runs to the end after the statement commits, or the
+	// transaction it is in.
+	mustExec(t, db, "ALTER TABLE t ADD n INT DEFAULT 1")
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, tx, "CREATE INDEX by_n ON t (n)")
+	mustExec(t, tx, "INSERT INTO t VALUES (1500, 'b', x'', 2)")
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	ktx, err := kdb.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ktx.Rollback()
+	if names, err := table.Changes(ktx); err != nil || len(names) != 0 {
+		t.Errorf("changes under way after the commit: %v, %v", names, err)
+	}
+	var id int
+	if err = db.QueryRow("SELECT id FROM t WHERE n = 2").Scan(&id); err != nil || id != 1500 {
+		t.Errorf("row of n 2 = %d, %v", id, err)
+	}
+	p, err := table.Open(ktx, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Columns) != "[{id int64} {name string} {data bytes} {n int64}]" || len(p.Indexes) != 1 {
+		t.Errorf("after the changes: columns %v, indexes %v", p.Columns, p.Indexes)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	db := open(t, ":memory:")
+	db.SetMaxOpenConns(4)
+	mustExec(t, db, create)
+	// Every connection sees the one database.
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for i := range 3 {
+		c, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, c)
+		if _, err = c.ExecContext(ctx, "INSERT INTO t VALUES (?, 'x', x'')", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+	if count(t, db) != 3 {
+		t.Errorf("%d rows over the connections, want 3", count(t, db))
+	}
+}
@@ -0,0 +1,72 @@
+package fileio
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// WouldChange reports whether saving data to path+file would change what is
+// on disk, so callers can skip a no-op write (and its fsync) entirely.
+// A missing file always counts as a change.
+func WouldChange(path, file string, data []byte) (bool, error) {
+	return Options{}.wouldChange(path, file, data)
+}
+
+func (o Options) wouldChange(path, file string, data []byte) (bool, error) {
+	fi, err := o.fs().Stat(path + file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, wrapErr(ReadErr, "stat", path+file, err)
+	}
+	if fi.Size() != int64(len(data)) {
+		return true, nil // cheap: no need to read a file of the wrong size
+	}
+	old, err := vfs.ReadFile(o.fs(), path+file)
+	if err != nil {
+		return false, wrapErr(ReadErr, "read", path+file, err)
+	}
+	return !bytes.Equal(old, data), nil
+}
+
+// ReplaceIfMatches atomically replaces path+file with data, but only if it
+// currently holds expectedCurrent; otherwise it returns ErrVersionConflict
+// and leaves the file alone. A nil expectedCurrent means the file must not
+// exist yet (an empty, non-nil one means it must exist and be empty).
+//
+// The check runs after the new content is written and synced, immediately
+// before the rename, so the window for a racing writer is as small as it
+// gets without locks. Writers that don't use ReplaceIfMatches can still
+// slip in between the check and the rename.
+func ReplaceIfMatches(path, file string, data, expectedCurrent []byte) error {
+	return Options{}.ReplaceIfMatches(path, file, data, expectedCurrent)
+}
+
+// ReplaceIfMatches is ReplaceIfMatches honouring the options in o.
+func (o Options) ReplaceIfMatches(path, file string, data, expectedCurrent []byte) error {
+	load := o.LoadData
+	if o.Trailer {
+		load = o.LoadDataVerified // expectedCurrent is the payload alone
+	}
+	o.precondition = func() error {
+		cur, err := load(path, file)
+		switch {
+		case errors.Is(err, NotFoundErr):
+			if expectedCurrent != nil {
+				return ErrVersionConflict
+			}
+			return nil
+		case err != nil:
+			return err
+		case expectedCurrent == nil || !bytes.Equal(cur, expectedCurrent):
+			return ErrVersionConflict
+		}
+		return nil
+	}
+	o.SkipIfUnchanged = false // the check must happen even for a no-op
+	return o.SaveData2(path, file, data)
+}
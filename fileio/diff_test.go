@@ -0,0 +1,73 @@
+package fileio_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/adcondev/go-database/fileio"
+)
+
+func TestWouldChange(t *testing.T) {
+	d := dir(t)
+	if err := fileio.SaveData2(d, "f", []byte("same")); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		file string
+		data string
+		want bool
+	}{
+		{"f", "same", false},
+		{"f", "diff", true},   // same size, other bytes
+		{"f", "longer", true}, // other size
+		{"missing", "same", true},
+	} {
+		got, err := fileio.WouldChange(d, tc.file, []byte(tc.data))
+		if err != nil || got != tc.want {
+			t.Errorf("WouldChange(%q, %q) = %v, %v; want %v", tc.file, tc.data, got, err, tc.want)
+		}
+	}
+}
+
+func TestReplaceIfMatches(t *testing.T) {
+	d := dir(t)
+	if err := fileio.ReplaceIfMatches(d, "f", []byte("v1"), nil); err != nil {
+		t.Fatalf("create with nil expected: %v", err)
+	}
+	if err := fileio.ReplaceIfMatches(d, "f", []byte("v2"), []byte("v1")); err != nil {
+		t.Fatalf("replace of v1: %v", err)
+	}
+	for _, expected := range [][]byte{[]byte("v1"), nil, {}} {
+		err := fileio.ReplaceIfMatches(d, "f", []byte("v3"), expected)
+		if !errors.Is(err, fileio.ErrVersionConflict) {
+			t.Errorf("replace expecting %q: %v, want ErrVersionConflict", expected, err)
+		}
+	}
+	if b := mustRead(t, d+"f"); string(b) != "v2" {
+		t.Errorf("content %q after the conflicts, want %q", b, "v2")
+	}
+	if entries, _ := os.ReadDir(d); len(entries) != 1 {
+		t.Errorf("directory holds %v, want the file alone", entries)
+	}
+	if err := fileio.ReplaceIfMatches(d, "g", []byte("x"), []byte("v1")); !errors.Is(err, fileio.ErrVersionConflict) {
+		t.Errorf("replace of a missing file expecting content: %v, want ErrVersionConflict", err)
+	}
+}
+
+func TestReplaceIfMatchesTrailer(t *testing.T) {
+	d := dir(t)
+	o := fileio.Options{Trailer: true}
+	if err := o.SaveData2(d, "f", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.ReplaceIfMatches(d, "f", []byte("v2"), []byte("v1")); err != nil {
+		t.Fatalf("replace of v1: %v", err)
+	}
+	if err := o.ReplaceIfMatches(d, "f", []byte("v3"), []byte("v1")); !errors.Is(err, fileio.ErrVersionConflict) {
+		t.Errorf("replace expecting v1 over v2: %v, want ErrVersionConflict", err)
+	}
+	if b, err := o.LoadDataVerified(d, "f"); err != nil || string(b) != "v2" {
+		t.Errorf("LoadDataVerified = %q, %v; want %q", b, err, "v2")
+	}
+}
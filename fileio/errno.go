@@ -0,0 +1,15 @@
+//go:build !plan9
+
+package fileio
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isReadOnlyFS reports whether err is the file system refusing writes.
+func isReadOnlyFS(err error) bool { return errors.Is(err, syscall.EROFS) }
+
+// isCrossDevice reports whether err is a rename refused for crossing file
+// systems.
+func isCrossDevice(err error) bool { return errors.Is(err, syscall.EXDEV) }
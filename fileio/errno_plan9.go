@@ -0,0 +1,10 @@
+package fileio
+
+// isReadOnlyFS reports whether err is the file system refusing writes.
+// Plan 9 has no errno for it, only a message that varies by server.
+func isReadOnlyFS(err error) bool { return false }
+
+// isCrossDevice reports whether err is a rename refused for crossing file
+// systems. Plan 9 renames within a directory only, so a temp file beside
+// its target never meets one.
+func isCrossDevice(err error) bool { return false }
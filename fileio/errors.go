@@ -0,0 +1,60 @@
+package fileio
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// Error is what the save and load functions return when a step fails on a
+// file. Kind is the package's sentinel for the step (WriteErr, OpenErr,
+// NotFoundErr, ...), Op the file system call and Path the file it was on.
+// Err is what the file system returned, or nil when the failure is the
+// package's own finding, such as a checksum mismatch.
+//
+// errors.Is matches both Kind and Err, so callers can keep testing for
+// WriteErr while telling syscall.ENOSPC from syscall.EPERM underneath, and
+// errors.As reaches the *fs.PathError, if any, through Err.
+type Error struct {
+	Kind error
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	s := e.Kind.Error()
+	if e.Path != "" {
+		s += ": " + e.Op + " " + e.Path
+	}
+	if e.Err != nil {
+		s += ": " + cause(e.Err).Error()
+	}
+	return s
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// cause strips the op and path off err when Error already prints them.
+func cause(err error) error {
+	var pe *fs.PathError
+	var le *os.LinkError
+	switch {
+	case errors.As(err, &pe):
+		return pe.Err
+	case errors.As(err, &le):
+		return le.Err
+	}
+	return err
+}
+
+// wrapErr returns an *Error of the given kind for op on path failing with
+// err.
+func wrapErr(kind error, op, path string, err error) error {
+	return &Error{Kind: kind, Op: op, Path: path, Err: err}
+}
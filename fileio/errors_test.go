@@ -0,0 +1,85 @@
+package fileio_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/fileio"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// errDiskFull stands for an errno the file system returns.
+var errDiskFull = errors.New("no space left on device")
+
+func TestErrorWrapsCause(t *testing.T) {
+	for _, tc := range []struct {
+		op   dbtest.Op
+		kind error
+	}{
+		{dbtest.OpWrite, fileio.WriteErr},
+		{dbtest.OpSync, fileio.SyncErr},
+		{dbtest.OpOpen, fileio.OpenErr},
+	} {
+		d := dir(t)
+		fsys := &dbtest.FaultyFS{FS: vfs.OS{}, FailAt: map[dbtest.Op]int{tc.op: 1}, Err: errDiskFull}
+		err := fileio.Options{FS: fsys}.SaveData1(d, "f", []byte("data"))
+		if !errors.Is(err, tc.kind) || !errors.Is(err, errDiskFull) {
+			t.Errorf("failed %v: %v, want both %v and the cause", tc.op, err, tc.kind)
+		}
+		var e *fileio.Error
+		if !errors.As(err, &e) || e.Path != d+"f" || e.Kind != tc.kind {
+			t.Errorf("failed %v: %#v, want an *Error of %v on the file", tc.op, err, tc.kind)
+			continue
+		}
+		var pe *fs.PathError
+		if !errors.As(err, &pe) {
+			t.Errorf("failed %v: the *fs.PathError is not reachable", tc.op)
+		}
+		// The path is printed once, not again by the cause.
+		if want := tc.kind.Error() + ": " + e.Op + " " + d + "f: " + errDiskFull.Error(); err.Error() != want {
+			t.Errorf("failed %v: message %q, want %q", tc.op, err, want)
+		}
+	}
+}
+
+func TestErrorNotFound(t *testing.T) {
+	d := dir(t)
+	_, err := fileio.LoadData(d, "missing")
+	if !errors.Is(err, fileio.NotFoundErr) || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LoadData of a missing file: %v, want NotFoundErr and fs.ErrNotExist", err)
+	}
+	if errors.Is(err, fileio.ReadErr) {
+		t.Error("a missing file matches ReadErr")
+	}
+}
+
+func TestErrorWithoutCause(t *testing.T) {
+	e := &fileio.Error{Kind: fileio.ChecksumErr, Op: "load", Path: "/x"}
+	if !errors.Is(e, fileio.ChecksumErr) || e.Error() != fileio.ChecksumErr.Error()+": load /x" {
+		t.Errorf("%q does not match its kind alone", e)
+	}
+	if (&fileio.Error{Kind: fileio.WriteErr}).Error() != fileio.WriteErr.Error() {
+		t.Error("an *Error without a path prints more than its kind")
+	}
+}
+
+func TestErrorRename(t *testing.T) {
+	d := dir(t)
+	fsys := &dbtest.FaultyFS{FS: vfs.OS{}, FailAt: map[dbtest.Op]int{dbtest.OpRename: 1}, Err: errDiskFull}
+	err := fileio.Options{FS: fsys}.SaveData2(d, "f", []byte("data"))
+	var e *fileio.Error
+	if !errors.Is(err, fileio.RenameErr) || !errors.Is(err, errDiskFull) || !errors.As(err, &e) || e.Path != d+"f" {
+		t.Errorf("SaveData2 with a failed rename: %#v, want an *Error of RenameErr on the file", err)
+	}
+	err = fileio.RenameReplace(d+"missing", d+"f")
+	var le *os.LinkError
+	if !errors.Is(err, fileio.RenameErr) || !errors.Is(err, fs.ErrNotExist) || !errors.As(err, &le) {
+		t.Fatalf("RenameReplace of a missing file: %#v, want RenameErr and the *LinkError", err)
+	}
+	if want := fileio.RenameErr.Error() + ": rename " + d + "f: " + le.Err.Error(); err.Error() != want {
+		t.Errorf("message %q, want %q", err, want)
+	}
+}
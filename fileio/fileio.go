@@ -0,0 +1,294 @@
+// Package fileio implements simple file operations demonstrating
+// techniques of updating files in-place and atomic renaming.
+package fileio
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// The save and load functions return these wrapped in an *Error, which
+// adds the file, the call and its cause; test for them with errors.Is.
+var (
+	WriteErr  error = errors.New("write: bytes not written")
+	ReadErr   error = errors.New("read: bytes not read")
+	OpenErr   error = errors.New("open: file not opened")
+	SyncErr   error = errors.New("sync: data not persisted")
+	FolderErr error = errors.New("folder: path not created")
+	ChmodErr  error = errors.New("chmod: mode not preserved")
+	ResumeErr error = errors.New("resume: stream shorter than partial file")
+	RenameErr error = errors.New("rename: file not replaced")
+
+	// Reasons a folder could not be created; FolderErr covers the rest.
+	ErrPermission    error = errors.New("folder: permission denied")
+	ErrNotADirectory error = errors.New("folder: path is not a directory")
+	ErrReadOnlyFS    error = errors.New("folder: read-only file system")
+	ErrDirNotExist   error = errors.New("folder: directory does not exist")
+
+	NotFoundErr    error = errors.New("load: file not found")
+	ErrIsDirectory error = errors.New("load: path is a directory")
+
+	VersionErr  error = errors.New("version: old file not kept")
+	ErrTimeout  error = errors.New("write: timed out waiting for write and sync")
+	ErrDiskFull error = errors.New("write: not enough free disk space")
+
+	ErrVersionConflict error = errors.New("replace: current content is not the expected one")
+
+	ErrSymlink      error = errors.New("open: target is a symlink")
+	ErrVerifyFailed error = errors.New("verify: data read back differs from data written")
+
+	ChecksumErr  error = errors.New("checksum: trailer does not match data")
+	ErrNoTrailer error = errors.New("checksum: file has no trailer")
+)
+
+// mkdir creates path and its parents unless o.AssumeDirExists.
+func (o Options) mkdir(path string) error {
+	if o.AssumeDirExists {
+		return nil
+	}
+	if err := o.fs().MkdirAll(path, 0755); err != nil {
+		return wrapErr(mkdirErr(err), "mkdir", path, err)
+	}
+	return nil
+}
+
+// openErr wraps a failure to create name. Without the MkdirAll, a missing
+// directory only shows up here, so name it instead of a bare OpenErr.
+func (o Options) openErr(name string, err error) error {
+	if o.AssumeDirExists && errors.Is(err, fs.ErrNotExist) {
+		return wrapErr(ErrDirNotExist, "open", name, err)
+	}
+	return wrapErr(OpenErr, "open", name, err)
+}
+
+// mkdirErr maps a MkdirAll failure to the most specific folder error.
+func mkdirErr(err error) error {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return ErrPermission
+	case errors.Is(err, syscall.ENOTDIR), errors.Is(err, fs.ErrExist):
+		// MkdirAll only reports "exists" when a non-directory is in the way.
+		return ErrNotADirectory
+	case isReadOnlyFS(err):
+		return ErrReadOnlyFS
+	}
+	return FolderErr
+}
+
+// ===
+// Chapter 01: From Files To Databases
+// 1.1 Updating files in-place
+// ===
+
+// SaveData1 Save some data to disk.
+//
+// Limitations:
+//  1. It updates the content as a whole; only usable for tiny data.
+//  2. If you need to update the old file, you must read and modify it in memory, then overwrite the old file.
+//  3. You need a server to coordinate concurrent clients.
+func SaveData1(path, file string, data []byte) error {
+	return Options{}.SaveData1(path, file, data)
+}
+
+// SaveData1 is SaveData1 honouring the options in o.
+func (o Options) SaveData1(path, file string, data []byte) error {
+	if o.Trailer {
+		data = withTrailer(data)
+	}
+	// Let’s say you need to save some data to disk; this is a typical way to do it
+	err := o.mkdir(path) // Ensure the directory exists
+	if err != nil {
+		return err
+	}
+	if err = o.checkSpace(path, int64(len(data))); err != nil {
+		return err
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if o.NoFollow {
+		if o.isSymlink(path + file) {
+			return wrapErr(ErrSymlink, "open", path+file, nil)
+		}
+		flag |= oNoFollow // closes the race between the check above and the open
+	}
+	_, statErr := o.fs().Lstat(path + file)
+	t := o.Latency.now()
+	fp, err := o.fs().OpenFile(
+		// write-only, create a new file if none exists, truncate regular writable file when opened
+		path+file, flag, o.mode(),
+	)
+	t = o.Latency.observe(OpOpen, t)
+	if err != nil {
+		if o.NoFollow && o.isSymlink(path+file) {
+			return wrapErr(ErrSymlink, "open", path+file, err)
+		}
+		return o.openErr(path+file, err)
+	}
+	defer fp.Close()
+	if o.ExactMode && errors.Is(statErr, fs.ErrNotExist) {
+		if err = fp.Chmod(o.mode()); err != nil {
+			return wrapErr(ChmodErr, "chmod", path+file, err)
+		}
+	}
+
+	_, err = fp.Write(data) // Writes data
+	t = o.Latency.observe(OpWrite, t)
+	if err != nil {
+		return wrapErr(WriteErr, "write", path+file, err)
+	}
+	err = fp.Sync() // data is not persistent until fp.Sync() call
+	o.Latency.observe(OpSync, t)
+	if err != nil {
+		return wrapErr(SyncErr, "sync", path+file, err)
+	}
+	return nil
+}
+
+// ===
+// Chapter 01: From Files To Databases
+// 1.2 Atomic Renaming
+// ===
+
+// SaveData2 Replacing data atomically by renaming files
+//
+// Not touching the old file data means:
+//  1. If the update is interrupted, you can recover from the old file since it remains intact.
+//  2. Concurrent readers won’t get half written data.
+//
+// Atomicity:
+//   - Rename is atomic w.r.t. concurrent readers; a reader opens either the old or the new file.
+//   - Rename is NOT atomic w.r.t. power loss; it’s not even durable.
+//     SaveData2 therefore fsyncs the directory after renaming, so once it
+//     returns a crash brings back the new content; before that, the old.
+//     Options.Fsync can relax this.
+//
+// An existing file keeps its permission bits (and, when the process is
+// allowed to, its owner) across the replacement.
+func SaveData2(path, file string, data []byte) error {
+	return Options{}.SaveData2(path, file, data)
+}
+
+// SaveData2 is SaveData2 honouring the options in o.
+func (o Options) SaveData2(path, file string, data []byte) error {
+	if o.Trailer {
+		data = withTrailer(data)
+	}
+	if o.SkipIfUnchanged {
+		// A failed comparison just means we cannot prove it's a no-op.
+		if changed, err := o.wouldChange(path, file, data); err == nil && !changed {
+			return nil
+		}
+	}
+	err := o.mkdir(path) // Ensure the directory exists
+	if err != nil {
+		return err
+	}
+	if err = o.checkSpace(path, int64(len(data))); err != nil {
+		return err
+	}
+
+	// Many problems are solved by not updating data in-place.
+	// You can write a new file and delete the old file.
+	t := o.Latency.now()
+	fp, tmp, err := o.createTemp(path + file)
+	t = o.Latency.observe(OpOpen, t)
+	if err != nil {
+		return o.openErr(tmp, err)
+	}
+	defer func() {
+		if err != nil {
+			fp.Close()         // if not closed already, below
+			o.fs().Remove(tmp) // If any error, deletes new file.
+		}
+	}()
+
+	// The replacement should look like the file it replaces, not like a
+	// fresh file: carry the old mode (and owner, where allowed) over.
+	if fi, statErr := o.fs().Stat(path + file); statErr == nil {
+		if err = fp.Chmod(fi.Mode().Perm()); err != nil {
+			return wrapErr(ChmodErr, "chmod", tmp, err)
+		}
+		chownLike(fp, fi)
+	} else if o.ExactMode {
+		if err = fp.Chmod(o.mode()); err != nil {
+			return wrapErr(ChmodErr, "chmod", tmp, err)
+		}
+	}
+
+	if o.reserve {
+		if err = preallocate(fp, int64(len(data))); err != nil {
+			return wrapErr(ErrDiskFull, "fallocate", tmp, err)
+		}
+	}
+
+	err = o.withTimeout(tmp, func() error {
+		t := t
+		_, err := fp.Write(data) // Write
+		t = o.Latency.observe(OpWrite, t)
+		if err != nil {
+			return wrapErr(WriteErr, "write", tmp, err)
+		}
+		if o.Fsync.syncFile() {
+			err = fp.Sync() // Persist data
+			o.Latency.observe(OpSync, t)
+			if err != nil {
+				return wrapErr(SyncErr, "sync", tmp, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err // on ErrTimeout the deferred cleanup still removes tmp
+	}
+	t = o.Latency.now()
+	if o.VerifyAfterWrite {
+		if err = o.verifyFile(tmp, data); err != nil {
+			return err
+		}
+		t = o.Latency.now() // don't bill the read-back to the rename
+	}
+	// Windows will not rename a file that is still open.
+	if err = fp.Close(); err != nil {
+		return wrapErr(WriteErr, "close", tmp, err)
+	}
+	t = o.Latency.now()
+	stashed := false
+	if o.KeepVersions > 0 {
+		if stashed, err = o.stashVersion(path + file); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil && stashed {
+				o.fs().Remove(versionName(path+file, 0))
+			}
+		}()
+		t = o.Latency.now()
+	}
+	if o.precondition != nil {
+		if err = o.precondition(); err != nil {
+			return err
+		}
+		t = o.Latency.now()
+	}
+	// Renaming a file to an existing one replaces it atomically;
+	// deleting the old file is not needed (and not correct).
+	err = o.renameReplace(tmp, path+file)
+	t = o.Latency.observe(OpRename, t)
+	if err != nil {
+		return err
+	}
+	var rotateErr error
+	if stashed {
+		// The new content is in place: only now do the versions move. A
+		// failure there must not skip the sync of the rename that is done.
+		rotateErr = o.rotateVersions(path+file, o.KeepVersions)
+		t = o.Latency.now()
+	}
+	// The rename lives in the directory; it is only durable once that is synced.
+	if o.Fsync.syncDir() {
+		err = o.syncDir(dirOf(path))
+		o.Latency.observe(OpSyncDir, t)
+	}
+	return errors.Join(rotateErr, err)
+}
@@ -0,0 +1,340 @@
+package fileio_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/fileio"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// dir returns a fresh directory for a test, with the trailing separator
+// the save functions expect of their path.
+func dir(t *testing.T) string {
+	return t.TempDir() + string(filepath.Separator)
+}
+
+// mustRead returns the content of name, failing the test if it can't.
+func mustRead(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSaveNotADirectory(t *testing.T) {
+	d := dir(t)
+	if err := os.WriteFile(d+"blocker", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, save := range map[string]func(path, file string, data []byte) error{
+		"SaveData1": fileio.SaveData1,
+		"SaveData2": fileio.SaveData2,
+	} {
+		err := save(d+"blocker/sub/", "f", []byte("x"))
+		if !errors.Is(err, fileio.ErrNotADirectory) {
+			t.Errorf("%s with a file in the way: %v, want ErrNotADirectory", name, err)
+		}
+		var e *fileio.Error
+		if !errors.As(err, &e) || e.Op != "mkdir" {
+			t.Errorf("%s: %#v, want an *Error of mkdir", name, err)
+		}
+	}
+}
+
+func TestSavePermission(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root is not denied")
+	}
+	d := dir(t)
+	if err := os.Chmod(d, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(d, 0700)
+	err := fileio.SaveData2(d+"sub/", "f", []byte("x"))
+	if !errors.Is(err, fileio.ErrPermission) {
+		t.Errorf("SaveData2 in a read-only directory: %v, want ErrPermission", err)
+	}
+}
+
+func TestSaveNoFollow(t *testing.T) {
+	d := dir(t)
+	victim := filepath.Join(t.TempDir(), "victim")
+	if err := os.WriteFile(victim, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(victim, d+"f"); err != nil {
+		t.Skip("symlinks not available:", err)
+	}
+	err := fileio.Options{NoFollow: true}.SaveData1(d, "f", []byte("evil"))
+	if !errors.Is(err, fileio.ErrSymlink) {
+		t.Errorf("SaveData1 through a symlink: %v, want ErrSymlink", err)
+	}
+	if b := mustRead(t, victim); string(b) != "keep" {
+		t.Errorf("link target now holds %q", b)
+	}
+
+	// SaveData2 replaces the link, not what it points to.
+	if err = fileio.SaveData2(d, "f", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Lstat(d + "f"); err != nil || fi.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("after SaveData2 the target is %v, %v; want a regular file", fi, err)
+	}
+	if b := mustRead(t, victim); string(b) != "keep" {
+		t.Errorf("link target now holds %q", b)
+	}
+}
+
+func TestSaveData2KeepsMode(t *testing.T) {
+	d := dir(t)
+	if err := os.WriteFile(d+"f", []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(d+"f", 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileio.SaveData2(d, "f", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(d + "f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Errorf("mode after SaveData2 is %v, want 0600", fi.Mode().Perm())
+	}
+	if b := mustRead(t, d+"f"); string(b) != "new" {
+		t.Errorf("content %q, want %q", b, "new")
+	}
+}
+
+// createFS remembers the names of the files opened with O_CREATE through
+// it.
+type createFS struct {
+	vfs.OS
+	creates []string
+}
+
+func (c *createFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	if flag&os.O_CREATE != 0 {
+		c.creates = append(c.creates, name)
+	}
+	return c.OS.OpenFile(name, flag, perm)
+}
+
+func TestSkipIfUnchanged(t *testing.T) {
+	d := dir(t)
+	if err := fileio.SaveData2(d, "f", []byte("same")); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(d+"f", old, old); err != nil {
+		t.Fatal(err)
+	}
+	fsys := &createFS{}
+	o := fileio.Options{FS: fsys, SkipIfUnchanged: true}
+	if err := o.SaveData2(d, "f", []byte("same")); err != nil {
+		t.Fatal(err)
+	}
+	if len(fsys.creates) != 0 {
+		t.Errorf("an unchanged save created %q", fsys.creates)
+	}
+	fi, err := os.Stat(d + "f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(old) {
+		t.Errorf("mod time %v, want it left at %v", fi.ModTime(), old)
+	}
+
+	if err = o.SaveData2(d, "f", []byte("diff")); err != nil {
+		t.Fatal(err)
+	}
+	if len(fsys.creates) != 1 {
+		t.Errorf("a changed save created %q, want its temp file", fsys.creates)
+	}
+	if b := mustRead(t, d+"f"); string(b) != "diff" {
+		t.Errorf("content %q, want %q", b, "diff")
+	}
+}
+
+// garbleFS writes every buffer with its first byte flipped.
+type garbleFS struct{ vfs.OS }
+
+func (g garbleFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	fp, err := g.OS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return garbledFile{fp}, nil
+}
+
+type garbledFile struct{ vfs.File }
+
+func (g garbledFile) Write(p []byte) (int, error) {
+	b := append([]byte(nil), p...)
+	if len(b) > 0 {
+		b[0] ^= 0xff
+	}
+	return g.File.Write(b)
+}
+
+func TestVerifyAfterWrite(t *testing.T) {
+	d := dir(t)
+	if err := fileio.SaveData2(d, "f", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	err := fileio.Options{FS: garbleFS{}, VerifyAfterWrite: true}.SaveData2(d, "f", []byte("new"))
+	if !errors.Is(err, fileio.ErrVerifyFailed) {
+		t.Fatalf("garbled write: %v, want ErrVerifyFailed", err)
+	}
+	if b := mustRead(t, d+"f"); string(b) != "old" {
+		t.Errorf("content %q after a failed verify, want the old one", b)
+	}
+	if entries, _ := os.ReadDir(d); len(entries) != 1 {
+		t.Errorf("directory holds %v, want the file alone", entries)
+	}
+
+	if err = (fileio.Options{VerifyAfterWrite: true}).SaveData2(d, "f", []byte("new")); err != nil {
+		t.Fatalf("sound write: %v", err)
+	}
+	if b := mustRead(t, d+"f"); string(b) != "new" {
+		t.Errorf("content %q, want %q", b, "new")
+	}
+}
+
+// stallFS is a file system whose file syncs hang until release is closed.
+type stallFS struct {
+	vfs.OS
+	release chan struct{}
+}
+
+func (s stallFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	fp, err := s.OS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return stalledFile{fp, s.release}, nil
+}
+
+type stalledFile struct {
+	vfs.File
+	release chan struct{}
+}
+
+func (s stalledFile) Sync() error {
+	<-s.release
+	return s.File.Sync()
+}
+
+func TestWriteTimeout(t *testing.T) {
+	d := dir(t)
+	if err := fileio.SaveData2(d, "f", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	fsys := stallFS{release: make(chan struct{})}
+	defer close(fsys.release)
+	o := fileio.Options{FS: fsys, WriteTimeout: 20 * time.Millisecond}
+	start := time.Now()
+	err := o.SaveData2(d, "f", []byte("new"))
+	if !errors.Is(err, fileio.ErrTimeout) {
+		t.Fatalf("hung sync: %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("SaveData2 took %v to time out", elapsed)
+	}
+	var e *fileio.Error
+	if !errors.As(err, &e) || !strings.HasPrefix(e.Path, d+"f.tmp.") {
+		t.Errorf("ErrTimeout as %#v, want an *Error naming the temp file", err)
+	}
+	if b := mustRead(t, d+"f"); string(b) != "old" {
+		t.Errorf("content %q after a timeout, want the old one", b)
+	}
+	if entries, _ := os.ReadDir(d); len(entries) != 1 {
+		t.Errorf("directory holds %v, want the temp file removed", entries)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, save := range map[string]func(path, file string, data []byte) error{
+		"SaveData1": fileio.SaveData1,
+		"SaveData2": fileio.SaveData2,
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := dir(t)
+			for _, data := range [][]byte{[]byte("first, and longer"), []byte("second"), {}} {
+				if err := save(d+"sub/", "f", data); err != nil {
+					t.Fatal(err)
+				}
+				b, err := fileio.LoadData(d+"sub/", "f")
+				if err != nil || string(b) != string(data) {
+					t.Errorf("LoadData = %q, %v; want %q", b, err, data)
+				}
+			}
+			if entries, _ := os.ReadDir(d + "sub"); len(entries) != 1 {
+				t.Errorf("directory holds %v, want the file alone", entries)
+			}
+		})
+	}
+}
+
+// windowsFS refuses to rename a file it has open, as Windows does.
+type windowsFS struct {
+	vfs.OS
+	open map[string]int
+}
+
+type windowsFile struct {
+	vfs.File
+	fs     *windowsFS
+	closed bool
+}
+
+func (w *windowsFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	fp, err := w.OS.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	w.open[name]++
+	return &windowsFile{File: fp, fs: w}, nil
+}
+
+func (f *windowsFile) Close() error {
+	if !f.closed {
+		f.closed = true
+		f.fs.open[f.Name()]--
+	}
+	return f.File.Close()
+}
+
+func (w *windowsFS) Rename(oldpath, newpath string) error {
+	if w.open[oldpath] > 0 {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrPermission}
+	}
+	return w.OS.Rename(oldpath, newpath)
+}
+
+func TestSaveData2ClosesBeforeRename(t *testing.T) {
+	d := dir(t)
+	fsys := &windowsFS{open: map[string]int{}}
+	for _, o := range []fileio.Options{{FS: fsys}, {FS: fsys, VerifyAfterWrite: true, KeepVersions: 1}} {
+		if err := o.SaveData2(d, "f", []byte("data")); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.ReplaceIfMatches(d, "f", []byte("more"), []byte("data")); err != nil {
+			t.Fatal(err)
+		}
+		if b := mustRead(t, d+"f"); string(b) != "more" {
+			t.Errorf("content %q, want %q", b, "more")
+		}
+	}
+}
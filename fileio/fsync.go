@@ -0,0 +1,34 @@
+package fileio
+
+// FsyncMode decides which fsyncs a save makes.
+type FsyncMode int
+
+const (
+	// FsyncFull syncs the new file and then, after the rename, its parent
+	// directory, so the replacement survives a power loss. This is the
+	// zero value.
+	FsyncFull FsyncMode = iota
+	// FsyncFileOnly syncs the new file but not the directory. A crash
+	// right after the save may bring back the old file, but never a torn
+	// new one.
+	FsyncFileOnly
+	// FsyncNone makes no fsync at all and leaves durability to the kernel.
+	// A crash may leave the new file empty or partial under the target
+	// name (some file systems reorder the rename before the data). Only
+	// for scratch data that can be regenerated.
+	FsyncNone
+)
+
+// syncFile reports whether mode fsyncs the written file.
+func (m FsyncMode) syncFile() bool { return m != FsyncNone }
+
+// syncDir reports whether mode fsyncs the directory after the rename.
+func (m FsyncMode) syncDir() bool { return m == FsyncFull }
+
+// dirOf returns the directory a save into path writes to.
+func dirOf(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
@@ -0,0 +1,90 @@
+package fileio_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/fileio"
+)
+
+func TestSaveData2Syncs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directories are not synced on Windows")
+	}
+	for _, tc := range []struct {
+		mode fileio.FsyncMode
+		want []string // "file" or "dir", in order
+	}{
+		{fileio.FsyncFull, []string{"file", "dir"}},
+		{fileio.FsyncFileOnly, []string{"file"}},
+		{fileio.FsyncNone, nil},
+	} {
+		d := dir(t)
+		fsys := &dbtest.RecordingFS{}
+		if err := (fileio.Options{FS: fsys, Fsync: tc.mode}).SaveData2(d, "f", []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range fsys.Syncs() {
+			switch {
+			case s.Dir && s.Name == d:
+				got = append(got, "dir")
+			case !s.Dir && strings.HasPrefix(s.Name, d+"f.tmp."):
+				got = append(got, "file")
+			default:
+				got = append(got, s.Name)
+			}
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("Fsync %d: syncs %q, want %q", tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestSaveData2Crash(t *testing.T) {
+	before, after := payload(2000), payload(3000)[1000:]
+	setup := func(t *testing.T) string {
+		d := dir(t)
+		if err := fileio.SaveData2(d, "f", before); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	count := &dbtest.CrashFS{}
+	if err := (fileio.Options{FS: count}).SaveData2(setup(t), "f", after); err != nil {
+		t.Fatal(err)
+	}
+	for at := 1; at <= count.Calls(); at++ {
+		for seed := range uint64(4) {
+			d := setup(t)
+			fsys := &dbtest.CrashFS{CrashAt: at, Rand: rand.New(rand.NewPCG(seed, uint64(at)))}
+			err := fileio.Options{FS: fsys}.SaveData2(d, "f", after)
+			if !errors.Is(err, dbtest.ErrCrashed) {
+				t.Fatalf("crash at call %d: %v, want ErrCrashed", at, err)
+			}
+			b := mustRead(t, d+"f")
+			if !bytes.Equal(b, before) && !bytes.Equal(b, after) {
+				t.Errorf("crash at call %d, seed %d: file of %d bytes is neither the old content nor the new", at, seed, len(b))
+			}
+		}
+	}
+
+	// A crash once SaveData2 has returned keeps the new content.
+	d := setup(t)
+	fsys := &dbtest.CrashFS{}
+	if err := (fileio.Options{FS: fsys}).SaveData2(d, "f", after); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Crash(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mustRead(t, d+"f"), after) {
+		t.Error("a crash after SaveData2 returned lost the new content")
+	}
+}
@@ -0,0 +1,221 @@
+package fileio
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// largeChunk is how much SaveLargeFile copies between progress reports.
+const largeChunk = 1 << 20
+
+// SaveLargeFile streams r into path+file without holding it in memory, using
+// the same write-then-rename scheme as SaveData2. onProgress, if not nil, is
+// called after every chunk with the total number of bytes written so far.
+//
+// Unlike SaveData2, the temp file has a fixed name (file+".partial") and is
+// kept when the copy fails, so a retry can pick up where it stopped:
+//   - the bytes already in the partial file are skipped in r (by seeking
+//     when r is an io.Seeker, by discarding them otherwise), so the retry
+//     must supply the same stream from its start;
+//   - if r turns out to be shorter than the partial file, the partial file
+//     cannot belong to it; it is removed and ResumeErr is returned, and the
+//     next call starts from scratch.
+func SaveLargeFile(path, file string, r io.Reader, onProgress func(written int64)) error {
+	return Options{}.SaveLargeFileContext(context.Background(), path, file, r, onProgress)
+}
+
+// SaveLargeFileContext is SaveLargeFile stopping early when ctx is done.
+// ctx is checked before every read from r, so cancellation is noticed
+// mid-copy rather than only once r is drained (a single Read that blocks
+// forever still can't be interrupted). A cancelled copy removes the partial
+// file, since the caller gave up on it, and returns ctx.Err().
+func SaveLargeFileContext(ctx context.Context, path, file string, r io.Reader, onProgress func(written int64)) error {
+	return Options{}.SaveLargeFileContext(ctx, path, file, r, onProgress)
+}
+
+// SaveLargeFile is SaveLargeFile honouring the options in o.
+func (o Options) SaveLargeFile(path, file string, r io.Reader, onProgress func(written int64)) error {
+	return o.SaveLargeFileContext(context.Background(), path, file, r, onProgress)
+}
+
+// SaveLargeFileContext is SaveLargeFileContext honouring the options in o.
+func (o Options) SaveLargeFileContext(ctx context.Context, path, file string, r io.Reader, onProgress func(written int64)) error {
+	err := o.mkdir(path) // Ensure the directory exists
+	if err != nil {
+		return err
+	}
+	if err = o.checkSpace(path, 0); err != nil {
+		return err // the stream's size is unknown; just check the floor
+	}
+	partial := path + file + ".partial"
+
+	t := o.Latency.now()
+	// read-write (a resumed trailer re-reads the prefix), create if missing,
+	// but keep what a previous attempt wrote
+	fp, err := o.fs().OpenFile(partial, os.O_RDWR|os.O_CREATE, o.mode())
+	t = o.Latency.observe(OpOpen, t)
+	if err != nil {
+		return o.openErr(partial, err)
+	}
+	defer fp.Close()
+	if o.ExactMode {
+		if err = fp.Chmod(o.mode()); err != nil {
+			return wrapErr(ChmodErr, "chmod", partial, err)
+		}
+	}
+
+	written, err := resume(ctx, fp, r)
+	if errors.Is(err, ResumeErr) || ctx.Err() != nil {
+		fp.Close()
+		o.fs().Remove(partial)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if written > 0 && onProgress != nil {
+		onProgress(written)
+	}
+
+	// With a trailer, the CRC is computed as the data goes by rather than
+	// by reading the file back; only a resumed prefix has to be re-read.
+	var sum hash.Hash32
+	if o.Trailer {
+		sum = crc32.NewIEEE()
+		if written > 0 {
+			if err = hashPrefix(fp, sum, written); err != nil {
+				return err
+			}
+		}
+	}
+
+	cr := &ctxReader{ctx: ctx, r: r}
+	buf := make([]byte, largeChunk)
+	for {
+		n, rerr := io.ReadFull(cr, buf)
+		if n > 0 {
+			if _, err = fp.Write(buf[:n]); err != nil {
+				return wrapErr(WriteErr, "write", partial, err)
+			}
+			if sum != nil {
+				sum.Write(buf[:n])
+			}
+			written += int64(n)
+			if onProgress != nil {
+				onProgress(written)
+			}
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			if ctx.Err() != nil {
+				fp.Close()
+				o.fs().Remove(partial)
+				return ctx.Err()
+			}
+			return wrapErr(ReadErr, "read", "", rerr)
+		}
+	}
+	if sum != nil {
+		if _, err = fp.Write(appendTrailer(nil, uint64(written), sum.Sum32())); err != nil {
+			// The partial file now ends in (part of) a trailer, which a
+			// resume would mistake for data. Start over next time.
+			fp.Close()
+			o.fs().Remove(partial)
+			return wrapErr(WriteErr, "write", partial, err)
+		}
+	}
+	t = o.Latency.observe(OpWrite, t)
+	if o.Fsync.syncFile() {
+		err = fp.Sync() // Persist data
+		t = o.Latency.observe(OpSync, t)
+		if err != nil {
+			if sum != nil {
+				fp.Close() // as above: the trailer is written
+				o.fs().Remove(partial)
+			}
+			return wrapErr(SyncErr, "sync", partial, err)
+		}
+	}
+	// Windows will not rename a file that is still open.
+	if err = fp.Close(); err != nil {
+		return wrapErr(WriteErr, "close", partial, err)
+	}
+	err = o.renameReplace(partial, path+file)
+	t = o.Latency.observe(OpRename, t)
+	if err == nil && o.Fsync.syncDir() {
+		err = o.syncDir(dirOf(path))
+		o.Latency.observe(OpSyncDir, t)
+	}
+	return err
+}
+
+// resume positions fp after the bytes a previous attempt left in it and
+// advances r past the same number of bytes, returning that count.
+func resume(ctx context.Context, fp vfs.File, r io.Reader) (int64, error) {
+	fi, err := fp.Stat()
+	if err != nil {
+		return 0, wrapErr(OpenErr, "stat", fp.Name(), err)
+	}
+	n := fi.Size()
+	if n == 0 {
+		return 0, nil
+	}
+	if s, ok := r.(io.Seeker); ok {
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, wrapErr(ReadErr, "seek", "", err)
+		}
+		if end < n {
+			return 0, wrapErr(ResumeErr, "resume", fp.Name(), nil)
+		}
+		if _, err = s.Seek(n, io.SeekStart); err != nil {
+			return 0, wrapErr(ReadErr, "seek", "", err)
+		}
+	} else {
+		skipped, err := io.CopyN(io.Discard, &ctxReader{ctx: ctx, r: r}, n)
+		if skipped < n {
+			return 0, wrapErr(ResumeErr, "resume", fp.Name(), nil)
+		}
+		if err != nil {
+			return 0, wrapErr(ReadErr, "read", "", err)
+		}
+	}
+	if _, err = fp.Seek(n, io.SeekStart); err != nil {
+		return 0, wrapErr(WriteErr, "seek", fp.Name(), err)
+	}
+	return n, nil
+}
+
+// hashPrefix feeds the first n bytes of fp to h, leaving fp at offset n.
+func hashPrefix(fp vfs.File, h hash.Hash, n int64) error {
+	if _, err := fp.Seek(0, io.SeekStart); err != nil {
+		return wrapErr(ReadErr, "seek", fp.Name(), err)
+	}
+	if _, err := io.CopyN(h, fp, n); err != nil {
+		return wrapErr(ReadErr, "read", fp.Name(), err)
+	}
+	return nil
+}
+
+// ctxReader fails reads once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,224 @@
+package fileio_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math/rand/v2"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/fileio"
+)
+
+// payload returns n bytes of deterministic noise.
+func payload(n int) []byte {
+	b := make([]byte, n)
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := range b {
+		b[i] = byte(r.Uint32())
+	}
+	return b
+}
+
+// onlyReader hides every method of its reader but Read, Seek included.
+type onlyReader struct{ r io.Reader }
+
+func (o onlyReader) Read(p []byte) (int, error) { return o.r.Read(p) }
+
+// failingReader fails with errStream once it has read n bytes of r.
+type failingReader struct {
+	r io.Reader
+	n int
+}
+
+var errStream = errors.New("stream broke")
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, errStream
+	}
+	n, err := f.r.Read(p[:min(len(p), f.n)])
+	f.n -= n
+	return n, err
+}
+
+func TestSaveLargeFileProgress(t *testing.T) {
+	d := dir(t)
+	data := payload(3<<20 + 12345)
+	var reports []int64
+	err := fileio.SaveLargeFile(d, "big", onlyReader{bytes.NewReader(data)}, func(n int64) {
+		reports = append(reports, n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) < 4 {
+		t.Fatalf("%d progress reports for a stream of four chunks", len(reports))
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i] <= reports[i-1] {
+			t.Fatalf("progress went from %d to %d", reports[i-1], reports[i])
+		}
+	}
+	if last := reports[len(reports)-1]; last != int64(len(data)) {
+		t.Errorf("last report %d, want %d", last, len(data))
+	}
+	if !bytes.Equal(mustRead(t, d+"big"), data) {
+		t.Error("content differs from the stream")
+	}
+	if _, err = os.Stat(d + "big.partial"); !os.IsNotExist(err) {
+		t.Errorf("partial file left behind: %v", err)
+	}
+}
+
+func TestSaveLargeFileResume(t *testing.T) {
+	for name, wrap := range map[string]func([]byte) io.Reader{
+		"seeker":  func(b []byte) io.Reader { return bytes.NewReader(b) },
+		"discard": func(b []byte) io.Reader { return onlyReader{bytes.NewReader(b)} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			d := dir(t)
+			data := payload(3 << 20)
+			const cut = 2 << 20
+			err := fileio.SaveLargeFile(d, "big", &failingReader{r: bytes.NewReader(data), n: cut}, nil)
+			if !errors.Is(err, errStream) || !errors.Is(err, fileio.ReadErr) {
+				t.Fatalf("broken stream: %v, want a ReadErr", err)
+			}
+			if fi, err := os.Stat(d + "big.partial"); err != nil || fi.Size() != cut {
+				t.Fatalf("partial file after the break: %v, %v; want %d bytes", fi, err, cut)
+			}
+
+			var first int64 = -1
+			err = fileio.SaveLargeFile(d, "big", wrap(data), func(n int64) {
+				if first < 0 {
+					first = n
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first != cut {
+				t.Errorf("retry first reported %d bytes, want the %d resumed", first, cut)
+			}
+			if !bytes.Equal(mustRead(t, d+"big"), data) {
+				t.Error("resumed content differs from the stream")
+			}
+		})
+	}
+}
+
+func TestSaveLargeFileShorterStream(t *testing.T) {
+	d := dir(t)
+	if err := os.WriteFile(d+"big.partial", payload(100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := fileio.SaveLargeFile(d, "big", bytes.NewReader(payload(50)), nil)
+	if !errors.Is(err, fileio.ResumeErr) {
+		t.Fatalf("stream shorter than the partial file: %v, want ResumeErr", err)
+	}
+	if _, err = os.Stat(d + "big.partial"); !os.IsNotExist(err) {
+		t.Errorf("partial file kept after ResumeErr: %v", err)
+	}
+	if err = fileio.SaveLargeFile(d, "big", bytes.NewReader(payload(50)), nil); err != nil {
+		t.Fatalf("retry from scratch: %v", err)
+	}
+	if !bytes.Equal(mustRead(t, d+"big"), payload(50)) {
+		t.Error("content differs from the stream")
+	}
+}
+
+// slowReader hands out a small chunk of zeros per Read, slowly, and calls
+// after once it has handed out n bytes.
+type slowReader struct {
+	n     int
+	after func()
+}
+
+func (s *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	n := min(len(p), 4096)
+	if s.n -= n; s.n <= 0 && s.after != nil {
+		s.after()
+		s.after = nil
+	}
+	return n, nil
+}
+
+func TestSaveLargeFileCancel(t *testing.T) {
+	d := dir(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// An endless stream: only the cancellation can end the copy.
+	r := &slowReader{n: 64 << 10, after: cancel}
+	done := make(chan error, 1)
+	go func() { done <- fileio.SaveLargeFileContext(ctx, d, "big", r, nil) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("cancelled copy: %v, want context.Canceled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("SaveLargeFileContext did not return after the cancellation")
+	}
+	entries, _ := os.ReadDir(d)
+	if len(entries) != 0 {
+		t.Errorf("directory holds %v after a cancelled copy, want nothing", entries)
+	}
+}
+
+func TestSaveLargeFileTrailer(t *testing.T) {
+	d := dir(t)
+	data := payload(5<<20/2 + 7)
+	o := fileio.Options{Trailer: true}
+	if err := o.SaveLargeFile(d, "big", onlyReader{bytes.NewReader(data)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	raw := mustRead(t, d+"big")
+	if len(raw) != len(data)+16 || !bytes.Equal(raw[:len(data)], data) {
+		t.Fatalf("file of %d bytes, want the %d of the stream and a trailer", len(raw), len(data))
+	}
+	tr := raw[len(data):]
+	if n := binary.LittleEndian.Uint64(tr); n != uint64(len(data)) {
+		t.Errorf("trailer length %d, want %d", n, len(data))
+	}
+	if sum, want := binary.LittleEndian.Uint32(tr[8:]), crc32.ChecksumIEEE(data); sum != want {
+		t.Errorf("trailer CRC %08x, want %08x", sum, want)
+	}
+	if b, err := fileio.LoadDataVerified(d, "big"); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("LoadDataVerified: %d bytes, %v", len(b), err)
+	}
+
+	// A resumed copy hashes the prefix it finds on disk.
+	err := o.SaveLargeFile(d, "resumed", &failingReader{r: bytes.NewReader(data), n: 1 << 20}, nil)
+	if !errors.Is(err, errStream) {
+		t.Fatalf("broken stream: %v", err)
+	}
+	if err = o.SaveLargeFile(d, "resumed", bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := fileio.LoadDataVerified(d, "resumed"); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("resumed: LoadDataVerified: %d bytes, %v", len(b), err)
+	}
+}
+
+func TestSaveLargeFileTrailerWriteFails(t *testing.T) {
+	d := dir(t)
+	// Three chunks of the stream, then the trailer.
+	fsys := &dbtest.FaultyFS{FailAt: map[dbtest.Op]int{dbtest.OpWrite: 4}}
+	o := fileio.Options{FS: fsys, Trailer: true}
+	err := o.SaveLargeFile(d, "big", bytes.NewReader(payload(5<<20/2)), nil)
+	var e *fileio.Error
+	if !errors.As(err, &e) || e.Kind != fileio.WriteErr || e.Op != "write" {
+		t.Fatalf("failed trailer write: %v, want a WriteErr of write", err)
+	}
+	entries, _ := os.ReadDir(d)
+	if len(entries) != 0 {
+		t.Errorf("directory holds %v, want the partial file removed", entries)
+	}
+}
@@ -0,0 +1,127 @@
+package fileio
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LatencyOp names a step of a save that Latency times.
+type LatencyOp int
+
+const (
+	OpOpen LatencyOp = iota
+	OpWrite
+	OpSync
+	OpRename
+	OpSyncDir
+	numLatencyOps
+)
+
+func (op LatencyOp) String() string {
+	switch op {
+	case OpOpen:
+		return "open"
+	case OpWrite:
+		return "write"
+	case OpSync:
+		return "sync"
+	case OpRename:
+		return "rename"
+	case OpSyncDir:
+		return "syncdir"
+	}
+	return "unknown"
+}
+
+// Bucket bounds grow by powers of two from 1µs; the last bucket takes
+// everything slower than 2^(numBuckets-2)µs (about 67s).
+const numBuckets = 28
+
+// bucketBound is the inclusive upper bound of bucket i.
+func bucketBound(i int) time.Duration {
+	if i == numBuckets-1 {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Microsecond << i
+}
+
+// Latency is a set of fixed-bucket histograms, one per LatencyOp. It is
+// safe for concurrent use, so one Latency can be shared by every Options
+// value writing to the same disk.
+type Latency struct {
+	ops [numLatencyOps]Recorder
+}
+
+// Recorder is a fixed-bucket histogram of durations, the kind Latency keeps
+// per step, for timing anything else. Its zero value is empty and ready to
+// use, and it is safe for concurrent use.
+type Recorder struct {
+	counts [numBuckets]atomic.Uint64
+	sum    atomic.Int64
+}
+
+// Observe records a sample of d.
+func (r *Recorder) Observe(d time.Duration) {
+	i := 0
+	for i < numBuckets-1 && d > bucketBound(i) {
+		i++
+	}
+	r.counts[i].Add(1)
+	r.sum.Add(int64(d))
+}
+
+// Histogram returns a copy of the samples recorded so far.
+func (r *Recorder) Histogram() Histogram {
+	h := Histogram{Sum: time.Duration(r.sum.Load())}
+	h.Buckets = make([]Bucket, numBuckets)
+	for i := range h.Buckets {
+		n := r.counts[i].Load()
+		h.Buckets[i] = Bucket{Le: bucketBound(i), Count: n}
+		h.Count += n
+	}
+	return h
+}
+
+// Bucket counts the samples no slower than Le (and slower than the
+// previous bucket's bound).
+type Bucket struct {
+	Le    time.Duration
+	Count uint64
+}
+
+// Histogram is a point-in-time copy of the samples of a Recorder, such as
+// those of one LatencyOp.
+type Histogram struct {
+	Count   uint64
+	Sum     time.Duration
+	Buckets []Bucket
+}
+
+// LatencyStats returns a snapshot of every histogram, keyed by step.
+func (l *Latency) LatencyStats() map[LatencyOp]Histogram {
+	stats := make(map[LatencyOp]Histogram, numLatencyOps)
+	for op := LatencyOp(0); op < numLatencyOps; op++ {
+		stats[op] = l.ops[op].Histogram()
+	}
+	return stats
+}
+
+// now returns the current time, or the zero time when timing is off so
+// that a nil Latency costs nothing but the nil check.
+func (l *Latency) now() time.Time {
+	if l == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// observe records the time elapsed since start under op and returns the
+// current time, ready to start timing the next step.
+func (l *Latency) observe(op LatencyOp, start time.Time) time.Time {
+	if l == nil {
+		return start
+	}
+	end := time.Now()
+	l.ops[op].Observe(end.Sub(start))
+	return end
+}
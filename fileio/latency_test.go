@@ -0,0 +1,76 @@
+package fileio_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/fileio"
+)
+
+func TestLatency(t *testing.T) {
+	d := dir(t)
+	lat := new(fileio.Latency)
+	o := fileio.Options{Latency: lat}
+	const saves = 3
+	for range saves {
+		if err := o.SaveData2(d, "f", []byte("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := lat.LatencyStats()
+	for _, op := range []fileio.LatencyOp{fileio.OpOpen, fileio.OpWrite, fileio.OpSync, fileio.OpRename, fileio.OpSyncDir} {
+		h := stats[op]
+		if h.Count != saves {
+			t.Errorf("%v: %d samples, want %d", op, h.Count, saves)
+		}
+		var n uint64
+		for _, b := range h.Buckets {
+			n += b.Count
+		}
+		if n != h.Count {
+			t.Errorf("%v: buckets hold %d samples, Count says %d", op, n, h.Count)
+		}
+	}
+}
+
+func TestRecorderBuckets(t *testing.T) {
+	var r fileio.Recorder
+	r.Observe(500 * time.Nanosecond)
+	r.Observe(3 * time.Microsecond)
+	r.Observe(time.Hour)
+	h := r.Histogram()
+	if h.Count != 3 || h.Sum != time.Hour+3500*time.Nanosecond {
+		t.Fatalf("Count %d, Sum %v", h.Count, h.Sum)
+	}
+	want := map[time.Duration]uint64{time.Microsecond: 1, 4 * time.Microsecond: 1}
+	for i, b := range h.Buckets {
+		if i > 0 && b.Le <= h.Buckets[i-1].Le {
+			t.Errorf("bucket %d bound %v not above the previous one", i, b.Le)
+		}
+		if i == len(h.Buckets)-1 {
+			if b.Count != 1 {
+				t.Errorf("last bucket has %d samples, want the hour", b.Count)
+			}
+		} else if b.Count != want[b.Le] {
+			t.Errorf("bucket ≤%v has %d samples, want %d", b.Le, b.Count, want[b.Le])
+		}
+	}
+}
+
+func BenchmarkSaveData2Latency(b *testing.B) {
+	data := make([]byte, 4096)
+	for _, bc := range []struct {
+		name string
+		lat  *fileio.Latency
+	}{{"off", nil}, {"on", new(fileio.Latency)}} {
+		b.Run(bc.name, func(b *testing.B) {
+			d := b.TempDir() + "/"
+			o := fileio.Options{Latency: bc.lat, Fsync: fileio.FsyncNone}
+			for b.Loop() {
+				if err := o.SaveData2(d, "f", data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
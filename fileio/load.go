@@ -0,0 +1,83 @@
+package fileio
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// LoadData reads back what SaveData1 or SaveData2 stored at path+file.
+//
+// A name that does not exist yields NotFoundErr and one that resolves to a
+// directory yields ErrIsDirectory, so callers can tell "nothing saved yet"
+// and "wrong path" apart from a genuine read failure (ReadErr).
+func LoadData(path, file string) ([]byte, error) {
+	return Options{}.LoadData(path, file)
+}
+
+// LoadData is LoadData honouring the options in o.
+func (o Options) LoadData(path, file string) ([]byte, error) {
+	fi, err := o.fs().Stat(path + file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, wrapErr(NotFoundErr, "stat", path+file, err)
+	}
+	if err != nil {
+		return nil, wrapErr(ReadErr, "stat", path+file, err)
+	}
+	if fi.IsDir() {
+		return nil, wrapErr(ErrIsDirectory, "stat", path+file, nil)
+	}
+	data, err := o.readFile(path + file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, wrapErr(NotFoundErr, "open", path+file, err) // removed since the Stat
+	}
+	if err != nil {
+		return nil, wrapErr(ReadErr, "read", path+file, err)
+	}
+	return data, nil
+}
+
+// readFile is os.ReadFile, opening with O_NOATIME when o.NoAtime asks for it.
+func (o Options) readFile(name string) ([]byte, error) {
+	if !o.NoAtime || oNoAtime == 0 {
+		return vfs.ReadFile(o.fs(), name)
+	}
+	fp, err := o.fs().OpenFile(name, os.O_RDONLY|oNoAtime, 0)
+	if errors.Is(err, fs.ErrPermission) {
+		// Only the owner (or CAP_FOWNER) may pass O_NOATIME.
+		fp, err = o.fs().OpenFile(name, os.O_RDONLY, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return io.ReadAll(fp)
+}
+
+// LoadDataFS is LoadData reading name from fsys instead of the operating
+// system, so data can be served from an embed.FS, an fstest.MapFS or any
+// other read-only file system. name follows io/fs rules: slash-separated
+// and unrooted. Writing still needs the real file system (SaveData1/2).
+func LoadDataFS(fsys fs.FS, name string) ([]byte, error) {
+	fi, err := fs.Stat(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, wrapErr(NotFoundErr, "stat", name, err)
+	}
+	if err != nil {
+		return nil, wrapErr(ReadErr, "stat", name, err)
+	}
+	if fi.IsDir() {
+		return nil, wrapErr(ErrIsDirectory, "stat", name, nil)
+	}
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, wrapErr(NotFoundErr, "open", name, err)
+	}
+	if err != nil {
+		return nil, wrapErr(ReadErr, "read", name, err)
+	}
+	return data, nil
+}
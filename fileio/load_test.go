@@ -0,0 +1,53 @@
+package fileio_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/adcondev/go-database/fileio"
+)
+
+func TestLoadData(t *testing.T) {
+	d := dir(t)
+	if err := os.Mkdir(d+"sub", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileio.SaveData2(d, "f", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := fileio.LoadData(d, "f"); err != nil || string(b) != "data" {
+		t.Errorf("LoadData = %q, %v", b, err)
+	}
+	if _, err := fileio.LoadData(d, "missing"); !errors.Is(err, fileio.NotFoundErr) {
+		t.Errorf("missing file: %v, want NotFoundErr", err)
+	}
+	_, err := fileio.LoadData(d, "sub")
+	if !errors.Is(err, fileio.ErrIsDirectory) {
+		t.Errorf("directory: %v, want ErrIsDirectory", err)
+	}
+	if errors.Is(err, fileio.ReadErr) || errors.Is(err, fileio.NotFoundErr) {
+		t.Errorf("directory error %v also matches a read or not-found error", err)
+	}
+}
+
+func TestLoadDataFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"keys/a":   {Data: []byte("alpha")},
+		"keys/b":   {Data: []byte("beta")},
+		"keys/sub": {Mode: fs.ModeDir},
+	}
+	for name, want := range map[string]string{"keys/a": "alpha", "keys/b": "beta"} {
+		if b, err := fileio.LoadDataFS(fsys, name); err != nil || string(b) != want {
+			t.Errorf("LoadDataFS(%q) = %q, %v; want %q", name, b, err, want)
+		}
+	}
+	if _, err := fileio.LoadDataFS(fsys, "keys/c"); !errors.Is(err, fileio.NotFoundErr) {
+		t.Errorf("missing key: %v, want NotFoundErr", err)
+	}
+	if _, err := fileio.LoadDataFS(fsys, "keys/sub"); !errors.Is(err, fileio.ErrIsDirectory) {
+		t.Errorf("directory: %v, want ErrIsDirectory", err)
+	}
+}
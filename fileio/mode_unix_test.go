@@ -0,0 +1,42 @@
+//go:build unix
+
+package fileio_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/adcondev/go-database/fileio"
+)
+
+func TestExactModeUnderUmask(t *testing.T) {
+	defer syscall.Umask(syscall.Umask(0077))
+	d := dir(t)
+	for _, tc := range []struct {
+		file  string
+		exact bool
+		want  os.FileMode
+	}{
+		{"masked", false, 0600},
+		{"exact", true, 0664},
+	} {
+		o := fileio.Options{Mode: 0664, ExactMode: tc.exact}
+		for name, save := range map[string]func(path, file string, data []byte) error{
+			"SaveData1": o.SaveData1,
+			"SaveData2": o.SaveData2,
+		} {
+			file := name + "-" + tc.file
+			if err := save(d, file, []byte("x")); err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(d + file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != tc.want {
+				t.Errorf("%s with umask 077, ExactMode %v: mode %v, want %v", name, tc.exact, fi.Mode().Perm(), tc.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build linux
+
+package fileio
+
+import "syscall"
+
+// oNoAtime stops reads from updating the file's access time.
+const oNoAtime = syscall.O_NOATIME
@@ -0,0 +1,41 @@
+package fileio_test
+
+import (
+	"io/fs"
+	"syscall"
+	"testing"
+
+	"github.com/adcondev/go-database/fileio"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// flagFS remembers the flags of the opens made through it.
+type flagFS struct {
+	vfs.OS
+	flags []int
+}
+
+func (f *flagFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	f.flags = append(f.flags, flag)
+	return f.OS.OpenFile(name, flag, perm)
+}
+
+func TestLoadDataNoAtime(t *testing.T) {
+	d := dir(t)
+	if err := fileio.SaveData2(d, "f", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	for _, noAtime := range []bool{false, true} {
+		fsys := &flagFS{}
+		b, err := fileio.Options{FS: fsys, NoAtime: noAtime}.LoadData(d, "f")
+		if err != nil || string(b) != "data" {
+			t.Fatalf("NoAtime %v: LoadData = %q, %v", noAtime, b, err)
+		}
+		if len(fsys.flags) == 0 {
+			t.Fatalf("NoAtime %v: no open seen", noAtime)
+		}
+		if got := fsys.flags[0]&syscall.O_NOATIME != 0; got != noAtime {
+			t.Errorf("NoAtime %v: the open passed O_NOATIME: %v", noAtime, got)
+		}
+	}
+}
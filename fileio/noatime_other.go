@@ -0,0 +1,6 @@
+//go:build !linux
+
+package fileio
+
+// oNoAtime is Linux-only; elsewhere reads open files normally.
+const oNoAtime = 0
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package fileio
+
+// oNoFollow is unavailable here; only the Lstat check guards the open.
+const oNoFollow = 0
@@ -0,0 +1,8 @@
+//go:build unix
+
+package fileio
+
+import "syscall"
+
+// oNoFollow makes open fail when the final path component is a symlink.
+const oNoFollow = syscall.O_NOFOLLOW
@@ -0,0 +1,188 @@
+package fileio
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// Options tunes the save functions. The zero value behaves exactly like the
+// package-level SaveData1 and SaveData2.
+type Options struct {
+	// FS is the file system every save and load goes through; nil means
+	// the real one (vfs.OS). Tests swap in the wrappers from package dbtest
+	// to inject faults.
+	FS vfs.FileSystem
+
+	// NoFollow makes SaveData1 refuse to write through a symlink sitting at
+	// the target path, returning ErrSymlink instead of truncating whatever
+	// the link points to. SaveData2 never follows the target: the rename
+	// replaces the link itself.
+	NoFollow bool
+
+	// SkipIfUnchanged makes SaveData2 read the current file first and skip
+	// the whole write, fsync and rename when it already holds data. This
+	// trades a read for the write, so it only pays off for writers that
+	// mostly rewrite the same content (config reconcilers and the like).
+	SkipIfUnchanged bool
+
+	// VerifyAfterWrite makes SaveData2 read the synced temp file back and
+	// compare it with data before renaming it into place, failing with
+	// ErrVerifyFailed (and leaving the old file untouched) on a mismatch.
+	// The read is usually served from the page cache, so this catches a
+	// misbehaving write path rather than bad media.
+	VerifyAfterWrite bool
+
+	// Mode is the permission requested for newly created files; zero means
+	// 0664. The process umask still masks it unless ExactMode is set.
+	Mode os.FileMode
+
+	// ExactMode chmods newly created files to exactly Mode after opening
+	// them, overriding the umask. The umask is usually how an administrator
+	// keeps files from being group or world writable, so only set this when
+	// Mode is itself the policy. Files being replaced keep their own mode.
+	ExactMode bool
+
+	// KeepVersions makes SaveData2 keep up to this many previous contents of
+	// the file as file.v1 (newest) to file.vN (oldest); see LoadVersion.
+	// The versions move only once the new content is in place, so a failed
+	// save leaves them as they were.
+	KeepVersions int
+
+	// WriteTimeout bounds how long SaveData2 waits for the write and fsync
+	// of its temp file; past it SaveData2 removes the temp file and returns
+	// ErrTimeout, leaving the old file in place. The write itself cannot be
+	// interrupted: a hung fsync keeps its goroutine (and file descriptor)
+	// blocked in the kernel until the disk answers. Zero means no limit.
+	WriteTimeout time.Duration
+
+	// NoAtime opens files read by LoadData with O_NOATIME on Linux, so
+	// reads don't turn into access-time writes on file systems mounted
+	// without relatime. It needs to own the file; when it doesn't, and on
+	// other systems, the read silently goes ahead without the flag.
+	NoAtime bool
+
+	// MinFreeBytes makes the save functions fail fast with ErrDiskFull when
+	// writing would leave less than this many bytes free on the target file
+	// system, instead of running into ENOSPC halfway through (and starving
+	// everything else on the disk). Zero disables the check.
+	MinFreeBytes int64
+
+	// FreeSpace reports the bytes available in dir for the MinFreeBytes
+	// check. Nil means asking the operating system (statfs and friends).
+	// When it fails the check is skipped rather than blocking the write.
+	FreeSpace func(dir string) (int64, error)
+
+	// AssumeDirExists skips the MkdirAll every save does before writing,
+	// saving its syscalls when the directory is known to be there. If it
+	// is not, the save fails with ErrDirNotExist.
+	AssumeDirExists bool
+
+	// Trailer makes SaveData1, SaveData2 and SaveLargeFile append a
+	// length + CRC32 trailer after the data, for LoadDataVerified to check
+	// and strip.
+	Trailer bool
+
+	// TempConflict decides what SaveData2 does when its temp file name is
+	// already taken. The zero value, TempFail, fails the save.
+	TempConflict TempConflictPolicy
+
+	// StampFunc generates the suffix of SaveData2's temp file names
+	// (file.tmp.<stamp>). Nil means RandomStamp. Tests can plug in a counter
+	// for predictable names; distributed callers a node-unique ID.
+	StampFunc func() string
+
+	// AllowNoTrailer makes LoadDataVerified return files that carry no
+	// trailer as they are, instead of failing with ErrNoTrailer.
+	AllowNoTrailer bool
+
+	// Latency, when set, records how long each open, write, sync, rename
+	// and directory sync took. Leave it nil to skip timing altogether.
+	Latency *Latency
+
+	// Fsync decides which fsyncs SaveData2 and SaveLargeFile make. The
+	// zero value, FsyncFull, syncs the file and its directory.
+	Fsync FsyncMode
+
+	// precondition, if set, runs right before SaveData2's rename; an error
+	// aborts the save. See ReplaceIfMatches.
+	precondition func() error
+
+	// reserve makes SaveData2 preallocate the temp file before writing.
+	// See SaveDataIfSpace.
+	reserve bool
+}
+
+// mode returns the permission bits for newly created files.
+func (o Options) mode() os.FileMode {
+	if o.Mode == 0 {
+		return 0664
+	}
+	return o.Mode.Perm()
+}
+
+// fs returns the file system to use.
+func (o Options) fs() vfs.FileSystem {
+	if o.FS == nil {
+		return vfs.OS{}
+	}
+	return o.FS
+}
+
+// checkSpace returns ErrDiskFull if writing n more bytes into dir would
+// leave less than o.MinFreeBytes free.
+func (o Options) checkSpace(dir string, n int64) error {
+	if o.MinFreeBytes <= 0 {
+		return nil
+	}
+	free := o.FreeSpace
+	if free == nil {
+		free = freeSpace
+	}
+	avail, err := free(dir)
+	if err != nil {
+		return nil
+	}
+	if avail-n < o.MinFreeBytes {
+		return wrapErr(ErrDiskFull, "statfs", dir, nil)
+	}
+	return nil
+}
+
+// withTimeout runs fn, the write of the file name, giving up on it after
+// o.WriteTimeout if one is set.
+func (o Options) withTimeout(name string, fn func() error) error {
+	if o.WriteTimeout <= 0 {
+		return fn()
+	}
+	done := make(chan error, 1) // buffered: an abandoned fn must not leak blocked on send
+	go func() { done <- fn() }()
+	timer := time.NewTimer(o.WriteTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return wrapErr(ErrTimeout, "write", name, nil)
+	}
+}
+
+// isSymlink reports whether name exists and is a symbolic link.
+func (o Options) isSymlink(name string) bool {
+	fi, err := o.fs().Lstat(name)
+	return err == nil && fi.Mode()&os.ModeSymlink != 0
+}
+
+// verifyFile checks that name holds exactly data.
+func (o Options) verifyFile(name string, data []byte) error {
+	got, err := vfs.ReadFile(o.fs(), name)
+	if err != nil {
+		return wrapErr(ReadErr, "read", name, err)
+	}
+	if !bytes.Equal(got, data) {
+		return wrapErr(ErrVerifyFailed, "verify", name, nil)
+	}
+	return nil
+}
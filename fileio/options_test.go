@@ -0,0 +1,109 @@
+package fileio_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/adcondev/go-database/fileio"
+	"github.com/adcondev/go-database/vfs"
+)
+
+func TestMinFreeBytes(t *testing.T) {
+	d := dir(t)
+	var asked []string
+	o := fileio.Options{
+		MinFreeBytes: 1000,
+		FreeSpace: func(dir string) (int64, error) {
+			asked = append(asked, dir)
+			return 1500, nil
+		},
+	}
+	if err := o.SaveData2(d, "small", make([]byte, 400)); err != nil {
+		t.Fatalf("save leaving 1100 bytes free: %v", err)
+	}
+	if len(asked) != 1 || asked[0] != d {
+		t.Errorf("free space asked of %q, want %q", asked, d)
+	}
+	for name, save := range map[string]func(path, file string, data []byte) error{
+		"SaveData1": o.SaveData1,
+		"SaveData2": o.SaveData2,
+	} {
+		if err := save(d, "big", make([]byte, 600)); !errors.Is(err, fileio.ErrDiskFull) {
+			t.Errorf("%s leaving 900 bytes free: %v, want ErrDiskFull", name, err)
+		}
+	}
+	if _, err := os.Stat(d + "big"); !os.IsNotExist(err) {
+		t.Errorf("a refused save created the file: %v", err)
+	}
+	err := o.SaveLargeFile(d, "stream", bytes.NewReader(nil), nil)
+	if err != nil {
+		t.Errorf("SaveLargeFile above the floor: %v", err)
+	}
+
+	// A failing report skips the check rather than blocking the write.
+	o.FreeSpace = func(string) (int64, error) { return 0, errors.New("no statfs") }
+	if err := o.SaveData2(d, "big", make([]byte, 600)); err != nil {
+		t.Errorf("save with no free-space report: %v", err)
+	}
+}
+
+func TestMinFreeBytesOS(t *testing.T) {
+	if !slices.Contains([]string{"linux", "darwin", "freebsd", "dragonfly", "windows"}, runtime.GOOS) {
+		t.Skip("free space is not read on", runtime.GOOS)
+	}
+	// No disk has this much to spare.
+	err := fileio.Options{MinFreeBytes: 1 << 62}.SaveData2(dir(t), "f", []byte("x"))
+	if !errors.Is(err, fileio.ErrDiskFull) {
+		t.Errorf("SaveData2 with an impossible MinFreeBytes: %v, want ErrDiskFull", err)
+	}
+}
+
+func TestAssumeDirExists(t *testing.T) {
+	d := dir(t)
+	o := fileio.Options{AssumeDirExists: true}
+	for name, save := range map[string]func(path, file string, data []byte) error{
+		"SaveData1": o.SaveData1,
+		"SaveData2": o.SaveData2,
+	} {
+		err := save(d+"missing/", "f", []byte("x"))
+		if !errors.Is(err, fileio.ErrDirNotExist) {
+			t.Errorf("%s into a missing directory: %v, want ErrDirNotExist", name, err)
+		}
+		if err = save(d, "f", []byte("x")); err != nil {
+			t.Errorf("%s into an existing directory: %v", name, err)
+		}
+	}
+}
+
+// mkdirFS counts the MkdirAll calls made through it.
+type mkdirFS struct {
+	vfs.OS
+	mkdirs int
+}
+
+func (m *mkdirFS) MkdirAll(path string, perm fs.FileMode) error {
+	m.mkdirs++
+	return m.OS.MkdirAll(path, perm)
+}
+
+func BenchmarkAssumeDirExists(b *testing.B) {
+	for _, assume := range []bool{false, true} {
+		b.Run(fmt.Sprint("assume=", assume), func(b *testing.B) {
+			d := b.TempDir() + "/"
+			fsys := &mkdirFS{}
+			o := fileio.Options{FS: fsys, AssumeDirExists: assume, Fsync: fileio.FsyncNone}
+			for b.Loop() {
+				if err := o.SaveData2(d, "f", []byte("data")); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(fsys.mkdirs)/float64(b.N), "mkdirs/op")
+		})
+	}
+}
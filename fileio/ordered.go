@@ -0,0 +1,97 @@
+package fileio
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// SaveOp is one write for SaveOrdered.
+type SaveOp struct {
+	Path, File string
+	Data       []byte
+}
+
+// SaveOrdered performs ops one after another with SaveData2, and makes each
+// one fully durable (file and directory entry) before starting the next.
+// Use it when a later file refers to an earlier one: after a crash the later
+// file is never visible without the earlier one. It stops at the first
+// failing op; ops before it are durable, ops after it were not attempted.
+func SaveOrdered(ops []SaveOp) error {
+	return Options{}.SaveOrdered(ops)
+}
+
+// SaveOrdered is SaveOrdered honouring the options in o.
+// The ordering is the point, so o.Fsync is ignored: every op is fully synced.
+func (o Options) SaveOrdered(ops []SaveOp) error {
+	o.Fsync = FsyncFull
+	for _, op := range ops {
+		if err := o.SaveData2(op.Path, op.File, op.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncDir fsyncs the directory at path, persisting the renames and new
+// entries made in it. It does nothing on Windows, where directories cannot
+// be synced.
+func SyncDir(path string) error {
+	return Options{}.syncDir(path)
+}
+
+// SyncDir is SyncDir honouring the options in o.
+func (o Options) SyncDir(path string) error {
+	return o.syncDir(path)
+}
+
+// syncDir fsyncs the directory at path, persisting renames and new entries.
+// It does nothing where directories cannot be synced (Windows).
+func (o Options) syncDir(path string) error {
+	if !canSyncDir {
+		return nil
+	}
+	dir, err := o.fs().OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return wrapErr(OpenErr, "open", path, err)
+	}
+	defer dir.Close()
+	if err = dir.Sync(); err != nil {
+		return wrapErr(SyncErr, "sync", path, err)
+	}
+	return nil
+}
+
+// SyncTree fsyncs every directory under root, root included, deepest first,
+// so that after a bulk import into nested directories every entry, and the
+// entry of every directory in its parent, survives a crash. Files are not
+// synced: the code that wrote them should have done that already.
+func SyncTree(root string) error {
+	return Options{}.SyncTree(root)
+}
+
+// SyncTree is SyncTree honouring the options in o. The tree is listed from
+// the real file system; only the syncs themselves go through o.FS.
+func (o Options) SyncTree(root string) error {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapErr(ReadErr, "walk", root, err)
+	}
+	// WalkDir lists a directory before its children; syncing in reverse
+	// settles every child before the parent that names it.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err = o.syncDir(dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package fileio_test
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/fileio"
+)
+
+func TestSaveOrderedCrash(t *testing.T) {
+	a, b := payload(3000), []byte("refers to a")
+	ops := func(d string) []fileio.SaveOp {
+		return []fileio.SaveOp{{Path: d, File: "a", Data: a}, {Path: d, File: "b", Data: b}}
+	}
+
+	// Count the calls of a run without crashing, then crash at each one.
+	count := &dbtest.CrashFS{}
+	if err := (fileio.Options{FS: count}).SaveOrdered(ops(dir(t))); err != nil {
+		t.Fatal(err)
+	}
+	for at := 1; at <= count.Calls(); at++ {
+		d := dir(t)
+		fsys := &dbtest.CrashFS{CrashAt: at, Rand: rand.New(rand.NewPCG(uint64(at), 0))}
+		if err := (fileio.Options{FS: fsys}).SaveOrdered(ops(d)); err == nil {
+			t.Fatalf("crash at call %d: SaveOrdered did not fail", at)
+		}
+		gotB, errB := fileio.LoadData(d, "b")
+		if errB != nil {
+			continue // b never made it: nothing to check
+		}
+		if !bytes.Equal(gotB, b) {
+			t.Errorf("crash at call %d: b visible with %q", at, gotB)
+		}
+		if gotA, err := fileio.LoadData(d, "a"); err != nil || !bytes.Equal(gotA, a) {
+			t.Errorf("crash at call %d: b is there but a is not, whole (%d bytes, %v)", at, len(gotA), err)
+		}
+	}
+}
+
+func TestSyncTree(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directories are not synced on Windows")
+	}
+	root := t.TempDir()
+	dirs := []string{root, filepath.Join(root, "a"), filepath.Join(root, "a", "b"), filepath.Join(root, "c")}
+	for _, d := range dirs[1:] {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, "f"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys := &dbtest.RecordingFS{}
+	if err := (fileio.Options{FS: fsys}).SyncTree(root); err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]int{}
+	for i, s := range fsys.Syncs() {
+		if !s.Dir {
+			t.Errorf("SyncTree synced the file %s", s.Name)
+		}
+		seen[s.Name] = i
+	}
+	if len(seen) != len(dirs) || len(fsys.Syncs()) != len(dirs) {
+		t.Errorf("synced %v, want each of %v once", fsys.Syncs(), dirs)
+	}
+	for _, d := range dirs[1:] {
+		if seen[d] >= seen[filepath.Dir(d)] {
+			t.Errorf("%s synced after its parent", d)
+		}
+	}
+}
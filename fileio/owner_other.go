@@ -0,0 +1,12 @@
+//go:build !unix
+
+package fileio
+
+import (
+	"os"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// chownLike is a no-op where files have no Unix owner.
+func chownLike(fp vfs.File, fi os.FileInfo) {}
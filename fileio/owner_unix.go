@@ -0,0 +1,22 @@
+//go:build unix
+
+package fileio
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// chownLike gives fp the owner and group of fi. Only the superuser (or the
+// owner, for the group) may do this, so failures are ignored.
+func chownLike(fp vfs.File, fi os.FileInfo) {
+	f, ok := fp.(*os.File)
+	if !ok {
+		return // not a real file: nothing to own
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		_ = f.Chown(int(st.Uid), int(st.Gid))
+	}
+}
@@ -0,0 +1,25 @@
+//go:build linux
+
+package fileio
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// preallocate reserves size bytes for fp with fallocate(2). It returns the
+// error when the file system can't provide them, and nil when it can or
+// when fallocate is not supported (the write then just proceeds).
+func preallocate(fp vfs.File, size int64) error {
+	f, ok := fp.(interface{ Fd() uintptr })
+	if !ok || size == 0 {
+		return nil
+	}
+	err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package fileio
+
+import "github.com/adcondev/go-database/vfs"
+
+// preallocate is a no-op without fallocate; the write itself reports ENOSPC.
+func preallocate(fp vfs.File, size int64) error {
+	return nil
+}
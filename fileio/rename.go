@@ -0,0 +1,63 @@
+package fileio
+
+import (
+	"io"
+	"os"
+)
+
+// RenameReplace moves oldpath onto newpath, replacing newpath if it exists.
+//
+// When the two paths are on different file systems the kernel refuses the
+// rename (EXDEV). RenameReplace then falls back to copying oldpath over
+// newpath, fsyncing it and removing oldpath. That fallback is NOT atomic:
+// a concurrent reader may see newpath truncated or half written, and a
+// crash midway leaves it partial. Keep temp files next to their target
+// (as SaveData2 does) to stay on the atomic path.
+func RenameReplace(oldpath, newpath string) error {
+	return Options{}.renameReplace(oldpath, newpath)
+}
+
+func (o Options) renameReplace(oldpath, newpath string) error {
+	err := o.fs().Rename(oldpath, newpath)
+	if err == nil {
+		return nil
+	}
+	if !isCrossDevice(err) {
+		return wrapErr(RenameErr, "rename", newpath, err)
+	}
+	if err = o.copyReplace(oldpath, newpath); err != nil {
+		return err
+	}
+	if err = o.fs().Remove(oldpath); err != nil {
+		return wrapErr(RenameErr, "remove", oldpath, err)
+	}
+	return nil
+}
+
+// copyReplace overwrites dst with the content and mode of src and fsyncs it.
+func (o Options) copyReplace(src, dst string) error {
+	in, err := o.fs().OpenFile(src, os.O_RDONLY, 0)
+	if err != nil {
+		return wrapErr(OpenErr, "open", src, err)
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return wrapErr(OpenErr, "stat", src, err)
+	}
+	out, err := o.fs().OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return wrapErr(OpenErr, "open", dst, err)
+	}
+	defer out.Close()
+	if _, err = io.Copy(out, in); err != nil {
+		return wrapErr(WriteErr, "write", dst, err)
+	}
+	if err = out.Sync(); err != nil {
+		return wrapErr(SyncErr, "sync", dst, err)
+	}
+	if err = out.Close(); err != nil {
+		return wrapErr(WriteErr, "close", dst, err)
+	}
+	return nil
+}
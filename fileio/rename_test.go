@@ -0,0 +1,84 @@
+//go:build !plan9
+
+package fileio_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/adcondev/go-database/fileio"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// exdevFS refuses every rename as one across file systems.
+type exdevFS struct{ vfs.OS }
+
+func (exdevFS) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+}
+
+func TestSaveData2CopyFallback(t *testing.T) {
+	d := dir(t)
+	if err := fileio.SaveData2(d, "f", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := (fileio.Options{FS: exdevFS{}}).SaveData2(d, "f", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if b := mustRead(t, d+"f"); string(b) != "new" {
+		t.Errorf("content %q, want %q", b, "new")
+	}
+	entries, err := os.ReadDir(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %v, want the file alone", entries)
+	}
+}
+
+// otherMount returns a directory on another file system than dir, from
+// $FILEIO_OTHER_DIR or /dev/shm, or skips the test if there is none.
+func otherMount(t *testing.T, dir string) string {
+	other := os.Getenv("FILEIO_OTHER_DIR")
+	if other == "" {
+		other = "/dev/shm"
+	}
+	other, err := os.MkdirTemp(other, "fileio")
+	if err != nil {
+		t.Skip("no second file system:", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(other) })
+	probe := filepath.Join(dir, "probe")
+	if err = os.WriteFile(probe, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if os.Rename(probe, filepath.Join(other, "probe")) == nil {
+		t.Skip(other, "is on the same file system; set FILEIO_OTHER_DIR")
+	}
+	os.Remove(probe)
+	return other
+}
+
+func TestRenameReplaceAcrossMounts(t *testing.T) {
+	src := t.TempDir()
+	dst := otherMount(t, src)
+	data := payload(1 << 16)
+	if err := os.WriteFile(filepath.Join(src, "f"), data, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "f"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fileio.RenameReplace(filepath.Join(src, "f"), filepath.Join(dst, "f")); err != nil {
+		t.Fatal(err)
+	}
+	if b := mustRead(t, filepath.Join(dst, "f")); string(b) != string(data) {
+		t.Error("content differs after the copy")
+	}
+	if _, err := os.Stat(filepath.Join(src, "f")); !os.IsNotExist(err) {
+		t.Errorf("source left behind: %v", err)
+	}
+}
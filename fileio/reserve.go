@@ -0,0 +1,16 @@
+package fileio
+
+// SaveDataIfSpace is SaveData2 that first reserves room for all of data on
+// the temp file (fallocate on Linux). If the file system can't provide it,
+// it returns ErrDiskFull before a single byte is written, instead of
+// running out of space halfway through. Where preallocation isn't
+// available it behaves exactly like SaveData2.
+func SaveDataIfSpace(path, file string, data []byte) error {
+	return Options{}.SaveDataIfSpace(path, file, data)
+}
+
+// SaveDataIfSpace is SaveDataIfSpace honouring the options in o.
+func (o Options) SaveDataIfSpace(path, file string, data []byte) error {
+	o.reserve = true
+	return o.SaveData2(path, file, data)
+}
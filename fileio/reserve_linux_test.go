@@ -0,0 +1,78 @@
+package fileio_test
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/adcondev/go-database/fileio"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// blocksFS records how many bytes its files had allocated at their first
+// write.
+type blocksFS struct {
+	vfs.OS
+	allocated int64
+}
+
+func (b *blocksFS) OpenFile(name string, flag int, perm fs.FileMode) (vfs.File, error) {
+	fp, err := b.OS.OpenFile(name, flag, perm)
+	if err != nil || flag&os.O_CREATE == 0 {
+		return fp, err
+	}
+	return &blocksFile{File: fp, fs: b}, nil
+}
+
+type blocksFile struct {
+	vfs.File
+	fs      *blocksFS
+	written bool
+}
+
+func (f *blocksFile) Write(p []byte) (int, error) {
+	if !f.written {
+		f.written = true
+		if fi, err := f.Stat(); err == nil {
+			f.fs.allocated = fi.Sys().(*syscall.Stat_t).Blocks * 512
+		}
+	}
+	return f.File.Write(p)
+}
+
+func (f *blocksFile) Fd() uintptr { return f.File.(*os.File).Fd() }
+
+func TestSaveDataIfSpaceReserves(t *testing.T) {
+	d := dir(t)
+	probe, err := os.Create(d + "probe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = syscall.Fallocate(int(probe.Fd()), 0, 0, 4096)
+	probe.Close()
+	if err != nil {
+		t.Skip("no fallocate here:", err)
+	}
+
+	data := payload(1 << 20)
+	fsys := &blocksFS{}
+	if err = (fileio.Options{FS: fsys}).SaveDataIfSpace(d, "f", data); err != nil {
+		t.Fatal(err)
+	}
+	if fsys.allocated < int64(len(data)) {
+		t.Errorf("%d bytes allocated before the write, want the %d of the data", fsys.allocated, len(data))
+	}
+	if !bytes.Equal(mustRead(t, d+"f"), data) {
+		t.Error("content differs from the data")
+	}
+
+	// Without the reservation the blocks come with the write.
+	if err = (fileio.Options{FS: fsys}).SaveData2(d, "g", data); err != nil {
+		t.Fatal(err)
+	}
+	if fsys.allocated >= int64(len(data)) {
+		t.Errorf("SaveData2 had %d bytes allocated before its write", fsys.allocated)
+	}
+}
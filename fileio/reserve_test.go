@@ -0,0 +1,22 @@
+package fileio_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/adcondev/go-database/fileio"
+	"github.com/adcondev/go-database/vfs"
+)
+
+func TestSaveDataIfSpaceFallback(t *testing.T) {
+	// Mem files have no descriptor to fallocate: the save goes ahead
+	// without the reservation.
+	mem := &vfs.Mem{}
+	data := payload(10000)
+	if err := (fileio.Options{FS: mem}).SaveDataIfSpace("d/", "f", data); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := vfs.ReadFile(mem, "d/f"); err != nil || !bytes.Equal(b, data) {
+		t.Errorf("content of %d bytes, %v; want the %d saved", len(b), err, len(data))
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !windows
+
+package fileio
+
+const canSyncDir = true
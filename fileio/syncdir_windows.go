@@ -0,0 +1,5 @@
+package fileio
+
+// Windows cannot open a directory for FlushFileBuffers through os.Open, and
+// NTFS journals renames anyway; directory syncs are skipped.
+const canSyncDir = false
@@ -0,0 +1,70 @@
+package fileio
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// TempConflictPolicy says what SaveData2 does when the temp file it wants
+// to create already exists, typically left behind by a crashed writer.
+type TempConflictPolicy int
+
+const (
+	// TempFail gives up with OpenErr.
+	TempFail TempConflictPolicy = iota
+	// TempOverwrite truncates the existing temp file and reuses it.
+	TempOverwrite
+	// TempNewName picks a fresh stamp and tries again.
+	TempNewName
+)
+
+// maxTempTries bounds how many names TempNewName tries before giving up.
+const maxTempTries = 10
+
+// RandomStamp is the default Options.StampFunc: 64 bits from crypto/rand,
+// hex encoded, so concurrent writers (even in other processes) don't pick
+// the same temp name.
+func RandomStamp() string {
+	var b [8]byte
+	rand.Read(b[:]) // never fails; see crypto/rand.Read
+	return hex.EncodeToString(b[:])
+}
+
+// tempName returns a temp file name for target.
+func (o Options) tempName(target string) string {
+	stamp := o.StampFunc
+	if stamp == nil {
+		stamp = RandomStamp
+	}
+	return fmt.Sprintf("%s.tmp.%s", target, stamp())
+}
+
+// createTemp creates the temp file SaveData2 writes before renaming it onto
+// target, resolving a name clash according to o.TempConflict.
+func (o Options) createTemp(target string) (vfs.File, string, error) {
+	tmp := o.tempName(target)
+	fp, err := o.fs().OpenFile(
+		// write-only, create a new file if none exists, file must not exist
+		tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, o.mode(),
+	)
+	for tries := 1; errors.Is(err, fs.ErrExist) && tries < maxTempTries; tries++ {
+		switch o.TempConflict {
+		case TempOverwrite:
+			// Nobody else should own this name; truncate what's there.
+			fp, err = o.fs().OpenFile(tmp, os.O_WRONLY|os.O_TRUNC, o.mode())
+			return fp, tmp, err
+		case TempNewName:
+			tmp = o.tempName(target)
+			fp, err = o.fs().OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, o.mode())
+		default:
+			return nil, tmp, err
+		}
+	}
+	return fp, tmp, err
+}
@@ -0,0 +1,106 @@
+package fileio_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/adcondev/go-database/fileio"
+)
+
+// stamps returns a StampFunc handing out s in turn.
+func stamps(s ...string) func() string {
+	return func() string {
+		next := s[0]
+		s = s[1:]
+		return next
+	}
+}
+
+func TestTempConflict(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		policy    fileio.TempConflictPolicy
+		wantErr   bool
+		wantStale bool // whether the stale temp file is still there after
+	}{
+		{"fail", fileio.TempFail, true, true},
+		{"overwrite", fileio.TempOverwrite, false, false},
+		{"newname", fileio.TempNewName, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := dir(t)
+			stale := d + "f.tmp.x"
+			if err := os.WriteFile(stale, []byte("left by a crash"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fsys := &createFS{}
+			o := fileio.Options{FS: fsys, TempConflict: tc.policy, StampFunc: stamps("x", "y")}
+			err := o.SaveData2(d, "f", []byte("new"))
+			if tc.wantErr {
+				if !errors.Is(err, fileio.OpenErr) || !errors.Is(err, fs.ErrExist) {
+					t.Errorf("SaveData2: %v, want an OpenErr for an existing file", err)
+				}
+				if _, err := os.Stat(d + "f"); !os.IsNotExist(err) {
+					t.Errorf("the failed save created the file: %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("SaveData2: %v", err)
+				}
+				if b := mustRead(t, d+"f"); string(b) != "new" {
+					t.Errorf("content %q, want %q", b, "new")
+				}
+			}
+			b, err := os.ReadFile(stale)
+			switch {
+			case tc.wantStale && string(b) != "left by a crash":
+				t.Errorf("stale temp file holds %q, %v; want it untouched", b, err)
+			case !tc.wantStale && !os.IsNotExist(err):
+				t.Errorf("stale temp file still there: %q, %v", b, err)
+			}
+			want := []string{stale}
+			if tc.policy == fileio.TempNewName {
+				want = append(want, d+"f.tmp.y")
+			}
+			if !slices.Equal(fsys.creates, want) {
+				t.Errorf("created %q, want %q", fsys.creates, want)
+			}
+			if _, err := os.Stat(d + "f.tmp.y"); !os.IsNotExist(err) {
+				t.Errorf("temp file of the second stamp left behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestStampFunc(t *testing.T) {
+	d := dir(t)
+	n := 0
+	fsys := &createFS{}
+	o := fileio.Options{FS: fsys, StampFunc: func() string { n++; return fmt.Sprint(n) }}
+	for range 2 {
+		if err := o.SaveData2(d, "f", []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{d + "f.tmp.1", d + "f.tmp.2"}; !slices.Equal(fsys.creates, want) {
+		t.Errorf("temp files %q, want %q", fsys.creates, want)
+	}
+}
+
+func TestRandomStamp(t *testing.T) {
+	seen := map[string]bool{}
+	for range 1000 {
+		s := fileio.RandomStamp()
+		if len(s) != 16 {
+			t.Fatalf("stamp %q is not 16 hex digits", s)
+		}
+		if seen[s] {
+			t.Fatalf("stamp %q came up twice", s)
+		}
+		seen[s] = true
+	}
+}
@@ -0,0 +1,78 @@
+package fileio
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// A trailer is appended after the payload by saves with Options.Trailer:
+//
+//	| payload | length (8, LE) | CRC32 of payload (4, LE) | magic (4) |
+//
+// It lets a reader notice a file that was cut short or mangled by a writer
+// that did not use the atomic path, something the rename itself can't
+// promise for files it did not write.
+const trailerSize = 16
+
+var trailerMagic = [4]byte{'g', 'd', 'b', 'T'}
+
+// withTrailer returns data followed by its trailer.
+func withTrailer(data []byte) []byte {
+	out := make([]byte, len(data), len(data)+trailerSize)
+	copy(out, data)
+	return appendTrailer(out, uint64(len(data)), crc32.ChecksumIEEE(data))
+}
+
+// appendTrailer appends the trailer for a payload of n bytes with CRC sum.
+func appendTrailer(b []byte, n uint64, sum uint32) []byte {
+	b = binary.LittleEndian.AppendUint64(b, n)
+	b = binary.LittleEndian.AppendUint32(b, sum)
+	return append(b, trailerMagic[:]...)
+}
+
+// hasTrailer reports whether raw ends with the trailer magic.
+func hasTrailer(raw []byte) bool {
+	return len(raw) >= trailerSize && [4]byte(raw[len(raw)-4:]) == trailerMagic
+}
+
+// stripTrailer validates raw's trailer and returns the payload before it.
+func stripTrailer(raw []byte) ([]byte, error) {
+	end := len(raw) - trailerSize
+	n := binary.LittleEndian.Uint64(raw[end:])
+	sum := binary.LittleEndian.Uint32(raw[end+8:])
+	if n != uint64(end) || sum != crc32.ChecksumIEEE(raw[:end]) {
+		return nil, ChecksumErr
+	}
+	return raw[:end], nil
+}
+
+// LoadDataVerified is LoadData for files saved with Options.Trailer: it
+// checks the trailer and returns the payload without it. A length or CRC
+// mismatch yields ChecksumErr; a file with no trailer at all yields
+// ErrNoTrailer.
+//
+// Cutting a file short removes its trailer too, so a truncated file also
+// reports ErrNoTrailer. That is why accepting trailer-less files
+// (Options.AllowNoTrailer) should be limited to migrating old data.
+func LoadDataVerified(path, file string) ([]byte, error) {
+	return Options{}.LoadDataVerified(path, file)
+}
+
+// LoadDataVerified is LoadDataVerified honouring the options in o.
+func (o Options) LoadDataVerified(path, file string) ([]byte, error) {
+	raw, err := o.LoadData(path, file)
+	if err != nil {
+		return nil, err
+	}
+	if !hasTrailer(raw) {
+		if o.AllowNoTrailer {
+			return raw, nil
+		}
+		return nil, wrapErr(ErrNoTrailer, "verify", path+file, nil)
+	}
+	data, err := stripTrailer(raw)
+	if err != nil {
+		return nil, wrapErr(err, "verify", path+file, nil)
+	}
+	return data, nil
+}
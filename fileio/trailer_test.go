@@ -0,0 +1,57 @@
+package fileio_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/adcondev/go-database/fileio"
+)
+
+func TestLoadDataVerified(t *testing.T) {
+	d := dir(t)
+	data := []byte("payload")
+	o := fileio.Options{Trailer: true}
+	for name, save := range map[string]func(path, file string, data []byte) error{
+		"SaveData1": o.SaveData1,
+		"SaveData2": o.SaveData2,
+	} {
+		if err := save(d, name, data); err != nil {
+			t.Fatal(err)
+		}
+		if raw := mustRead(t, d+name); len(raw) != len(data)+16 {
+			t.Errorf("%s wrote %d bytes, want the payload and a 16-byte trailer", name, len(raw))
+		}
+		if b, err := fileio.LoadDataVerified(d, name); err != nil || !bytes.Equal(b, data) {
+			t.Errorf("%s: LoadDataVerified = %q, %v; want %q", name, b, err, data)
+		}
+	}
+
+	raw := mustRead(t, d+"SaveData2")
+	for _, tc := range []struct {
+		name string
+		raw  []byte
+		want error
+	}{
+		{"truncated", raw[:len(raw)-3], fileio.ErrNoTrailer},
+		{"short payload", raw[1:], fileio.ChecksumErr},
+		{"flipped", append([]byte{raw[0] ^ 1}, raw[1:]...), fileio.ChecksumErr},
+		{"plain", data, fileio.ErrNoTrailer},
+	} {
+		if err := os.WriteFile(d+tc.name, tc.raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fileio.LoadDataVerified(d, tc.name); !errors.Is(err, tc.want) {
+			t.Errorf("%s file: %v, want %v", tc.name, err, tc.want)
+		}
+	}
+
+	b, err := fileio.Options{AllowNoTrailer: true}.LoadDataVerified(d, "plain")
+	if err != nil || !bytes.Equal(b, data) {
+		t.Errorf("AllowNoTrailer on a plain file = %q, %v; want it as it is", b, err)
+	}
+	if _, err = (fileio.Options{AllowNoTrailer: true}).LoadDataVerified(d, "flipped"); !errors.Is(err, fileio.ChecksumErr) {
+		t.Errorf("AllowNoTrailer on a bad trailer: %v, want ChecksumErr", err)
+	}
+}
@@ -0,0 +1,82 @@
+package fileio
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// versionName is the name of the n-th previous version of name.
+func versionName(name string, n int) string {
+	return fmt.Sprintf("%s.v%d", name, n)
+}
+
+// stashVersion keeps the current content of name as name.v0, for
+// rotateVersions to make it name.v1 once the save has replaced name, and
+// reports whether there was a current content. Until then the older
+// versions stay where they are, so a save that fails before its rename
+// leaves them as they were; the caller removes name.v0 then.
+//
+// The current file is hard-linked rather than renamed, so it never
+// disappears before the caller's rename replaces it; where links are not
+// supported (or o.FS is not the real file system) it is copied instead.
+func (o Options) stashVersion(name string) (bool, error) {
+	fsys := o.fs()
+	if _, err := fsys.Lstat(name); errors.Is(err, fs.ErrNotExist) {
+		return false, nil // first write: nothing to keep
+	}
+	stash := versionName(name, 0)
+	err := fsys.Remove(stash) // left by a crash
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, wrapErr(VersionErr, "remove", stash, err)
+	}
+	if _, real := fsys.(vfs.OS); !real || os.Link(name, stash) != nil {
+		if err = o.copyReplace(name, stash); err != nil {
+			return false, wrapErr(VersionErr, "copy", name, err)
+		}
+	}
+	return true, nil
+}
+
+// rotateVersions shifts name.v1..name.v(keep-1) one slot older, dropping
+// name.v<keep>, and makes name.v0 of stashVersion the new name.v1.
+func (o Options) rotateVersions(name string, keep int) error {
+	fsys := o.fs()
+	err := fsys.Remove(versionName(name, keep))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return wrapErr(VersionErr, "remove", versionName(name, keep), err)
+	}
+	for n := keep - 1; n >= 0; n-- {
+		err = fsys.Rename(versionName(name, n), versionName(name, n+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return wrapErr(VersionErr, "rename", versionName(name, n), err)
+		}
+	}
+	return nil
+}
+
+// LoadVersion reads the n-th previous version of path+file kept by
+// SaveData2 with Options.KeepVersions; n == 0 reads the current content.
+// A version that was never written or has been pruned yields NotFoundErr.
+func LoadVersion(path, file string, n int) ([]byte, error) {
+	return Options{}.LoadVersion(path, file, n)
+}
+
+// LoadVersion is LoadVersion honouring the options in o: it reads from
+// o.FS, and with o.Trailer it checks and strips the trailer, as
+// LoadDataVerified does.
+func (o Options) LoadVersion(path, file string, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, NotFoundErr
+	}
+	if n > 0 {
+		file = versionName(file, n)
+	}
+	if o.Trailer {
+		return o.LoadDataVerified(path, file)
+	}
+	return o.LoadData(path, file)
+}
@@ -0,0 +1,106 @@
+package fileio_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/fileio"
+	"github.com/adcondev/go-database/vfs"
+)
+
+func TestKeepVersions(t *testing.T) {
+	d := dir(t)
+	o := fileio.Options{KeepVersions: 2}
+	for i := 1; i <= 4; i++ {
+		if err := o.SaveData2(d, "f", fmt.Appendf(nil, "c%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var names []string
+	entries, _ := os.ReadDir(d)
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if want := []string{"f", "f.v1", "f.v2"}; !slices.Equal(names, want) {
+		t.Errorf("files %v, want %v", names, want)
+	}
+	for n, want := range []string{"c4", "c3", "c2"} {
+		if b, err := fileio.LoadVersion(d, "f", n); err != nil || string(b) != want {
+			t.Errorf("LoadVersion(%d) = %q, %v; want %q", n, b, err, want)
+		}
+	}
+	if _, err := fileio.LoadVersion(d, "f", 3); !errors.Is(err, fileio.NotFoundErr) {
+		t.Errorf("pruned version: %v, want NotFoundErr", err)
+	}
+}
+
+func TestKeepVersionsFailedSave(t *testing.T) {
+	d := dir(t)
+	o := fileio.Options{KeepVersions: 2}
+	for _, c := range []string{"c1", "c2"} {
+		if err := o.SaveData2(d, "f", []byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := o.ReplaceIfMatches(d, "f", []byte("c3"), []byte("not c2"))
+	if !errors.Is(err, fileio.ErrVersionConflict) {
+		t.Fatalf("ReplaceIfMatches: %v, want ErrVersionConflict", err)
+	}
+	for n, want := range []string{"c2", "c1"} {
+		if b, err := fileio.LoadVersion(d, "f", n); err != nil || string(b) != want {
+			t.Errorf("after a failed save LoadVersion(%d) = %q, %v; want %q", n, b, err, want)
+		}
+	}
+	if _, err := os.Stat(d + "f.v2"); !os.IsNotExist(err) {
+		t.Errorf("a failed save rotated the versions: %v", err)
+	}
+}
+
+func TestLoadVersionOptions(t *testing.T) {
+	o := fileio.Options{FS: &vfs.Mem{}, KeepVersions: 1, Trailer: true}
+	for _, c := range []string{"c1", "c2"} {
+		if err := o.SaveData2("/d/", "f", []byte(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The versions are on o.FS, and come back without their trailer.
+	for n, want := range []string{"c2", "c1"} {
+		if b, err := o.LoadVersion("/d/", "f", n); err != nil || string(b) != want {
+			t.Errorf("LoadVersion(%d) = %q, %v; want %q", n, b, err, want)
+		}
+	}
+	if _, err := o.LoadVersion("/d/", "f", 2); !errors.Is(err, fileio.NotFoundErr) {
+		t.Errorf("pruned version: %v, want NotFoundErr", err)
+	}
+	if _, err := fileio.LoadVersion("/d/", "f", 0); !errors.Is(err, fileio.NotFoundErr) {
+		t.Errorf("LoadVersion off the OS: %v, want NotFoundErr", err)
+	}
+}
+
+func TestKeepVersionsRotateFails(t *testing.T) {
+	d := dir(t)
+	rec := &dbtest.RecordingFS{}
+	// The first rename puts the new content in place; the second is the
+	// first of the rotation.
+	fsys := &dbtest.FaultyFS{FS: rec, FailAt: map[dbtest.Op]int{dbtest.OpRename: 2}}
+	o := fileio.Options{FS: fsys, KeepVersions: 2}
+	if err := fileio.SaveData2(d, "f", []byte("c1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.SaveData2(d, "f", []byte("c2")); !errors.Is(err, fileio.VersionErr) {
+		t.Fatalf("SaveData2 with a failed rotation: %v, want VersionErr", err)
+	}
+	if b := mustRead(t, d+"f"); string(b) != "c2" {
+		t.Errorf("content %q, want %q", b, "c2")
+	}
+	// The rename is done, so it is synced all the same (where directories
+	// can be).
+	if syncs := rec.Syncs(); runtime.GOOS != "windows" && (len(syncs) == 0 || !syncs[len(syncs)-1].Dir) {
+		t.Errorf("syncs %v, want the directory's last", syncs)
+	}
+}
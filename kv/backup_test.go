@@ -0,0 +1,134 @@
+package kv_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// restore writes backup to a file and opens it.
+func restore(t *testing.T, backup []byte) *kv.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "restored")
+	if err := os.WriteFile(path, backup, 0644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err = db.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestBackupWhileWriting(t *testing.T) {
+	db := open(t, kv.Options{PageSize: 512})
+	fill(t, db, 500)
+	// The writer records the content after each commit, by number.
+	states := map[uint64]map[string]string{db.LastCommit(): dump(t, db)}
+	var mu sync.Mutex
+	done := make(chan error, 1)
+	cur := dump(t, db)
+	go func() {
+		for i := range 200 {
+			k, v := fmt.Sprintf("k%03d", i*7%700), fmt.Sprint("w", i)
+			if err := db.Set([]byte(k), []byte(v)); err != nil {
+				done <- err
+				return
+			}
+			cur[k] = v
+			mu.Lock()
+			states[db.LastCommit()] = maps.Clone(cur)
+			mu.Unlock()
+		}
+		close(done)
+	}()
+	var backups [][]byte
+	var commits []uint64
+	for writing := true; writing; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			writing = false
+		default:
+		}
+		var buf bytes.Buffer
+		c, err := db.Backup(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backups, commits = append(backups, buf.Bytes()), append(commits, c)
+	}
+
+	for i, b := range backups {
+		got := dump(t, restore(t, b))
+		mu.Lock()
+		want, ok := states[commits[i]]
+		mu.Unlock()
+		if !ok || !maps.Equal(got, want) {
+			t.Errorf("backup %d, of commit %d, holds %d keys, not that commit's %d", i, commits[i], len(got), len(want))
+		}
+	}
+	if commits[0] == commits[len(commits)-1] {
+		t.Errorf("%d backups all of commit %d: the writes did not go on", len(commits), commits[0])
+	}
+}
+
+func TestBackupLastCommit(t *testing.T) {
+	db := open(t, kv.Options{})
+	fill(t, db, 10)
+	var buf bytes.Buffer
+	c, err := db.Backup(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A backup is current as long as LastCommit has not moved.
+	if c != db.LastCommit() {
+		t.Errorf("backup of commit %d, LastCommit %d", c, db.LastCommit())
+	}
+	restored := restore(t, buf.Bytes())
+	if restored.LastCommit() != c {
+		t.Errorf("restored database at commit %d, want %d", restored.LastCommit(), c)
+	}
+	db.Set([]byte("k"), nil)
+	if c == db.LastCommit() {
+		t.Error("LastCommit did not move with a commit")
+	}
+	// A restored database takes updates as any other.
+	if err = restored.Set([]byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err = restored.Verify(); err != nil {
+		t.Error(err)
+	}
+
+	db.Close()
+	if _, err = db.Backup(&buf); err != kv.ErrClosed {
+		t.Errorf("Backup after Close: %v, want ErrClosed", err)
+	}
+}
+
+func TestBackupWriteError(t *testing.T) {
+	db := open(t, kv.Options{})
+	fill(t, db, 10)
+	bad := errors.New("disk full")
+	if _, err := db.Backup(failWriter{bad}); !errors.Is(err, bad) {
+		t.Errorf("Backup to a failing writer: %v", err)
+	}
+}
+
+type failWriter struct{ err error }
+
+func (w failWriter) Write([]byte) (int, error) { return 0, w.err }
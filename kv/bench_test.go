@@ -0,0 +1,124 @@
+package kv_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/pager"
+)
+
+// The benchmarks of the sync policies and of the page cache, which group
+// commit and the cache are to be judged by. godb bench runs workloads of
+// more shapes.
+
+func BenchmarkSet(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		sync pager.SyncPolicy
+	}{{"always", pager.SyncAlways}, {"batch", pager.SyncBatch}, {"off", pager.SyncOff}} {
+		b.Run(bc.name, func(b *testing.B) {
+			db := open(b, kv.Options{Sync: bc.sync})
+			v := make([]byte, 100)
+			i := 0
+			for b.Loop() {
+				if err := db.Set(fmt.Appendf(nil, "k%08d", i%10000), v); err != nil {
+					b.Fatal(err)
+				}
+				i++
+			}
+		})
+	}
+}
+
+func BenchmarkSetParallel(b *testing.B) {
+	// Concurrent writers, whose commits SyncBatch covers with a sync.
+	for _, bc := range []struct {
+		name string
+		sync pager.SyncPolicy
+	}{{"always", pager.SyncAlways}, {"batch", pager.SyncBatch}} {
+		b.Run(bc.name, func(b *testing.B) {
+			db := open(b, kv.Options{Sync: bc.sync})
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				v := make([]byte, 100)
+				for i := 0; pb.Next(); i++ {
+					if err := db.Set(fmt.Appendf(nil, "k%08d", i%10000), v); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		o    kv.Options
+	}{
+		{"mmap", kv.Options{}},
+		{"read", kv.Options{NoMmap: true}},
+		{"cache", kv.Options{NoMmap: true, CacheSize: 1 << 20}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			bc.o.Sync = pager.SyncOff
+			db := open(b, bc.o)
+			w := dbtest.Workload{Keys: 20000, Ops: 1, NoReads: true}
+			if _, err := w.Run(db); err != nil {
+				b.Fatal(err)
+			}
+			i := 0
+			for b.Loop() {
+				if _, err := db.Get(w.Key(i * 7919 % w.Keys)); err != nil {
+					b.Fatal(err)
+				}
+				i++
+			}
+		})
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	db := open(b, kv.Options{Sync: pager.SyncOff})
+	w := dbtest.Workload{Keys: 10000, Ops: 1, NoReads: true}
+	if _, err := w.Run(db); err != nil {
+		b.Fatal(err)
+	}
+	for b.Loop() {
+		n := 0
+		db.Scan(nil, nil, func(k, v []byte) bool { n++; return true })
+		if n != w.Keys {
+			b.Fatalf("Scan found %d keys, want %d", n, w.Keys)
+		}
+	}
+	b.ReportMetric(float64(w.Keys*b.N)/b.Elapsed().Seconds(), "keys/s")
+}
+
+func BenchmarkWorkload(b *testing.B) {
+	// A mixed load of each distribution, unsynced to measure the tree and
+	// the cache rather than the disk, with its tail latencies, which the
+	// time of a run alone does not show.
+	for _, dist := range []dbtest.Distribution{dbtest.Uniform, dbtest.Zipf, dbtest.Sequential} {
+		b.Run(dist.String(), func(b *testing.B) {
+			w := dbtest.Workload{Ops: 2000, Keys: 10000, Reads: 0.9, Dist: dist, Workers: 4}
+			var res dbtest.Result
+			for b.Loop() {
+				b.StopTimer()
+				db := open(b, kv.Options{Sync: pager.SyncOff, NoMmap: true, CacheSize: 256 << 10})
+				b.StartTimer()
+				var err error
+				if res, err = w.Run(db); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				db.Close()
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(res.Reads.Percentile(0.99).Nanoseconds()), "get-p99-ns")
+			b.ReportMetric(float64(res.Writes.Percentile(0.99).Nanoseconds()), "commit-p99-ns")
+		})
+	}
+}
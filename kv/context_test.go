@@ -0,0 +1,144 @@
+package kv_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/pager"
+)
+
+func TestBeginContext(t *testing.T) {
+	db := open(t, kv.Options{})
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.BeginContext(canceled); err != context.Canceled {
+		t.Errorf("BeginContext with a canceled context: %v, want Canceled", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The open write transaction holds the others off until the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err = db.BeginContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("BeginContext with a transaction open: %v, want DeadlineExceeded", err)
+	}
+	if err = db.SetContext(ctx, []byte("k"), nil); err != context.DeadlineExceeded {
+		t.Errorf("SetContext with a transaction open: %v, want DeadlineExceeded", err)
+	}
+	if _, err = db.DelContext(ctx, []byte("k")); err != context.DeadlineExceeded {
+		t.Errorf("DelContext with a transaction open: %v, want DeadlineExceeded", err)
+	}
+	// Neither touched the lock: the transaction ends, and the next
+	// begins.
+	tx.Set([]byte("k"), []byte("v"))
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	long, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if deleted, err := db.DelContext(long, []byte("k")); !deleted || err != nil {
+		t.Errorf("DelContext = %v, %v", deleted, err)
+	}
+	if err = db.SetContext(long, []byte("k"), []byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	if v := mustGet(t, db, "k"); v != "again" {
+		t.Errorf("k = %q, want again", v)
+	}
+	if _, err = db.GetContext(canceled, []byte("k")); err != context.Canceled {
+		t.Errorf("GetContext with a canceled context: %v, want Canceled", err)
+	}
+	if v, err := db.GetContext(long, []byte("k")); err != nil || string(v) != "again" {
+		t.Errorf("GetContext = %q, %v", v, err)
+	}
+}
+
+func TestCommitContext(t *testing.T) {
+	db := open(t, kv.Options{})
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Set([]byte("k"), []byte("v"))
+	// Done before the commit starts: the transaction is rolled back.
+	if err = tx.CommitContext(canceled); err != context.Canceled {
+		t.Errorf("CommitContext with a canceled context: %v, want Canceled", err)
+	}
+	if err = tx.Commit(); err != kv.ErrTxClosed {
+		t.Errorf("Commit after CommitContext gave up: %v, want ErrTxClosed", err)
+	}
+	if _, err = db.Get([]byte("k")); err != kv.ErrKeyNotFound {
+		t.Errorf("Get of the rolled back key: %v", err)
+	}
+	if db.LastCommit() != 0 {
+		t.Errorf("commit %d after the rollback", db.LastCommit())
+	}
+	// A read transaction has nothing to give up.
+	if tx, err = db.BeginRead(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.CommitContext(canceled); err != nil {
+		t.Errorf("CommitContext of a read transaction: %v", err)
+	}
+	if err = db.Set([]byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Set after the rollback: %v", err)
+	}
+}
+
+func TestCommitContextSyncBatch(t *testing.T) {
+	// CommitContext stops waiting for a sync it shares, which SyncDelay
+	// puts off, with the updates visible.
+	db := open(t, kv.Options{Sync: pager.SyncBatch, SyncDelay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := db.SetContext(ctx, []byte("k"), []byte("v")); err != context.DeadlineExceeded {
+		t.Errorf("SetContext under SyncBatch: %v, want DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("SetContext returned after %v, past its deadline", d)
+	}
+	if v := mustGet(t, db, "k"); v != "v" {
+		t.Errorf("k = %q after the commit gave up, want v", v)
+	}
+	if err := db.Set([]byte("k2"), []byte("v")); err != nil {
+		t.Errorf("Set, which waits for the sync: %v", err)
+	}
+}
+
+func TestScanContext(t *testing.T) {
+	db := open(t, kv.Options{})
+	fill(t, db, 1000)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for name, scan := range map[string]func(context.Context, []byte, []byte, func(k, v []byte) bool) error{
+		"DB": db.ScanContext,
+		"Tx": tx.ScanContext,
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		n := 0
+		err := scan(ctx, nil, nil, func(k, v []byte) bool {
+			if n++; n == 10 {
+				cancel()
+			}
+			return true
+		})
+		// It looks at the context every few hundred keys.
+		if err != context.Canceled || n >= 1000 {
+			t.Errorf("%s.ScanContext canceled after 10 keys: %v after %d", name, err, n)
+		}
+		n = 0
+		if err = scan(context.Background(), nil, nil, func(k, v []byte) bool { n++; return true }); err != nil || n != 1000 {
+			t.Errorf("%s.ScanContext = %v after %d keys, want 1000", name, err, n)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package kv_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/pager"
+)
+
+// damaged returns the path of a database of 1000 keys over 512-byte
+// pages, with a bit flipped in the last leaf of its tree, and that leaf's
+// page number.
+func damaged(t *testing.T) (string, uint64) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Options{PageSize: 512}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fill(t, db, 1000)
+	db.Close()
+
+	p, err := pager.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last uint64
+	if _, err = p.Tree().Check(func(ptr uint64) error { last = ptr; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+	fp, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	b := make([]byte, 1)
+	off := int64(last)*512 + 300
+	fp.ReadAt(b, off)
+	b[0] ^= 0x10
+	if _, err = fp.WriteAt(b, off); err != nil {
+		t.Fatal(err)
+	}
+	return path, last
+}
+
+func TestCorruptPage(t *testing.T) {
+	path, leaf := damaged(t)
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	wantLeaf := func(op string, err error) {
+		t.Helper()
+		var ce *btree.CorruptError
+		if !errors.Is(err, kv.ErrCorrupt) || !errors.As(err, &ce) || ce.Page != leaf {
+			t.Errorf("%s: %v, want ErrCorrupt naming page %d", op, err, leaf)
+		}
+	}
+	_, err = db.Get([]byte("k999"))
+	wantLeaf("Get on the damaged leaf", err)
+	if v := mustGet(t, db, "k000"); v != "v0" {
+		t.Errorf("k000 = %q", v)
+	}
+	wantLeaf("Scan", db.Scan(nil, nil, func(k, v []byte) bool { return true }))
+	wantLeaf("Verify", db.Verify())
+
+	// An update through the damaged page fails, and leaves nothing
+	// behind.
+	tx, _ := db.Begin()
+	tx.Set([]byte("k000"), []byte("new"))
+	wantLeaf("Tx.Set on the damaged leaf", tx.Set([]byte("k999"), []byte("new")))
+	wantLeaf("Tx.Get after a failed update", func() error { _, err := tx.Get([]byte("k999")); return err }())
+	wantLeaf("Commit after a failed update", tx.Commit())
+	if v := mustGet(t, db, "k000"); v != "v0" {
+		t.Errorf("k000 = %q after the failed transaction", v)
+	}
+}
+
+func TestContinueOnError(t *testing.T) {
+	path, _ := damaged(t)
+	db, err := kv.Options{ContinueOnError: true}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = db.Set([]byte("k"), nil); err != kv.ErrReadOnly {
+		t.Errorf("Set in a salvage open: %v, want ErrReadOnly", err)
+	}
+	// Reads skip the damaged leaf and go on.
+	if _, err = db.Get([]byte("k999")); err != kv.ErrKeyNotFound {
+		t.Errorf("Get on the damaged leaf: %v, want ErrKeyNotFound", err)
+	}
+	n := 0
+	if err = db.Scan(nil, nil, func(k, v []byte) bool { n++; return true }); err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 || n >= 1000 {
+		t.Errorf("salvage scan read %d of the 1000 keys", n)
+	}
+	if v := mustGet(t, db, fmt.Sprintf("k%03d", 0)); v != "v0" {
+		t.Errorf("k000 = %q", v)
+	}
+	if err = db.Verify(); !errors.Is(err, kv.ErrCorrupt) {
+		t.Errorf("Verify in a salvage open: %v, want the damage reported", err)
+	}
+}
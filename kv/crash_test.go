@@ -0,0 +1,107 @@
+package kv_test
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// crashWorkload runs 12 transactions of random sets and deletes on a new
+// database on fsys. It calls commit with the content after each commit
+// acknowledged, and returns what stopped it, if anything.
+func crashWorkload(fsys vfs.FileSystem, commit func(map[string]string)) error {
+	db, err := kv.Options{FS: fsys, PageSize: 512}.Open("db")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	r := rand.New(rand.NewPCG(1, 1))
+	state := map[string]string{}
+	for n := range 12 {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		next := maps.Clone(state)
+		for range 30 {
+			k := fmt.Sprintf("k%03d", r.IntN(300))
+			if r.IntN(4) == 0 {
+				_, err = tx.Del([]byte(k))
+				delete(next, k)
+			} else {
+				v := fmt.Sprintf("%d-%d", n, r.IntN(1000))
+				err = tx.Set([]byte(k), []byte(v))
+				next[k] = v
+			}
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		state = next
+		commit(maps.Clone(state))
+	}
+	return nil
+}
+
+func dump(tb testing.TB, db *kv.DB) map[string]string {
+	tb.Helper()
+	m := map[string]string{}
+	if err := db.Scan(nil, nil, func(k, v []byte) bool { m[string(k)] = string(v); return true }); err != nil {
+		tb.Fatal(err)
+	}
+	return m
+}
+
+func TestCrashRecovery(t *testing.T) {
+	states := []map[string]string{{}}
+	ref := &dbtest.CrashFS{FS: &vfs.Mem{}}
+	if err := crashWorkload(ref, func(s map[string]string) { states = append(states, s) }); err != nil {
+		t.Fatal(err)
+	}
+	calls := ref.Calls()
+	step := 1
+	if testing.Short() {
+		step = max(1, calls/20)
+	}
+	for at := 1; at <= calls; at += step {
+		mem := &vfs.Mem{}
+		acked := 0
+		err := crashWorkload(&dbtest.CrashFS{FS: mem, CrashAt: at, Rand: rand.New(rand.NewPCG(uint64(at), 9))},
+			func(map[string]string) { acked++ })
+		if !errors.Is(err, dbtest.ErrCrashed) {
+			t.Fatalf("crash at call %d of %d: workload ended with %v", at, calls, err)
+		}
+		db, err := kv.Options{FS: mem}.Open("db")
+		if err != nil {
+			t.Fatalf("crash at call %d: reopen: %v", at, err)
+		}
+		if err = db.Verify(); err != nil {
+			t.Fatalf("crash at call %d: %v", at, err)
+		}
+		// Exactly the last commit acknowledged, or the one in progress.
+		got := dump(t, db)
+		if !maps.Equal(got, states[acked]) && (acked+1 >= len(states) || !maps.Equal(got, states[acked+1])) {
+			t.Fatalf("crash at call %d: %d keys, not the state of commit %d or %d", at, len(got), acked, acked+1)
+		}
+		// The recovered free list must be sound too.
+		for i := range 300 {
+			if err = db.Set(fmt.Appendf(nil, "k%03d", i), []byte("after")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = db.Verify(); err != nil {
+			t.Fatalf("crash at call %d: after updating the recovered database: %v", at, err)
+		}
+		db.Close()
+	}
+}
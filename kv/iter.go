@@ -0,0 +1,141 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// Iterator walks the keys of a DB in order. It is not safe for concurrent
+// use, but the DB may be updated while it is open: each step reads the last
+// commit, and an iterator that finds a new commit there finds its place
+// again by key and goes on over the updated keys. It pins no pages between
+// steps.
+type Iterator struct {
+	db       *DB
+	it       *btree.Iter
+	commit   uint64 // the commit it was positioned at
+	key, val []byte
+	err      error
+}
+
+// Seek returns an iterator at the first key greater than or equal to key.
+// Seek(prefix) is where the keys starting with prefix begin.
+func (db *DB) Seek(key []byte) *Iterator {
+	it := &Iterator{db: db}
+	it.err = db.view(func(tree *btree.BTree, commit uint64) {
+		it.at(tree, tree.SeekGE(key), commit, true)
+	})
+	return it
+}
+
+// at makes it track bi, positioned at commit, once bi has moved on, in the
+// given direction, past the keys whose TTL has passed.
+func (it *Iterator) at(tree *btree.BTree, bi *btree.Iter, commit uint64, forward bool) {
+	for bi.Valid() && expired(tree, bi.Key()) {
+		if forward {
+			bi.Next()
+		} else {
+			bi.Prev()
+		}
+	}
+	it.it, it.commit = bi, commit
+	it.key, it.val = nil, nil
+	if bi.Valid() {
+		it.key, it.val = bytes.Clone(bi.Key()), bytes.Clone(bi.Val())
+	}
+}
+
+// Valid reports whether the iterator is at a key. An iterator that went
+// past either end stays invalid.
+func (it *Iterator) Valid() bool { return it.key != nil }
+
+// Key returns the key the iterator is at. It stays valid after moving on.
+func (it *Iterator) Key() []byte { return it.key }
+
+// Val returns the value the iterator is at. It stays valid after moving on.
+func (it *Iterator) Val() []byte { return it.val }
+
+// Err returns what stopped the iterator, if it was not the end of the keys.
+func (it *Iterator) Err() error { return it.err }
+
+// Next moves to the following key.
+func (it *Iterator) Next() { it.step(true) }
+
+// Prev moves to the preceding key.
+func (it *Iterator) Prev() { it.step(false) }
+
+func (it *Iterator) step(forward bool) {
+	if !it.Valid() {
+		return
+	}
+	err := it.db.view(func(tree *btree.BTree, commit uint64) {
+		bi := it.it
+		if commit != it.commit {
+			// bi's pages may have been reused: look the key up again.
+			if forward {
+				bi = tree.SeekGE(it.key)
+			} else {
+				bi = tree.SeekLE(it.key)
+			}
+			if !bi.Valid() || !bytes.Equal(bi.Key(), it.key) {
+				it.at(tree, bi, commit, forward) // already at the neighbour
+				return
+			}
+		}
+		// Same commit: its pages are pinned by the snapshot view holds.
+		if forward {
+			bi.Next()
+		} else {
+			bi.Prev()
+		}
+		it.at(tree, bi, commit, forward)
+	})
+	if err != nil {
+		it.err = err
+		it.key, it.val = nil, nil
+	}
+}
+
+// Scan calls fn with every key-value in [lo, hi) in order, until fn returns
+// false; a nil hi means no upper bound. The scan reads a snapshot of the
+// last commit, so fn sees a consistent state even while updates go on.
+// The key and value are only valid during the call, and keys whose TTL has
+// passed are left out. fn must not close db.
+func (db *DB) Scan(lo, hi []byte, fn func(key, val []byte) bool) error {
+	return db.ScanContext(context.Background(), lo, hi, fn)
+}
+
+// ScanContext is Scan, giving up with the error of ctx once ctx is done.
+func (db *DB) ScanContext(ctx context.Context, lo, hi []byte, fn func(key, val []byte) bool) error {
+	var err error
+	if verr := db.view(func(tree *btree.BTree, _ uint64) { err = scan(ctx, tree, lo, hi, fn) }); verr != nil {
+		return verr
+	}
+	return err
+}
+
+// scanCheck is how many keys scan goes through between looks at its
+// context.
+const scanCheck = 256
+
+func scan(ctx context.Context, tree *btree.BTree, lo, hi []byte, fn func(key, val []byte) bool) error {
+	d := newDeadlines(tree, lo)
+	n := 0
+	for it := tree.SeekGE(lo); it.Valid(); it.Next() {
+		if n++; n%scanCheck == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if hi != nil && bytes.Compare(it.Key(), hi) >= 0 {
+			break
+		}
+		if d.expired(it.Key()) {
+			continue
+		}
+		if !fn(it.Key(), it.Val()) {
+			break
+		}
+	}
+	return nil
+}
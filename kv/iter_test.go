@@ -0,0 +1,150 @@
+package kv_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// fill sets keys "k000" to "k<n-1>", to "v<i>", in one transaction.
+func fill(tb testing.TB, db *kv.DB, n int) {
+	tb.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i := range n {
+		if err = tx.Set(fmt.Appendf(nil, "k%03d", i), fmt.Appendf(nil, "v%d", i)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func TestIterator(t *testing.T) {
+	db := open(t, kv.Options{PageSize: 512})
+	fill(t, db, 300)
+	it := db.Seek([]byte("k1"))
+	for i := 100; i < 300; i++ {
+		if !it.Valid() || string(it.Key()) != fmt.Sprintf("k%03d", i) || string(it.Val()) != fmt.Sprint("v", i) {
+			t.Fatalf("at %q=%q, want k%03d", it.Key(), it.Val(), i)
+		}
+		it.Next()
+	}
+	if it.Valid() || it.Err() != nil {
+		t.Errorf("past the end: valid %v, error %v", it.Valid(), it.Err())
+	}
+
+	it = db.Seek([]byte("k055x"))
+	key := it.Key()
+	it.Prev()
+	it.Prev()
+	if string(key) != "k056" || string(it.Key()) != "k054" {
+		t.Errorf("Seek(k055x) at %q, two back at %q; want k056, k054", key, it.Key())
+	}
+	for it = db.Seek(nil); it.Valid(); it.Prev() {
+	}
+	if it.Err() != nil {
+		t.Error(it.Err())
+	}
+	if db.Seek([]byte("l")).Valid() {
+		t.Error("Seek past every key is valid")
+	}
+}
+
+func TestIteratorAcrossCommits(t *testing.T) {
+	// An iterator goes on by key over the commits made between its steps.
+	db := open(t, kv.Options{PageSize: 512})
+	fill(t, db, 100)
+	it := db.Seek([]byte("k010"))
+	if err := db.Set([]byte("k010a"), []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Del([]byte("k011")); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for range 3 {
+		it.Next()
+		keys = append(keys, string(it.Key()))
+	}
+	if fmt.Sprint(keys) != "[k010a k012 k013]" {
+		t.Errorf("after the update the iterator goes on with %v", keys)
+	}
+	// Its own key deleted, it steps to the neighbour.
+	if _, err := db.Del([]byte("k013")); err != nil {
+		t.Fatal(err)
+	}
+	it.Prev()
+	if string(it.Key()) != "k012" {
+		t.Errorf("Prev from a deleted key at %q, want k012", it.Key())
+	}
+	db.Close()
+	it.Next()
+	if it.Valid() || it.Err() != kv.ErrClosed {
+		t.Errorf("step after Close: valid %v, error %v", it.Valid(), it.Err())
+	}
+}
+
+func TestScan(t *testing.T) {
+	db := open(t, kv.Options{PageSize: 512})
+	fill(t, db, 300)
+	for _, tc := range []struct {
+		lo, hi      string
+		first, last string
+		n           int
+	}{
+		{"k100", "k200", "k100", "k199", 100},
+		{"k1", "k2", "k100", "k199", 100},
+		{"", "", "k000", "k299", 300},
+		{"k250", "", "k250", "k299", 50},
+		{"k100", "k100", "", "", 0},
+		{"z", "", "", "", 0},
+	} {
+		var hi []byte
+		if tc.hi != "" {
+			hi = []byte(tc.hi)
+		}
+		var first, last string
+		n := 0
+		err := db.Scan([]byte(tc.lo), hi, func(key, val []byte) bool {
+			if n == 0 {
+				first = string(key)
+			}
+			last = string(key)
+			n++
+			return true
+		})
+		if err != nil || n != tc.n || first != tc.first || last != tc.last {
+			t.Errorf("Scan(%q, %q): %d keys from %q to %q, %v; want %d from %q to %q", tc.lo, tc.hi, n, first, last, err, tc.n, tc.first, tc.last)
+		}
+	}
+
+	n := 0
+	db.Scan(nil, nil, func(key, val []byte) bool {
+		n++
+		return n < 7
+	})
+	if n != 7 {
+		t.Errorf("Scan went on for %d keys after fn returned false at 7", n)
+	}
+
+	// fn sees the commit the scan started on, even as it updates.
+	n = 0
+	set := make(chan error, 1)
+	err := db.Scan(nil, nil, func(key, val []byte) bool {
+		if n++; n == 1 {
+			go func() { set <- db.Set([]byte("k999"), nil) }()
+		}
+		return true
+	})
+	if serr := <-set; serr != nil {
+		t.Fatal(serr)
+	}
+	if err != nil || n != 300 {
+		t.Errorf("Scan saw %d keys, %v; want the 300 of its commit", n, err)
+	}
+}
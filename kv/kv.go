@@ -0,0 +1,492 @@
+// Package kv is a key-value store in a single file: a B+tree (package
+// btree) over pages kept and committed by package pager.
+//
+// Keys are ordered byte strings; Get, Set and Del are each atomic and, by
+// default (see Options.Sync), durable once they return: a crash never
+// leaves a half-applied update behind. Updates are grouped with
+// transactions (Begin), whose savepoints undo a part of one
+// (Tx.Savepoint); readers
+// (BeginRead, Get, Scan, iterators) work on a snapshot of the last commit
+// and run concurrently with the one writer. A key set with SetWithTTL
+// expires: reads leave it out, and Sweep deletes it (see ttl.go). Watch
+// follows the changes committed, and Replicate streams them to the
+// follower of a primary (see replica.go). The methods ending in Context
+// give up when their context is done: on the wait for the write
+// transaction, a long scan, or the sync a commit shares.
+package kv
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/fileio"
+	"github.com/adcondev/go-database/pager"
+	"github.com/adcondev/go-database/vfs"
+)
+
+var (
+	ErrKeyNotFound = errors.New("kv: key not found")
+	ErrClosed      = errors.New("kv: database is closed")
+	ErrTxClosed    = errors.New("kv: transaction already committed or rolled back")
+	ErrReadOnly    = errors.New("kv: update in a read-only transaction or database")
+	ErrTxStale     = errors.New("kv: read transaction older than the last Compact")
+	ErrNoSavepoint = errors.New("kv: no such savepoint")
+
+	// ErrCorrupt is pager.ErrCorrupt: the file is damaged. The error
+	// returned is a *btree.CorruptError naming the page.
+	ErrCorrupt = pager.ErrCorrupt
+)
+
+// Options tunes how a database is opened. The zero value is what Open
+// uses.
+type Options struct {
+	// PageSize is the page size of a new database; zero means
+	// btree.DefaultPageSize. It bounds the size of keys and values (see
+	// btree.BTree.MaxKeySize). An existing database keeps its own.
+	PageSize int
+
+	// MaxValueSize bounds the size of a value Set takes; zero means
+	// btree.DefaultValueLimit. Values too large for a page are kept on
+	// overflow pages, and GetReader reads them without holding them in
+	// memory whole.
+	MaxValueSize int
+
+	// Mode is the permission of a newly created file; zero means 0664.
+	Mode os.FileMode
+
+	// FS is the file system the database lives on; see pager.Options.FS.
+	FS vfs.FileSystem
+
+	// Durability decides how updates are synced; see pager.Durability.
+	Durability pager.Durability
+
+	// Sync decides when updates are synced; see pager.SyncPolicy. Under
+	// SyncBatch, Commit returns once its sync is done, which the commits
+	// of concurrent writers share; under SyncInterval and SyncOff it
+	// returns before, and a crash may lose the update.
+	Sync pager.SyncPolicy
+
+	// SyncDelay is pager.Options.SyncDelay.
+	SyncDelay time.Duration
+
+	// NoMmap, CacheSize and Eviction set up the page cache; see
+	// pager.Options.
+	NoMmap    bool
+	CacheSize int
+	Eviction  pager.Eviction
+
+	// Compressor compresses the pages of the database, for instance with
+	// pager.Flate; see pager.Options.Compressor. A database with
+	// compressed pages must be opened with one of the same name.
+	Compressor pager.Compressor
+
+	// Key or DeriveKey encrypts the database with AES-GCM; see
+	// pager.Options.Key. An encrypted database opens only with its key.
+	Key       []byte
+	DeriveKey func(salt []byte) ([]byte, error)
+
+	// ReadOnly opens an existing database for reading: Begin, Set and
+	// Del fail with ErrReadOnly. Read-only opens share the file between
+	// processes; a read-write open needs it to itself and otherwise fails
+	// with pager.ErrLocked.
+	ReadOnly bool
+
+	// ContinueOnError opens a damaged database read-only, for salvage:
+	// reads skip the keys on pages that fail their checksum instead of
+	// failing with ErrCorrupt. See pager.Options.ContinueOnError.
+	ContinueOnError bool
+
+	// SweepInterval, if positive, has a goroutine call Sweep that often,
+	// to delete the keys whose TTL has passed, until the database is
+	// closed. Read-only databases are not swept.
+	SweepInterval time.Duration
+
+	// Follower opens the database as the follower of a primary: only
+	// Follow updates it, with the changes the primary streams (see
+	// DB.Replicate), and to everything else it is read-only. A follower
+	// cannot be opened ReadOnly.
+	Follower bool
+
+	// ReplicaBacklog is how many changes a primary keeps for followers
+	// that reconnect, and how many a follower can fall behind, before it
+	// is sent a snapshot instead; zero means 10000. See DB.Replicate.
+	ReplicaBacklog int
+}
+
+// DB is an open database. Its methods are safe for concurrent use. There
+// is one write transaction at a time: Begin waits for the open one to end.
+type DB struct {
+	writer   lock         // held by the write transaction
+	mu       sync.RWMutex // read-held by reads, held by Close
+	pager    *pager.Pager // only the writer uses it, except for Snapshot
+	sync     pager.SyncPolicy
+	maxValue int // see Options.MaxValueSize
+	readOnly bool
+	closed   bool
+	stop     func() // stops the background sweep, if there is one
+
+	commits    atomic.Uint64   // see Stats
+	commitTime fileio.Recorder // of Commit
+
+	watchMu  sync.Mutex // guards watchers and the backlog
+	watchers map[*Watcher]bool
+
+	follower    bool
+	maxBacklog  int      // see Options.ReplicaBacklog
+	backlog     []Change // of the commits after backlogFrom, once kept
+	backlogFrom uint64
+	keepBacklog bool
+}
+
+// lock is a mutex whose wait can be given up (see lockContext): a channel
+// holding a token while it is held.
+type lock chan struct{}
+
+func (l lock) Lock()   { l <- struct{}{} }
+func (l lock) Unlock() { <-l }
+
+// lockContext is Lock, giving up with the error of ctx once ctx is done.
+func (l lock) lockContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Open opens the database at path, creating it if needed. The path
+// pager.Memory, ":memory:", opens a new database held in memory instead,
+// which goes away when it is closed.
+func Open(path string) (*DB, error) {
+	return Options{}.Open(path)
+}
+
+// OpenContext is Open, waiting for the file while another process has it
+// locked; see Options.OpenContext.
+func OpenContext(ctx context.Context, path string) (*DB, error) {
+	return Options{}.OpenContext(ctx, path)
+}
+
+// OpenContext is Open honouring the options in o, except that while
+// another process has the file locked (see ReadOnly) it tries again, more
+// and more slowly, rather than failing with pager.ErrLocked, until ctx is
+// done. It fails then with both pager.ErrLocked and the error of ctx.
+func (o Options) OpenContext(ctx context.Context, path string) (*DB, error) {
+	delay := time.Millisecond
+	for {
+		db, err := o.Open(path)
+		if !errors.Is(err, pager.ErrLocked) {
+			return db, err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("%w: %w", err, ctx.Err())
+		}
+		delay = min(2*delay, 100*time.Millisecond)
+	}
+}
+
+// Open is Open honouring the options in o.
+func (o Options) Open(path string) (*DB, error) {
+	if o.Follower && (o.ReadOnly || o.ContinueOnError) {
+		return nil, errors.New("kv: a follower cannot be read-only")
+	}
+	p, err := pager.Options{
+		PageSize:        o.PageSize,
+		Mode:            o.Mode,
+		FS:              o.FS,
+		Durability:      o.Durability,
+		Sync:            o.Sync,
+		SyncDelay:       o.SyncDelay,
+		NoMmap:          o.NoMmap,
+		CacheSize:       o.CacheSize,
+		Eviction:        o.Eviction,
+		Compressor:      o.Compressor,
+		Key:             o.Key,
+		DeriveKey:       o.DeriveKey,
+		ReadOnly:        o.ReadOnly,
+		ContinueOnError: o.ContinueOnError,
+	}.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{
+		writer:     make(lock, 1),
+		pager:      p,
+		sync:       o.Sync,
+		maxValue:   o.MaxValueSize,
+		readOnly:   o.ReadOnly || o.ContinueOnError || o.Follower,
+		follower:   o.Follower,
+		maxBacklog: cmp.Or(o.ReplicaBacklog, 10000),
+	}
+	if o.SweepInterval > 0 && !db.readOnly {
+		stop, done := make(chan struct{}), make(chan struct{})
+		go db.sweeper(o.SweepInterval, stop, done)
+		db.stop = sync.OnceFunc(func() {
+			close(stop)
+			<-done
+		})
+	}
+	return db, nil
+}
+
+// view calls fn with the tree of a snapshot of the last commit.
+func (db *DB) view(fn func(tree *btree.BTree, commit uint64)) (err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return ErrClosed
+	}
+	snap := db.pager.Snapshot()
+	defer snap.Release()
+	defer catch(&err)
+	fn(db.snapTree(snap), snap.Commit())
+	return nil
+}
+
+// catch recovers the panic with which the pager reports a damaged page
+// (see pager.Pager.Page) into *err. Other panics go on.
+func catch(err *error) {
+	switch r := recover().(type) {
+	case nil:
+	case *btree.CorruptError:
+		*err = r
+	default:
+		panic(r)
+	}
+}
+
+// snapTree returns the tree snap views.
+func (db *DB) snapTree(snap *pager.Snapshot) *btree.BTree {
+	return &btree.BTree{Root: snap.Root(), Pager: snap, PageSize: db.pager.PageSize()}
+}
+
+// Get returns a copy of the value stored under key, or ErrKeyNotFound.
+func (db *DB) Get(key []byte) ([]byte, error) {
+	return db.GetContext(context.Background(), key)
+}
+
+// GetContext is Get, unless ctx is done: it returns the error of ctx then.
+// A Get reads a few pages and waits for nothing but a Compact under way,
+// which it cannot give up on.
+func (db *DB) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var val []byte
+	var err error
+	if verr := db.view(func(tree *btree.BTree, _ uint64) { val, err = get(tree, key) }); verr != nil {
+		return nil, verr
+	}
+	return val, err
+}
+
+// GetReader returns a reader of the value stored under key, or
+// ErrKeyNotFound. It reads a value on overflow pages a page at a time, on
+// a snapshot of the last commit, which it holds until closed; see
+// Tx.GetReader.
+func (db *DB) GetReader(key []byte) (io.ReadCloser, error) {
+	tx, err := db.BeginRead()
+	if err != nil {
+		return nil, err
+	}
+	r, err := tx.GetReader(key)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return valueCloser{r, tx}, nil
+}
+
+// valueCloser is a reader of GetReader, ending its transaction on Close.
+type valueCloser struct {
+	io.Reader
+	tx *Tx
+}
+
+func (v valueCloser) Close() error { return v.tx.Rollback() }
+
+func get(tree *btree.BTree, key []byte) ([]byte, error) {
+	val, ok := tree.Get(key)
+	if !ok || expired(tree, key) {
+		return nil, ErrKeyNotFound
+	}
+	return bytes.Clone(val), nil
+}
+
+// Set stores val under key, replacing any value already there, in a
+// transaction of its own.
+func (db *DB) Set(key, val []byte) error {
+	return db.SetContext(context.Background(), key, val)
+}
+
+// SetContext is Set with a transaction of BeginContext and CommitContext:
+// it gives up when ctx is done, as they do.
+func (db *DB) SetContext(ctx context.Context, key, val []byte) error {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err = tx.Set(key, val); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.CommitContext(ctx)
+}
+
+// Del removes key, in a transaction of its own, and reports whether it was
+// there.
+func (db *DB) Del(key []byte) (bool, error) {
+	return db.DelContext(context.Background(), key)
+}
+
+// DelContext is Del with a transaction of BeginContext and CommitContext:
+// it gives up when ctx is done, as they do.
+func (db *DB) DelContext(ctx context.Context, key []byte) (bool, error) {
+	tx, err := db.BeginContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := tx.Del(key)
+	if err != nil || !deleted {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.CommitContext(ctx)
+}
+
+// BulkLoad fills an empty database with the key-values of seq, which must
+// come in strictly increasing key order, in a single transaction: its
+// pages are built bottom-up (see btree.BTree.BulkLoad), held in memory and
+// synced once, at the end. It is much faster than setting the keys one by
+// one and leaves the pages full. On an error, from the tree or
+// btree.ErrNotEmpty if the database has keys, nothing is loaded. seq must
+// not use db.
+func (db *DB) BulkLoad(seq iter.Seq2[[]byte, []byte]) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if tx.watched {
+		seq = tx.noting(seq)
+	}
+	if err = tx.update(func() error { return tx.tree.BulkLoad(seq) }); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Verify checks the database file for corruption, as of the last commit;
+// see pager.Pager.Verify. It returns nil, or every problem found, each a
+// *btree.CorruptError matching ErrCorrupt and naming its page. It waits
+// for the write transaction, if one is open, and holds off the next one
+// while it runs; reads go on.
+func (db *DB) Verify() error {
+	db.writer.Lock()
+	defer db.writer.Unlock()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return ErrClosed
+	}
+	_, err := db.pager.Verify()
+	return err
+}
+
+// Backup writes a copy of the database, as of the last commit, to w: the
+// content of a database file that Open can open. Updates go on while it
+// runs; see pager.Snapshot.WriteTo. It returns the number of the commit
+// copied, which tools can compare with LastCommit later to tell whether
+// the backup is still current.
+func (db *DB) Backup(w io.Writer) (uint64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return 0, ErrClosed
+	}
+	snap := db.pager.Snapshot()
+	defer snap.Release()
+	_, err := snap.WriteTo(w)
+	return snap.Commit(), err
+}
+
+// LastCommit returns the number of the last commit. Commits are numbered
+// from 1, in order, so a database whose number has not moved since a
+// backup still holds what the backup does. It returns 0 once db is closed.
+func (db *DB) LastCommit() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return 0
+	}
+	return db.pager.LastCommit()
+}
+
+// Compact shrinks the database file to what its keys need and reports its
+// size before and after; see pager.Pager.Compact. Deleted keys leave free
+// pages that later updates reuse, but the file never gives them back
+// otherwise. Keys whose TTL has passed are swept (see Sweep) first. Compact
+// waits for the write transaction, if one is open, and holds off updates
+// and reads while it runs. Read transactions still open fail with
+// ErrTxStale from then on.
+func (db *DB) Compact() (pager.CompactStats, error) {
+	if _, err := db.Sweep(); err != nil {
+		return pager.CompactStats{}, err
+	}
+	db.writer.Lock()
+	defer db.writer.Unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	switch {
+	case db.closed:
+		return pager.CompactStats{}, ErrClosed
+	case db.readOnly:
+		return pager.CompactStats{}, ErrReadOnly
+	}
+	p, stats, err := db.pager.Compact()
+	if p == nil {
+		// The file could not be opened again.
+		db.closed = true
+		db.endWatches()
+	} else {
+		db.pager = p
+	}
+	return stats, err
+}
+
+// Close closes the database, after waiting for the write transaction, if
+// one is open. Read transactions still open fail from then on.
+func (db *DB) Close() error {
+	if db.stop != nil {
+		// Before the locks: a sweep under way needs them to finish.
+		db.stop()
+	}
+	db.writer.Lock()
+	defer db.writer.Unlock()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	db.closed = true
+	db.endWatches()
+	return db.pager.Close()
+}
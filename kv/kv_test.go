@@ -0,0 +1,288 @@
+package kv_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"iter"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/kv"
+)
+
+// open opens a new database for a test, which closes it at the end.
+func open(tb testing.TB, o kv.Options) *kv.DB {
+	tb.Helper()
+	db, err := o.Open(filepath.Join(tb.TempDir(), "db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// mustGet returns the value of key, failing the test if there is none.
+func mustGet(tb testing.TB, db *kv.DB, key string) string {
+	tb.Helper()
+	val, err := db.Get([]byte(key))
+	if err != nil {
+		tb.Fatalf("Get(%q): %v", key, err)
+	}
+	return string(val)
+}
+
+func TestSetGetDel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Get([]byte("k")); err != kv.ErrKeyNotFound {
+		t.Errorf("Get in a new database: %v, want ErrKeyNotFound", err)
+	}
+	for i := range 1000 {
+		if err = db.Set(fmt.Appendf(nil, "k%04d", i), fmt.Appendf(nil, "v%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = db.Set([]byte("k0000"), []byte("replaced")); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"k0001", "k0500", "nope"} {
+		deleted, err := db.Del([]byte(k))
+		if err != nil || deleted != (k != "nope") {
+			t.Errorf("Del(%q) = %v, %v", k, deleted, err)
+		}
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Get([]byte("k0000")); err != kv.ErrClosed {
+		t.Errorf("Get after Close: %v, want ErrClosed", err)
+	}
+	if err = db.Set([]byte("k"), nil); err != kv.ErrClosed {
+		t.Errorf("Set after Close: %v, want ErrClosed", err)
+	}
+	if err = db.Close(); err != kv.ErrClosed {
+		t.Errorf("second Close: %v, want ErrClosed", err)
+	}
+
+	// Every update was durable.
+	if db, err = kv.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v := mustGet(t, db, "k0000"); v != "replaced" {
+		t.Errorf("k0000 = %q after reopening", v)
+	}
+	if v := mustGet(t, db, "k0999"); v != "v999" {
+		t.Errorf("k0999 = %q after reopening", v)
+	}
+	for _, k := range []string{"k0001", "k0500"} {
+		if _, err = db.Get([]byte(k)); err != kv.ErrKeyNotFound {
+			t.Errorf("deleted %s: %v, want ErrKeyNotFound", k, err)
+		}
+	}
+}
+
+func TestGetReturnsCopy(t *testing.T) {
+	db := open(t, kv.Options{})
+	val := []byte("value")
+	if err := db.Set([]byte("k"), val); err != nil {
+		t.Fatal(err)
+	}
+	val[0] = 'X'
+	got, err := db.Get([]byte("k"))
+	if err != nil || string(got) != "value" {
+		t.Fatalf("Get = %q, %v; Set kept the caller's slice", got, err)
+	}
+	got[0] = 'Y'
+	if v := mustGet(t, db, "k"); v != "value" {
+		t.Errorf("changing a value read changed the database: %q", v)
+	}
+}
+
+func TestBadKeys(t *testing.T) {
+	db := open(t, kv.Options{PageSize: 1024, MaxValueSize: 100})
+	for _, tc := range []struct {
+		key, val []byte
+		want     error
+	}{
+		{nil, []byte("v"), btree.ErrEmptyKey},
+		{make([]byte, 1024), nil, btree.ErrKeyTooLarge},
+		{[]byte("k"), make([]byte, 101), btree.ErrValueTooLarge},
+	} {
+		if err := db.Set(tc.key, tc.val); !errors.Is(err, tc.want) {
+			t.Errorf("Set of a %d-byte key, %d-byte value: %v, want %v", len(tc.key), len(tc.val), err, tc.want)
+		}
+	}
+	if db.LastCommit() != 0 {
+		t.Errorf("failed sets made %d commits", db.LastCommit())
+	}
+}
+
+func TestMemory(t *testing.T) {
+	db, err := kv.Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	big := bytes.Repeat([]byte("x"), 500)
+	if err = db.Set([]byte("big"), big); err != nil {
+		t.Fatal(err)
+	}
+	if v := mustGet(t, db, "big"); v != string(big) {
+		t.Errorf("value of %d bytes read back as %d", len(big), len(v))
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+	seq := func(n int) iter.Seq2[[]byte, []byte] {
+		return func(yield func([]byte, []byte) bool) {
+			for i := range n {
+				if !yield(fmt.Appendf(nil, "k%06d", i), fmt.Appendf(nil, "v%d", i)) {
+					return
+				}
+			}
+		}
+	}
+	unsorted := func(yield func([]byte, []byte) bool) {
+		for k, v := range seq(5000) {
+			if !yield(k, v) {
+				return
+			}
+		}
+		yield([]byte("a"), nil)
+	}
+	if err = db.BulkLoad(unsorted); !errors.Is(err, btree.ErrUnsorted) {
+		t.Fatalf("BulkLoad of unsorted keys: %v, want ErrUnsorted", err)
+	}
+	if _, err = db.Get([]byte("k000000")); err != kv.ErrKeyNotFound {
+		t.Errorf("Get after a failed load: %v, want ErrKeyNotFound", err)
+	}
+
+	commit := db.LastCommit()
+	if err = db.BulkLoad(seq(5000)); err != nil {
+		t.Fatal(err)
+	}
+	if db.LastCommit() != commit+1 {
+		t.Errorf("BulkLoad took commits %d to %d, want one", commit, db.LastCommit())
+	}
+	if err = db.BulkLoad(seq(1)); !errors.Is(err, btree.ErrNotEmpty) {
+		t.Errorf("BulkLoad into a database with keys: %v, want ErrNotEmpty", err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = kv.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 1234, 4999} {
+		if got, want := mustGet(t, db, fmt.Sprintf("k%06d", i)), fmt.Sprint("v", i); got != want {
+			t.Errorf("k%06d after reopening = %q, want %q", i, got, want)
+		}
+	}
+}
+
+// TestLastCommitCompact is for the race detector: Compact replaces the
+// pager LastCommit reads.
+func TestLastCommitCompact(t *testing.T) {
+	db := open(t, kv.Options{})
+	fill(t, db, 100)
+	done := make(chan error)
+	go func() {
+		for range 20 {
+			if _, err := db.Compact(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	var last uint64
+	for running := true; running; {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+			running = false
+		default:
+		}
+		c := db.LastCommit()
+		if c < last {
+			t.Fatalf("LastCommit went from %d back to %d", last, c)
+		}
+		last = c
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c := db.LastCommit(); c != 0 {
+		t.Errorf("LastCommit of a closed database = %d, want 0", c)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { db.Close() }()
+	for i := range 3000 {
+		if err = db.Set(fmt.Appendf(nil, "k%04d", i), bytes.Repeat([]byte("v"), 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 100; i < 3000; i++ {
+		if _, err = db.Del(fmt.Appendf(nil, "k%04d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx, err := db.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	stats, err := db.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.After >= stats.Before/4 {
+		t.Errorf("Compact took %d bytes to %d", stats.Before, stats.After)
+	}
+	if _, err = tx.Get([]byte("k0000")); !errors.Is(err, kv.ErrTxStale) {
+		t.Errorf("Get in a read transaction from before Compact: %v, want ErrTxStale", err)
+	}
+	if got := mustGet(t, db, "k0099"); len(got) != 100 {
+		t.Errorf("k0099 after Compact = %q", got)
+	}
+	if _, err = db.Get([]byte("k0100")); err != kv.ErrKeyNotFound {
+		t.Errorf("Get of a deleted key after Compact: %v, want ErrKeyNotFound", err)
+	}
+	if err = db.Set([]byte("after"), []byte("compact")); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if db, err = kv.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, db, "after"); got != "compact" {
+		t.Errorf("after = %q after reopening, want %q", got, "compact")
+	}
+	if err = db.Verify(); err != nil {
+		t.Error(err)
+	}
+}
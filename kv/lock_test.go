@@ -0,0 +1,48 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows
+
+package kv_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/pager"
+)
+
+func TestOpenContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set([]byte("k"), []byte("v"))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, err = kv.OpenContext(ctx, path)
+	if !errors.Is(err, pager.ErrLocked) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("OpenContext of a locked file: %v, want ErrLocked and DeadlineExceeded", err)
+	}
+
+	// It opens the file once the holder lets go.
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		db.Close()
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if db, err = (kv.Options{ReadOnly: true}).OpenContext(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v := mustGet(t, db, "k"); v != "v" {
+		t.Errorf("k = %q", v)
+	}
+	// Errors other than the lock come back at once.
+	if _, err = kv.OpenContext(ctx, t.TempDir()); err == nil || errors.Is(err, pager.ErrLocked) || ctx.Err() != nil {
+		t.Errorf("OpenContext of a directory: %v", err)
+	}
+}
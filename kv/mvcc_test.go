@@ -0,0 +1,177 @@
+package kv_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+func TestSnapshotIsolation(t *testing.T) {
+	db := open(t, kv.Options{})
+	fill(t, db, 10)
+	tx, err := db.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	db.Set([]byte("k000"), []byte("changed"))
+	db.Del([]byte("k001"))
+	db.Set([]byte("k100"), []byte("added"))
+
+	if v, err := tx.Get([]byte("k000")); err != nil || string(v) != "v0" {
+		t.Errorf("k000 = %q, %v in the read transaction, want the value it began on", v, err)
+	}
+	if _, err := tx.Get([]byte("k001")); err != nil {
+		t.Errorf("k001 deleted since the read transaction began: %v", err)
+	}
+	n := 0
+	tx.Scan(nil, nil, func(key, val []byte) bool { n++; return true })
+	if n != 10 {
+		t.Errorf("read transaction scans %d keys, want the 10 it began on", n)
+	}
+	if v := mustGet(t, db, "k000"); v != "changed" {
+		t.Errorf("k000 = %q outside the transaction", v)
+	}
+}
+
+// TestConcurrentReaders hammers a database with readers while a writer
+// commits: each commit sets every key to the same value, so a reader that
+// sees two values saw part of a commit.
+func TestConcurrentReaders(t *testing.T) {
+	const keys, commits, readers = 200, 40, 6
+	db := open(t, kv.Options{PageSize: 512})
+	fill(t, db, keys)
+	setAll := func(tx *kv.Tx, val []byte) error {
+		for i := range keys {
+			if err := tx.Set(fmt.Appendf(nil, "k%03d", i), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tx, _ := db.Begin()
+	setAll(tx, []byte("c0"))
+	tx.Commit()
+
+	done := make(chan struct{})
+	errs := make(chan error, readers+1)
+	var wg sync.WaitGroup
+	for r := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				var err error
+				switch r % 3 {
+				case 0:
+					err = readTx(db, keys)
+				case 1:
+					err = readScan(db, keys)
+				default:
+					err = readIter(db, keys)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	for c := 1; c <= commits; c++ {
+		tx, err := db.Begin()
+		if err == nil {
+			if err = setAll(tx, fmt.Appendf(nil, "c%d", c)); err == nil {
+				err = tx.Commit()
+			}
+		}
+		if err != nil {
+			errs <- err
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// readTx reads every key with Get in a read transaction.
+func readTx(db *kv.DB, keys int) error {
+	tx, err := db.BeginRead()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	first, err := tx.Get([]byte("k000"))
+	if err != nil {
+		return err
+	}
+	for i := 1; i < keys; i++ {
+		v, err := tx.Get(fmt.Appendf(nil, "k%03d", i))
+		if err != nil {
+			return err
+		}
+		if string(v) != string(first) {
+			return fmt.Errorf("read transaction sees k000=%s and k%03d=%s", first, i, v)
+		}
+	}
+	return nil
+}
+
+// readScan reads every key with Scan.
+func readScan(db *kv.DB, keys int) error {
+	var first string
+	n := 0
+	var err error
+	serr := db.Scan(nil, nil, func(key, val []byte) bool {
+		if n++; n == 1 {
+			first = string(val)
+		} else if string(val) != first {
+			err = fmt.Errorf("scan sees k000=%s and %s=%s", first, key, val)
+			return false
+		}
+		return true
+	})
+	if serr != nil {
+		return serr
+	}
+	if err == nil && n != keys {
+		err = fmt.Errorf("scan sees %d keys, want %d", n, keys)
+	}
+	return err
+}
+
+// readIter walks the keys with an iterator, which may move on to later
+// commits between its steps, but never back.
+func readIter(db *kv.DB, keys int) error {
+	last := -1
+	n := 0
+	it := db.Seek(nil)
+	for ; it.Valid(); it.Next() {
+		var c int
+		if _, err := fmt.Sscanf(string(it.Val()), "c%d", &c); err != nil {
+			return fmt.Errorf("iterator at %s=%q", it.Key(), it.Val())
+		}
+		if c < last {
+			return fmt.Errorf("iterator went back from commit %d to %d at %s", last, c, it.Key())
+		}
+		last = c
+		n++
+	}
+	if it.Err() != nil {
+		return it.Err()
+	}
+	if n != keys {
+		return fmt.Errorf("iterator saw %d keys, want %d", n, keys)
+	}
+	return nil
+}
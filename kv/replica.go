@@ -0,0 +1,346 @@
+package kv
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/pager"
+)
+
+// A primary streams its commits to a follower (Options.Follower) as
+// frames,
+//
+//	| kind | commit | entry ... | 0 |
+//	|  1B  |   8B   |           |   |
+//
+// each entry a key and what became of it,
+//
+//	| len(key)+1 | key | len(val)+1 | val |
+//	|  uvarint   |     |  uvarint   |     |
+//
+// where a value length of 0, with no value, deletes the key. A frame of
+// kind frameCommit holds the changes of the commit of the primary it
+// numbers, big-endian; a frame of kind frameSnapshot holds every key-value
+// of the primary as of the commit, in place of the follower's own. Either
+// is applied whole, in a transaction, or not at all.
+const (
+	frameCommit   = 'c'
+	frameSnapshot = 's'
+)
+
+// ReplicaKey is the key under which a follower keeps the number of the last
+// commit of its primary it applied, 8 bytes big-endian; see Replicated.
+const ReplicaKey = "\x00r"
+
+var ErrNotFollower = errors.New("kv: database is not a follower")
+
+// Replicate streams the commits of db to w, for a follower to apply with
+// Follow, until db closes, when it returns ErrClosed, or writing to w
+// fails. since is the commit of db the follower is at (see Replicated):
+// if the backlog db keeps of its changes (see Options.ReplicaBacklog)
+// still holds every commit after it, those are sent first; if not, or if
+// the follower falls more than the backlog behind later on, the follower
+// is sent a snapshot of every key-value, and goes on from there. The
+// backlog is kept from the first call on. Any number of followers can be
+// streamed to at once.
+//
+// Over a network the follower tells the primary since, and the primary
+// calls Replicate with it on the connection. A connection that breaks is
+// noticed at the next write. Followers are streamed what db commits, not
+// its file, so their options need not match db's.
+func (db *DB) Replicate(w io.Writer, since uint64) error {
+	bw := bufio.NewWriter(w)
+	for {
+		watcher, changes, snap, err := db.catchUp(since)
+		if err != nil {
+			return err
+		}
+		since, err = db.stream(bw, watcher, changes, snap, since)
+		watcher.Stop()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// catchUp returns, as of the last commit, a Watcher of the commits to come
+// and either the changes of the backlog committed after since or, if the
+// backlog does not hold them all, a snapshot.
+func (db *DB) catchUp(since uint64) (*Watcher, []Change, *pager.Snapshot, error) {
+	db.writer.Lock()
+	defer db.writer.Unlock()
+	w, err := db.watch(nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	last := db.pager.LastCommit()
+	db.watchMu.Lock()
+	if !db.keepBacklog {
+		db.keepBacklog, db.backlogFrom = true, last
+	}
+	var changes []Change
+	caught := since >= db.backlogFrom && since <= last
+	if caught {
+		i := slices.IndexFunc(db.backlog, func(ch Change) bool { return ch.Commit > since })
+		if i >= 0 {
+			changes = slices.Clone(db.backlog[i:])
+		}
+	}
+	db.watchMu.Unlock()
+	if caught {
+		return w, changes, nil, nil
+	}
+	// No Close can come between watch and here: it waits for the writer.
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return w, nil, db.pager.Snapshot(), nil
+}
+
+// keep adds the changes of a commit to the backlog, dropping the oldest
+// commits of those beyond db.maxBacklog. The caller holds watchMu.
+func (db *DB) keep(changes []Change) {
+	db.backlog = append(db.backlog, changes...)
+	for len(db.backlog) > db.maxBacklog {
+		c := db.backlog[0].Commit
+		i := 0
+		for i < len(db.backlog) && db.backlog[i].Commit == c {
+			i++
+		}
+		db.backlog, db.backlogFrom = db.backlog[i:], c
+	}
+}
+
+// stream writes snap, or the changes of the backlog, and then the commits
+// of watcher to bw, until the follower falls too far behind. It returns the
+// last commit written.
+func (db *DB) stream(bw *bufio.Writer, watcher *Watcher, changes []Change, snap *pager.Snapshot, since uint64) (uint64, error) {
+	if snap != nil {
+		since = snap.Commit()
+		if err := db.writeSnapshot(bw, snap); err != nil {
+			return since, err
+		}
+	}
+	for len(changes) > 0 {
+		c := changes[0].Commit
+		n := 1
+		for n < len(changes) && changes[n].Commit == c {
+			n++
+		}
+		if err := writeCommit(bw, changes[:n]); err != nil {
+			return since, err
+		}
+		changes, since = changes[n:], c
+	}
+	for {
+		// Flush before waiting for the next commit, not between commits
+		// already queued.
+		if watcher.backlog() == 0 {
+			if err := bw.Flush(); err != nil {
+				return since, err
+			}
+		}
+		changes, ok := watcher.next()
+		if !ok {
+			return since, ErrClosed
+		}
+		if err := writeCommit(bw, changes); err != nil {
+			return since, err
+		}
+		since = changes[0].Commit
+		if watcher.backlog() > db.maxBacklog {
+			return since, nil // too far behind: start over
+		}
+	}
+}
+
+// writeSnapshot writes a snapshot frame of snap to bw and releases snap.
+// Like Backup it holds off Close while it runs.
+func (db *DB) writeSnapshot(bw *bufio.Writer, snap *pager.Snapshot) (err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	defer snap.Release()
+	if db.closed {
+		return ErrClosed
+	}
+	defer catch(&err)
+	writeHeader(bw, frameSnapshot, snap.Commit())
+	tree := db.snapTree(snap)
+	for it := tree.SeekGE(nil); it.Valid(); it.Next() {
+		if err := writeEntry(bw, it.Key(), it.Val()); err != nil {
+			return err
+		}
+	}
+	return bw.WriteByte(0)
+}
+
+// writeCommit writes a commit frame of changes, all of one commit, to bw.
+func writeCommit(bw *bufio.Writer, changes []Change) error {
+	writeHeader(bw, frameCommit, changes[0].Commit)
+	for _, ch := range changes {
+		if err := writeEntry(bw, ch.Key, ch.New); err != nil {
+			return err
+		}
+	}
+	return bw.WriteByte(0)
+}
+
+func writeHeader(bw *bufio.Writer, kind byte, commit uint64) {
+	bw.WriteByte(kind)
+	bw.Write(binary.BigEndian.AppendUint64(nil, commit))
+}
+
+// writeEntry writes the entry of key to bw: val, or a deletion if val is
+// nil.
+func writeEntry(bw *bufio.Writer, key, val []byte) error {
+	var buf [binary.MaxVarintLen64]byte
+	bw.Write(binary.AppendUvarint(buf[:0], uint64(len(key))+1))
+	bw.Write(key)
+	if val == nil {
+		return bw.WriteByte(0)
+	}
+	bw.Write(binary.AppendUvarint(buf[:0], uint64(len(val))+1))
+	_, err := bw.Write(val)
+	return err
+}
+
+// Follow applies to db, a follower, the frames that the Replicate of its
+// primary streams from r, until r ends. Each commit of the primary is
+// applied in a transaction of its own, so reads on the follower see it
+// whole; a frame cut short is not applied. Follow returns nil at the end
+// of r, and ErrNotFollower if db was not opened with Options.Follower.
+func (db *DB) Follow(r io.Reader) error {
+	if !db.follower {
+		return ErrNotFollower
+	}
+	br := bufio.NewReader(r)
+	for {
+		kind, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = db.apply(br, kind); err != nil {
+			return err
+		}
+	}
+}
+
+// apply applies the frame of the given kind whose header byte was read
+// from br.
+func (db *DB) apply(br *bufio.Reader, kind byte) error {
+	if kind != frameCommit && kind != frameSnapshot {
+		return fmt.Errorf("kv: replication frame of unknown kind %q", kind)
+	}
+	commit := make([]byte, 8)
+	if _, err := io.ReadFull(br, commit); err != nil {
+		return frameError(err)
+	}
+	tx, err := db.begin(context.Background())
+	if err != nil {
+		return err
+	}
+	err = tx.update(func() error {
+		if kind == frameSnapshot {
+			if err := tx.clear(); err != nil {
+				return err
+			}
+		}
+		for {
+			key, val, err := readEntry(br)
+			switch {
+			case err != nil:
+				return frameError(err)
+			case key == nil:
+				return tx.insert([]byte(ReplicaKey), commit)
+			case val == nil:
+				_, err = tx.delete(key)
+			default:
+				err = tx.insert(key, val)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func frameError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("kv: replication frame: %w", err)
+}
+
+// readEntry reads an entry from br: a key and its value, nil for a
+// deletion, or a nil key at the end of the frame.
+func readEntry(br *bufio.Reader) (key, val []byte, err error) {
+	key, err = readBytes(br, btree.MaxPageSize)
+	if err != nil || key == nil {
+		return nil, nil, err
+	}
+	val, err = readBytes(br, btree.DefaultValueLimit)
+	return key, val, err
+}
+
+// readBytes reads a length plus one and that many bytes from br, or nil for
+// a length of 0. Lengths over max fail, against a damaged stream.
+func readBytes(br *bufio.Reader, max int) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	switch {
+	case err != nil:
+		return nil, err
+	case n == 0:
+		return nil, nil
+	case n-1 > uint64(max):
+		return nil, fmt.Errorf("a length of %d", n-1)
+	}
+	buf := make([]byte, n-1)
+	_, err = io.ReadFull(br, buf)
+	return buf, err
+}
+
+// clear deletes every key.
+func (tx *Tx) clear() error {
+	for {
+		var keys [][]byte
+		for it := tx.tree.SeekGE(nil); it.Valid() && len(keys) < sweepBatch; it.Next() {
+			keys = append(keys, slices.Clone(it.Key()))
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		for _, key := range keys {
+			if _, err := tx.delete(key); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Replicated returns the number of the last commit of its primary that a
+// follower applied, or zero: the since to resume Replicate from.
+func (db *DB) Replicated() (uint64, error) {
+	val, err := db.Get([]byte(ReplicaKey))
+	switch {
+	case err == ErrKeyNotFound:
+		return 0, nil
+	case err != nil:
+		return 0, err
+	case len(val) != 8:
+		return 0, fmt.Errorf("kv: %q holds %d bytes, not a commit", ReplicaKey, len(val))
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
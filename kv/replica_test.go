@@ -0,0 +1,257 @@
+package kv_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// link streams primary to follower from since, over a pipe, until the
+// returned function is called, which cuts the pipe and returns the frames
+// that went through it. Replicate goes on until its next write, or until
+// primary closes.
+func link(tb testing.TB, primary, follower *kv.DB, since uint64) (cut func() []byte) {
+	tb.Helper()
+	pr, pw := io.Pipe()
+	followed := make(chan error, 1)
+	var frames bytes.Buffer
+	go func() {
+		primary.Replicate(pw, since)
+		pw.Close()
+	}()
+	go func() { followed <- follower.Follow(io.TeeReader(pr, &frames)) }()
+	return func() []byte {
+		pr.CloseWithError(io.ErrClosedPipe)
+		if err := <-followed; err != nil && err != io.ErrClosedPipe {
+			tb.Errorf("Follow: %v", err)
+		}
+		return frames.Bytes()
+	}
+}
+
+// kinds returns the kinds of the frames of a stream, in order: 'c' for a
+// commit, 's' for a snapshot.
+func kinds(tb testing.TB, frames []byte) string {
+	tb.Helper()
+	r := bytes.NewReader(frames)
+	var s []byte
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return string(s)
+		}
+		s = append(s, kind)
+		r.Seek(8, io.SeekCurrent)
+		// Entries, a key and a value each, up to a key length of 0.
+		for n := 0; ; n++ {
+			l, err := binary.ReadUvarint(r)
+			if err != nil {
+				tb.Fatalf("frame %d cut short", len(s))
+			}
+			if l == 0 && n%2 == 0 {
+				break
+			}
+			r.Seek(int64(max(l, 1)-1), io.SeekCurrent)
+		}
+	}
+}
+
+// caughtUp waits for follower to apply the last commit of primary, and
+// fails the test if it then does not hold what primary does.
+func caughtUp(tb testing.TB, primary, follower *kv.DB) {
+	tb.Helper()
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		c, err := follower.Replicated()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if c == primary.LastCommit() {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			tb.Fatalf("follower at commit %d of %d", c, primary.LastCommit())
+		}
+	}
+	got := dump(tb, follower)
+	delete(got, kv.ReplicaKey)
+	if want := dump(tb, primary); !maps.Equal(got, want) {
+		tb.Fatalf("follower holds %d keys, primary %d", len(got), len(want))
+	}
+}
+
+func TestReplicate(t *testing.T) {
+	primary := open(t, kv.Options{})
+	fill(t, primary, 100)
+	follower := open(t, kv.Options{Follower: true})
+	cut := link(t, primary, follower, 0)
+	caughtUp(t, primary, follower)
+	for i := range 50 {
+		primary.Set(fmt.Appendf(nil, "k%03d", i*3), []byte("new"))
+		primary.Del(fmt.Appendf(nil, "k%03d", i*3+1))
+	}
+	caughtUp(t, primary, follower)
+	frames := cut()
+	// A snapshot as of the fill, then every commit after it.
+	if k, n := kinds(t, frames), int(primary.LastCommit()-1); k != "s"+strings.Repeat("c", n) {
+		t.Errorf("frames of kinds %s, want a snapshot and %d commits", k, n)
+	}
+
+	if err := follower.Set([]byte("k"), nil); err != kv.ErrReadOnly {
+		t.Errorf("Set on a follower: %v, want ErrReadOnly", err)
+	}
+	if err := primary.Follow(bytes.NewReader(frames)); err != kv.ErrNotFollower {
+		t.Errorf("Follow on a primary: %v, want ErrNotFollower", err)
+	}
+	if _, err := (kv.Options{Follower: true, ReadOnly: true}).Open(t.TempDir() + "/db"); err == nil {
+		t.Error("a read-only follower opened")
+	}
+}
+
+func TestReplicateResume(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		commits int
+		kind    byte
+	}{
+		{"from the backlog", 5, 'c'},
+		{"too far behind", 20, 's'},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := open(t, kv.Options{ReplicaBacklog: 10})
+			fill(t, primary, 10)
+			follower := open(t, kv.Options{Follower: true})
+			cut := link(t, primary, follower, 0)
+			caughtUp(t, primary, follower)
+			cut()
+
+			// The follower was away for some commits.
+			for i := range tc.commits {
+				primary.Del(fmt.Appendf(nil, "k%03d", i%10))
+				primary.Set(fmt.Appendf(nil, "n%03d", i), []byte("v"))
+			}
+			since, err := follower.Replicated()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cut = link(t, primary, follower, since)
+			caughtUp(t, primary, follower)
+			if k := kinds(t, cut()); k[0] != tc.kind {
+				t.Errorf("resumed with frames of kinds %s, want %c first", k, tc.kind)
+			}
+		})
+	}
+}
+
+// signalWriter closes first at its first Write.
+type signalWriter struct {
+	w     io.Writer
+	once  sync.Once
+	first chan struct{}
+}
+
+func (w *signalWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.first) })
+	return w.w.Write(p)
+}
+
+func TestReplicateFollowerBehind(t *testing.T) {
+	// A follower that reads nothing falls behind, and is sent a snapshot
+	// once it reads again.
+	primary := open(t, kv.Options{ReplicaBacklog: 10})
+	fill(t, primary, 1)
+	if err := primary.Replicate(failWriter{io.ErrClosedPipe}, 0); err != io.ErrClosedPipe {
+		t.Fatalf("Replicate to a writer that fails: %v", err)
+	}
+	pr, pw := io.Pipe()
+	sw := &signalWriter{w: pw, first: make(chan struct{})}
+	replicated := make(chan error, 1)
+	go func() {
+		err := primary.Replicate(sw, primary.LastCommit())
+		pw.Close()
+		replicated <- err
+	}()
+	// Once Replicate writes, it waits for the follower.
+written:
+	for i := 0; ; i++ {
+		primary.Set([]byte("first"), fmt.Append(nil, i))
+		select {
+		case <-sw.first:
+			break written
+		case <-time.After(time.Millisecond):
+		}
+	}
+	for i := range 100 {
+		primary.Set(fmt.Appendf(nil, "k%03d", i), []byte("v"))
+	}
+	follower := open(t, kv.Options{Follower: true})
+	var frames bytes.Buffer
+	followed := make(chan error, 1)
+	go func() { followed <- follower.Follow(io.TeeReader(pr, &frames)) }()
+	caughtUp(t, primary, follower)
+	if err := primary.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-replicated; err != kv.ErrClosed {
+		t.Errorf("Replicate after Close: %v, want ErrClosed", err)
+	}
+	if err := <-followed; err != nil {
+		t.Errorf("Follow at the end of the stream: %v", err)
+	}
+	if k := kinds(t, frames.Bytes()); k[0] != 'c' || !strings.Contains(k, "s") {
+		t.Errorf("frames of kinds %s, want commits, then a snapshot", k)
+	}
+}
+
+func TestFollowCut(t *testing.T) {
+	// The stream of a primary that closed, whole: two commits, from the
+	// backlog that a first Replicate, which fails, starts.
+	primary := open(t, kv.Options{})
+	fill(t, primary, 3)
+	if err := primary.Replicate(failWriter{io.ErrClosedPipe}, 0); err != io.ErrClosedPipe {
+		t.Fatalf("Replicate to a writer that fails: %v", err)
+	}
+	primary.Set([]byte("more"), []byte("v"))
+	primary.Set([]byte("last"), []byte("v"))
+	var frames bytes.Buffer
+	replicated := make(chan error, 1)
+	go func() { replicated <- primary.Replicate(&frames, 1) }()
+	time.Sleep(50 * time.Millisecond)
+	primary.Close()
+	if err := <-replicated; err != kv.ErrClosed {
+		t.Fatalf("Replicate: %v", err)
+	}
+	stream := frames.Bytes()
+	if k := kinds(t, stream); k != "cc" {
+		t.Fatalf("frames of kinds %s, want the 2 commits", k)
+	}
+
+	whole := open(t, kv.Options{Follower: true})
+	if err := whole.Follow(bytes.NewReader(stream)); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := whole.Replicated(); c != 3 {
+		t.Errorf("follower at commit %d, want 3", c)
+	}
+	// A frame cut short is not applied, and the ones before are.
+	cut := open(t, kv.Options{Follower: true})
+	if err := cut.Follow(bytes.NewReader(stream[:len(stream)-2])); err == nil {
+		t.Error("Follow of a stream cut short returned nil")
+	}
+	if c, _ := cut.Replicated(); c != 2 {
+		t.Errorf("follower at commit %d, want 2", c)
+	}
+	if _, err := cut.Get([]byte("last")); err != kv.ErrKeyNotFound {
+		t.Errorf("Get of a key of the cut frame: %v", err)
+	}
+	if err := cut.Follow(bytes.NewReader([]byte("x"))); err == nil {
+		t.Error("Follow of a frame of unknown kind returned nil")
+	}
+}
@@ -0,0 +1,212 @@
+package kv_test
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// txDump returns the keys and values tx sees.
+func txDump(tb testing.TB, tx *kv.Tx) map[string]string {
+	tb.Helper()
+	m := map[string]string{}
+	if err := tx.Scan(nil, nil, func(k, v []byte) bool { m[string(k)] = string(v); return true }); err != nil {
+		tb.Fatal(err)
+	}
+	return m
+}
+
+// scribble updates keys from to to of tx with val, deletes every tenth and
+// adds as many new ones, enough to split and merge pages of 512 bytes.
+func scribble(tb testing.TB, tx *kv.Tx, from, to int, val string) {
+	tb.Helper()
+	for i := from; i < to; i++ {
+		var err error
+		if i%10 == 0 {
+			_, err = tx.Del(fmt.Appendf(nil, "k%05d", i))
+		} else {
+			err = tx.Set(fmt.Appendf(nil, "k%05d", i), []byte(val))
+		}
+		if err == nil {
+			err = tx.Set(fmt.Appendf(nil, "new%05d", i), []byte(val))
+		}
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	db := commitN(t, kv.Options{}, 1000)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	before := txDump(t, tx)
+
+	if err = tx.Savepoint("a"); err != nil {
+		t.Fatal(err)
+	}
+	scribble(t, tx, 0, 300, "a")
+	atA, dirtyA := txDump(t, tx), db.Stats().Dirty
+	if err = tx.Savepoint("b"); err != nil {
+		t.Fatal(err)
+	}
+	// RollbackTo keeps the savepoint, for another.
+	for range 2 {
+		scribble(t, tx, 200, 800, "b")
+		if err = tx.RollbackTo("b"); err != nil {
+			t.Fatal(err)
+		}
+		if got := txDump(t, tx); !maps.Equal(got, atA) {
+			t.Fatalf("after RollbackTo(b) %d keys, want %d", len(got), len(atA))
+		}
+		if d := db.Stats().Dirty; d != dirtyA {
+			t.Errorf("after RollbackTo(b) %d dirty pages, want %d", d, dirtyA)
+		}
+	}
+	// Going back past b drops it.
+	if err = tx.RollbackTo("a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := txDump(t, tx); !maps.Equal(got, before) {
+		t.Fatalf("after RollbackTo(a) %d keys, want %d", len(got), len(before))
+	}
+	if d := db.Stats().Dirty; d != 0 {
+		t.Errorf("after RollbackTo(a) %d dirty pages, want 0", d)
+	}
+	if err = tx.RollbackTo("b"); !errors.Is(err, kv.ErrNoSavepoint) {
+		t.Errorf("RollbackTo(b) after RollbackTo(a): %v, want ErrNoSavepoint", err)
+	}
+
+	// Release keeps the updates, and the pages given back stay accounted
+	// for once committed.
+	scribble(t, tx, 500, 700, "c")
+	if err = tx.Release("a"); err != nil {
+		t.Fatal(err)
+	}
+	scribble(t, tx, 900, 1000, "d")
+	want := txDump(t, tx)
+	if want["k00601"] != "c" || want["k00901"] != "d" {
+		t.Errorf("the transaction lost updates: k00601 %q, k00901 %q", want["k00601"], want["k00901"])
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := dump(t, db); !maps.Equal(got, want) {
+		t.Errorf("committed %d keys, want %d", len(got), len(want))
+	}
+	if err = db.Verify(); err != nil {
+		t.Error(err)
+	}
+
+	// Savepoints end with their transaction.
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err = tx.RollbackTo("a"); !errors.Is(err, kv.ErrNoSavepoint) {
+		t.Errorf("RollbackTo(a) in the next transaction: %v, want ErrNoSavepoint", err)
+	}
+}
+
+func TestSavepointNames(t *testing.T) {
+	db := open(t, kv.Options{})
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	step := func(do func() error, want string) {
+		t.Helper()
+		if err := do(); err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(txDump(t, tx)); got != want {
+			t.Errorf("the transaction holds %s, want %s", got, want)
+		}
+	}
+	set := func(v string) func() error { return func() error { return tx.Set([]byte("k"), []byte(v)) } }
+	sp := func(name string) func() error { return func() error { return tx.Savepoint(name) } }
+	step(sp("x"), "map[]")
+	step(set("1"), "map[k:1]")
+	step(sp("x"), "map[k:1]")
+	step(set("2"), "map[k:2]")
+	step(sp("y"), "map[k:2]")
+	step(set("3"), "map[k:3]")
+	// The second x hides the first, and y goes with it.
+	step(func() error { return tx.RollbackTo("x") }, "map[k:1]")
+	if err = tx.Release("y"); !errors.Is(err, kv.ErrNoSavepoint) {
+		t.Errorf("Release(y) after RollbackTo(x): %v, want ErrNoSavepoint", err)
+	}
+	step(set("4"), "map[k:4]")
+	step(func() error { return tx.Release("x") }, "map[k:4]")
+	step(func() error { return tx.RollbackTo("x") }, "map[]")
+	step(func() error { return tx.Release("x") }, "map[]")
+	if err = tx.Release("x"); !errors.Is(err, kv.ErrNoSavepoint) {
+		t.Errorf("Release(x) of none left: %v, want ErrNoSavepoint", err)
+	}
+}
+
+func TestSavepointErrors(t *testing.T) {
+	db := open(t, kv.Options{})
+	rtx, err := db.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rtx.Rollback()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.RollbackTo("none"); !errors.Is(err, kv.ErrNoSavepoint) {
+		t.Errorf("RollbackTo of no savepoint: %v, want ErrNoSavepoint", err)
+	}
+	tx.Savepoint("a")
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for name, tc := range map[string]struct {
+		tx  *kv.Tx
+		err error
+	}{"a read": {rtx, kv.ErrReadOnly}, "a committed": {tx, kv.ErrTxClosed}} {
+		for op, fn := range map[string]func(string) error{"Savepoint": tc.tx.Savepoint, "RollbackTo": tc.tx.RollbackTo, "Release": tc.tx.Release} {
+			if err := fn("a"); err != tc.err {
+				t.Errorf("%s in %s transaction: %v, want %v", op, name, err, tc.err)
+			}
+		}
+	}
+}
+
+func TestSavepointWatch(t *testing.T) {
+	db := open(t, kv.Options{})
+	w, err := db.Watch(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Set([]byte("kept"), []byte("1"))
+	tx.Savepoint("a")
+	tx.Set([]byte("undone"), []byte("2"))
+	tx.Set([]byte("kept"), []byte("3"))
+	if err = tx.RollbackTo("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// Only the changes that were committed are published.
+	if got := fmt.Sprint(changes(t, w, 1)); got != `[kept →"1" @1]` {
+		t.Errorf("changes %s", got)
+	}
+	quiet(t, w)
+}
@@ -0,0 +1,90 @@
+package kv
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/fileio"
+	"github.com/adcondev/go-database/pager"
+)
+
+// Stats are the statistics of a DB: those of its pager, whose counters
+// start over when Compact replaces it, and its own, counted since it was
+// opened.
+type Stats struct {
+	pager.Stats
+
+	Depth int // levels of the tree of the last commit; see btree.BTree.Depth
+
+	// Commits counts the write transactions committed, and CommitLatency
+	// times their Commit, the wait for the sync under SyncBatch included.
+	Commits       uint64
+	CommitLatency fileio.Histogram
+}
+
+// Stats returns the statistics of db. It is cheap enough to call often:
+// it reads the counters and a page or so of the tree, for its depth.
+func (db *DB) Stats() Stats {
+	var st Stats
+	db.view(func(tree *btree.BTree, _ uint64) { st.Depth = tree.Depth() })
+	db.mu.RLock()
+	st.Stats = db.pager.Stats()
+	db.mu.RUnlock()
+	st.Commits = db.commits.Load()
+	st.CommitLatency = db.commitTime.Histogram()
+	return st
+}
+
+// PublishExpvar publishes the statistics of db as the expvar variable
+// name, a JSON object of Stats, for /debug/vars. Like expvar.Publish it
+// panics if the name is taken.
+func (db *DB) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any { return db.Stats() }))
+}
+
+// WriteMetrics writes the statistics of db to w in the text format of
+// Prometheus, as metrics named godb_*, for a /metrics handler to serve:
+//
+//	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+//		db.WriteMetrics(w)
+//	})
+func (db *DB) WriteMetrics(w io.Writer) error {
+	st := db.Stats()
+	bw := bufio.NewWriter(w)
+	for _, m := range []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"godb_pages", "gauge", "Pages in the file, the meta page included.", float64(st.Pages)},
+		{"godb_free_pages", "gauge", "Pages on the free list.", float64(st.FreePages)},
+		{"godb_dirty_pages", "gauge", "Pages the write transaction holds in memory.", float64(st.Dirty)},
+		{"godb_tree_depth", "gauge", "Levels of the tree.", float64(st.Depth)},
+		{"godb_page_reads_total", "counter", "Committed pages read.", float64(st.Reads)},
+		{"godb_page_writes_total", "counter", "Pages written by commits.", float64(st.Writes)},
+		{"godb_syncs_total", "counter", "Syncs of the file.", float64(st.Syncs)},
+		{"godb_commits_total", "counter", "Write transactions committed.", float64(st.Commits)},
+		{"godb_cache_hits_total", "counter", "Page reads found in the cache.", float64(st.Cache.Hits)},
+		{"godb_cache_misses_total", "counter", "Page reads that went to the file.", float64(st.Cache.Misses)},
+		{"godb_cache_evictions_total", "counter", "Pages dropped from the cache.", float64(st.Cache.Evictions)},
+		{"godb_cache_pages", "gauge", "Pages in the cache.", float64(st.Cache.Pages)},
+		{"godb_cache_hit_ratio", "gauge", "Share of page reads found in the cache.", st.Cache.HitRate()},
+	} {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+	h := st.CommitLatency
+	fmt.Fprint(bw, "# HELP godb_commit_seconds Latency of Commit.\n# TYPE godb_commit_seconds histogram\n")
+	var count uint64
+	for i, b := range h.Buckets {
+		count += b.Count
+		le := "+Inf"
+		if i < len(h.Buckets)-1 {
+			le = fmt.Sprintf("%g", b.Le.Seconds())
+		}
+		fmt.Fprintf(bw, "godb_commit_seconds_bucket{le=%q} %d\n", le, count)
+	}
+	fmt.Fprintf(bw, "godb_commit_seconds_sum %g\ngodb_commit_seconds_count %d\n", h.Sum.Seconds(), h.Count)
+	return bw.Flush()
+}
@@ -0,0 +1,170 @@
+package kv_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// commitN commits keys [0, n) of 512-byte pages, 100 a commit, to a new
+// database.
+func commitN(tb testing.TB, o kv.Options, n int) *kv.DB {
+	tb.Helper()
+	o.PageSize = 512
+	db := open(tb, o)
+	for i := 0; i < n; i += 100 {
+		tx, err := db.Begin()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		for j := i; j < i+100 && j < n; j++ {
+			tx.Set(fmt.Appendf(nil, "k%05d", j), []byte("value"))
+		}
+		if err = tx.Commit(); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestStats(t *testing.T) {
+	db := commitN(t, kv.Options{NoMmap: true}, 2000)
+	st := db.Stats()
+	if st.Commits != 20 || st.CommitLatency.Count != 20 {
+		t.Errorf("%d commits, %d timed; want 20", st.Commits, st.CommitLatency.Count)
+	}
+	if st.Depth < 2 || st.Writes < st.Pages-1 || st.Syncs < 20 || st.Dirty != 0 {
+		t.Errorf("stats after the commits: %+v", st)
+	}
+	reads := st.Reads
+	for i := range 100 {
+		mustGet(t, db, fmt.Sprintf("k%05d", i*20))
+	}
+	if st = db.Stats(); st.Reads <= reads || st.Cache.Hits+st.Cache.Misses == 0 {
+		t.Errorf("stats after the reads: %+v", st)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 1500 {
+		tx.Del(fmt.Appendf(nil, "k%05d", i))
+	}
+	if st = db.Stats(); st.Dirty == 0 {
+		t.Error("no dirty pages in the write transaction")
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if st = db.Stats(); st.FreePages == 0 {
+		t.Error("no free pages after the deletes")
+	}
+	// The counters of the pager start over with Compact, the others not.
+	if _, err = db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if st = db.Stats(); st.FreePages != 0 || st.Reads > reads || st.Commits != 21 {
+		t.Errorf("stats after Compact: %+v", st)
+	}
+}
+
+// metrics parses the output of WriteMetrics into the value of each
+// sample, by name and labels, failing the test if a sample does not
+// follow a TYPE line of its metric.
+func metrics(tb testing.TB, db *kv.DB) map[string]float64 {
+	tb.Helper()
+	var buf bytes.Buffer
+	if err := db.WriteMetrics(&buf); err != nil {
+		tb.Fatal(err)
+	}
+	m := map[string]float64{}
+	typed := ""
+	for sc := bufio.NewScanner(&buf); sc.Scan(); {
+		line := sc.Text()
+		if f := strings.Fields(line); len(f) == 4 && f[1] == "TYPE" {
+			typed = f[2]
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, " ")
+		v, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil || !strings.HasPrefix(name, typed) {
+			tb.Fatalf("bad sample %q", line)
+		}
+		m[name] = v
+	}
+	return m
+}
+
+func TestWriteMetrics(t *testing.T) {
+	db := commitN(t, kv.Options{}, 1000)
+	m := metrics(t, db)
+	st := db.Stats()
+	for name, want := range map[string]float64{
+		"godb_pages":                            float64(st.Pages),
+		"godb_tree_depth":                       float64(st.Depth),
+		"godb_commits_total":                    10,
+		"godb_syncs_total":                      float64(st.Syncs),
+		"godb_page_writes_total":                float64(st.Writes),
+		"godb_commit_seconds_count":             10,
+		`godb_commit_seconds_bucket{le="+Inf"}`: 10,
+	} {
+		if got, ok := m[name]; !ok || got != want {
+			t.Errorf("%s = %v, %v; want %v", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"godb_free_pages", "godb_dirty_pages", "godb_page_reads_total", "godb_cache_hit_ratio", "godb_commit_seconds_sum"} {
+		if _, ok := m[name]; !ok {
+			t.Errorf("no %s", name)
+		}
+	}
+	// The buckets count the commits as fast or faster.
+	last := 0.0
+	for _, b := range st.CommitLatency.Buckets[:len(st.CommitLatency.Buckets)-1] {
+		name := fmt.Sprintf("godb_commit_seconds_bucket{le=%q}", fmt.Sprintf("%g", b.Le.Seconds()))
+		got, ok := m[name]
+		if !ok || got < last {
+			t.Errorf("%s = %v, %v; after %v", name, got, ok, last)
+		}
+		last = got
+	}
+}
+
+// published counts the runs of TestPublishExpvar, for a name of its own
+// to each.
+var published int
+
+func TestPublishExpvar(t *testing.T) {
+	db := commitN(t, kv.Options{}, 300)
+	published++
+	name := fmt.Sprintf("godb_test%d", published)
+	db.PublishExpvar(name)
+	var st kv.Stats
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Commits != 3 || st.Pages == 0 {
+		t.Errorf("published %+v", st)
+	}
+	// It reads the stats as they are.
+	db.Set([]byte("more"), nil)
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &st); err != nil || st.Commits != 4 {
+		t.Errorf("published %d commits after one more, %v", st.Commits, err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("a second PublishExpvar of the name did not panic")
+		}
+	}()
+	db.PublishExpvar(name)
+}
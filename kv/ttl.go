@@ -0,0 +1,261 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// A key set with SetWithTTL has a deadline, the Unix time in nanoseconds
+// at which it expires, kept under TTLPrefix twice over:
+//
+//	TTLPrefix "k" key          → deadline, 8 bytes big-endian
+//	TTLPrefix "e" deadline key → empty
+//
+// The first tells a read whether a key has expired; the second, the index,
+// orders the keys by deadline, so that Sweep finds the expired ones without
+// a scan. An expired key reads as deleted until Sweep, Compact or the
+// background sweep of Options.SweepInterval deletes it. Like the rows of
+// package table, under "\x00t", the records show up in scans, and a dump
+// of the keys keeps them.
+const TTLPrefix = "\x00x"
+
+var ErrTTL = errors.New("kv: bad TTL")
+
+const (
+	deadlinePrefix = TTLPrefix + "k"
+	indexPrefix    = TTLPrefix + "e"
+
+	// ttlOverhead is how much longer than its key an index key is.
+	ttlOverhead = len(indexPrefix) + 8
+
+	// sweepBatch is how many keys Sweep deletes in a transaction.
+	sweepBatch = 1000
+)
+
+func deadlineKey(key []byte) []byte {
+	return append([]byte(deadlinePrefix), key...)
+}
+
+func indexKey(deadline uint64, key []byte) []byte {
+	return append(binary.BigEndian.AppendUint64([]byte(indexPrefix), deadline), key...)
+}
+
+func now() uint64 { return uint64(time.Now().UnixNano()) }
+
+// deadline returns the deadline of key in tree, if it has one.
+func deadline(tree *btree.BTree, key []byte) (uint64, bool) {
+	val, ok := tree.Get(deadlineKey(key))
+	if !ok || len(val) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(val), true
+}
+
+// expired reports whether key has a deadline in tree that has passed.
+func expired(tree *btree.BTree, key []byte) bool {
+	d, ok := deadline(tree, key)
+	return ok && d <= now()
+}
+
+// setDeadline gives key the deadline d, in place of any it had.
+func (tx *Tx) setDeadline(key []byte, d uint64) error {
+	if err := tx.clearDeadline(key); err != nil {
+		return err
+	}
+	if err := tx.insert(deadlineKey(key), binary.BigEndian.AppendUint64(nil, d)); err != nil {
+		return err
+	}
+	return tx.insert(indexKey(d, key), nil)
+}
+
+// clearDeadline drops the deadline of key, if it has one.
+func (tx *Tx) clearDeadline(key []byte) error {
+	d, ok := deadline(&tx.tree, key)
+	if !ok {
+		return nil
+	}
+	if _, err := tx.delete(deadlineKey(key)); err != nil {
+		return err
+	}
+	_, err := tx.delete(indexKey(d, key))
+	return err
+}
+
+// deadlines tells the expired keys of a scan apart, walking the deadline
+// records of the tree alongside it rather than looking each one up: the
+// keys come in order, and so do their records.
+type deadlines struct {
+	it  *btree.Iter
+	now uint64
+}
+
+// newDeadlines returns the deadlines of a scan from lo.
+func newDeadlines(tree *btree.BTree, lo []byte) *deadlines {
+	return &deadlines{it: tree.SeekGE(deadlineKey(lo)), now: now()}
+}
+
+// expired reports whether key, which comes after the last key asked about,
+// has expired.
+func (d *deadlines) expired(key []byte) bool {
+	dk := deadlineKey(key)
+	for ; d.it.Valid(); d.it.Next() {
+		switch c := bytes.Compare(d.it.Key(), dk); {
+		case c == 0:
+			val := d.it.Val()
+			return len(val) == 8 && binary.BigEndian.Uint64(val) <= d.now
+		case c > 0:
+			return false
+		}
+	}
+	return false
+}
+
+// SetWithTTL stores val under key, as Set does, in a transaction of its
+// own, for ttl: after that the key reads as deleted.
+func (db *DB) SetWithTTL(key, val []byte, ttl time.Duration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = tx.SetWithTTL(key, val, ttl); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetWithTTL stores val under key, as Set does, for ttl from now: after
+// that the key reads as deleted, and a sweep deletes it. Keys under
+// TTLPrefix cannot have a TTL, and a key with one must leave room in a
+// page for its index entry: a few bytes fewer than tree.MaxKeySize.
+func (tx *Tx) SetWithTTL(key, val []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: %v is not positive", ErrTTL, ttl)
+	}
+	if err := notTTL(key); err != nil {
+		return err
+	}
+	return tx.update(func() error {
+		// Fail before the value is stored rather than after.
+		if len(key) > tx.tree.MaxKeySize()-ttlOverhead {
+			return btree.ErrKeyTooLarge
+		}
+		if err := tx.insert(key, val); err != nil {
+			return err
+		}
+		return tx.setDeadline(key, uint64(time.Now().Add(ttl).UnixNano()))
+	})
+}
+
+// notTTL fails with ErrTTL if key is under TTLPrefix, where only this
+// file writes.
+func notTTL(key []byte) error {
+	if bytes.HasPrefix(key, []byte(TTLPrefix)) {
+		return fmt.Errorf("%w: key %q is under TTLPrefix", ErrTTL, key)
+	}
+	return nil
+}
+
+// RestoreTTL sets the record under TTLPrefix key, val, as a scan of the
+// database returned it, for restoring a dump: a deadline record gives its
+// key, which must be set, that deadline again, and an index record, which
+// the deadline record puts back, is skipped.
+func (tx *Tx) RestoreTTL(key, val []byte) error {
+	if !bytes.HasPrefix(key, []byte(TTLPrefix)) {
+		return fmt.Errorf("%w: key %q is not under TTLPrefix", ErrTTL, key)
+	}
+	return tx.update(func() error {
+		switch {
+		case bytes.HasPrefix(key, []byte(indexPrefix)):
+			return nil
+		case !bytes.HasPrefix(key, []byte(deadlinePrefix)) || len(val) != 8:
+			return fmt.Errorf("%w: %q is not a TTL record", ErrTTL, key)
+		}
+		k := key[len(deadlinePrefix):]
+		if _, ok := tx.tree.Get(k); !ok {
+			return fmt.Errorf("%w: TTL of %q, which is not set", ErrTTL, k)
+		}
+		return tx.setDeadline(k, binary.BigEndian.Uint64(val))
+	})
+}
+
+// Sweep deletes the keys whose TTL has passed and returns how many it
+// deleted. It finds them on the index of deadlines rather than by a scan,
+// and deletes them in transactions of up to a thousand keys, so that other
+// writers get their turn in between.
+func (db *DB) Sweep() (int, error) {
+	n := 0
+	for {
+		tx, err := db.Begin()
+		if err != nil {
+			return n, err
+		}
+		var swept int
+		err = tx.update(func() (err error) {
+			swept, err = tx.sweep(now(), sweepBatch)
+			return err
+		})
+		if err != nil || swept == 0 {
+			tx.Rollback()
+			return n, err
+		}
+		if err = tx.Commit(); err != nil {
+			return n, err
+		}
+		n += swept
+		if swept < sweepBatch {
+			return n, nil
+		}
+	}
+}
+
+// sweep deletes up to limit keys whose deadline is not after now, with
+// their records, and returns how many it deleted.
+func (tx *Tx) sweep(now uint64, limit int) (int, error) {
+	// Collect the index keys first: updates invalidate iterators.
+	var due [][]byte
+	for it := tx.tree.SeekGE([]byte(indexPrefix)); it.Valid() && len(due) < limit; it.Next() {
+		k := it.Key()
+		if !bytes.HasPrefix(k, []byte(indexPrefix)) {
+			break
+		}
+		if len(k) <= ttlOverhead {
+			continue // not an index key: leave it be
+		}
+		if binary.BigEndian.Uint64(k[len(indexPrefix):]) > now {
+			break
+		}
+		due = append(due, bytes.Clone(k))
+	}
+	for _, k := range due {
+		key := k[ttlOverhead:]
+		for _, del := range [][]byte{key, deadlineKey(key), k} {
+			if _, err := tx.delete(del); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(due), nil
+}
+
+// sweeper calls Sweep every interval until stop is closed, then closes
+// done.
+func (db *DB) sweeper(every time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			// A sweep that fails is tried again at the next tick.
+			db.Sweep()
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package kv_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/kv"
+)
+
+// ttlRecords returns how many records db keeps under kv.TTLPrefix.
+func ttlRecords(tb testing.TB, db *kv.DB) int {
+	tb.Helper()
+	n := 0
+	for k := range dump(tb, db) {
+		if strings.HasPrefix(k, kv.TTLPrefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTTL(t *testing.T) {
+	db := open(t, kv.Options{})
+	fill(t, db, 5)
+	for _, k := range []string{"k001", "k003", "k010"} {
+		if err := db.SetWithTTL([]byte(k), []byte("short"), 50*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetWithTTL([]byte("k004"), []byte("long"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// Set drops a TTL.
+	if err := db.SetWithTTL([]byte("k000"), []byte("short"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Set([]byte("k000"), []byte("kept")); err != nil {
+		t.Fatal(err)
+	}
+	if v := mustGet(t, db, "k010"); v != "short" {
+		t.Errorf("k010 = %q before it expired", v)
+	}
+	// Two records for each of the 4 TTLs.
+	if n := ttlRecords(t, db); n != 8 {
+		t.Errorf("%d TTL records, want 8", n)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	for _, k := range []string{"k001", "k003", "k010"} {
+		if _, err := db.Get([]byte(k)); err != kv.ErrKeyNotFound {
+			t.Errorf("Get(%s) after it expired: %v, want ErrKeyNotFound", k, err)
+		}
+	}
+	want := map[string]string{"k000": "kept", "k002": "v2", "k004": "long"}
+	got := map[string]string{}
+	db.Scan([]byte("k"), nil, func(k, v []byte) bool { got[string(k)] = string(v); return true })
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Scan = %v, want %v", got, want)
+	}
+	var seen []string
+	for it := db.Seek([]byte("k001")); it.Valid(); it.Next() {
+		seen = append(seen, string(it.Key()))
+	}
+	if fmt.Sprint(seen) != "[k002 k004]" {
+		t.Errorf("Seek(k001) went through %v", seen)
+	}
+	if deleted, err := db.Del([]byte("k001")); deleted || err != nil {
+		t.Errorf("Del of an expired key = %v, %v", deleted, err)
+	}
+	tx, err := db.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Get([]byte("k003")); err != kv.ErrKeyNotFound {
+		t.Errorf("Tx.Get of an expired key: %v, want ErrKeyNotFound", err)
+	}
+	tx.Rollback()
+
+	if n, err := db.Sweep(); n != 3 || err != nil {
+		t.Errorf("Sweep = %d, %v; want the 3 expired", n, err)
+	}
+	if n := ttlRecords(t, db); n != 2 {
+		t.Errorf("%d TTL records after Sweep, want k004's 2", n)
+	}
+	if n, err := db.Sweep(); n != 0 || err != nil {
+		t.Errorf("second Sweep = %d, %v", n, err)
+	}
+}
+
+func TestTTLErrors(t *testing.T) {
+	db := open(t, kv.Options{})
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		if err := db.SetWithTTL([]byte("k"), nil, ttl); !errors.Is(err, kv.ErrTTL) {
+			t.Errorf("SetWithTTL for %v: %v, want ErrTTL", ttl, err)
+		}
+	}
+	under := []byte(kv.TTLPrefix + "kk")
+	if err := db.SetWithTTL(under, nil, time.Hour); !errors.Is(err, kv.ErrTTL) {
+		t.Errorf("SetWithTTL under TTLPrefix: %v, want ErrTTL", err)
+	}
+	if err := db.Set(under, nil); !errors.Is(err, kv.ErrTTL) {
+		t.Errorf("Set under TTLPrefix: %v, want ErrTTL", err)
+	}
+	if _, err := db.Del(under); !errors.Is(err, kv.ErrTTL) {
+		t.Errorf("Del under TTLPrefix: %v, want ErrTTL", err)
+	}
+	// A key set without a TTL may be as long as the tree allows; with
+	// one, a few bytes shorter.
+	long := []byte(strings.Repeat("k", btree.DefaultPageSize/4-24))
+	if err := db.Set(long, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetWithTTL(long, []byte("v"), time.Hour); !errors.Is(err, btree.ErrKeyTooLarge) {
+		t.Errorf("SetWithTTL of a key of MaxKeySize: %v, want ErrKeyTooLarge", err)
+	}
+	if v := mustGet(t, db, string(long)); v != "" {
+		t.Errorf("failed SetWithTTL left %q", v)
+	}
+	if n := ttlRecords(t, db); n != 0 {
+		t.Errorf("%d TTL records after the failures", n)
+	}
+}
+
+func TestRestoreTTL(t *testing.T) {
+	src := open(t, kv.Options{})
+	if err := src.SetWithTTL([]byte("a"), []byte("1"), 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetWithTTL([]byte("b"), []byte("2"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// Restore as godb restore does: the keys, then their TTLs.
+	dst := open(t, kv.Options{})
+	tx, err := dst.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := dump(t, src)
+	for k, v := range records {
+		if !strings.HasPrefix(k, kv.TTLPrefix) {
+			if err = tx.Set([]byte(k), []byte(v)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for k, v := range records {
+		if strings.HasPrefix(k, kv.TTLPrefix) {
+			if err = tx.RestoreTTL([]byte(k), []byte(v)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for name, rec := range map[string][2]string{
+		"not under TTLPrefix": {"a", "12345678"},
+		"not a TTL record":    {kv.TTLPrefix + "zz", "12345678"},
+		"short deadline":      {kv.TTLPrefix + "ka", "1234"},
+		"key not set":         {kv.TTLPrefix + "kc", "12345678"},
+	} {
+		if err = tx.RestoreTTL([]byte(rec[0]), []byte(rec[1])); !errors.Is(err, kv.ErrTTL) {
+			t.Errorf("RestoreTTL of %s: %v, want ErrTTL", name, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(dump(t, dst)), fmt.Sprint(records); got != want {
+		t.Errorf("restored %s, want %s", got, want)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err = dst.Get([]byte("a")); err != kv.ErrKeyNotFound {
+		t.Errorf("a after its restored TTL: %v, want ErrKeyNotFound", err)
+	}
+	if v := mustGet(t, dst, "b"); v != "2" {
+		t.Errorf("b = %q", v)
+	}
+}
+
+func TestSweepLarge(t *testing.T) {
+	// More keys than Sweep deletes in a transaction.
+	db := open(t, kv.Options{})
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2500 {
+		if err = tx.SetWithTTL(fmt.Appendf(nil, "k%04d", i), []byte("v"), time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	commit := db.LastCommit()
+	if n, err := db.Sweep(); n != 2500 || err != nil {
+		t.Errorf("Sweep = %d, %v; want 2500", n, err)
+	}
+	if c := db.LastCommit() - commit; c != 3 {
+		t.Errorf("Sweep took %d commits, want 3", c)
+	}
+	if m := dump(t, db); len(m) != 0 {
+		t.Errorf("%d records left after Sweep", len(m))
+	}
+}
+
+func TestSweepInterval(t *testing.T) {
+	db := open(t, kv.Options{SweepInterval: 5 * time.Millisecond})
+	if err := db.SetWithTTL([]byte("k"), []byte("v"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); ttlRecords(t, db) != 0; time.Sleep(5 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the background sweep did not delete the expired key")
+		}
+	}
+	if m := dump(t, db); len(m) != 0 {
+		t.Errorf("records left after the sweep: %v", m)
+	}
+}
+
+func TestCompactSweeps(t *testing.T) {
+	db := open(t, kv.Options{})
+	fill(t, db, 10)
+	if err := db.SetWithTTL([]byte("gone"), []byte("v"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if m := dump(t, db); len(m) != 10 {
+		t.Errorf("%d records after Compact, want the 10 without a TTL", len(m))
+	}
+}
@@ -0,0 +1,386 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/pager"
+)
+
+// Tx is a transaction. A write transaction (Begin) is a set of updates
+// that are committed together, with a single fsync, or not at all. A read
+// transaction (BeginRead) sees the database as of the commit it started
+// at, whatever is committed after. A Tx is not safe for concurrent use.
+type Tx struct {
+	db   *DB
+	tree btree.BTree     // the transaction's view
+	snap *pager.Snapshot // set for read transactions
+	p    *pager.Pager    // the pager snap is from
+	err  error           // a damaged page an update ran into
+	done bool
+
+	watched bool     // whether the DB has watchers to note changes for
+	changes []Change // the changes noted, for Commit to publish
+
+	savepoints []savepoint // in the order taken
+}
+
+// savepoint is a savepoint of a write transaction: its state when taken.
+type savepoint struct {
+	name    string
+	mark    int    // of pager.Pager.Savepoint
+	root    uint64 // of the tree
+	changes int    // noted
+}
+
+// Begin starts a write transaction. Only one can be open at a time: Begin
+// waits for the open one to end, so a Tx must always be ended. Reads go on
+// meanwhile, on the last commit.
+func (db *DB) Begin() (*Tx, error) {
+	return db.BeginContext(context.Background())
+}
+
+// BeginContext is Begin, giving up with the error of ctx if ctx is done
+// before the open write transaction ends.
+func (db *DB) BeginContext(ctx context.Context) (*Tx, error) {
+	if db.readOnly {
+		return nil, ErrReadOnly
+	}
+	return db.begin(ctx)
+}
+
+// begin is BeginContext, even on a follower.
+func (db *DB) begin(ctx context.Context) (*Tx, error) {
+	if err := db.writer.lockContext(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.RLock()
+	closed := db.closed
+	db.mu.RUnlock()
+	if closed {
+		db.writer.Unlock()
+		return nil, ErrClosed
+	}
+	tx := &Tx{db: db, tree: *db.pager.Tree(), watched: db.watched()}
+	tx.tree.ValueLimit = db.maxValue
+	return tx, nil
+}
+
+// BeginRead starts a read-only transaction on the last commit. Any number
+// can be open, alongside a write transaction. Until it ends, the pages of
+// its commit are not reused, so the file grows while it stays open under
+// a steady stream of updates.
+func (db *DB) BeginRead() (*Tx, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	snap := db.pager.Snapshot()
+	return &Tx{db: db, tree: *db.snapTree(snap), snap: snap, p: db.pager}, nil
+}
+
+// Writable reports whether tx is a write transaction.
+func (tx *Tx) Writable() bool { return tx.snap == nil }
+
+// read runs fn on the transaction's tree, unless the transaction or the
+// database is closed.
+func (tx *Tx) read(fn func()) (err error) {
+	if tx.done {
+		return ErrTxClosed
+	}
+	if tx.snap != nil {
+		// Close may run under a read transaction; keep it from unmapping
+		// the pages while fn reads them.
+		tx.db.mu.RLock()
+		defer tx.db.mu.RUnlock()
+		if tx.db.closed {
+			return ErrClosed
+		}
+		if tx.p != tx.db.pager {
+			return ErrTxStale // its pager is closed
+		}
+	}
+	defer catch(&err)
+	fn()
+	return nil
+}
+
+// update runs fn on the tree of a write transaction. A damaged page found
+// on the way may leave the tree half updated: the transaction fails, and
+// Commit rolls it back.
+func (tx *Tx) update(fn func() error) (err error) {
+	switch {
+	case tx.done:
+		return ErrTxClosed
+	case tx.snap != nil:
+		return ErrReadOnly
+	case tx.err != nil:
+		return tx.err
+	}
+	defer func() {
+		if errors.Is(err, ErrCorrupt) {
+			tx.err = err
+		}
+	}()
+	defer catch(&err)
+	return fn()
+}
+
+// Get returns a copy of the value stored under key, or ErrKeyNotFound. It
+// sees the transaction's own updates.
+func (tx *Tx) Get(key []byte) ([]byte, error) {
+	var val []byte
+	var err error
+	if rerr := tx.read(func() { val, err = get(&tx.tree, key) }); rerr != nil {
+		return nil, rerr
+	}
+	return val, err
+}
+
+// GetReader returns a reader of the value stored under key, or
+// ErrKeyNotFound, which reads a large value a page at a time rather than
+// all at once. It is good until the transaction ends, or in a write
+// transaction until the next update; reading on fails with ErrTxClosed, or
+// with ErrCorrupt at a damaged page.
+func (tx *Tx) GetReader(key []byte) (io.Reader, error) {
+	var r io.Reader
+	var ok bool
+	if err := tx.read(func() {
+		if r, ok = tx.tree.GetReader(key); ok && expired(&tx.tree, key) {
+			r, ok = nil, false
+		}
+	}); err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return &txReader{tx: tx, r: r}, nil
+}
+
+// txReader is a reader of GetReader, reading through Tx.read.
+type txReader struct {
+	tx *Tx
+	r  io.Reader
+}
+
+func (t *txReader) Read(p []byte) (n int, err error) {
+	if rerr := t.tx.read(func() { n, err = t.r.Read(p) }); rerr != nil {
+		return 0, rerr
+	}
+	return n, err
+}
+
+// Set stores val under key, replacing any value already there, and any
+// TTL it had (see SetWithTTL). Keys under TTLPrefix are not for Set; see
+// RestoreTTL.
+func (tx *Tx) Set(key, val []byte) error {
+	if err := notTTL(key); err != nil {
+		return err
+	}
+	return tx.update(func() error {
+		if err := tx.insert(key, val); err != nil {
+			return err
+		}
+		return tx.clearDeadline(key)
+	})
+}
+
+// Del removes key and reports whether it was there. A key whose TTL has
+// passed is not, and is left for a sweep to delete. Keys under TTLPrefix
+// are not for Del.
+func (tx *Tx) Del(key []byte) (bool, error) {
+	if err := notTTL(key); err != nil {
+		return false, err
+	}
+	var deleted bool
+	err := tx.update(func() (err error) {
+		if expired(&tx.tree, key) {
+			return nil
+		}
+		if deleted, err = tx.delete(key); err != nil || !deleted {
+			return err
+		}
+		return tx.clearDeadline(key)
+	})
+	return deleted, err
+}
+
+// Scan is DB.Scan within the transaction, seeing its own updates. fn must
+// not update the transaction.
+func (tx *Tx) Scan(lo, hi []byte, fn func(key, val []byte) bool) error {
+	return tx.ScanContext(context.Background(), lo, hi, fn)
+}
+
+// ScanContext is Scan, giving up with the error of ctx once ctx is done.
+func (tx *Tx) ScanContext(ctx context.Context, lo, hi []byte, fn func(key, val []byte) bool) error {
+	var err error
+	if rerr := tx.read(func() { err = scan(ctx, &tx.tree, lo, hi, fn) }); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// Commit makes the updates of a write transaction durable and visible. If
+// it fails, none of them is applied, except under SyncBatch when the sync
+// it waits for fails: the updates are visible then, their durability
+// unknown. Either way the transaction is over. Committing a read
+// transaction just ends it. A transaction whose update ran into a damaged
+// page is rolled back instead, and Commit returns that ErrCorrupt.
+func (tx *Tx) Commit() error {
+	return tx.CommitContext(context.Background())
+}
+
+// CommitContext is Commit, giving up when ctx is done. If it is done
+// before the commit starts, the write transaction is rolled back and the
+// error of ctx returned. A commit under way is not stopped: its writes,
+// and its sync under SyncAlways, run to the end. Under SyncBatch though,
+// CommitContext stops waiting for the sync it shares and returns the
+// error of ctx, the updates visible and their durability unknown, as when
+// that sync fails.
+func (tx *Tx) CommitContext(ctx context.Context) error {
+	if tx.done {
+		return ErrTxClosed
+	}
+	if tx.err != nil {
+		tx.Rollback()
+		return tx.err
+	}
+	if err := ctx.Err(); err != nil && tx.Writable() {
+		tx.Rollback()
+		return err
+	}
+	tx.done = true
+	if tx.snap != nil {
+		tx.snap.Release()
+		return nil
+	}
+	db := tx.db
+	start := time.Now()
+	err := db.pager.Commit(tx.tree.Root)
+	c := db.pager.LastCommit()
+	if err == nil {
+		// Under the writer lock, so that watchers get the commits in
+		// order.
+		db.publish(tx.changes, c)
+	}
+	tx.changes = nil
+	db.writer.Unlock()
+	if err == nil && db.sync == pager.SyncBatch {
+		// Wait without the writer lock, so the next writers can commit
+		// and share the sync.
+		err = waitSynced(ctx, db.pager, c)
+	}
+	if err == nil {
+		db.commits.Add(1)
+		db.commitTime.Observe(time.Since(start))
+	}
+	return err
+}
+
+// waitSynced is p.WaitSynced(c), giving up with the error of ctx once ctx
+// is done. The wait goes on in the background then, until the sync or the
+// pager stops it.
+func waitSynced(ctx context.Context, p *pager.Pager, c uint64) error {
+	if ctx.Done() == nil {
+		return p.WaitSynced(c)
+	}
+	done := make(chan error, 1)
+	go func() { done <- p.WaitSynced(c) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Rollback discards the updates of a write transaction. The pages they
+// allocated are dropped and the file is not touched. Rolling back a read
+// transaction just ends it.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxClosed
+	}
+	tx.done = true
+	if tx.snap != nil {
+		tx.snap.Release()
+		return nil
+	}
+	tx.changes = nil
+	tx.db.pager.Rollback()
+	tx.db.writer.Unlock()
+	return nil
+}
+
+// Savepoint marks the state of the write transaction under name, for
+// RollbackTo to go back to, so that a failed part of the transaction can
+// be undone and the rest committed. Savepoints nest: one of a name taken
+// already hides the other until it is released or rolled past.
+func (tx *Tx) Savepoint(name string) error {
+	return tx.update(func() error {
+		tx.savepoints = append(tx.savepoints, savepoint{
+			name:    name,
+			mark:    tx.db.pager.Savepoint(),
+			root:    tx.tree.Root,
+			changes: len(tx.changes),
+		})
+		return nil
+	})
+}
+
+// RollbackTo undoes the updates of the transaction since the savepoint
+// name, and drops the savepoints taken after it; name itself stays, for
+// another RollbackTo. It fails with ErrNoSavepoint if there is no such
+// savepoint. It also undoes an update that failed with ErrCorrupt: the
+// transaction can go on after, and commit.
+func (tx *Tx) RollbackTo(name string) error {
+	i, err := tx.savepoint(name)
+	if err != nil {
+		return err
+	}
+	sp := tx.savepoints[i]
+	tx.db.pager.RollbackTo(sp.mark)
+	tx.tree.Root = sp.root
+	clear(tx.changes[sp.changes:])
+	tx.changes = tx.changes[:sp.changes]
+	tx.savepoints = tx.savepoints[:i+1]
+	tx.err = nil
+	return nil
+}
+
+// Release drops the savepoint name and those taken after it, keeping the
+// updates since. It fails with ErrNoSavepoint if there is no such
+// savepoint.
+func (tx *Tx) Release(name string) error {
+	i, err := tx.savepoint(name)
+	if err != nil {
+		return err
+	}
+	tx.savepoints = tx.savepoints[:i]
+	if i == 0 {
+		tx.db.pager.ReleaseSavepoints()
+	}
+	return nil
+}
+
+// savepoint returns the index of the last savepoint called name.
+func (tx *Tx) savepoint(name string) (int, error) {
+	switch {
+	case tx.done:
+		return 0, ErrTxClosed
+	case tx.snap != nil:
+		return 0, ErrReadOnly
+	}
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q", ErrNoSavepoint, name)
+}
@@ -0,0 +1,167 @@
+package kv_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/kv"
+)
+
+func TestTxCommit(t *testing.T) {
+	rec := &dbtest.RecordingFS{}
+	db := open(t, kv.Options{FS: rec})
+	rec.Reset()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Writable() {
+		t.Error("Begin gave a read transaction")
+	}
+	for i := range 100 {
+		if err = tx.Set(fmt.Appendf(nil, "k%02d", i), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = tx.Del([]byte("k00")); err != nil {
+		t.Fatal(err)
+	}
+	// The transaction sees its updates; nothing else does yet.
+	if v, err := tx.Get([]byte("k01")); err != nil || string(v) != "v" {
+		t.Errorf("Tx.Get(k01) = %q, %v", v, err)
+	}
+	if _, err := tx.Get([]byte("k00")); err != kv.ErrKeyNotFound {
+		t.Errorf("Tx.Get of a key it deleted: %v", err)
+	}
+	if _, err := db.Get([]byte("k01")); err != kv.ErrKeyNotFound {
+		t.Errorf("DB.Get of an update not committed: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// One commit of the file, whatever the number of updates: its pages
+	// and then its meta page, each synced once.
+	if syncs := rec.Syncs(); len(syncs) > 3 {
+		t.Errorf("commit of 100 updates made %d fsyncs: %v", len(syncs), syncs)
+	}
+	if v := mustGet(t, db, "k99"); v != "v" {
+		t.Errorf("k99 = %q after the commit", v)
+	}
+	if db.LastCommit() != 1 {
+		t.Errorf("LastCommit = %d", db.LastCommit())
+	}
+
+	for name, end := range map[string]func() error{"Commit": tx.Commit, "Rollback": tx.Rollback} {
+		if err := end(); err != kv.ErrTxClosed {
+			t.Errorf("%s of a committed transaction: %v, want ErrTxClosed", name, err)
+		}
+	}
+	if err = tx.Set([]byte("k"), nil); err != kv.ErrTxClosed {
+		t.Errorf("Set in a committed transaction: %v, want ErrTxClosed", err)
+	}
+	if _, err = tx.Get([]byte("k01")); err != kv.ErrTxClosed {
+		t.Errorf("Get in a committed transaction: %v, want ErrTxClosed", err)
+	}
+}
+
+func TestTxRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	fill(t, db, 100)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, _ := db.Begin()
+	for i := range 1000 {
+		tx.Set(fmt.Appendf(nil, "new%04d", i), bytes.Repeat([]byte("x"), 100))
+	}
+	tx.Del([]byte("k001"))
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Error("Rollback changed the file")
+	}
+	if db.LastCommit() != 1 {
+		t.Errorf("LastCommit = %d after a rollback", db.LastCommit())
+	}
+	if v := mustGet(t, db, "k001"); v != "v1" {
+		t.Errorf("k001 = %q after rolling back its delete", v)
+	}
+	if _, err = db.Get([]byte("new0000")); err != kv.ErrKeyNotFound {
+		t.Errorf("key set by a rolled-back transaction: %v", err)
+	}
+	if err = tx.Rollback(); err != kv.ErrTxClosed {
+		t.Errorf("second Rollback: %v, want ErrTxClosed", err)
+	}
+	// The next transaction starts from the last commit.
+	if err = db.Set([]byte("k000"), []byte("w")); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	db.Scan(nil, nil, func(key, val []byte) bool { n++; return true })
+	if n != 100 {
+		t.Errorf("%d keys after the rollback and a Set, want 100", n)
+	}
+}
+
+func TestOneWriter(t *testing.T) {
+	db := open(t, kv.Options{})
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	began := make(chan *kv.Tx)
+	go func() {
+		tx2, _ := db.Begin()
+		began <- tx2
+	}()
+	select {
+	case <-began:
+		t.Fatal("second Begin did not wait for the open transaction")
+	case <-time.After(20 * time.Millisecond):
+	}
+	tx.Set([]byte("k"), []byte("first"))
+	tx.Commit()
+	tx2 := <-began
+	// It starts on the commit of the first.
+	if v, err := tx2.Get([]byte("k")); err != nil || string(v) != "first" {
+		t.Errorf("second transaction reads %q, %v", v, err)
+	}
+	tx2.Rollback()
+}
+
+func TestReadTx(t *testing.T) {
+	db := open(t, kv.Options{})
+	fill(t, db, 10)
+	tx, err := db.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Writable() {
+		t.Error("BeginRead gave a write transaction")
+	}
+	if err = tx.Set([]byte("k"), nil); err != kv.ErrReadOnly {
+		t.Errorf("Set in a read transaction: %v, want ErrReadOnly", err)
+	}
+	if _, err = tx.Del([]byte("k000")); err != kv.ErrReadOnly {
+		t.Errorf("Del in a read transaction: %v, want ErrReadOnly", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Errorf("Commit of a read transaction: %v", err)
+	}
+	if _, err = tx.Get([]byte("k000")); err != kv.ErrTxClosed {
+		t.Errorf("Get after the end: %v, want ErrTxClosed", err)
+	}
+}
@@ -0,0 +1,80 @@
+package kv_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"testing"
+	"testing/iotest"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/kv"
+)
+
+func TestLargeValues(t *testing.T) {
+	db := open(t, kv.Options{MaxValueSize: 4 << 20})
+	big := make([]byte, 3<<20)
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := range big {
+		big[i] = byte(r.Uint32())
+	}
+	if err := db.Set([]byte("big"), big); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Get([]byte("big")); err != nil || !bytes.Equal(got, big) {
+		t.Errorf("Get of a 3 MiB value: %d bytes, %v", len(got), err)
+	}
+	rc, err := db.GetReader([]byte("big"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = iotest.TestReader(rc, big); err != nil {
+		t.Error(err)
+	}
+	if err = rc.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err = db.GetReader([]byte("none")); err != kv.ErrKeyNotFound {
+		t.Errorf("GetReader of a missing key: %v, want ErrKeyNotFound", err)
+	}
+	if err = db.Set([]byte("huge"), make([]byte, 4<<20+1)); !errors.Is(err, btree.ErrValueTooLarge) {
+		t.Errorf("Set over MaxValueSize: %v, want ErrValueTooLarge", err)
+	}
+	if err = db.Verify(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGetReaderOutlivesUpdates(t *testing.T) {
+	db := open(t, kv.Options{})
+	old := bytes.Repeat([]byte("old "), 10_000)
+	if err := db.Set([]byte("k"), old); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := db.GetReader([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	// The reader holds its snapshot: the update writes other pages.
+	if err = db.Set([]byte("k"), bytes.Repeat([]byte("new "), 10_000)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(rc); err != nil || !bytes.Equal(got, old) {
+		t.Errorf("reader after an update read %d bytes, %v; want the old value", len(got), err)
+	}
+
+	tx, err := db.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := tx.GetReader([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+	if _, err = r.Read(make([]byte, 10)); err != kv.ErrTxClosed {
+		t.Errorf("Read after the transaction ended: %v, want ErrTxClosed", err)
+	}
+}
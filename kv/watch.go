@@ -0,0 +1,272 @@
+package kv
+
+import (
+	"bytes"
+	"iter"
+	"sync"
+)
+
+// Change is an update of a key, as a Watcher delivers it.
+type Change struct {
+	Key []byte
+
+	// Old is the value the key had, New the value it was given: nil
+	// where the key was absent, or was deleted, and non-nil, if empty,
+	// for an empty value.
+	Old, New []byte
+
+	// Commit is the number of the commit that made the change (see
+	// DB.LastCommit).
+	Commit uint64
+}
+
+// Watcher delivers the changes committed to the keys of a DB under a
+// prefix, from DB.Watch. The changes of a commit come together, in the
+// order the transaction made them, and commits come in order. Every key a
+// transaction updates counts, the records of TTLs (see TTLPrefix) and the
+// rows of package table included; a key that expires is changed when a
+// sweep deletes it.
+//
+// Changes are queued for C without ever holding up Commit, so a watcher
+// that falls behind holds its backlog in memory. A Watcher must be
+// stopped, or C read until it closes, which it does once the DB is closed
+// and the changes queued before are delivered.
+type Watcher struct {
+	C <-chan Change
+
+	db     *DB
+	prefix []byte
+	mu     sync.Mutex    // guards queue, queued and ended
+	queue  [][]Change    // the changes of each commit
+	queued int           // how many changes the queue holds
+	ended  bool          // no more changes come
+	more   chan struct{} // signalled as the queue grows or ends
+	stop   chan struct{} // closed by Stop
+	once   sync.Once
+}
+
+// Watch returns a Watcher of the changes to the keys starting with prefix,
+// from the next commit on; a nil prefix watches every key. Watch waits for
+// the write transaction, if one is open. The Old and New of each Change
+// are shared by every Watcher and must not be modified.
+func (db *DB) Watch(prefix []byte) (*Watcher, error) {
+	// Under the writer lock, each transaction notes its changes, or not,
+	// for every watcher there is.
+	db.writer.Lock()
+	defer db.writer.Unlock()
+	w, err := db.watch(prefix)
+	if err != nil {
+		return nil, err
+	}
+	c := make(chan Change)
+	w.C = c
+	go w.run(c)
+	return w, nil
+}
+
+// watch adds a Watcher without C, whose changes are taken with next. The
+// caller holds db.writer.
+func (db *DB) watch(prefix []byte) (*Watcher, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	w := &Watcher{
+		db:     db,
+		prefix: bytes.Clone(prefix),
+		more:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+	db.watchMu.Lock()
+	if db.watchers == nil {
+		db.watchers = make(map[*Watcher]bool)
+	}
+	db.watchers[w] = true
+	db.watchMu.Unlock()
+	return w, nil
+}
+
+// Stop ends the watch: C closes, and changes not yet delivered are
+// dropped. Stopping a stopped Watcher does nothing.
+func (w *Watcher) Stop() {
+	w.once.Do(func() {
+		w.db.watchMu.Lock()
+		delete(w.db.watchers, w)
+		w.db.watchMu.Unlock()
+		close(w.stop)
+	})
+}
+
+// run sends the changes queued to c until the queue ends or w is stopped,
+// then closes c.
+func (w *Watcher) run(c chan<- Change) {
+	defer close(c)
+	for {
+		changes, ok := w.next()
+		if !ok {
+			return
+		}
+		for _, ch := range changes {
+			select {
+			case c <- ch:
+			case <-w.stop:
+				return
+			}
+		}
+	}
+}
+
+// next waits for the changes of the next commit in the queue, and reports
+// false instead if the queue ends first or w is stopped.
+func (w *Watcher) next() ([]Change, bool) {
+	for {
+		w.mu.Lock()
+		if len(w.queue) > 0 {
+			changes := w.queue[0]
+			w.queue = w.queue[1:]
+			w.queued -= len(changes)
+			w.mu.Unlock()
+			return changes, true
+		}
+		ended := w.ended
+		w.mu.Unlock()
+		if ended {
+			return nil, false
+		}
+		select {
+		case <-w.more:
+		case <-w.stop:
+			return nil, false
+		}
+	}
+}
+
+// backlog returns how many changes are queued.
+func (w *Watcher) backlog() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.queued
+}
+
+// push queues the changes of a commit under w's prefix, or ends the
+// queue.
+func (w *Watcher) push(changes []Change, end bool) {
+	w.mu.Lock()
+	var mine []Change
+	for _, ch := range changes {
+		if bytes.HasPrefix(ch.Key, w.prefix) {
+			mine = append(mine, ch)
+		}
+	}
+	if len(mine) > 0 {
+		w.queue = append(w.queue, mine)
+		w.queued += len(mine)
+	}
+	w.ended = w.ended || end
+	w.mu.Unlock()
+	select {
+	case w.more <- struct{}{}:
+	default: // already signalled
+	}
+}
+
+// watched reports whether db has watchers, or keeps a backlog.
+func (db *DB) watched() bool {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	return len(db.watchers) > 0 || db.keepBacklog
+}
+
+// publish hands the changes of commit to the watchers.
+func (db *DB) publish(changes []Change, commit uint64) {
+	if len(changes) == 0 {
+		return
+	}
+	for i := range changes {
+		changes[i].Commit = commit
+	}
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	for w := range db.watchers {
+		w.push(changes, false)
+	}
+	if db.keepBacklog {
+		db.keep(changes)
+	}
+}
+
+// endWatches ends the queues of the watchers of db, which is closing.
+func (db *DB) endWatches() {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	for w := range db.watchers {
+		w.push(nil, true)
+	}
+	db.watchers = nil
+}
+
+// insert is tx.tree.Insert, noting the change for the watchers.
+func (tx *Tx) insert(key, val []byte) error {
+	old := tx.old(key)
+	if err := tx.tree.Insert(key, val); err != nil {
+		return err
+	}
+	if val == nil {
+		val = []byte{}
+	}
+	tx.note(key, old, val)
+	return nil
+}
+
+// delete is tx.tree.Delete, noting the change for the watchers.
+func (tx *Tx) delete(key []byte) (bool, error) {
+	old := tx.old(key)
+	deleted, err := tx.tree.Delete(key)
+	if deleted {
+		tx.note(key, old, nil)
+	}
+	return deleted, err
+}
+
+// old returns a copy of the value of key, if the transaction notes its
+// changes.
+func (tx *Tx) old(key []byte) []byte {
+	if !tx.watched {
+		return nil
+	}
+	val, ok := tx.tree.Get(key)
+	if !ok {
+		return nil
+	}
+	return append([]byte{}, val...)
+}
+
+// note notes a change of key from old to new: to a copy of new, unless new
+// is nil for a deletion.
+func (tx *Tx) note(key, old, new []byte) {
+	if !tx.watched {
+		return
+	}
+	if new != nil {
+		new = append([]byte{}, new...)
+	}
+	tx.changes = append(tx.changes, Change{Key: bytes.Clone(key), Old: old, New: new})
+}
+
+// noting returns seq, noting the key-values it yields as they are loaded
+// into an empty tree.
+func (tx *Tx) noting(seq iter.Seq2[[]byte, []byte]) iter.Seq2[[]byte, []byte] {
+	return func(yield func([]byte, []byte) bool) {
+		for key, val := range seq {
+			if val == nil {
+				tx.note(key, nil, []byte{})
+			} else {
+				tx.note(key, nil, val)
+			}
+			if !yield(key, val) {
+				return
+			}
+		}
+	}
+}
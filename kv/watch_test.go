@@ -0,0 +1,187 @@
+package kv_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// changes receives n changes from w, failing the test if they take more
+// than a few seconds, and returns them as key, old, new and commit.
+func changes(tb testing.TB, w *kv.Watcher, n int) []string {
+	tb.Helper()
+	var got []string
+	for range n {
+		select {
+		case ch, ok := <-w.C:
+			if !ok {
+				tb.Fatalf("C closed after %d changes of %d", len(got), n)
+			}
+			var old, new string
+			if ch.Old != nil {
+				old = fmt.Sprintf("%q", ch.Old)
+			}
+			if ch.New != nil {
+				new = fmt.Sprintf("%q", ch.New)
+			}
+			got = append(got, fmt.Sprintf("%s %s→%s @%d", ch.Key, old, new, ch.Commit))
+		case <-time.After(5 * time.Second):
+			tb.Fatalf("%d changes of %d came", len(got), n)
+		}
+	}
+	return got
+}
+
+// quiet fails the test if w delivers a change in the next little while.
+func quiet(tb testing.TB, w *kv.Watcher) {
+	tb.Helper()
+	select {
+	case ch := <-w.C:
+		tb.Errorf("unexpected change %q", ch.Key)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestWatch(t *testing.T) {
+	db := open(t, kv.Options{})
+	db.Set([]byte("before"), []byte("unseen"))
+	all, err := db.Watch(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer all.Stop()
+	a, err := db.Watch([]byte("a/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Stop()
+
+	c := db.LastCommit()
+	db.Set([]byte("a/1"), []byte("x"))
+	db.Set([]byte("a/1"), []byte("y"))
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Set([]byte("a/2"), []byte{})
+	tx.Del([]byte("a/1"))
+	tx.Set([]byte("b/1"), []byte("z"))
+	tx.Del([]byte("missing"))
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// Neither a rolled back transaction nor a Del of nothing is a change.
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Set([]byte("a/3"), []byte("never"))
+	tx.Rollback()
+	db.Del([]byte("missing"))
+	db.Set([]byte("b/2"), nil)
+
+	want := []string{
+		fmt.Sprintf(`a/1 →"x" @%d`, c+1),
+		fmt.Sprintf(`a/1 "x"→"y" @%d`, c+2),
+		fmt.Sprintf(`a/2 →"" @%d`, c+3),
+		fmt.Sprintf(`a/1 "y"→ @%d`, c+3),
+		fmt.Sprintf(`b/1 →"z" @%d`, c+3),
+		fmt.Sprintf(`b/2 →"" @%d`, c+4),
+	}
+	if got := changes(t, all, 6); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("changes\n%q\nwant\n%q", got, want)
+	}
+	quiet(t, all)
+	if got := changes(t, a, 4); fmt.Sprint(got) != fmt.Sprint(want[:4]) {
+		t.Errorf("changes under a/\n%q\nwant\n%q", got, want[:4])
+	}
+	quiet(t, a)
+}
+
+func TestWatchBacklog(t *testing.T) {
+	// A watcher that reads nothing holds up no commit.
+	db := open(t, kv.Options{})
+	w, err := db.Watch(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	for i := range 500 {
+		if err = db.Set(fmt.Appendf(nil, "k%03d", i), []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := changes(t, w, 500)
+	for i, ch := range got {
+		if want := fmt.Sprintf(`k%03d →"v" @%d`, i, i+1); ch != want {
+			t.Fatalf("change %d is %s, want %s", i, ch, want)
+		}
+	}
+}
+
+func TestWatchLoadAndSweep(t *testing.T) {
+	db := open(t, kv.Options{})
+	w, err := db.Watch([]byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	err = db.BulkLoad(func(yield func(k, v []byte) bool) {
+		_ = yield([]byte("k1"), nil) && yield([]byte("k2"), []byte("2"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.SetWithTTL([]byte("k3"), []byte("3"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err = db.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+	// The TTL records are not under the prefix.
+	want := []string{`k1 →"" @1`, `k2 →"2" @1`, `k3 →"3" @2`, `k3 "3"→ @3`}
+	if got := changes(t, w, 4); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("changes\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestWatchEnd(t *testing.T) {
+	db := open(t, kv.Options{})
+	stopped, err := db.Watch(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := db.Watch(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set([]byte("a"), []byte("1"))
+	stopped.Stop()
+	stopped.Stop()
+	// C closes, after a change it was sending, at most.
+	for range stopped.C {
+	}
+	db.Set([]byte("b"), []byte("2"))
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// What was committed before Close comes, then C closes.
+	if got := changes(t, w, 2); fmt.Sprint(got) != `[a →"1" @1 b →"2" @2]` {
+		t.Errorf("changes before Close: %q", got)
+	}
+	select {
+	case _, ok := <-w.C:
+		if ok {
+			t.Error("a change after the last")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("C still open after Close")
+	}
+	w.Stop()
+	if _, err = db.Watch(nil); err != kv.ErrClosed {
+		t.Errorf("Watch after Close: %v, want ErrClosed", err)
+	}
+}
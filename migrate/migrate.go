@@ -0,0 +1,227 @@
+// Package migrate moves the rows of the tables of package table in and out
+// of a database, in common formats: CSV and JSON lines, both ways, and the
+// .dump of a SQLite database, in (see sqlite.go). The key-values of the
+// database itself go in and out as the JSON lines of godb dump and
+// restore.
+//
+// In CSV, the first record names the columns and each of the others is a
+// row: an Int column in decimal, a String as it is, and Bytes in standard
+// base64. In JSON lines, each line is an object of a row, its members
+// named by the columns: an Int a number, a String a string, and Bytes a
+// string in base64, as encoding/json has them. Exports list the columns
+// in the order of the schema; imports take them in any order, but every
+// column once, since a row has no NULL.
+//
+// Every function runs in the kv.Tx it is given, as package table does: an
+// import in one transaction is all or nothing.
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/table"
+)
+
+// ErrFormat is input that is not CSV or JSON lines of the table, or a
+// SQLite dump; the error returned says where.
+var ErrFormat = errors.New("migrate: malformed input")
+
+// ExportCSV writes the rows of t to w as CSV, in primary-key order.
+func ExportCSV(w io.Writer, tx *kv.Tx, t *table.Table) error {
+	cw := csv.NewWriter(w)
+	rec := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		rec[i] = c.Name
+	}
+	if err := cw.Write(rec); err != nil {
+		return err
+	}
+	var werr error
+	err := t.Scan(tx, func(row table.Row) bool {
+		for i, v := range row {
+			switch v := v.(type) {
+			case int64:
+				rec[i] = strconv.FormatInt(v, 10)
+			case string:
+				rec[i] = v
+			case []byte:
+				rec[i] = base64.StdEncoding.EncodeToString(v)
+			}
+		}
+		werr = cw.Write(rec)
+		return werr == nil
+	})
+	if err == nil {
+		err = werr
+	}
+	if err == nil {
+		cw.Flush()
+		err = cw.Error()
+	}
+	return err
+}
+
+// ImportCSV inserts the rows of the CSV r into t, and returns how many
+// there were. Its first record names the columns.
+func ImportCSV(tx *kv.Tx, t *table.Table, r io.Reader) (int, error) {
+	cr := csv.NewReader(r)
+	head, err := cr.Read()
+	if err != nil {
+		return 0, fmt.Errorf("%w: CSV header: %v", ErrFormat, err)
+	}
+	cols, err := columns(t, head)
+	if err != nil {
+		return 0, err
+	}
+	cr.FieldsPerRecord = len(head)
+	cr.ReuseRecord = true
+	n := 0
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		line, _ := cr.FieldPos(0)
+		row := make(table.Row, len(t.Columns))
+		for j, s := range rec {
+			c := t.Columns[cols[j]]
+			var v any
+			switch c.Type {
+			case table.Int:
+				v, err = strconv.ParseInt(s, 10, 64)
+			case table.String:
+				v = s
+			case table.Bytes:
+				v, err = base64.StdEncoding.DecodeString(s)
+			}
+			if err != nil {
+				return n, fmt.Errorf("%w: line %d: column %q: %v", ErrFormat, line, c.Name, err)
+			}
+			row[cols[j]] = v
+		}
+		if err = t.Insert(tx, row); err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		n++
+	}
+}
+
+// columns returns the position in t of each column of names, which must
+// name all of them once.
+func columns(t *table.Table, names []string) ([]int, error) {
+	cols := make([]int, len(names))
+	seen := make([]bool, len(t.Columns))
+	for j, name := range names {
+		i := slices.IndexFunc(t.Columns, func(c table.Column) bool { return c.Name == name })
+		switch {
+		case i < 0:
+			return nil, fmt.Errorf("%w: %s has no column %q", ErrFormat, t.Name, name)
+		case seen[i]:
+			return nil, fmt.Errorf("%w: column %q twice", ErrFormat, name)
+		}
+		cols[j], seen[i] = i, true
+	}
+	if i := slices.Index(seen, false); i >= 0 {
+		return nil, fmt.Errorf("%w: no column %q", ErrFormat, t.Columns[i].Name)
+	}
+	return cols, nil
+}
+
+// ExportJSON writes the rows of t to w as JSON lines, in primary-key
+// order.
+func ExportJSON(w io.Writer, tx *kv.Tx, t *table.Table) error {
+	bw := bufio.NewWriter(w)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	var werr error
+	err := t.Scan(tx, func(row table.Row) bool {
+		buf.Reset()
+		for i, v := range row {
+			buf.WriteString(",")
+			enc.Encode(t.Columns[i].Name)
+			buf.Truncate(buf.Len() - 1) // the newline of Encode
+			buf.WriteString(":")
+			if werr = enc.Encode(v); werr != nil {
+				return false
+			}
+			buf.Truncate(buf.Len() - 1)
+		}
+		line := buf.Bytes()
+		line[0] = '{'
+		bw.Write(line)
+		_, werr = bw.WriteString("}\n")
+		return werr == nil
+	})
+	if err == nil {
+		err = werr
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	return err
+}
+
+// ImportJSON inserts the rows of the JSON lines r into t, and returns how
+// many there were.
+func ImportJSON(tx *kv.Tx, t *table.Table, r io.Reader) (int, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	n := 0
+	for {
+		var obj map[string]json.RawMessage
+		if err := dec.Decode(&obj); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("%w: row %d: %v", ErrFormat, n+1, err)
+		}
+		cols, err := columns(t, slices.Collect(maps.Keys(obj)))
+		if err != nil {
+			return n, fmt.Errorf("row %d: %w", n+1, err)
+		}
+		row := make(table.Row, len(t.Columns))
+		for _, i := range cols {
+			c := t.Columns[i]
+			raw := obj[c.Name]
+			var v any
+			switch c.Type {
+			case table.Int:
+				v, err = decode[int64](raw)
+			case table.String:
+				v, err = decode[string](raw)
+			case table.Bytes:
+				v, err = decode[[]byte](raw)
+			}
+			if err != nil {
+				return n, fmt.Errorf("%w: row %d: column %q: %v", ErrFormat, n+1, c.Name, err)
+			}
+			row[i] = v
+		}
+		if err = t.Insert(tx, row); err != nil {
+			return n, fmt.Errorf("row %d: %w", n+1, err)
+		}
+		n++
+	}
+}
+
+// decode decodes the JSON value raw as a T, which null is not.
+func decode[T any](raw json.RawMessage) (any, error) {
+	var v T
+	if bytes.Equal(raw, []byte("null")) {
+		return v, errors.New("null")
+	}
+	err := json.Unmarshal(raw, &v)
+	return v, err
+}
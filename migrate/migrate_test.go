@@ -0,0 +1,179 @@
+package migrate_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/migrate"
+	"github.com/adcondev/go-database/table"
+)
+
+// schema is that of the table of the tests.
+var schema = table.Schema{
+	Name:       "t",
+	Columns:    []table.Column{{Name: "id", Type: table.Int}, {Name: "name", Type: table.String}, {Name: "data", Type: table.Bytes}},
+	PrimaryKey: []string{"id"},
+}
+
+// begin opens a new database for a test, which closes it at the end, and
+// returns a write transaction of it, rolled back at the end unless it was
+// committed, and the table of schema in it.
+func begin(tb testing.TB) (*kv.Tx, *table.Table) {
+	tb.Helper()
+	db, err := kv.Open(filepath.Join(tb.TempDir(), "db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	tx, err := db.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { tx.Rollback() })
+	t, err := table.Create(tx, schema)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return tx, t
+}
+
+// rows returns the rows of t, in primary-key order, the strings and bytes
+// quoted.
+func rows(tb testing.TB, tx *kv.Tx, t *table.Table) string {
+	tb.Helper()
+	var rs []string
+	err := t.Scan(tx, func(row table.Row) bool {
+		var vals []string
+		for _, v := range row {
+			if n, ok := v.(int64); ok {
+				vals = append(vals, fmt.Sprint(n))
+			} else {
+				vals = append(vals, fmt.Sprintf("%q", v))
+			}
+		}
+		rs = append(rs, "["+strings.Join(vals, " ")+"]")
+		return true
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return "[" + strings.Join(rs, " ") + "]"
+}
+
+// some are rows that take quoting in CSV and JSON.
+var some = []table.Row{
+	{int64(-5), "", []byte{}},
+	{int64(1), `a, "quoted"` + "\nline", []byte{0, 0xff, 'x'}},
+	{int64(2), "ünïcode <&>", []byte("plain")},
+}
+
+// insertSome inserts the rows of some into t.
+func insertSome(tb testing.TB, tx *kv.Tx, t *table.Table) {
+	tb.Helper()
+	for _, row := range some {
+		if err := t.Insert(tx, row); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	tx, tt := begin(t)
+	insertSome(t, tx, tt)
+	var buf bytes.Buffer
+	if err := migrate.ExportCSV(&buf, tx, tt); err != nil {
+		t.Fatal(err)
+	}
+	want := "id,name,data\n" +
+		"-5,,\n" +
+		"1,\"a, \"\"quoted\"\"\nline\",AP94\n" +
+		"2,ünïcode <&>,cGxhaW4=\n"
+	if buf.String() != want {
+		t.Errorf("ExportCSV wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// The columns go in any order.
+	in := "data,id,name\n" + "AP94,1,\"a, \"\"quoted\"\"\nline\"\n" + ",-5,\n" + "cGxhaW4=,2,ünïcode <&>\n"
+	tx2, t2 := begin(t)
+	if n, err := migrate.ImportCSV(tx2, t2, strings.NewReader(in)); n != 3 || err != nil {
+		t.Fatalf("ImportCSV = %d, %v", n, err)
+	}
+	if got, want := rows(t, tx2, t2), rows(t, tx, tt); got != want {
+		t.Errorf("imported %s, want %s", got, want)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tx, tt := begin(t)
+	insertSome(t, tx, tt)
+	var buf bytes.Buffer
+	if err := migrate.ExportJSON(&buf, tx, tt); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":-5,"name":"","data":""}` + "\n" +
+		`{"id":1,"name":"a, \"quoted\"\nline","data":"AP94"}` + "\n" +
+		`{"id":2,"name":"ünïcode <&>","data":"cGxhaW4="}` + "\n"
+	if buf.String() != want {
+		t.Errorf("ExportJSON wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// The members go in any order, and the lines need not be lines.
+	in := `{"data":"AP94","name":"a, \"quoted\"\nline","id":1} {"name":"","id":-5,"data":""}
+		{
+			"id": 2, "name": "ünïcode <&>", "data": "cGxhaW4="
+		}`
+	tx2, t2 := begin(t)
+	if n, err := migrate.ImportJSON(tx2, t2, strings.NewReader(in)); n != 3 || err != nil {
+		t.Fatalf("ImportJSON = %d, %v", n, err)
+	}
+	if got, want := rows(t, tx2, t2), rows(t, tx, tt); got != want {
+		t.Errorf("imported %s, want %s", got, want)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	importCSV := func(tx *kv.Tx, t *table.Table, in string) (int, error) {
+		return migrate.ImportCSV(tx, t, strings.NewReader(in))
+	}
+	importJSON := func(tx *kv.Tx, t *table.Table, in string) (int, error) {
+		return migrate.ImportJSON(tx, t, strings.NewReader(in))
+	}
+	for _, tc := range []struct {
+		name     string
+		imp      func(*kv.Tx, *table.Table, string) (int, error)
+		in       string
+		inserted int
+		err      error
+	}{
+		{"CSV without a header", importCSV, "", 0, migrate.ErrFormat},
+		{"CSV without a column", importCSV, "id,name\n", 0, migrate.ErrFormat},
+		{"CSV of an unknown column", importCSV, "id,name,data,more\n", 0, migrate.ErrFormat},
+		{"CSV of a column twice", importCSV, "id,name,data,id\n", 0, migrate.ErrFormat},
+		{"CSV of a bad Int", importCSV, "id,name,data\n1,a,\nx,b,\n", 1, migrate.ErrFormat},
+		{"CSV of bad base64", importCSV, "id,name,data\n1,a,!!\n", 0, migrate.ErrFormat},
+		{"CSV of a short record", importCSV, "id,name,data\n1,a\n", 0, migrate.ErrFormat},
+		{"CSV of a key twice", importCSV, "id,name,data\n1,a,\n1,b,\n", 1, table.ErrRowExists},
+		{"JSON without a column", importJSON, `{"id":1,"name":"a"}`, 0, migrate.ErrFormat},
+		{"JSON of an unknown column", importJSON, `{"id":1,"name":"a","data":"","more":1}`, 0, migrate.ErrFormat},
+		{"JSON of a bad Int", importJSON, `{"id":1,"name":"a","data":""} {"id":"2","name":"b","data":""}`, 1, migrate.ErrFormat},
+		{"JSON of bad base64", importJSON, `{"id":1,"name":"a","data":"!!"}`, 0, migrate.ErrFormat},
+		{"JSON of a null", importJSON, `{"id":1,"name":null,"data":""}`, 0, migrate.ErrFormat},
+		{"JSON of an array", importJSON, `{"id":1,"name":"a","data":""} [1, "b", ""]`, 1, migrate.ErrFormat},
+		{"JSON of a key twice", importJSON, `{"id":1,"name":"a","data":""} {"id":1,"name":"b","data":""}`, 1, table.ErrRowExists},
+	} {
+		tx, tt := begin(t)
+		if n, err := tc.imp(tx, tt, tc.in); n != tc.inserted || !errors.Is(err, tc.err) {
+			t.Errorf("import of %s = %d, %v; want %d, %v", tc.name, n, err, tc.inserted, tc.err)
+		}
+	}
+	// No lines are no rows.
+	tx, tt := begin(t)
+	if n, err := importJSON(tx, tt, ""); n != 0 || err != nil {
+		t.Errorf("ImportJSON of nothing = %d, %v", n, err)
+	}
+}
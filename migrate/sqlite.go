@@ -0,0 +1,829 @@
+package migrate
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/table"
+)
+
+// ErrUnsupported is a statement of a SQLite dump that ImportSQLite cannot
+// import, such as a table without a type the engine has; the error
+// returned says which.
+var ErrUnsupported = errors.New("migrate: unsupported in a SQLite dump")
+
+// A SQLite dump, the output of the .dump command of the sqlite3 shell, is
+// SQL: a CREATE TABLE for each table, its rows as INSERTs, then its
+// indexes, views and triggers, all in a transaction. ImportSQLite creates
+// the tables and inserts the rows, the columns typed by the rules of
+// SQLite's type affinity:
+//
+//	a type containing INT         table.Int
+//	CHAR, CLOB or TEXT            table.String
+//	BLOB, or no type              table.Bytes
+//	anything else: REAL, NUMERIC  table.String, the values as written
+//
+// A SQLite table without a PRIMARY KEY, keyed by its rowid, gets an Int
+// column "rowid" at the end for its primary key, numbering its rows from
+// 1. UNIQUE columns and constraints become unique indexes, and CREATE
+// INDEX makes an index of the table, filled in with table.Step; NOT NULL,
+// DEFAULT, CHECK, COLLATE and foreign keys are left out, as the engine has
+// no such thing, and so are the statements of the transaction, PRAGMAs
+// and the tables of SQLite itself, sqlite_sequence and the like. A NULL
+// value fails the import, since a row of the engine has a value for every
+// column, and so does a REAL one for an Int column.
+//
+// Indexes on expressions and partial indexes, with a WHERE, the CREATE
+// VIEW and TRIGGER statements and virtual tables are not imported;
+// SQLiteResult lists them.
+
+// SQLiteResult is what ImportSQLite did.
+type SQLiteResult struct {
+	Tables  []string // created
+	Rows    int      // inserted
+	Skipped []string // the beginnings of the statements not imported
+}
+
+// ImportSQLite runs the SQLite dump r in tx: it creates its tables and
+// indexes and inserts their rows. The tables must not exist yet.
+func ImportSQLite(tx *kv.Tx, r io.Reader) (*SQLiteResult, error) {
+	im := &sqliteImport{
+		tx:     tx,
+		lex:    &sqlLexer{r: bufio.NewReader(r), line: 1},
+		tables: make(map[string]*sqliteTable),
+		res:    &SQLiteResult{},
+	}
+	for {
+		stmt, err := im.lex.statement()
+		if err == io.EOF {
+			return im.res, nil
+		}
+		if err == nil {
+			err = im.run(stmt)
+		}
+		if err != nil {
+			return im.res, fmt.Errorf("line %d: %w", im.lex.stmtLine, err)
+		}
+	}
+}
+
+type sqliteImport struct {
+	tx     *kv.Tx
+	lex    *sqlLexer
+	tables map[string]*sqliteTable // by name
+	res    *SQLiteResult
+}
+
+// sqliteTable is a table ImportSQLite created.
+type sqliteTable struct {
+	t     *table.Table
+	rowid int64 // the last rowid given, if the table has the column
+}
+
+// run runs a statement.
+func (im *sqliteImport) run(stmt []sqlToken) error {
+	p := &sqlParser{toks: stmt}
+	switch {
+	case p.word("PRAGMA"), p.word("BEGIN"), p.word("COMMIT"), p.word("END"),
+		p.word("ANALYZE"), p.word("ROLLBACK"), p.word("SAVEPOINT"), p.word("RELEASE"):
+		return nil
+	case p.word("CREATE"):
+		p.word("TEMP")
+		p.word("TEMPORARY")
+		if p.word("TABLE") {
+			return im.createTable(p)
+		}
+		unique := p.word("UNIQUE")
+		if p.word("INDEX") {
+			if ok, err := im.createIndex(p, unique); ok || err != nil {
+				return err
+			}
+		}
+	case p.word("INSERT"):
+		return im.insert(p)
+	case p.word("DELETE"):
+		// Of sqlite_sequence, which the dump sets again after.
+		if p.word("FROM") && internal(p.next().text) {
+			return nil
+		}
+		return fmt.Errorf("%w: DELETE from a table", ErrUnsupported)
+	default:
+		return fmt.Errorf("%w: statement %s", ErrUnsupported, p.toks[0].text)
+	}
+	im.res.Skipped = append(im.res.Skipped, skipped(stmt))
+	return nil
+}
+
+// internal reports whether name is that of a table of SQLite itself.
+func internal(name string) bool {
+	return strings.HasPrefix(strings.ToLower(name), "sqlite_")
+}
+
+// skipped returns the beginning of stmt: its words up to the name of what
+// it creates.
+func skipped(stmt []sqlToken) string {
+	var words []string
+	for _, tok := range stmt {
+		if tok.kind != sqlIdent && tok.kind != sqlName {
+			break
+		}
+		words = append(words, tok.text)
+		if tok.kind == sqlName || !slices.Contains(createWords, strings.ToUpper(tok.text)) {
+			break
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// createWords are the words of a CREATE statement before the name.
+var createWords = []string{"CREATE", "TEMP", "TEMPORARY", "UNIQUE", "VIRTUAL",
+	"TABLE", "INDEX", "VIEW", "TRIGGER", "IF", "NOT", "EXISTS"}
+
+func (im *sqliteImport) createTable(p *sqlParser) error {
+	if p.word("IF") && !(p.word("NOT") && p.word("EXISTS")) {
+		return p.errorf("expected IF NOT EXISTS")
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if internal(name) {
+		return nil
+	}
+	if !p.punct("(") {
+		// CREATE TABLE ... AS SELECT.
+		im.res.Skipped = append(im.res.Skipped, "CREATE TABLE "+name)
+		return nil
+	}
+	s := table.Schema{Name: name}
+	for {
+		if err := im.definition(p, &s); err != nil {
+			return fmt.Errorf("table %s: %w", name, err)
+		}
+		if p.punct(")") {
+			break
+		}
+		if !p.punct(",") {
+			return p.errorf("expected , or ) in CREATE TABLE")
+		}
+	}
+	st := &sqliteTable{rowid: -1}
+	if s.PrimaryKey == nil {
+		if slices.ContainsFunc(s.Columns, func(c table.Column) bool { return strings.EqualFold(c.Name, "rowid") }) {
+			return fmt.Errorf("%w: table %s has a column rowid but no primary key", ErrUnsupported, name)
+		}
+		s.Columns = append(s.Columns, table.Column{Name: "rowid", Type: table.Int})
+		s.PrimaryKey = []string{"rowid"}
+		st.rowid = 0
+	}
+	if st.t, err = table.Create(im.tx, s); err != nil {
+		return err
+	}
+	im.tables[name] = st
+	im.res.Tables = append(im.res.Tables, name)
+	return nil
+}
+
+// createIndex creates the index of a CREATE INDEX, and reports whether it
+// could: not if it is on expressions, partial or of a table not imported.
+func (im *sqliteImport) createIndex(p *sqlParser, unique bool) (bool, error) {
+	if p.word("IF") && !(p.word("NOT") && p.word("EXISTS")) {
+		return false, p.errorf("expected IF NOT EXISTS")
+	}
+	name, err := p.name()
+	if err != nil {
+		return false, err
+	}
+	if !p.word("ON") {
+		return false, p.errorf("expected ON in CREATE INDEX")
+	}
+	tname, err := p.name()
+	if err != nil {
+		return false, err
+	}
+	st := im.tables[tname]
+	cols, err := p.names()
+	if st == nil || err != nil || p.peek().kind != sqlEOF {
+		return internal(tname), nil
+	}
+	x := table.Index{Name: name, Columns: cols, Unique: unique}
+	if err = table.CreateIndex(im.tx, tname, x); err != nil {
+		return false, fmt.Errorf("index %s: %w", name, err)
+	}
+	// The rows are in already, and in the same transaction: no use going
+	// a batch per transaction.
+	for done := false; !done; {
+		if done, err = table.Step(im.tx, tname); err != nil {
+			return false, fmt.Errorf("index %s: %w", name, err)
+		}
+	}
+	// Opened again, the table need not read its new catalog entry for
+	// every row inserted after.
+	st.t, err = table.Open(im.tx, tname)
+	return true, err
+}
+
+// definition parses a column or a constraint of a CREATE TABLE into s.
+func (im *sqliteImport) definition(p *sqlParser, s *table.Schema) error {
+	if p.word("CONSTRAINT") {
+		if _, err := p.name(); err != nil {
+			return err
+		}
+	}
+	switch {
+	case p.word("PRIMARY"):
+		if !p.word("KEY") {
+			return p.errorf("expected KEY after PRIMARY")
+		}
+		cols, err := p.names()
+		if err != nil {
+			return err
+		}
+		s.PrimaryKey = cols
+		p.skip()
+		return nil
+	case p.word("UNIQUE"):
+		cols, err := p.names()
+		if err != nil {
+			return err
+		}
+		s.Indexes = append(s.Indexes, table.Index{Name: "unique_" + strings.Join(cols, "_"), Columns: cols, Unique: true})
+		p.skip()
+		return nil
+	case p.word("CHECK"), p.word("FOREIGN"):
+		p.skip()
+		return nil
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	var typ []string
+	for tok := p.peek(); tok.kind == sqlIdent && !slices.Contains(constraintWords, strings.ToUpper(tok.text)); tok = p.peek() {
+		typ = append(typ, strings.ToUpper(p.next().text))
+	}
+	if p.punct("(") {
+		// VARCHAR(20), DECIMAL(10, 2): the numbers change nothing.
+		p.skipTo(")")
+		p.next()
+	}
+	s.Columns = append(s.Columns, table.Column{Name: name, Type: affinity(strings.Join(typ, " "))})
+	for {
+		switch {
+		case p.word("PRIMARY"):
+			if s.PrimaryKey != nil {
+				return fmt.Errorf("%w: two primary keys", ErrUnsupported)
+			}
+			s.PrimaryKey = []string{name}
+		case p.word("UNIQUE"):
+			s.Indexes = append(s.Indexes, table.Index{Name: "unique_" + name, Columns: []string{name}, Unique: true})
+		case p.peek().kind == sqlPunct && (p.peek().text == "," || p.peek().text == ")"), p.peek().kind == sqlEOF:
+			return nil
+		case p.punct("("):
+			p.skipTo(")") // of CHECK, DEFAULT or REFERENCES
+			p.next()
+		default:
+			p.next()
+		}
+	}
+}
+
+// constraintWords are the words that can start a constraint of a column,
+// and so end its type.
+var constraintWords = []string{"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK",
+	"DEFAULT", "COLLATE", "REFERENCES", "GENERATED", "AS"}
+
+// affinity returns the type of a column of the SQLite type typ.
+func affinity(typ string) table.Type {
+	switch {
+	case strings.Contains(typ, "INT"):
+		return table.Int
+	case strings.Contains(typ, "CHAR"), strings.Contains(typ, "CLOB"), strings.Contains(typ, "TEXT"):
+		return table.String
+	case strings.Contains(typ, "BLOB"), typ == "":
+		return table.Bytes
+	}
+	return table.String
+}
+
+func (im *sqliteImport) insert(p *sqlParser) error {
+	if p.word("OR") {
+		p.next() // REPLACE, IGNORE and the like: the rows are new anyway
+	}
+	if !p.word("INTO") {
+		return p.errorf("expected INTO")
+	}
+	name, err := p.name()
+	if err != nil {
+		return err
+	}
+	if internal(name) {
+		return nil
+	}
+	st := im.tables[name]
+	if st == nil {
+		return fmt.Errorf("%w: INSERT into %s, which the dump does not create", ErrUnsupported, name)
+	}
+	t := st.t
+	var cols []int
+	if p.peek().text == "(" {
+		names, err := p.names()
+		if err != nil {
+			return err
+		}
+		if st.rowid >= 0 {
+			names = append(names, "rowid")
+		}
+		if cols, err = columns(t, names); err != nil {
+			return err
+		}
+		if st.rowid >= 0 {
+			cols = cols[:len(cols)-1]
+		}
+	} else {
+		for i := range t.Columns {
+			cols = append(cols, i)
+		}
+		if st.rowid >= 0 {
+			cols = cols[:len(cols)-1]
+		}
+	}
+	if !p.word("VALUES") {
+		return fmt.Errorf("%w: INSERT into %s but of VALUES", ErrUnsupported, name)
+	}
+	for {
+		if !p.punct("(") {
+			return p.errorf("expected ( of a row")
+		}
+		row := make(table.Row, len(t.Columns))
+		for j := 0; ; j++ {
+			if j == len(cols) {
+				return fmt.Errorf("%w: a row of %s with more values than columns", ErrFormat, name)
+			}
+			c := t.Columns[cols[j]]
+			if row[cols[j]], err = p.value(c.Type); err != nil {
+				return fmt.Errorf("%s, column %s: %w", name, c.Name, err)
+			}
+			if p.punct(")") {
+				if j != len(cols)-1 {
+					return fmt.Errorf("%w: a row of %s with fewer values than columns", ErrFormat, name)
+				}
+				break
+			}
+			if !p.punct(",") {
+				return p.errorf("expected , or ) in a row")
+			}
+		}
+		if st.rowid >= 0 {
+			st.rowid++
+			row[len(row)-1] = st.rowid
+		}
+		if err := t.Insert(im.tx, row); err != nil {
+			return err
+		}
+		im.res.Rows++
+		if !p.punct(",") {
+			break
+		}
+	}
+	if p.peek().kind != sqlEOF {
+		return p.errorf("expected the end of the INSERT")
+	}
+	return nil
+}
+
+// sqlParser reads the tokens of a statement.
+type sqlParser struct {
+	toks []sqlToken
+	i    int
+}
+
+// peek returns the next token, an sqlEOF past the end.
+func (p *sqlParser) peek() sqlToken {
+	if p.i == len(p.toks) {
+		return sqlToken{kind: sqlEOF}
+	}
+	return p.toks[p.i]
+}
+
+func (p *sqlParser) next() sqlToken {
+	tok := p.peek()
+	if p.i < len(p.toks) {
+		p.i++
+	}
+	return tok
+}
+
+// word moves past the next token if it is the keyword w, which is upper
+// case.
+func (p *sqlParser) word(w string) bool {
+	if tok := p.peek(); tok.kind == sqlIdent && strings.EqualFold(tok.text, w) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// punct moves past the next token if it is the punctuation s.
+func (p *sqlParser) punct(s string) bool {
+	if tok := p.peek(); tok.kind == sqlPunct && tok.text == s {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// name reads a name, quoted or not.
+func (p *sqlParser) name() (string, error) {
+	tok := p.next()
+	if tok.kind != sqlIdent && tok.kind != sqlName && tok.kind != sqlString {
+		return "", p.errorf("expected a name, found %q", tok.text)
+	}
+	return tok.text, nil
+}
+
+// names reads a parenthesized list of names; an index column may have a
+// COLLATE, ASC or DESC after it, which is skipped.
+func (p *sqlParser) names() ([]string, error) {
+	if !p.punct("(") {
+		return nil, p.errorf("expected (")
+	}
+	var names []string
+	for {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		for p.peek().kind == sqlIdent {
+			p.next()
+		}
+		if p.punct(")") {
+			return names, nil
+		}
+		if !p.punct(",") {
+			return nil, p.errorf("expected , or ) in a list of names")
+		}
+	}
+}
+
+// skipTo moves to the next token s outside parentheses, or the end.
+func (p *sqlParser) skipTo(s string) {
+	depth := 0
+	for tok := p.peek(); tok.kind != sqlEOF; tok = p.peek() {
+		if tok.kind == sqlPunct {
+			switch {
+			case depth == 0 && tok.text == s:
+				return
+			case tok.text == "(":
+				depth++
+			case tok.text == ")":
+				depth--
+			}
+		}
+		p.next()
+	}
+}
+
+// skip moves to the end of a definition of CREATE TABLE: to the next , or
+// ) outside parentheses.
+func (p *sqlParser) skip() {
+	depth := 0
+	for tok := p.peek(); tok.kind != sqlEOF; tok = p.peek() {
+		if tok.kind == sqlPunct {
+			switch {
+			case depth == 0 && (tok.text == "," || tok.text == ")"):
+				return
+			case tok.text == "(":
+				depth++
+			case tok.text == ")":
+				depth--
+			}
+		}
+		p.next()
+	}
+}
+
+// value reads a literal value of the type of a column.
+func (p *sqlParser) value(typ table.Type) (any, error) {
+	neg := p.punct("-")
+	if !neg {
+		p.punct("+")
+	}
+	tok := p.peek()
+	if tok.kind == sqlIdent && p.i+1 < len(p.toks) && p.toks[p.i+1].text == "(" {
+		s, err := p.text()
+		if err != nil {
+			return nil, err
+		}
+		tok = sqlToken{kind: sqlString, text: s}
+	} else {
+		p.next()
+	}
+	switch {
+	case tok.kind == sqlNumber && typ == table.Int:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s for an integer column", ErrUnsupported, tok.text)
+		}
+		if neg {
+			n = -n
+		}
+		return n, nil
+	case tok.kind == sqlNumber && (typ == table.String || typ == table.Bytes):
+		s := tok.text
+		if neg {
+			s = "-" + s
+		}
+		if typ == table.Bytes {
+			return []byte(s), nil
+		}
+		return s, nil
+	case neg:
+	case tok.kind == sqlString && typ == table.String:
+		return tok.text, nil
+	case tok.kind == sqlString && typ == table.Bytes:
+		return []byte(tok.text), nil
+	case tok.kind == sqlBlob && typ == table.Bytes:
+		return tok.blob, nil
+	case tok.kind == sqlIdent && strings.EqualFold(tok.text, "NULL"):
+		return nil, fmt.Errorf("%w: NULL", ErrUnsupported)
+	}
+	return nil, fmt.Errorf("%w: %q for a %s column", ErrUnsupported, tok.text, typ)
+}
+
+// text reads a string: a literal, or the calls of replace and char with
+// which the sqlite3 shell writes one with line breaks, such as
+//
+//	replace('a\nb','\n',char(10))
+func (p *sqlParser) text() (string, error) {
+	tok := p.next()
+	switch {
+	case tok.kind == sqlString:
+		return tok.text, nil
+	case tok.kind != sqlIdent || !p.punct("("):
+		return "", fmt.Errorf("%w: %q in a string", ErrUnsupported, tok.text)
+	}
+	var args []string
+	for {
+		if arg := p.peek(); arg.kind == sqlNumber && strings.EqualFold(tok.text, "char") {
+			n, err := strconv.ParseInt(p.next().text, 10, 32)
+			if err != nil {
+				return "", fmt.Errorf("%w: char(%s)", ErrUnsupported, arg.text)
+			}
+			args = append(args, string(rune(n)))
+		} else {
+			s, err := p.text()
+			if err != nil {
+				return "", err
+			}
+			args = append(args, s)
+		}
+		if p.punct(")") {
+			break
+		}
+		if !p.punct(",") {
+			return "", p.errorf("expected , or ) in %s()", tok.text)
+		}
+	}
+	switch {
+	case strings.EqualFold(tok.text, "replace") && len(args) == 3:
+		return strings.ReplaceAll(args[0], args[1], args[2]), nil
+	case strings.EqualFold(tok.text, "char"):
+		return strings.Join(args, ""), nil
+	}
+	return "", fmt.Errorf("%w: a call of %s in a value", ErrUnsupported, tok.text)
+}
+
+func (p *sqlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrFormat, fmt.Sprintf(format, args...))
+}
+
+// A sqlToken is a lexical unit of a SQLite dump.
+type sqlToken struct {
+	kind sqlKind
+	text string // as written; the content of a quoted name or a string
+	blob []byte // of an sqlBlob
+}
+
+type sqlKind int
+
+const (
+	sqlEOF    sqlKind = iota
+	sqlIdent          // a name or a keyword
+	sqlName           // a quoted name: "name", [name] or `name`
+	sqlNumber         // 12, 1.5, 1e3
+	sqlString         // 'text', with '' for a quote
+	sqlBlob           // x'hex'
+	sqlPunct          // anything else, a character at a time
+)
+
+// sqlLexer splits a SQLite dump into statements of tokens, as it reads
+// it: a dump can be larger than memory.
+type sqlLexer struct {
+	r        *bufio.Reader
+	line     int // of the next byte
+	stmtLine int // where the last statement began
+}
+
+// statement returns the tokens of the next statement, without its
+// semicolon, or io.EOF at the end of the dump. A CREATE TRIGGER takes in
+// the statements of its body, up to its END.
+func (l *sqlLexer) statement() ([]sqlToken, error) {
+	var toks []sqlToken
+	for {
+		tok, err := l.token()
+		if len(toks) == 0 {
+			l.stmtLine = l.line
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case tok.kind == sqlEOF && len(toks) == 0:
+			return nil, io.EOF
+		case tok.kind == sqlEOF:
+			return toks, nil
+		case tok.kind == sqlPunct && tok.text == ";":
+			if len(toks) == 0 {
+				continue
+			}
+			if trigger(toks) && !strings.EqualFold(toks[len(toks)-1].text, "END") {
+				toks = append(toks, tok)
+				continue
+			}
+			return toks, nil
+		}
+		toks = append(toks, tok)
+	}
+}
+
+// trigger reports whether toks begin a CREATE TRIGGER.
+func trigger(toks []sqlToken) bool {
+	p := &sqlParser{toks: toks}
+	if !p.word("CREATE") {
+		return false
+	}
+	p.word("TEMP")
+	p.word("TEMPORARY")
+	return p.word("TRIGGER")
+}
+
+func (l *sqlLexer) readByte() (byte, error) {
+	c, err := l.r.ReadByte()
+	if c == '\n' {
+		l.line++
+	}
+	return c, err
+}
+
+func (l *sqlLexer) unreadByte(c byte) {
+	l.r.UnreadByte()
+	if c == '\n' {
+		l.line--
+	}
+}
+
+// token returns the next token, skipping space and comments.
+func (l *sqlLexer) token() (sqlToken, error) {
+	for {
+		c, err := l.readByte()
+		if err == io.EOF {
+			return sqlToken{kind: sqlEOF}, nil
+		} else if err != nil {
+			return sqlToken{}, err
+		}
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case c == '-' || c == '/':
+			d, err := l.readByte()
+			if err == nil && (c == '-' && d == '-' || c == '/' && d == '*') {
+				if err = l.comment(c); err != nil {
+					return sqlToken{}, err
+				}
+				continue
+			}
+			if err == nil {
+				l.unreadByte(d)
+			}
+			return sqlToken{kind: sqlPunct, text: string(c)}, nil
+		case c == '\'':
+			s, err := l.quoted('\'')
+			return sqlToken{kind: sqlString, text: s}, err
+		case c == '"' || c == '`':
+			s, err := l.quoted(c)
+			return sqlToken{kind: sqlName, text: s}, err
+		case c == '[':
+			s, err := l.quoted(']')
+			return sqlToken{kind: sqlName, text: s}, err
+		case (c == 'x' || c == 'X') && l.peekByte() == '\'':
+			l.readByte()
+			s, err := l.quoted('\'')
+			if err != nil {
+				return sqlToken{}, err
+			}
+			b, err := hex.DecodeString(s)
+			if err != nil {
+				return sqlToken{}, fmt.Errorf("%w: blob x'%s': %v", ErrFormat, s, err)
+			}
+			return sqlToken{kind: sqlBlob, text: "x'" + s + "'", blob: b}, nil
+		case isLetter(c):
+			return sqlToken{kind: sqlIdent, text: l.run(c, func(c byte) bool { return isLetter(c) || isDigit(c) || c == '$' })}, nil
+		case isDigit(c) || c == '.' && isDigit(l.peekByte()):
+			return sqlToken{kind: sqlNumber, text: l.number(c)}, nil
+		}
+		return sqlToken{kind: sqlPunct, text: string(c)}, nil
+	}
+}
+
+func (l *sqlLexer) peekByte() byte {
+	b, err := l.r.Peek(1)
+	if err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+// run reads the bytes from c on that ok accepts.
+func (l *sqlLexer) run(c byte, ok func(c byte) bool) string {
+	b := []byte{c}
+	for ok(l.peekByte()) {
+		c, _ = l.readByte()
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// number reads a number from c on, with its fraction and exponent.
+func (l *sqlLexer) number(c byte) string {
+	s := l.run(c, func(c byte) bool { return isDigit(c) || c == '.' })
+	if d := l.peekByte(); d == 'e' || d == 'E' {
+		l.readByte()
+		s += string(d)
+		if d = l.peekByte(); d == '+' || d == '-' {
+			l.readByte()
+			s += string(d)
+		}
+		for isDigit(l.peekByte()) {
+			d, _ = l.readByte()
+			s += string(d)
+		}
+	}
+	return s
+}
+
+// quoted reads up to the closing quote q, a doubled one standing for
+// itself, and returns what is between.
+func (l *sqlLexer) quoted(q byte) (string, error) {
+	var b []byte
+	for {
+		c, err := l.readByte()
+		if err == io.EOF {
+			return "", fmt.Errorf("%w: unterminated %c", ErrFormat, q)
+		} else if err != nil {
+			return "", err
+		}
+		if c == q {
+			if l.peekByte() != q || q == ']' {
+				return string(b), nil
+			}
+			l.readByte()
+		}
+		b = append(b, c)
+	}
+}
+
+// comment skips a -- comment to the end of the line, or a /* */ one.
+func (l *sqlLexer) comment(c byte) error {
+	prev := byte(0)
+	for {
+		d, err := l.readByte()
+		switch {
+		case err == io.EOF && c == '-':
+			return nil
+		case err == io.EOF:
+			return fmt.Errorf("%w: unterminated /*", ErrFormat)
+		case err != nil:
+			return err
+		case c == '-' && d == '\n', c == '/' && prev == '*' && d == '/':
+			return nil
+		}
+		prev = d
+	}
+}
+
+// isLetter reports whether c can start a name: a letter, _, or a byte of
+// a non-ASCII character.
+func isLetter(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
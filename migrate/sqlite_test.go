@@ -0,0 +1,140 @@
+package migrate_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/migrate"
+	"github.com/adcondev/go-database/table"
+)
+
+// dump is a dump as the sqlite3 shell writes it, of tables of most kinds.
+const dump = `PRAGMA foreign_keys=OFF;
+BEGIN TRANSACTION;
+CREATE TABLE users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  name VARCHAR(20) NOT NULL UNIQUE,
+  bio TEXT DEFAULT 'none' CHECK (length(bio) < 100),
+  score REAL,
+  avatar BLOB
+);
+INSERT INTO users VALUES(1,'ann','it''s me',1.5,X'0102');
+INSERT INTO users VALUES(2,'bob',replace('line1\nline2','\n',char(10)),-2,x'');
+CREATE TABLE [log] (msg, "at" INT, -- a comment
+  FOREIGN KEY (msg) REFERENCES users(name));
+INSERT INTO "log" VALUES('a',10);
+INSERT INTO log VALUES(X'62',20);
+CREATE TABLE pairs (a INT, b INT, CONSTRAINT pk PRIMARY KEY (a, b), UNIQUE (b));
+INSERT INTO pairs(b,a) VALUES(2,1),(3,1);
+DELETE FROM sqlite_sequence;
+INSERT INTO sqlite_sequence VALUES('users',2);
+CREATE INDEX log_at ON log (at DESC);
+CREATE INDEX partial ON log(at) WHERE at > 0;
+CREATE VIEW v AS SELECT * FROM users;
+CREATE TRIGGER trg AFTER INSERT ON log BEGIN INSERT INTO log VALUES('x',1); END;
+/* the end */
+COMMIT;
+`
+
+// importDump runs ImportSQLite of s in a transaction of a new database,
+// rolled back at the end.
+func importDump(tb testing.TB, s string) (*kv.Tx, *migrate.SQLiteResult, error) {
+	tb.Helper()
+	db, err := kv.Open(filepath.Join(tb.TempDir(), "db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	tx, err := db.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { tx.Rollback() })
+	res, err := migrate.ImportSQLite(tx, strings.NewReader(s))
+	return tx, res, err
+}
+
+func TestImportSQLite(t *testing.T) {
+	tx, res, err := importDump(t, dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(res.Tables) != "[users log pairs]" || res.Rows != 6 {
+		t.Errorf("imported tables %v, %d rows", res.Tables, res.Rows)
+	}
+	if want := "[CREATE INDEX partial CREATE VIEW v CREATE TRIGGER trg]"; fmt.Sprint(res.Skipped) != want {
+		t.Errorf("skipped %v, want %s", res.Skipped, want)
+	}
+	for _, tc := range []struct {
+		name, schema, rows string
+	}{
+		{"users",
+			`{users [{id int64} {name string} {bio string} {score string} {avatar bytes}] [id] [{unique_name [name] true}]}`,
+			`[[1 "ann" "it's me" "1.5" "\x01\x02"] [2 "bob" "line1\nline2" "-2" ""]]`},
+		{"log",
+			`{log [{msg bytes} {at int64} {rowid int64}] [rowid] [{log_at [at] false}]}`,
+			`[["a" 10 1] ["b" 20 2]]`},
+		{"pairs",
+			`{pairs [{a int64} {b int64}] [a b] [{unique_b [b] true}]}`,
+			`[[1 2] [1 3]]`},
+	} {
+		tt, err := table.Open(tx, tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(tt.Schema); got != tc.schema {
+			t.Errorf("schema %s, want %s", got, tc.schema)
+		}
+		if got := rows(t, tx, tt); got != tc.rows {
+			t.Errorf("rows of %s %s, want %s", tc.name, got, tc.rows)
+		}
+	}
+
+	// The indexes hold the rows.
+	tt, _ := table.Open(tx, "log")
+	var found []string
+	err = tt.ScanIndex(tx, "log_at", table.Range{}, func(row table.Row) bool {
+		found = append(found, string(row[0].([]byte)))
+		return true
+	})
+	if err != nil || fmt.Sprint(found) != "[a b]" {
+		t.Errorf("ScanIndex(log_at) = %v, %v", found, err)
+	}
+	users, _ := table.Open(tx, "users")
+	if err = users.Insert(tx, table.Row{int64(3), "ann", "", "", []byte{}}); !errors.Is(err, table.ErrUnique) {
+		t.Errorf("Insert of a second ann: %v, want ErrUnique", err)
+	}
+}
+
+func TestImportSQLiteErrors(t *testing.T) {
+	const create = "CREATE TABLE t (a INT PRIMARY KEY, b TEXT);\n"
+	for _, tc := range []struct {
+		name, dump string
+		err        error
+		line       int
+	}{
+		{"NULL", create + "INSERT INTO t VALUES(1,NULL);", migrate.ErrUnsupported, 2},
+		{"REAL for an Int", create + "INSERT INTO t VALUES(1.5,'x');", migrate.ErrUnsupported, 2},
+		{"a string for an Int", create + "INSERT INTO t VALUES('1','x');", migrate.ErrUnsupported, 2},
+		{"a table not created", "INSERT INTO u VALUES(1);", migrate.ErrUnsupported, 1},
+		{"more values", create + "INSERT INTO t VALUES(1,'x',2);", migrate.ErrFormat, 2},
+		{"fewer values", create + "\n\nINSERT INTO t VALUES(1);", migrate.ErrFormat, 4},
+		{"a SELECT", "SELECT 1;", migrate.ErrUnsupported, 1},
+		{"a rowid column", "CREATE TABLE t (rowid INT, b TEXT);", migrate.ErrUnsupported, 1},
+		{"two primary keys", "CREATE TABLE t (a INT PRIMARY KEY, b INT PRIMARY KEY);", migrate.ErrUnsupported, 1},
+		{"a table twice", create + create, table.ErrExists, 2},
+		{"a key twice", create + "INSERT INTO t VALUES(1,'x'),(1,'y');", table.ErrRowExists, 2},
+		{"an unterminated string", create + "INSERT INTO t VALUES(1,'x);", migrate.ErrFormat, 2},
+		{"a bad blob", "CREATE TABLE t (a BLOB);\nINSERT INTO t VALUES(x'0g');", migrate.ErrFormat, 2},
+		{"an unterminated comment", create + "/* more", migrate.ErrFormat, 2},
+	} {
+		_, _, err := importDump(t, tc.dump)
+		if !errors.Is(err, tc.err) || !strings.HasPrefix(fmt.Sprint(err), fmt.Sprintf("line %d: ", tc.line)) {
+			t.Errorf("ImportSQLite of %s: %v, want %v at line %d", tc.name, err, tc.err, tc.line)
+		}
+	}
+}
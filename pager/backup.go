@@ -0,0 +1,93 @@
+package pager
+
+import (
+	"io"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// WriteTo writes a copy of the snapshot's commit to w, as a database file
+// of its own: the meta page, the pages of the tree where they are in the
+// file, decompressed, and a free list of every other page, which are
+// zeroed, so that the copy opens without a Compressor. The copy of an
+// encrypted file is encrypted anew, and opens with the same key. The
+// writer of p goes on committing meanwhile; the snapshot keeps the tree's
+// pages from changing under the copy. The tree is checked (see
+// btree.BTree.Check) before anything is written, so the copy of a damaged
+// commit fails with the damage found instead.
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	p := s.p
+	inTree, err := p.checkTree(s.root, s.npages, s)
+	if err != nil {
+		return 0, err
+	}
+
+	// The free list is kept on the first free pages and lists the rest.
+	var chain, free []uint64
+	for ptr := uint64(1); ptr < s.npages; ptr++ {
+		if !inTree[ptr] {
+			free = append(free, ptr)
+		}
+	}
+	for len(free) > len(chain)*p.freeCap() {
+		chain, free = append(chain, free[0]), free[1:]
+	}
+	list := make(map[uint64][]byte)
+	p.layFreeList(chain, free, func(ptr uint64, page []byte) {
+		seal(ptr, page)
+		if p.aead != nil {
+			page = p.encrypt(ptr, page)
+		}
+		list[ptr] = page
+	})
+	var head uint64
+	if len(chain) > 0 {
+		head = chain[0]
+	}
+	m := p.meta(s.commit, s.root, s.npages, head)
+	m.compressor = ""
+
+	var written int64
+	zero := make([]byte, p.pageSize)
+	for ptr := uint64(0); ptr < s.npages; ptr++ {
+		page := zero
+		switch {
+		case ptr == 0:
+			page = m.page()
+		case inTree[ptr]:
+			if page, err = p.readPage(ptr); err != nil {
+				return written, err
+			}
+			if p.aead != nil {
+				page = p.encrypt(ptr, page)
+			}
+		case list[ptr] != nil:
+			page = list[ptr]
+		}
+		n, err := w.Write(page)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// checkTree checks the tree at root of a commit with npages pages, read
+// through pages, and returns which pages it is made of.
+func (p *Pager) checkTree(root, npages uint64, pages btree.Pager) ([]bool, error) {
+	inTree := make([]bool, npages)
+	tree := btree.BTree{Root: root, Pager: pages, PageSize: p.usable}
+	_, err := tree.Check(func(ptr uint64) error {
+		if ptr == 0 || ptr >= npages {
+			return errOutside(ptr)
+		}
+		if inTree[ptr] {
+			return errTwice
+		}
+		inTree[ptr] = true
+		_, err := p.readPage(ptr)
+		return err
+	})
+	return inTree, err
+}
@@ -0,0 +1,220 @@
+package pager
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCacheSize is the memory budget of the page cache when
+// Options.CacheSize is zero.
+const DefaultCacheSize = 8 << 20
+
+// Eviction is how the page cache picks the page to drop when it is full.
+type Eviction int
+
+const (
+	// LRU drops the page read least recently.
+	LRU Eviction = iota
+
+	// Clock keeps a reference bit per page, set as the page is read, and
+	// sweeps the pages in a circle, clearing the bits, to drop the first
+	// page found without one. It approximates LRU at less cost per read.
+	Clock
+)
+
+// CacheStats are the counters of the page cache.
+type CacheStats struct {
+	// Mapped is set if pages are read through a memory mapping, which
+	// the system caches; there is no page cache then, and the rest is
+	// zero, as it is with the cache disabled.
+	Mapped bool
+
+	Hits      uint64 // reads found in the cache
+	Misses    uint64 // reads that went to the file
+	Evictions uint64 // pages dropped to make room
+	Pages     int    // pages cached now
+	Capacity  int    // pages the memory budget holds
+}
+
+// HitRate returns the share of reads found in the cache, from 0 to 1; 0
+// before the first read.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Stats are the statistics of a pager.
+type Stats struct {
+	Cache CacheStats
+
+	// Dirty is the number of pages the commit in progress has written,
+	// which live in memory until Commit writes them, outside the cache's
+	// budget.
+	Dirty int
+
+	Pages     uint64 // in the file as of the last commit, the meta page included
+	FreePages int    // on the free list of the last commit; see FreePages
+
+	// The counts since the file was opened: of the committed pages read,
+	// whether from the cache, the mapping or the file, of the pages
+	// commits wrote, meta pages aside, and of the syncs of the file.
+	Reads, Writes, Syncs uint64
+}
+
+// Stats returns the statistics of p. Unlike most of p's methods, it is safe
+// to call from any goroutine.
+func (p *Pager) Stats() Stats {
+	p.mu.Lock()
+	st := Stats{Dirty: int(p.dirty.Load()), Pages: max(p.latest.npages, 1)}
+	p.mu.Unlock()
+	st.FreePages = int(p.freePages.Load())
+	st.Reads, st.Writes, st.Syncs = p.reads.Load(), p.writes.Load(), p.syncs.Load()
+	switch src := p.mm.(type) {
+	case *cache:
+		st.Cache = src.stats()
+	case *readAt, *inflate:
+	default:
+		st.Cache.Mapped = true
+	}
+	return st
+}
+
+// cache keeps the pages read from a page source that reads every page
+// anew from the file, or decompresses it, up to a number of them. The
+// pages are shared: no one writes a committed page, and Commit drops the
+// pages it overwrites.
+type cache struct {
+	src      pageSource
+	policy   Eviction
+	budget   int // in bytes
+	capacity int // in pages, once the page size is known
+
+	mu     sync.Mutex
+	pages  map[uint64]*cached
+	lru    list.List // of *cached, the most recent first, for LRU
+	ring   []*cached // for Clock; a nil is a free slot
+	hand   int
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	evicts uint64
+}
+
+type cached struct {
+	ptr  uint64
+	page []byte
+	ref  bool          // for Clock
+	elem *list.Element // for LRU
+	slot int           // for Clock
+}
+
+func newCache(src pageSource, policy Eviction, budget int) *cache {
+	return &cache{src: src, policy: policy, budget: budget, pages: make(map[uint64]*cached)}
+}
+
+func (c *cache) extend(size int) error { return c.src.extend(size) }
+
+func (c *cache) page(ptr uint64, pageSize int) ([]byte, error) {
+	c.mu.Lock()
+	if e, ok := c.pages[ptr]; ok {
+		if c.policy == LRU {
+			c.lru.MoveToFront(e.elem)
+		} else {
+			e.ref = true
+		}
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return e.page, nil
+	}
+	c.mu.Unlock()
+	// Read without the lock, so that readers of other pages go on.
+	c.misses.Add(1)
+	page, err := c.src.page(ptr, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capacity == 0 {
+		c.capacity = max(c.budget/pageSize, 1)
+	}
+	if _, ok := c.pages[ptr]; !ok {
+		c.add(&cached{ptr: ptr, page: page})
+	}
+	return page, nil
+}
+
+// add adds e, dropping a page if the cache is full.
+func (c *cache) add(e *cached) {
+	c.pages[e.ptr] = e
+	if c.policy == LRU {
+		e.elem = c.lru.PushFront(e)
+		if c.lru.Len() > c.capacity {
+			c.drop(c.lru.Back().Value.(*cached))
+			c.evicts++
+		}
+		return
+	}
+	if len(c.ring) < c.capacity {
+		e.slot = len(c.ring)
+		c.ring = append(c.ring, e)
+		return
+	}
+	for {
+		old := c.ring[c.hand]
+		if old == nil {
+			break
+		}
+		if !old.ref {
+			c.drop(old)
+			c.evicts++
+			break
+		}
+		old.ref = false
+		c.hand = (c.hand + 1) % len(c.ring)
+	}
+	e.slot = c.hand
+	c.ring[c.hand] = e
+	c.hand = (c.hand + 1) % len(c.ring)
+}
+
+// drop drops e from the cache.
+func (c *cache) drop(e *cached) {
+	delete(c.pages, e.ptr)
+	if c.policy == LRU {
+		c.lru.Remove(e.elem)
+	} else {
+		c.ring[e.slot] = nil
+	}
+}
+
+// forget drops page ptr, if cached, as it is overwritten.
+func (c *cache) forget(ptr uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.pages[ptr]; ok {
+		c.drop(e)
+	}
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evicts,
+		Pages:     len(c.pages),
+		Capacity:  c.capacity,
+	}
+}
+
+func (c *cache) close() error {
+	c.mu.Lock()
+	c.pages, c.ring = make(map[uint64]*cached), nil
+	c.lru.Init()
+	c.mu.Unlock()
+	return c.src.close()
+}
@@ -0,0 +1,111 @@
+package pager_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/pager"
+)
+
+// cached returns a pager of 512-byte pages on a file of keys [0, 2000),
+// reopened with o, so that its cache starts empty.
+func cached(tb testing.TB, o pager.Options) *pager.Pager {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "db")
+	p, err := pager.Options{PageSize: 512}.Open(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	update(tb, p, 0, 2000, "value")
+	if err = p.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	if p, err = o.Open(path); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestCacheBudget(t *testing.T) {
+	for _, ev := range []pager.Eviction{pager.LRU, pager.Clock} {
+		t.Run(fmt.Sprint(ev), func(t *testing.T) {
+			p := cached(t, pager.Options{NoMmap: true, CacheSize: 16 * 512, Eviction: ev})
+			if st := p.Stats().Cache; st.Mapped || st.Pages != 0 || st.Hits+st.Misses != 0 {
+				t.Errorf("cache of a file just opened: %+v", st)
+			}
+			// The tree is far larger than the cache.
+			holds(t, p.Tree(), 2000, "value")
+			st := p.Stats().Cache
+			if st.Capacity != 16 || st.Pages != 16 || st.Evictions == 0 || st.Misses == 0 {
+				t.Errorf("cache after reading the tree: %+v", st)
+			}
+
+			// A few keys, on fewer pages than the cache holds, read again
+			// and again, come from the cache.
+			tree := p.Tree()
+			for range 100 {
+				for _, i := range []int{0, 1000, 1999} {
+					if _, ok := tree.Get(key(i)); !ok {
+						t.Fatalf("%s not found", key(i))
+					}
+				}
+			}
+			after := p.Stats().Cache
+			if hits, misses := after.Hits-st.Hits, after.Misses-st.Misses; misses > 16 || hits < 800 {
+				t.Errorf("hot keys: %d hits, %d misses", hits, misses)
+			}
+			if after.HitRate() <= st.HitRate() {
+				t.Errorf("hit rate went from %.2f to %.2f on hot keys", st.HitRate(), after.HitRate())
+			}
+		})
+	}
+}
+
+func TestCacheModes(t *testing.T) {
+	if st := cached(t, pager.Options{}).Stats().Cache; !st.Mapped {
+		t.Errorf("cache of a memory-mapped file: %+v", st)
+	}
+	p := cached(t, pager.Options{NoMmap: true, CacheSize: -1})
+	holds(t, p.Tree(), 2000, "value")
+	if st := p.Stats(); st.Cache != (pager.CacheStats{}) || st.Reads == 0 {
+		t.Errorf("stats with the cache disabled: %+v", st)
+	}
+}
+
+func TestCacheAfterCommits(t *testing.T) {
+	// Commits reuse the pages they free, which the cache must not give
+	// out as they were.
+	p := cached(t, pager.Options{NoMmap: true, CacheSize: 64 * 512})
+	for k := range 10 {
+		val := fmt.Sprint("v", k)
+		update(t, p, 0, 2000, val)
+		holds(t, p.Tree(), 2000, val)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDirty(t *testing.T) {
+	p := cached(t, pager.Options{})
+	tree := p.Tree()
+	for i := range 100 {
+		if err := tree.Insert(key(i), []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := p.Stats().Dirty; d == 0 {
+		t.Error("no dirty pages after the inserts")
+	}
+	p.Rollback()
+	if d := p.Stats().Dirty; d != 0 {
+		t.Errorf("%d dirty pages after Rollback", d)
+	}
+	writes := p.Stats().Writes
+	update(t, p, 0, 100, "new")
+	if st := p.Stats(); st.Dirty != 0 || st.Writes == writes {
+		t.Errorf("after Commit: %d dirty pages, %d written", st.Dirty, st.Writes-writes)
+	}
+}
@@ -0,0 +1,98 @@
+package pager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"path/filepath"
+
+	"github.com/adcondev/go-database/fileio"
+)
+
+// CompactStats are the sizes of a file before and after Compact, in bytes.
+type CompactStats struct {
+	Before, After int64
+}
+
+// Compact shrinks the file to the pages the tree of the last commit needs.
+// The free list only lets later commits reuse pages; it never gives them
+// back. Compact writes the tree, packed (see btree.BTree.BulkLoad), to a
+// new file next to p's, syncs it and renames it over p's file, the way
+// fileio.SaveData2 replaces a file: a crash leaves one file or the other,
+// whole. The new file holds the tree as the commit after the last one, so
+// commit numbers keep growing.
+//
+// Compact drops the commit in progress, closes p and returns the pager of
+// the new file, opened with p's options, to use from then on. Snapshots of
+// p must be released first. If Compact fails before closing p, it returns
+// p as it was; if it cannot open the file again, nil.
+func (p *Pager) Compact() (*Pager, CompactStats, error) {
+	var stats CompactStats
+	switch {
+	case p.closed:
+		return p, stats, ErrClosed
+	case p.readOnly:
+		return p, stats, ErrReadOnly
+	}
+	if err := p.failed(); err != nil {
+		return p, stats, err
+	}
+	p.reset()
+	fi, err := p.fp.Stat()
+	if err != nil {
+		return p, stats, err
+	}
+	stats.Before = fi.Size()
+	tmp, err := p.compactTo(fi)
+	if err != nil {
+		return p, stats, err
+	}
+
+	err = p.Close()
+	if rerr := p.fs.Rename(tmp, p.path); rerr != nil {
+		p.fs.Remove(tmp)
+		err = errors.Join(err, rerr)
+	} else if serr := (fileio.Options{FS: p.fs}).SyncDir(filepath.Dir(p.path)); serr != nil {
+		err = errors.Join(err, serr)
+	}
+	np, oerr := p.opts.Open(p.path)
+	if oerr != nil {
+		return nil, stats, errors.Join(err, oerr)
+	}
+	if fi, serr := np.fp.Stat(); serr == nil {
+		stats.After = fi.Size()
+	}
+	return np, stats, err
+}
+
+// compactTo writes the packed tree of the last commit to a new file, synced,
+// and returns its name. fi describes p's file.
+func (p *Pager) compactTo(fi fs.FileInfo) (string, error) {
+	// A damaged page would fail the copy halfway; find out first.
+	if _, err := p.checkTree(p.root, p.npages, p); err != nil {
+		return "", err
+	}
+	o := p.opts
+	o.PageSize, o.Mode, o.Sync = p.pageSize, fi.Mode(), SyncAlways
+	tmp := fmt.Sprintf("%s.tmp.%s", p.path, fileio.RandomStamp())
+	np, err := o.Open(tmp)
+	if err != nil {
+		return "", err
+	}
+	np.commit = p.commit
+	tree := np.Tree()
+	tree.ValueLimit = math.MaxInt // whatever limit let the values in
+	err = tree.BulkLoad(p.Tree().All())
+	if err == nil {
+		err = np.Commit(tree.Root)
+	}
+	if cerr := np.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		p.fs.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
@@ -0,0 +1,136 @@
+package pager_test
+
+import (
+	"errors"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/pager"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// shrunk returns a pager of a file that held keys [0, 2000) and now holds
+// [0, 100), for Compact to shrink.
+func shrunk(tb testing.TB, o pager.Options, path string) *pager.Pager {
+	tb.Helper()
+	p, err := o.Open(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	update(tb, p, 0, 2000, "value")
+	tree := p.Tree()
+	for i := 100; i < 2000; i++ {
+		tree.Delete(key(i))
+	}
+	if err = p.Commit(tree.Root); err != nil {
+		tb.Fatal(err)
+	}
+	return p
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db")
+	p := shrunk(t, pager.Options{PageSize: 512}, path)
+	commit := p.LastCommit()
+	np, stats, err := p.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { np.Close() }()
+	if stats.After >= stats.Before/4 {
+		t.Errorf("Compact took %d bytes to %d", stats.Before, stats.After)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != stats.After {
+		t.Errorf("file after Compact is %v, %v; want %d bytes", fi, err, stats.After)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory holds %v, want the file alone", entries)
+	}
+	if np.LastCommit() != commit+1 {
+		t.Errorf("compacted file at commit %d, want %d", np.LastCommit(), commit+1)
+	}
+	if np.PageSize() != 512 {
+		t.Errorf("compacted file of %d-byte pages, want 512", np.PageSize())
+	}
+	holds(t, np.Tree(), 100, "value")
+
+	// The new pager is the one to go on with, and says so after reopening.
+	if err = p.Commit(0); !errors.Is(err, pager.ErrClosed) {
+		t.Errorf("Commit of the old pager: %v, want ErrClosed", err)
+	}
+	update(t, np, 100, 200, "value")
+	if err = np.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if np, err = pager.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	holds(t, np.Tree(), 200, "value")
+}
+
+func TestCompactErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	p := shrunk(t, pager.Options{PageSize: 512}, path)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if np, _, err := p.Compact(); !errors.Is(err, pager.ErrClosed) || np != p {
+		t.Errorf("Compact of a closed pager = %p, %v; want it back and ErrClosed", np, err)
+	}
+
+	ro, err := pager.Options{ReadOnly: true}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if np, _, err := ro.Compact(); !errors.Is(err, pager.ErrReadOnly) || np != ro {
+		t.Errorf("Compact of a read-only pager = %p, %v; want it back and ErrReadOnly", np, err)
+	}
+	holds(t, ro.Tree(), 100, "value")
+}
+
+func TestCompactCrash(t *testing.T) {
+	setup := func() *vfs.Mem {
+		mem := &vfs.Mem{}
+		if err := shrunk(t, pager.Options{PageSize: 512, FS: mem}, "db").Close(); err != nil {
+			t.Fatal(err)
+		}
+		return mem
+	}
+	compact := func(fsys vfs.FileSystem) error {
+		p, err := pager.Options{PageSize: 512, FS: fsys}.Open("db")
+		if err != nil {
+			return err
+		}
+		np, _, err := p.Compact()
+		if np != nil {
+			np.Close()
+		}
+		return err
+	}
+	ref := &dbtest.CrashFS{FS: setup()}
+	if err := compact(ref); err != nil {
+		t.Fatal(err)
+	}
+	calls := ref.Calls()
+	for at := 1; at <= calls; at++ {
+		mem := setup()
+		err := compact(&dbtest.CrashFS{FS: mem, CrashAt: at, Rand: rand.New(rand.NewPCG(uint64(at), 4))})
+		if !errors.Is(err, dbtest.ErrCrashed) {
+			t.Fatalf("crash at call %d of %d: Compact ended with %v", at, calls, err)
+		}
+		// The old file or the new one, whole; both hold the same keys.
+		p, err := pager.Options{FS: mem}.Open("db")
+		if err != nil {
+			t.Fatalf("crash at call %d: reopen: %v", at, err)
+		}
+		holds(t, p.Tree(), 100, "value")
+		update(t, p, 0, 300, "after")
+		holds(t, p.Tree(), 300, "after")
+		p.Close()
+	}
+}
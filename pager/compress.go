@@ -0,0 +1,151 @@
+package pager
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// Compressor compresses pages, for Options.Compressor. Its methods must be
+// safe for concurrent use: snapshots read pages from any goroutine. Flate
+// is one; one wrapping snappy or zstd plugs in the same way.
+type Compressor interface {
+	// Name identifies the compressed format in the file, in 1 to 8
+	// bytes. A file whose pages are compressed opens only with a
+	// Compressor of the same name.
+	Name() string
+
+	// Compress appends src, compressed, to dst and returns the result.
+	Compress(dst, src []byte) []byte
+
+	// Decompress appends src, decompressed, to dst and returns the
+	// result, or an error if src is not something Compress made.
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+// A page written when the pager has a Compressor is kept compressed if
+// that makes it smaller, as
+//
+//	| 0xffff | length | checksum | compressed page |
+//	|   2B   |   2B   |    4B    |   length bytes  |
+//
+// where the compressed page is the page without its checksum, bytes 0 to 4
+// and 8 on, and the checksum is that of the stored bytes, as for any page
+// (see pages.go). No page of the tree or of the free list starts with
+// 0xffff, so compressed pages and others are told apart as they are read,
+// and a file can hold both. A compressed page keeps the place of the page
+// in the file, but the rest of it is not written: commits write less, and
+// on file systems with sparse files, pages larger than a block take less
+// room on disk.
+const compressedMark = 0xffff
+
+// maxCompressorName is how long a Compressor's name can be, the room the
+// meta page has for it.
+const maxCompressorName = 8
+
+// Flate compresses pages with compress/flate, favouring speed.
+var Flate Compressor = flateCompressor{}
+
+type flateCompressor struct{}
+
+var (
+	flateWriters sync.Pool // of *flate.Writer
+	flateReaders sync.Pool // of io.ReadCloser, which are flate.Resetters
+)
+
+func (flateCompressor) Name() string { return "flate" }
+
+func (flateCompressor) Compress(dst, src []byte) []byte {
+	buf := bytes.NewBuffer(dst)
+	w, _ := flateWriters.Get().(*flate.Writer)
+	if w == nil {
+		w, _ = flate.NewWriter(buf, flate.BestSpeed)
+	} else {
+		w.Reset(buf)
+	}
+	// Writes to a bytes.Buffer cannot fail.
+	w.Write(src)
+	w.Close()
+	flateWriters.Put(w)
+	return buf.Bytes()
+}
+
+func (flateCompressor) Decompress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	r, _ := flateReaders.Get().(io.ReadCloser)
+	if r == nil {
+		r = flate.NewReader(bytes.NewReader(src))
+	} else {
+		r.(flate.Resetter).Reset(bytes.NewReader(src), nil)
+	}
+	_, err := buf.ReadFrom(r)
+	flateReaders.Put(r)
+	return buf.Bytes(), err
+}
+
+// stored returns what Commit writes of page at ptr, sealed: page, its
+// compressed form if p compresses pages and that is smaller, or it
+// encrypted if p encrypts them. It may change page.
+func (p *Pager) stored(ptr uint64, page []byte) []byte {
+	if p.aead != nil {
+		seal(ptr, page)
+		return p.encrypt(ptr, page)
+	}
+	if p.comp != nil {
+		// The first 4 bytes go where the checksum was, so that what is
+		// compressed is the rest of the page.
+		copy(page[4:8], page[:4])
+		slot := p.comp.Compress(make([]byte, 8, p.pageSize), page[4:])
+		if len(slot) < p.pageSize {
+			binary.LittleEndian.PutUint16(slot[0:], compressedMark)
+			binary.LittleEndian.PutUint16(slot[2:], uint16(len(slot)-8))
+			seal(ptr, slot)
+			return slot
+		}
+	}
+	seal(ptr, page)
+	return page
+}
+
+// inflate decompresses the compressed pages its source reads, and passes
+// the others on as they are. The pages it returns are sealed anew, so
+// that they check out like any.
+type inflate struct {
+	src  pageSource
+	comp Compressor
+}
+
+func (f *inflate) extend(size int) error { return f.src.extend(size) }
+
+func (f *inflate) page(ptr uint64, pageSize int) ([]byte, error) {
+	slot, err := f.src.page(ptr, pageSize)
+	if err != nil || binary.LittleEndian.Uint16(slot) != compressedMark {
+		return slot, err
+	}
+	n := 8 + int(binary.LittleEndian.Uint16(slot[2:]))
+	if n > len(slot) {
+		return nil, &btree.CorruptError{Page: ptr, Reason: fmt.Sprintf("compressed to %d bytes, more than a page", n-8)}
+	}
+	if err := checkPage(ptr, slot[:n]); err != nil {
+		return nil, err
+	}
+	// Decompressed after 4 bytes of room, the page's first 4 bytes land
+	// on its checksum, and the rest where it belongs.
+	page, err := f.comp.Decompress(make([]byte, 4, pageSize), slot[8:n])
+	if err == nil && len(page) != pageSize {
+		err = fmt.Errorf("%d bytes, not a page", len(page)-4)
+	}
+	if err != nil {
+		return nil, &btree.CorruptError{Page: ptr, Reason: "decompressing: " + err.Error()}
+	}
+	copy(page[:4], page[4:8])
+	seal(ptr, page)
+	return page, nil
+}
+
+func (f *inflate) close() error { return f.src.close() }
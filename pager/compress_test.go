@@ -0,0 +1,187 @@
+package pager_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/pager"
+)
+
+// renamed is a Compressor that compresses like Flate under another name.
+type renamed string
+
+func (r renamed) Name() string                             { return string(r) }
+func (renamed) Compress(dst, src []byte) []byte            { return pager.Flate.Compress(dst, src) }
+func (renamed) Decompress(dst, src []byte) ([]byte, error) { return pager.Flate.Decompress(dst, src) }
+
+// compressed returns the numbers of the pages of the file at path, of
+// 1024-byte pages, that are stored compressed.
+func compressed(tb testing.TB, path string) []uint64 {
+	tb.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var ptrs []uint64
+	for ptr := uint64(1); ptr < uint64(len(b)/1024); ptr++ {
+		if binary.LittleEndian.Uint16(b[ptr*1024:]) == 0xffff {
+			ptrs = append(ptrs, ptr)
+		}
+	}
+	return ptrs
+}
+
+func TestCompress(t *testing.T) {
+	for name, o := range map[string]pager.Options{
+		"mmap":   {PageSize: 1024, Compressor: pager.Flate},
+		"ReadAt": {PageSize: 1024, Compressor: pager.Flate, NoMmap: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "db")
+			p, err := o.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			update(t, p, 0, 2000, strings.Repeat("value", 20))
+			holds(t, p.Tree(), 2000, strings.Repeat("value", 20))
+			p.Close()
+			if n, all := len(compressed(t, path)), p.Pages()-1; n < int(all)*3/4 {
+				t.Errorf("%d pages of %d compressed", n, all)
+			}
+
+			if p, err = o.Open(path); err != nil {
+				t.Fatal(err)
+			}
+			holds(t, p.Tree(), 2000, strings.Repeat("value", 20))
+			if _, err = p.Verify(); err != nil {
+				t.Error(err)
+			}
+			p.Close()
+		})
+	}
+}
+
+func TestCompressOpen(t *testing.T) {
+	// An uncompressed file opens with a Compressor, and its pages are
+	// compressed as they are written again.
+	path := filepath.Join(t.TempDir(), "db")
+	p, err := pager.Options{PageSize: 1024}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(t, p, 0, 1000, strings.Repeat("v", 50))
+	p.Close()
+	if n := len(compressed(t, path)); n != 0 {
+		t.Fatalf("%d pages compressed without a Compressor", n)
+	}
+	if p, err = (pager.Options{Compressor: pager.Flate}).Open(path); err != nil {
+		t.Fatal(err)
+	}
+	update(t, p, 0, 10, "new")
+	np, _, err := p.Compact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	np.Close()
+	if n := len(compressed(t, path)); n == 0 {
+		t.Error("no page compressed after Compact")
+	}
+
+	// The compressed file then opens only with the same compressor.
+	for _, o := range []pager.Options{{}, {Compressor: renamed("other")}} {
+		if p, err = o.Open(path); !errors.Is(err, pager.ErrCompress) {
+			t.Errorf("open with %v: %v, want ErrCompress", o.Compressor, err)
+			p.Close()
+		}
+	}
+	if p, err = (pager.Options{Compressor: renamed("flate")}).Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	tree := p.Tree()
+	for i := range 1000 {
+		want := strings.Repeat("v", 50)
+		if i < 10 {
+			want = "new"
+		}
+		if v, ok := tree.Get(key(i)); !ok || string(v) != want {
+			t.Fatalf("%s = %q, %v; want %q", key(i), v, ok, want)
+		}
+	}
+
+	// A backup is written decompressed, for opening without one.
+	var buf bytes.Buffer
+	s := p.Snapshot()
+	_, err = s.WriteTo(&buf)
+	s.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+	copyPath := filepath.Join(t.TempDir(), "copy")
+	if err = os.WriteFile(copyPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := pager.Open(copyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if m := contents(t, c.Tree()); len(m) != 1000 {
+		t.Errorf("backup holds %d keys, want 1000", len(m))
+	}
+}
+
+func TestCompressErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []pager.Compressor{renamed(""), renamed("ninechars")} {
+		if _, err := (pager.Options{Compressor: c}).Open(filepath.Join(dir, "db")); !errors.Is(err, pager.ErrCompress) {
+			t.Errorf("Compressor named %q: %v, want ErrCompress", c.Name(), err)
+		}
+	}
+	o := pager.Options{Compressor: pager.Flate, Key: make([]byte, 16)}
+	if _, err := o.Open(filepath.Join(dir, "db")); err == nil {
+		t.Error("pages both compressed and encrypted")
+	}
+
+	// Damage to a compressed page shows as such.
+	path := filepath.Join(dir, "damaged")
+	p, err := pager.Options{PageSize: 1024, Compressor: pager.Flate}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(t, p, 0, 500, strings.Repeat("value", 20))
+	p.Close()
+	ptrs := compressed(t, path)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := ptrs[len(ptrs)-1]
+	b[bad*1024+20] ^= 0x01
+	// The length of the first is past the end of its page.
+	binary.LittleEndian.PutUint16(b[ptrs[0]*1024+2:], 1024)
+	if err = os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = (pager.Options{Compressor: pager.Flate}).Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for _, ptr := range []uint64{bad, ptrs[0]} {
+		func() {
+			defer func() {
+				ce, ok := recover().(*btree.CorruptError)
+				if !ok || ce.Page != ptr {
+					t.Errorf("reading damaged page %d panicked with %v", ptr, ce)
+				}
+			}()
+			p.Page(ptr)
+		}()
+	}
+}
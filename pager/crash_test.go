@@ -0,0 +1,79 @@
+package pager_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/pager"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// crashCommits is how many commits the crash workload makes. Commit k sets
+// keys [0, crashKeys(k)) to "c<k>".
+const crashCommits = 8
+
+func crashKeys(k int) int { return 100 + 40*k }
+
+// crashRun runs the crash workload on fsys and returns how many commits
+// were acknowledged before it failed, if it did.
+func crashRun(fsys vfs.FileSystem) (acked int, err error) {
+	p, err := pager.Options{PageSize: 512, FS: fsys}.Open("db")
+	if err != nil {
+		return 0, err
+	}
+	defer p.Close()
+	for k := 1; k <= crashCommits; k++ {
+		tree := p.Tree()
+		for i := range crashKeys(k) {
+			if err = tree.Insert(key(i), fmt.Appendf(nil, "c%d", k)); err != nil {
+				return acked, err
+			}
+		}
+		if err = p.Commit(tree.Root); err != nil {
+			return acked, err
+		}
+		acked = k
+	}
+	return acked, nil
+}
+
+func TestCrash(t *testing.T) {
+	ref := &dbtest.CrashFS{FS: &vfs.Mem{}}
+	if _, err := crashRun(ref); err != nil {
+		t.Fatal(err)
+	}
+	calls := ref.Calls()
+	for at := 1; at <= calls; at++ {
+		mem := &vfs.Mem{}
+		acked, err := crashRun(&dbtest.CrashFS{FS: mem, CrashAt: at, Rand: rand.New(rand.NewPCG(uint64(at), 3))})
+		if !errors.Is(err, dbtest.ErrCrashed) {
+			t.Fatalf("crash at call %d of %d: workload ended with %v", at, calls, err)
+		}
+
+		p, err := pager.Options{FS: mem}.Open("db")
+		if err != nil {
+			t.Fatalf("crash at call %d: reopen: %v", at, err)
+		}
+		// The last commit acknowledged survives, or the one in progress
+		// made it whole.
+		k := int(p.LastCommit())
+		if k != acked && k != acked+1 {
+			t.Fatalf("crash at call %d: reopened at commit %d after %d acknowledged", at, k, acked)
+		}
+		if k == 0 {
+			if p.Root() != 0 {
+				t.Fatalf("crash at call %d: no commit, but a root", at)
+			}
+		} else {
+			holds(t, p.Tree(), crashKeys(k), fmt.Sprintf("c%d", k))
+		}
+		// An update of what was recovered reuses its free pages, which
+		// must not be pages the tree still uses.
+		update(t, p, 0, crashKeys(crashCommits), "after")
+		holds(t, p.Tree(), crashKeys(crashCommits), "after")
+		p.Close()
+	}
+}
@@ -0,0 +1,131 @@
+package pager
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// A file opened with Options.Key or Options.DeriveKey has every page but
+// the meta page encrypted with AES-GCM, as
+//
+//	| encrypted page | tag | nonce |
+//	|                | 16B |  12B  |
+//
+// The tree and the free list get pages that much smaller (see
+// Pager.PageSize), so that an encrypted page fills its place in the file.
+// The nonce is random, made anew each time a page is written, and the page
+// number is authenticated along with the page: a page copied to another
+// place fails as surely as one changed in place. Random nonces collide
+// once a key has encrypted some 2^32 pages, so a key should not outlive
+// that many writes.
+//
+// The meta slots are not encrypted, but authenticated: each holds the salt
+// of the file, which DeriveKey is called with, a nonce and the GCM tag of
+// an empty message with the rest of the slot as additional data. No one
+// without the key can point the file at other pages or commits.
+const (
+	saltSize  = 16
+	nonceSize = 12
+	tagSize   = 16
+	reserve   = tagSize + nonceSize // bytes an encrypted page gives up
+)
+
+func (o Options) encrypted() bool { return o.Key != nil || o.DeriveKey != nil }
+
+// cipher returns the AEAD of the key of a file with the given salt, and
+// makes it p's. The key is derived once for the salt.
+func (p *Pager) cipher(salt []byte) (cipher.AEAD, error) {
+	if p.aead != nil && bytes.Equal(salt, p.salt) {
+		return p.aead, nil
+	}
+	key := p.opts.Key
+	if p.opts.DeriveKey != nil {
+		var err error
+		if key, err = p.opts.DeriveKey(bytes.Clone(salt)); err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	p.aead, p.salt = aead, bytes.Clone(salt)
+	return aead, nil
+}
+
+// newSalt sets up the cipher of a new file, with a salt of its own.
+func (p *Pager) newSalt() error {
+	salt := make([]byte, saltSize)
+	rand.Read(salt)
+	_, err := p.cipher(salt)
+	return err
+}
+
+// encrypt returns page, sealed, encrypted to be written at ptr.
+func (p *Pager) encrypt(ptr uint64, page []byte) []byte {
+	var nonce [nonceSize]byte
+	rand.Read(nonce[:])
+	slot := p.aead.Seal(make([]byte, 0, p.pageSize), nonce[:], page, pageNumber(ptr))
+	return append(slot, nonce[:]...)
+}
+
+func pageNumber(ptr uint64) []byte {
+	return binary.LittleEndian.AppendUint64(nil, ptr)
+}
+
+// decrypt decrypts the pages its source reads.
+type decrypt struct {
+	src  pageSource
+	aead cipher.AEAD
+}
+
+func (d *decrypt) extend(size int) error { return d.src.extend(size) }
+
+func (d *decrypt) page(ptr uint64, pageSize int) ([]byte, error) {
+	slot, err := d.src.page(ptr, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	n := pageSize - nonceSize
+	page, err := d.aead.Open(make([]byte, 0, n-tagSize), slot[n:], slot[:n], pageNumber(ptr))
+	if err != nil {
+		return nil, &btree.CorruptError{Page: ptr, Reason: "fails authentication"}
+	}
+	return page, nil
+}
+
+func (d *decrypt) close() error { return d.src.close() }
+
+// authenticate fills in ext, the salt, nonce and tag of the meta slot buf
+// of an encrypted file, whose other fields are set.
+func (m meta) authenticate(buf, ext []byte) {
+	copy(ext, m.salt)
+	nonce := ext[saltSize : saltSize+nonceSize]
+	rand.Read(nonce)
+	copy(ext[saltSize+nonceSize:], m.aead.Seal(nil, nonce, nil, buf[:len(buf)-len(ext)+saltSize]))
+}
+
+// authentic reports whether ext, the salt, nonce and tag of the meta slot
+// buf, check out with p's key. If not, p.keyErr says why.
+func (p *Pager) authentic(buf, ext []byte) (cipher.AEAD, bool) {
+	aead, err := p.cipher(ext[:saltSize])
+	if err != nil {
+		p.keyErr = err
+		return nil, false
+	}
+	nonce, tag := ext[saltSize:saltSize+nonceSize], ext[saltSize+nonceSize:]
+	if _, err = aead.Open(nil, nonce, tag, buf[:len(buf)-len(ext)+saltSize]); err != nil {
+		p.keyErr = ErrKey
+		return nil, false
+	}
+	return aead, true
+}
@@ -0,0 +1,160 @@
+package pager_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/pager"
+)
+
+// encrypted returns the path of a file of 1024-byte pages holding keys
+// [0, 1000), set to "secret", encrypted with o.
+func encrypted(tb testing.TB, o pager.Options) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "db")
+	o.PageSize = 1024
+	p, err := o.Open(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	update(tb, p, 0, 1000, "secret")
+	if err = p.Close(); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+func TestEncrypt(t *testing.T) {
+	for _, size := range []int{16, 24, 32} {
+		k := bytes.Repeat([]byte{byte(size)}, size)
+		path := encrypted(t, pager.Options{Key: k})
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(b, []byte("secret")) || bytes.Contains(b, key(500)) {
+			t.Errorf("AES-%d: the file holds its keys or values in the clear", size*8)
+		}
+		for _, o := range []pager.Options{{Key: k}, {Key: k, NoMmap: true}} {
+			p, err := o.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.PageSize() != 1024-28 {
+				t.Errorf("PageSize = %d, want 28 bytes less than 1024", p.PageSize())
+			}
+			holds(t, p.Tree(), 1000, "secret")
+			if _, err = p.Verify(); err != nil {
+				t.Error(err)
+			}
+			p.Close()
+		}
+	}
+}
+
+func TestEncryptKeys(t *testing.T) {
+	k := bytes.Repeat([]byte{1}, 32)
+	path := encrypted(t, pager.Options{Key: k})
+	for name, o := range map[string]pager.Options{
+		"no key":    {},
+		"wrong key": {Key: bytes.Repeat([]byte{2}, 32)},
+		"shorter":   {Key: k[:16]},
+	} {
+		if p, err := o.Open(path); !errors.Is(err, pager.ErrKey) {
+			t.Errorf("%s: %v, want ErrKey", name, err)
+			p.Close()
+		}
+	}
+	plain := encrypted(t, pager.Options{})
+	if p, err := (pager.Options{Key: k}).Open(plain); !errors.Is(err, pager.ErrKey) {
+		t.Errorf("unencrypted file with a key: %v, want ErrKey", err)
+		p.Close()
+	}
+	if _, err := (pager.Options{Key: k[:10]}).Open(filepath.Join(t.TempDir(), "db")); err == nil {
+		t.Error("a new file with a 10-byte key")
+	}
+}
+
+func TestDeriveKey(t *testing.T) {
+	var salts [][]byte
+	derive := func(salt []byte) ([]byte, error) {
+		salts = append(salts, salt)
+		return append(bytes.Repeat([]byte{7}, 16), salt...), nil
+	}
+	a := encrypted(t, pager.Options{DeriveKey: derive})
+	b := encrypted(t, pager.Options{DeriveKey: derive})
+	if len(salts) != 2 || len(salts[0]) != 16 || bytes.Equal(salts[0], salts[1]) {
+		t.Fatalf("salts of two files: %x", salts)
+	}
+	p, err := pager.Options{DeriveKey: derive}.Open(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holds(t, p.Tree(), 1000, "secret")
+	p.Close()
+	if !bytes.Equal(salts[2], salts[0]) {
+		t.Errorf("reopened with salt %x, want %x", salts[2], salts[0])
+	}
+	// The key of a is not that of b.
+	if _, err = (pager.Options{Key: append(bytes.Repeat([]byte{7}, 16), salts[0]...)}).Open(b); !errors.Is(err, pager.ErrKey) {
+		t.Errorf("open of b with a's key: %v, want ErrKey", err)
+	}
+	failed := errors.New("no passphrase")
+	if _, err = (pager.Options{DeriveKey: func([]byte) ([]byte, error) { return nil, failed }}).Open(a); !errors.Is(err, failed) {
+		t.Errorf("open with a failing DeriveKey: %v", err)
+	}
+}
+
+func TestEncryptTamper(t *testing.T) {
+	k := bytes.Repeat([]byte{1}, 32)
+	path := encrypted(t, pager.Options{Key: k})
+	p, err := pager.Options{Key: k}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages []uint64
+	p.Tree().Check(func(ptr uint64) error { pages = append(pages, ptr); return nil })
+	p.Close()
+	orig, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A page copied over another, whole, fails authentication there.
+	b := bytes.Clone(orig)
+	from, to := pages[1], pages[2]
+	copy(b[to*1024:(to+1)*1024], b[from*1024:(from+1)*1024])
+	if err = os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = (pager.Options{Key: k}).Open(path); err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Verify()
+	var ce *btree.CorruptError
+	if !errors.As(err, &ce) || ce.Page != to {
+		t.Errorf("Verify = %v, want page %d corrupt", err, to)
+	}
+	p.Close()
+
+	// A meta slot changed, with its checksum made good, does not open.
+	b = bytes.Clone(orig)
+	for _, off := range []int{0, 512} {
+		slot := b[off:]
+		binary.LittleEndian.PutUint64(slot[16:], binary.LittleEndian.Uint64(slot[16:])+1)
+		binary.LittleEndian.PutUint32(slot[96:], crc32.ChecksumIEEE(slot[:96]))
+	}
+	if err = os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = (pager.Options{Key: k}).Open(path); !errors.Is(err, pager.ErrKey) {
+		t.Errorf("open with the meta page changed: %v, want ErrKey", err)
+		p.Close()
+	}
+}
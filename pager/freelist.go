@@ -0,0 +1,129 @@
+package pager
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// The free list records the pages no committed tree uses, so that later
+// commits can reuse them instead of growing the file. It is kept in a
+// chain of pages, each
+//
+//	| count | checksum | next | count page pointers |
+//	|  4B   |    4B    |  8B  |      count * 8B     |
+//
+// where next is the following page of the chain, or 0 for the last one,
+// and the checksum is that of every page (see pages.go).
+// Every commit writes the whole list anew, over pages that were already
+// free, so the chain the previous commit points to stays intact until the
+// meta page flips.
+const freeHeader = 16
+
+// freeCap is how many pointers a free list page holds.
+func (p *Pager) freeCap() int { return (p.usable - freeHeader) / 8 }
+
+// loadFreeList reads the chain starting at head. A pager that continues
+// on errors makes do without a damaged one: it never reuses pages anyway.
+func (p *Pager) loadFreeList(head uint64) error {
+	free, chain, err := p.readFreeList(head)
+	if err != nil && !p.continueOnError {
+		return err
+	}
+	p.free, p.freeChain = free, chain
+	p.freePages.Store(int64(p.FreePages()))
+	return nil
+}
+
+// readFreeList returns the free pages listed by the chain starting at
+// head, and the pages of the chain. It reports every pointer out of range,
+// and stops at a chain page that cannot be read on.
+func (p *Pager) readFreeList(head uint64) (free, chain []uint64, err error) {
+	var errs []error
+	for ptr, prev := head, uint64(0); ptr != 0; { // prev, the meta page at first, points to ptr
+		switch {
+		case ptr >= p.npages:
+			errs = append(errs, &btree.CorruptError{Page: prev, Reason: fmt.Sprintf("free list points past the end, to %d", ptr)})
+		case uint64(len(chain)) >= p.npages:
+			errs = append(errs, &btree.CorruptError{Page: prev, Reason: "free list loops"})
+		}
+		if len(errs) > 0 {
+			return nil, nil, errors.Join(errs...)
+		}
+		chain = append(chain, ptr)
+		page, err := p.readPage(ptr)
+		if err != nil {
+			return nil, nil, err
+		}
+		count := int(binary.LittleEndian.Uint32(page[0:]))
+		if count > p.freeCap() {
+			return nil, nil, &btree.CorruptError{Page: ptr, Reason: fmt.Sprintf("free list page holds %d pointers, more than fit", count)}
+		}
+		for i := 0; i < count; i++ {
+			f := binary.LittleEndian.Uint64(page[freeHeader+8*i:])
+			if f == 0 || f >= p.npages {
+				errs = append(errs, &btree.CorruptError{Page: ptr, Reason: fmt.Sprintf("free list entry %d is page %d", i, f)})
+				continue
+			}
+			free = append(free, f)
+		}
+		prev, ptr = ptr, binary.LittleEndian.Uint64(page[8:])
+	}
+	return free, chain, errors.Join(errs...)
+}
+
+// buildFreeList lays out the free list the commit in progress leaves
+// behind: the pages Alloc did not take, the pages still held for
+// snapshots, plus the pages that the commit frees (freed pages and the old
+// chain), which only become free once it is durable. The chain's own pages
+// come out of the first group, or are appended when that runs dry. It
+// returns the head of the new chain.
+func (p *Pager) buildFreeList() uint64 {
+	later := append(append([]uint64(nil), p.freed...), p.freeChain...)
+	for _, h := range p.held {
+		later = append(later, h.pages...)
+	}
+	var chain []uint64
+	for {
+		n := len(p.avail) + len(later)
+		if (n+p.freeCap()-1)/p.freeCap() <= len(chain) {
+			break
+		}
+		if len(p.avail) > 0 {
+			chain = append(chain, p.avail[len(p.avail)-1])
+			p.avail = p.avail[:len(p.avail)-1]
+		} else {
+			p.pending = append(p.pending, nil)
+			chain = append(chain, p.npages+uint64(len(p.pending)-1))
+		}
+	}
+	free := append(append([]uint64(nil), p.avail...), later...)
+	p.layFreeList(chain, free, p.set)
+	p.nextAvail = append([]uint64(nil), p.avail...)
+	p.nextHeld = append(append([]uint64(nil), p.freed...), p.freeChain...)
+	p.nextChain = chain
+	if len(chain) == 0 {
+		return 0
+	}
+	return chain[0]
+}
+
+// layFreeList lays out the pages of a free list listing free over the
+// pages of chain, which must be enough, and passes each to set.
+func (p *Pager) layFreeList(chain, free []uint64, set func(ptr uint64, page []byte)) {
+	for i, ptr := range chain {
+		page := make([]byte, p.usable)
+		count := min(len(free), p.freeCap())
+		if i+1 < len(chain) {
+			binary.LittleEndian.PutUint64(page[8:], chain[i+1])
+		}
+		binary.LittleEndian.PutUint32(page[0:], uint32(count))
+		for j, f := range free[:count] {
+			binary.LittleEndian.PutUint64(page[freeHeader+8*j:], f)
+		}
+		free = free[count:]
+		set(ptr, page)
+	}
+}
@@ -0,0 +1,98 @@
+package pager_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/pager"
+)
+
+func TestFileSizeStabilizes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	p, err := pager.Options{PageSize: 512}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(t, p, 0, 1000, "v0")
+	var pages []uint64
+	for round := range 50 {
+		// Rewrite a tenth of the keys, a different tenth every time.
+		val := fmt.Sprint("v", round+1)
+		tree := p.Tree()
+		for i := round % 10; i < 1000; i += 10 {
+			if err = tree.Insert(key(i), []byte(val)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = p.Commit(tree.Root); err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, p.Pages())
+	}
+	if p.FreePages() == 0 {
+		t.Error("no free pages after 50 updates")
+	}
+	// Once the free list holds what a commit frees, the file stops
+	// growing.
+	if grown := pages[len(pages)-1] - pages[9]; grown != 0 {
+		t.Errorf("file grew by %d pages over the last 40 updates: %v", grown, pages)
+	}
+
+	// The free list is in the file: after a reopen, updates reuse it.
+	free, n := p.FreePages(), p.Pages()
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p, err = pager.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.FreePages() != free {
+		t.Errorf("%d free pages after reopening, want %d", p.FreePages(), free)
+	}
+	for range 10 {
+		update(t, p, 0, 100, "again")
+	}
+	if p.Pages() != n {
+		t.Errorf("file grew from %d to %d pages after the reopen", n, p.Pages())
+	}
+	m := contents(t, p.Tree())
+	if len(m) != 1000 || m[string(key(0))] != "again" || m[string(key(999))] != "v50" {
+		t.Errorf("tree of %d keys, %s=%q, %s=%q", len(m), key(0), m[string(key(0))], key(999), m[string(key(999))])
+	}
+}
+
+func TestSnapshotHoldsPages(t *testing.T) {
+	p, err := pager.Options{PageSize: 512}.Open(pager.Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	update(t, p, 0, 500, "old")
+	snap := p.Snapshot()
+	// While the snapshot is open, the pages it reads are not reused, so
+	// it reads the old tree whatever the writer does.
+	for range 20 {
+		update(t, p, 0, 500, "new")
+	}
+	old := contents(t, &btree.BTree{Root: snap.Root(), Pager: snap, PageSize: p.PageSize()})
+	if len(old) != 500 || old[string(key(0))] != "old" {
+		t.Fatalf("snapshot reads %d keys, %s=%q", len(old), key(0), old[string(key(0))])
+	}
+	snap.Release()
+	// Released, its pages go back on the free list, from the commit
+	// after next; the file stops growing.
+	for range 2 {
+		update(t, p, 0, 500, "newer")
+	}
+	grown := p.Pages()
+	for range 20 {
+		update(t, p, 0, 500, "newer")
+	}
+	if p.Pages() != grown {
+		t.Errorf("file grew from %d to %d pages after the release", grown, p.Pages())
+	}
+	holds(t, p.Tree(), 500, "newer")
+}
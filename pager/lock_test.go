@@ -0,0 +1,63 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows
+
+package pager_test
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/pager"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	w, err := pager.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(t, w, 0, 10, "v")
+	// The locks are per open file, so they hold within a process too.
+	for name, o := range map[string]pager.Options{"read-write": {}, "read-only": {ReadOnly: true}} {
+		_, err := o.Open(path)
+		if !errors.Is(err, pager.ErrLocked) {
+			t.Errorf("%s open of a file open for writing: %v, want ErrLocked", name, err)
+		}
+		var pe *fs.PathError
+		if !errors.As(err, &pe) || pe.Path != path {
+			t.Errorf("%s open: %v does not name the file", name, err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Readers share the file, and keep writers out.
+	r1, err := pager.Options{ReadOnly: true}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := pager.Options{ReadOnly: true}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	holds(t, r2.Tree(), 10, "v")
+	if err = r1.Commit(r1.Root()); err != pager.ErrReadOnly {
+		t.Errorf("Commit on a read-only pager: %v, want ErrReadOnly", err)
+	}
+	if _, err = pager.Open(path); !errors.Is(err, pager.ErrLocked) {
+		t.Errorf("read-write open of a file open for reading: %v, want ErrLocked", err)
+	}
+	r1.Close()
+	if _, err = pager.Open(path); !errors.Is(err, pager.ErrLocked) {
+		t.Errorf("read-write open with one reader left: %v, want ErrLocked", err)
+	}
+	r2.Close()
+
+	// Closed, the file is free again.
+	if w, err = pager.Open(path); err != nil {
+		t.Fatalf("open after every pager closed: %v", err)
+	}
+	w.Close()
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package pager
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procLockFileEx = syscall.NewLazyDLL("kernel32.dll").NewProc("LockFileEx")
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// lock takes a lock on fp, shared or exclusive, without waiting. Closing
+// fp releases it. Windows enforces byte-range locks on reads and writes,
+// so the locked byte is one no file reaches: the last offset there is.
+func lock(fp *os.File, exclusive bool) error {
+	flags := uintptr(lockfileFailImmediately)
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+	ol := syscall.Overlapped{Offset: 0xffffffff, OffsetHigh: 0x7fffffff}
+	r, _, err := procLockFileEx.Call(fp.Fd(), flags, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	switch {
+	case r != 0:
+		return nil
+	case errors.Is(err, errorLockViolation):
+		return ErrLocked
+	}
+	return os.NewSyscallError("LockFileEx", err)
+}
@@ -0,0 +1,205 @@
+package pager
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// The meta page, page 0, holds two slots, at offset 0 and at half the page
+// size. Each is
+//
+//	| signature | commit | root | npages | free list | page size | extension | crc32 |
+//	|    16B    |   8B   |  8B  |   8B   |    8B     |    4B     |           |  4B   |
+//
+// where npages counts the meta page itself, the free list is the first
+// page of the free list (see freelist.go) and the CRC32 (IEEE) covers the
+// bytes before it. Each write of the meta page goes to the slot the last
+// one did not use, so a torn write leaves the last synced commit intact
+// even when commits in between were never synced. The rest of the page is
+// zero.
+//
+// The signature ends with the version of the file format, which changes
+// whenever a page's layout does: 5 has node prefixes, 6 overflow pages
+// (see package btree), 7 compressed pages (see compress.go) and 8
+// encrypted ones (see crypt.go). The extension depends on the version:
+// version 7 names the Compressor, in 8 bytes padded with zeros, and
+// version 8 authenticates the slot, in 44 bytes. Version 6 has none, and a
+// file with neither compressed nor encrypted pages is written in it, for
+// older versions of the package to open.
+const (
+	signature6 = "go-database pg6\x00"
+	signature7 = "go-database pg7\x00"
+	signature8 = "go-database pg8\x00"
+)
+
+// signatureBase is the signature without its version.
+const signatureBase = "go-database pg"
+
+// metaExtension is the size of the extension of each version.
+var metaExtension = map[string]int{
+	signature6: 0,
+	signature7: maxCompressorName,
+	signature8: saltSize + nonceSize + tagSize,
+}
+
+const (
+	metaHead = 16 + 8 + 8 + 8 + 8 + 4
+	metaSize = metaHead + saltSize + nonceSize + tagSize + 4 // the largest
+)
+
+// meta is the content of a meta slot.
+type meta struct {
+	commit, root, npages, freeList uint64
+	pageSize                       int
+	compressor                     string      // "" if no page is compressed
+	salt                           []byte      // of an encrypted file
+	aead                           cipher.AEAD // authenticating the slot of an encrypted file
+}
+
+// readMeta returns the newest valid meta slot of a file of the given size,
+// and which slot it is.
+func (p *Pager) readMeta(size int64) (meta, int, bool) {
+	// Slot 0 gives away the page size, and with it where slot 1 is. When
+	// it is torn, try slot 1 at every page size it could have been
+	// written with.
+	best, ok := p.readSlot(0, size)
+	sizes := []int{best.pageSize}
+	if !ok {
+		sizes = nil
+		for s := btree.MinPageSize; s <= btree.MaxPageSize; s *= 2 {
+			sizes = append(sizes, s)
+		}
+	}
+	for _, s := range sizes {
+		m, mok := p.readSlot(int64(s/2), size)
+		if mok && m.pageSize == s && (!ok || m.commit > best.commit) {
+			return m, 1, true
+		}
+	}
+	return best, 0, ok
+}
+
+// otherVersion reports whether the file starts with the signature of
+// another version of the format.
+func (p *Pager) otherVersion() bool {
+	buf := make([]byte, len(signature6))
+	if _, err := p.fp.ReadAt(buf, 0); err != nil {
+		return false
+	}
+	_, known := metaExtension[string(buf)]
+	return string(buf[:len(signatureBase)]) == signatureBase && !known
+}
+
+// uncommitted reports whether a file of the given size starts out with
+// zeros where slot 0 would be: it never had a meta page.
+func (p *Pager) uncommitted(size int64) bool {
+	buf := make([]byte, min(size, metaSize))
+	if _, err := p.fp.ReadAt(buf, 0); err != nil {
+		return false
+	}
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// readSlot reads and checks the meta slot at off in a file of the given
+// size.
+func (p *Pager) readSlot(off, size int64) (meta, bool) {
+	// A slot shorter than the largest may end the file.
+	buf := make([]byte, metaSize)
+	got, _ := p.fp.ReadAt(buf, off)
+	buf = buf[:got]
+	if len(buf) < len(signature6) {
+		return meta{}, false
+	}
+	ext, ok := metaExtension[string(buf[:len(signature6)])]
+	n := metaHead + ext
+	if !ok || len(buf) < n+4 || crc32.ChecksumIEEE(buf[:n]) != binary.LittleEndian.Uint32(buf[n:]) {
+		return meta{}, false
+	}
+	m := meta{
+		commit:   binary.LittleEndian.Uint64(buf[16:]),
+		root:     binary.LittleEndian.Uint64(buf[24:]),
+		npages:   binary.LittleEndian.Uint64(buf[32:]),
+		freeList: binary.LittleEndian.Uint64(buf[40:]),
+		pageSize: int(binary.LittleEndian.Uint32(buf[48:])),
+	}
+	switch string(buf[:len(signature6)]) {
+	case signature7:
+		if m.compressor = string(bytes.TrimRight(buf[metaHead:n], "\x00")); m.compressor == "" {
+			return meta{}, false
+		}
+	case signature8:
+		if m.aead, ok = p.authentic(buf[:n], buf[metaHead:n]); !ok {
+			return meta{}, false
+		}
+		m.salt = bytes.Clone(buf[metaHead : metaHead+saltSize])
+	}
+	// The file may be longer than npages after a commit that failed
+	// midway, never shorter.
+	if !validPageSize(m.pageSize) || m.npages < 1 || m.root >= m.npages || m.freeList >= m.npages ||
+		m.npages > uint64(size)/uint64(m.pageSize) {
+		return meta{}, false
+	}
+	return m, true
+}
+
+// encode returns the meta slot holding m.
+func (m meta) encode() []byte {
+	sig := signature6
+	switch {
+	case m.aead != nil:
+		sig = signature8
+	case m.compressor != "":
+		sig = signature7
+	}
+	n := metaHead + metaExtension[sig]
+	buf := make([]byte, n+4)
+	copy(buf, sig)
+	binary.LittleEndian.PutUint64(buf[16:], m.commit)
+	binary.LittleEndian.PutUint64(buf[24:], m.root)
+	binary.LittleEndian.PutUint64(buf[32:], m.npages)
+	binary.LittleEndian.PutUint64(buf[40:], m.freeList)
+	binary.LittleEndian.PutUint32(buf[48:], uint32(m.pageSize))
+	switch sig {
+	case signature7:
+		copy(buf[metaHead:], m.compressor)
+	case signature8:
+		m.authenticate(buf[:n], buf[metaHead:n])
+	}
+	binary.LittleEndian.PutUint32(buf[n:], crc32.ChecksumIEEE(buf[:n]))
+	return buf
+}
+
+// page returns a whole meta page holding m in slot 0.
+func (m meta) page() []byte {
+	page := make([]byte, m.pageSize)
+	copy(page, m.encode())
+	return page
+}
+
+// writeMeta writes m to the slot not written last. The caller holds
+// flushMu.
+func (p *Pager) writeMeta(m meta) error {
+	buf := m.encode()
+	slot := 1 - p.metaSlot
+	off := int64(slot) * int64(m.pageSize/2)
+	if !p.metaSeen {
+		// The first write lays out the whole meta page; there is no
+		// earlier commit in the other slot to protect.
+		slot = 0
+		buf, off = m.page(), 0
+	}
+	if _, err := p.fp.WriteAt(buf, off); err != nil {
+		return err
+	}
+	p.metaSlot, p.metaSeen = slot, true
+	return nil
+}
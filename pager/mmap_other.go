@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package pager
+
+import "os"
+
+// mapFile reads fp with ReadAt on systems without a memory mapping.
+func mapFile(fp *os.File, readOnly bool) pageSource { return &readAt{fp: fp} }
@@ -0,0 +1,78 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package pager
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+)
+
+// minChunk is the size of the first mapping. Each later chunk is as large
+// as all the earlier ones together, so the number of chunks stays small.
+const minChunk = 64 << 20
+
+// mmap maps the file read-only in chunks. Chunks are never remapped, so a
+// page handed out stays valid until close, however much the file grows.
+// Writes go through the file and show up in the shared mapping. The chunk
+// list is replaced, never modified, so snapshots can read it while the
+// writer extends it.
+type mmap struct {
+	fp     *os.File
+	total  int // bytes mapped
+	chunks atomic.Pointer[[][]byte]
+}
+
+// mapFile returns a mapping of fp. Mapping past its end is fine here, so
+// a read-only file needs nothing special.
+func mapFile(fp *os.File, readOnly bool) pageSource { return &mmap{fp: fp} }
+
+// extend makes sure the first size bytes of the file are mapped.
+func (m *mmap) extend(size int) error {
+	if m.total > 0 && size <= m.total {
+		return nil
+	}
+	alloc := max(m.total, minChunk)
+	for m.total+alloc < size {
+		alloc *= 2
+	}
+	chunk, err := syscall.Mmap(int(m.fp.Fd()), int64(m.total), alloc, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	m.total += alloc
+	var chunks [][]byte
+	if old := m.chunks.Load(); old != nil {
+		chunks = append(chunks, *old...)
+	}
+	chunks = append(chunks, chunk)
+	m.chunks.Store(&chunks)
+	return nil
+}
+
+// page returns page ptr, which must be mapped.
+func (m *mmap) page(ptr uint64, pageSize int) ([]byte, error) {
+	start := uint64(0)
+	for _, chunk := range *m.chunks.Load() {
+		end := start + uint64(len(chunk)/pageSize)
+		if ptr < end {
+			off := uint64(pageSize) * (ptr - start)
+			return chunk[off : off+uint64(pageSize) : off+uint64(pageSize)], nil
+		}
+		start = end
+	}
+	panic("pager: bad page pointer")
+}
+
+func (m *mmap) close() error {
+	var err error
+	if chunks := m.chunks.Swap(nil); chunks != nil {
+		for _, chunk := range *chunks {
+			if uerr := syscall.Munmap(chunk); err == nil {
+				err = uerr
+			}
+		}
+	}
+	m.total = 0
+	return err
+}
@@ -0,0 +1,114 @@
+//go:build windows
+
+package pager
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// minChunk is the size of the first mapping; see mmap_unix.go. It is a
+// multiple of the 64 KiB allocation granularity view offsets must respect.
+const minChunk = 64 << 20
+
+// mmap maps the file read-only in chunks, one file mapping and view per
+// chunk, like the unix version. A read-only mapping cannot reach past the
+// end of the file, so extend grows the file to cover a new chunk before
+// mapping it; the zeros this adds past the last page are never read.
+// Windows also refuses to shrink a mapped file, which is why Commit never
+// truncates.
+type mmap struct {
+	fp       *os.File
+	total    int // bytes mapped
+	chunks   atomic.Pointer[[]view]
+	readOnly bool // the file is open read-only, so it cannot grow
+}
+
+// mapFile returns a mapping of fp.
+func mapFile(fp *os.File, readOnly bool) pageSource { return &mmap{fp: fp, readOnly: readOnly} }
+
+// view is one mapped chunk.
+type view struct {
+	mapping syscall.Handle
+	data    []byte
+}
+
+// extend makes sure the first size bytes of the file are mapped.
+func (m *mmap) extend(size int) error {
+	if m.total > 0 && size <= m.total {
+		return nil
+	}
+	alloc := max(m.total, minChunk)
+	for m.total+alloc < size {
+		alloc *= 2
+	}
+	if m.readOnly {
+		// A read-only file cannot grow, nor be mapped past its end; it
+		// does not change while the shared lock keeps writers out.
+		alloc = size - m.total
+	}
+	end := int64(m.total + alloc)
+	fi, err := m.fp.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < end {
+		if err = m.fp.Truncate(end); err != nil {
+			return err
+		}
+	}
+	h, err := syscall.CreateFileMapping(syscall.Handle(m.fp.Fd()), nil, syscall.PAGE_READONLY,
+		uint32(end>>32), uint32(end), nil)
+	if err != nil {
+		return os.NewSyscallError("CreateFileMapping", err)
+	}
+	off := int64(m.total)
+	addr, err := syscall.MapViewOfFile(h, syscall.FILE_MAP_READ, uint32(off>>32), uint32(off), uintptr(alloc))
+	if err != nil {
+		syscall.CloseHandle(h)
+		return os.NewSyscallError("MapViewOfFile", err)
+	}
+	// The view lives outside the Go heap; going through a pointer-typed
+	// copy of addr keeps vet's unsafe.Pointer rules satisfied.
+	data := unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&addr))), alloc)
+	m.total += alloc
+	var chunks []view
+	if old := m.chunks.Load(); old != nil {
+		chunks = append(chunks, *old...)
+	}
+	chunks = append(chunks, view{h, data})
+	m.chunks.Store(&chunks)
+	return nil
+}
+
+// page returns page ptr, which must be mapped.
+func (m *mmap) page(ptr uint64, pageSize int) ([]byte, error) {
+	start := uint64(0)
+	for _, v := range *m.chunks.Load() {
+		end := start + uint64(len(v.data)/pageSize)
+		if ptr < end {
+			off := uint64(pageSize) * (ptr - start)
+			return v.data[off : off+uint64(pageSize) : off+uint64(pageSize)], nil
+		}
+		start = end
+	}
+	panic("pager: bad page pointer")
+}
+
+func (m *mmap) close() error {
+	var err error
+	if chunks := m.chunks.Swap(nil); chunks != nil {
+		for _, v := range *chunks {
+			if uerr := syscall.UnmapViewOfFile(uintptr(unsafe.Pointer(unsafe.SliceData(v.data)))); err == nil {
+				err = uerr
+			}
+			if cerr := syscall.CloseHandle(v.mapping); err == nil {
+				err = cerr
+			}
+		}
+	}
+	m.total = 0
+	return err
+}
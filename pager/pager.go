@@ -0,0 +1,660 @@
+// Package pager keeps the pages of a btree.BTree in a single file, which
+// makes the tree a database that survives the process.
+//
+// Page 0 of the file is the meta page: it records the page size, how many
+// pages are in use and which one is the root of the tree. The tree's pages
+// follow it. Committed pages are read through a memory mapping of the file
+// (where the system has one); pages allocated since the last commit live
+// in memory until Commit appends them to the file and points the meta page
+// at the new root.
+//
+// Every other page carries a CRC32C checksum in its header, which is
+// checked as the page is read: damage is reported as ErrCorrupt, naming
+// the page, instead of being decoded into garbage. With a Compressor,
+// pages are kept compressed in the file and decompressed as they are read
+// (see compress.go); with a Key, encrypted and authenticated (see
+// crypt.go).
+//
+// Pages are never overwritten: the tree copies every node it changes, and
+// Commit only appends. What makes a commit atomic is the meta page, which
+// holds two copies of the meta data, each with a commit number and a
+// checksum. A commit first fsyncs its new pages, then writes the copy the
+// previous commit did not use and fsyncs again. A crash at any point
+// before the second fsync completes leaves the previous copy, and the tree
+// it names, untouched; Open picks the newest copy that checks out.
+//
+// Pages the tree frees go on a free list kept in the file itself and are
+// reused by later commits, so a file under a steady workload stops growing.
+// A page freed by a commit is only reused once that commit is durable: up
+// to then, the previous commit may still be the one a crash brings back.
+//
+// The Sync option trades that for speed: SyncBatch and SyncInterval
+// defer the fsyncs and the meta page to a background goroutine, which
+// covers every commit made meanwhile with one of them, and SyncOff never
+// fsyncs until Close. A crash then brings back the last commit synced.
+//
+// Snapshots let other goroutines read a commit while the next one is being
+// built and committed. Pages a snapshot may still read are kept off the
+// free list's reusable part until it is released.
+package pager
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/vfs"
+)
+
+var (
+	ErrBadFile  = errors.New("pager: not a database file")
+	ErrVersion  = errors.New("pager: database file of an unsupported format version")
+	ErrCorrupt  = btree.ErrCorrupt // matched by every *btree.CorruptError
+	ErrPageSize = errors.New("pager: bad page size")
+	ErrClosed   = errors.New("pager: closed")
+	ErrFailed   = errors.New("pager: a write or sync failed midway; reopen the file")
+	ErrLocked   = errors.New("pager: file is locked by another process")
+	ErrReadOnly = errors.New("pager: file is open read-only")
+	ErrCompress = errors.New("pager: wrong compressor")
+	ErrKey      = errors.New("pager: wrong key")
+)
+
+// Durability decides how Commit orders its writes.
+type Durability int
+
+const (
+	// CopyOnWrite fsyncs a commit's new pages before writing the meta
+	// slot that points to them, and fsyncs again after. An interrupted
+	// commit always leaves the previous one intact. This is the zero value.
+	CopyOnWrite Durability = iota
+
+	// SingleSync writes the pages and the meta slot, then fsyncs once.
+	// It saves an fsync per commit, but the disk may persist the meta
+	// slot before the pages it points to: a crash can leave a tree with
+	// missing pages. For data that can be rebuilt.
+	SingleSync
+)
+
+// Options tunes how a database file is opened. The zero value is what Open
+// uses.
+type Options struct {
+	// PageSize is the page size of a new file; zero means
+	// btree.DefaultPageSize. It must be a power of two the tree accepts.
+	// An existing file keeps the page size it was created with.
+	PageSize int
+
+	// Mode is the permission of a newly created file; zero means 0664.
+	Mode os.FileMode
+
+	// FS is the file system the file lives on; nil means vfs.OS. Pages
+	// are memory-mapped only from the real one.
+	FS vfs.FileSystem
+
+	// ReadOnly opens an existing file for reading only: Commit fails with
+	// ErrReadOnly. Any number of read-only pagers can share a file, while
+	// a read-write one has it to itself; Open fails with ErrLocked
+	// otherwise. The locks are advisory, and missing on systems without
+	// flock or LockFileEx.
+	ReadOnly bool
+
+	// ContinueOnError is for salvage tools, which rescue what they can of
+	// a damaged file. Rather than failing, a page that fails its checksum
+	// reads as an empty leaf, so that lookups and scans skip what it held
+	// and go on, and a damaged free list is ignored. It implies ReadOnly.
+	// Verify reports the damage either way.
+	ContinueOnError bool
+
+	// Durability decides how Commit orders its writes; the zero value is
+	// CopyOnWrite.
+	Durability Durability
+
+	// Sync decides when commits are synced; the zero value is SyncAlways.
+	Sync SyncPolicy
+
+	// SyncDelay is how long SyncBatch waits for more commits to join a
+	// sync (10ms if zero), and how often SyncInterval syncs (1s if zero).
+	SyncDelay time.Duration
+
+	// NoMmap reads the pages with ReadAt, through the page cache, even
+	// from a file that could be memory-mapped. A mapping leaves caching
+	// to the system, which holds as much of the file as memory allows.
+	NoMmap bool
+
+	// CacheSize is the memory budget of the page cache, in bytes, which
+	// keeps the pages read with ReadAt; zero means DefaultCacheSize, and
+	// a negative size disables the cache.
+	CacheSize int
+
+	// Eviction decides which page the full cache drops; the zero value
+	// is LRU.
+	Eviction Eviction
+
+	// Compressor, if set, compresses the pages commits write (see
+	// compress.go), which trades the time to compress and decompress
+	// them for fewer bytes written. The page cache then keeps the pages
+	// decompressed, whether the file is memory-mapped or not. A file
+	// with compressed pages opens only with a Compressor of the same
+	// name, and fails with ErrCompress otherwise; an uncompressed one
+	// opens either way, with its pages compressed as they are written
+	// anew (Compact rewrites them all).
+	Compressor Compressor
+
+	// Key, if set, encrypts the pages with AES-GCM, and authenticates the
+	// meta page (see crypt.go): AES-128, AES-192 or AES-256 for a key of
+	// 16, 24 or 32 bytes. The tree gets 28 bytes less of each page. An
+	// encrypted file opens only with its key, and fails with ErrKey
+	// otherwise, as an unencrypted one does with a key. Pages cannot be
+	// both compressed and encrypted.
+	Key []byte
+
+	// DeriveKey, if set, is called for the key instead, with the salt of
+	// the file: 16 random bytes made with it, for a key derived from a
+	// passphrase with scrypt or Argon2, say, to differ from file to file.
+	// Compact makes a new file, with a new salt.
+	DeriveKey func(salt []byte) ([]byte, error)
+}
+
+func (o Options) pageSize() int {
+	if o.PageSize == 0 {
+		return btree.DefaultPageSize
+	}
+	return o.PageSize
+}
+
+func (o Options) fs() vfs.FileSystem {
+	if o.FS == nil {
+		return vfs.OS{}
+	}
+	return o.FS
+}
+
+func (o Options) mode() os.FileMode {
+	if o.Mode == 0 {
+		return 0664
+	}
+	return o.Mode.Perm()
+}
+
+// validPageSize reports whether size can be a page size: the tree must
+// accept it, and it must divide the memory-mapped chunks evenly.
+func validPageSize(size int) bool {
+	return size >= btree.MinPageSize && size <= btree.MaxPageSize && size&(size-1) == 0
+}
+
+// Pager is an open database file. It implements btree.Pager for the single
+// writer building the next commit. A Pager is not safe for concurrent use,
+// except for Snapshot, LastCommit and the methods of the snapshots it
+// returns.
+type Pager struct {
+	fp         vfs.File
+	fs         vfs.FileSystem
+	pageSize   int
+	durability Durability
+	mm         pageSource
+	comp       Compressor   // compressing the pages Commit writes, or nil
+	aead       cipher.AEAD  // encrypting the pages, or nil; see crypt.go
+	salt       []byte       // the file's, if encrypted
+	keyErr     error        // from deriving the key, if that failed
+	usable     int          // of a page, for the tree; see PageSize
+	dirty      atomic.Int64 // pages of the commit in progress; see Stats
+
+	// Counters for Stats.
+	reads, writes, syncs atomic.Uint64
+	freePages            atomic.Int64 // FreePages of the last commit
+
+	// The last commit. mu guards commit and root, which snapshots read,
+	// and readers. Only the writer changes them, so it reads them freely.
+	mu      sync.Mutex
+	commit  uint64         // its number; 0 for a new file
+	root    uint64         // root of its tree
+	readers map[uint64]int // open snapshots per commit number
+
+	// Syncing; see sync.go. mu guards latest, taken, durable, syncErr
+	// and stopped; flushMu the meta page and newFile.
+	policy   SyncPolicy
+	delay    time.Duration
+	latest   meta       // meta of the last commit, maybe not written yet
+	taken    uint64     // last commit a background flush started on
+	durable  uint64     // last commit known to be on disk
+	syncErr  error      // set once the state on disk is unknown
+	stopped  bool       // Close has stopped syncing
+	synced   *sync.Cond // on mu; signalled as durable or syncErr change
+	flushMu  sync.Mutex
+	metaSlot int  // slot of the meta page written last
+	metaSeen bool // whether the file has a meta page yet
+	kick     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+
+	npages    uint64      // pages in the file
+	free      []uint64    // free pages that can be reused
+	held      []heldPages // free pages snapshots may still read
+	freeChain []uint64    // pages holding the free list
+
+	// The commit in progress.
+	pending [][]byte          // appended pages, numbered from npages
+	updates map[uint64][]byte // reused pages
+	avail   []uint64          // free pages Alloc may still reuse
+	freed   []uint64          // pages of the last commit freed since
+	undo    []undo            // since the first savepoint; see savepoint.go
+	logging bool              // whether there is a savepoint
+
+	// Set by Commit for the commit's success.
+	nextAvail, nextHeld, nextChain []uint64
+
+	opts            Options // opened with
+	path            string
+	newFile         bool // its directory entry may not be durable yet
+	readOnly        bool
+	continueOnError bool
+	closed          bool
+}
+
+// heldPages are the pages a commit freed. Snapshots of earlier commits
+// may still read them.
+type heldPages struct {
+	commit uint64
+	pages  []uint64
+}
+
+// Memory is the path that opens a new database in memory, on a vfs.Mem of
+// its own, unless Options.FS is set. It goes away when it is closed.
+const Memory = ":memory:"
+
+// Open opens the database file at path, creating it if needed.
+func Open(path string) (*Pager, error) {
+	return Options{}.Open(path)
+}
+
+// Open is Open honouring the options in o.
+func (o Options) Open(path string) (*Pager, error) {
+	if o.ContinueOnError {
+		o.ReadOnly = true
+	}
+	if path == Memory && o.FS == nil {
+		o.FS = new(vfs.Mem)
+	}
+	if c := o.Compressor; c != nil && (c.Name() == "" || len(c.Name()) > maxCompressorName) {
+		return nil, fmt.Errorf("%w: name %q is not 1 to %d bytes", ErrCompress, c.Name(), maxCompressorName)
+	}
+	if o.Compressor != nil && o.encrypted() {
+		return nil, errors.New("pager: pages cannot be both compressed and encrypted")
+	}
+	flag := os.O_RDWR | os.O_CREATE
+	if o.ReadOnly {
+		flag = os.O_RDONLY
+	}
+	fsys := o.fs()
+	fp, err := fsys.OpenFile(path, flag, o.mode())
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := fp.(*os.File); ok {
+		if err = lock(f, !o.ReadOnly); err != nil {
+			fp.Close()
+			return nil, openErr(path, err)
+		}
+	}
+	p := &Pager{
+		fp:              fp,
+		fs:              fsys,
+		opts:            o,
+		comp:            o.Compressor,
+		path:            path,
+		durability:      o.Durability,
+		readers:         make(map[uint64]int),
+		policy:          o.Sync,
+		delay:           o.syncDelay(),
+		readOnly:        o.ReadOnly,
+		continueOnError: o.ContinueOnError,
+	}
+	p.synced = sync.NewCond(&p.mu)
+	if err = p.load(o); err != nil {
+		if p.mm != nil {
+			p.mm.close()
+		}
+		fp.Close()
+		return nil, openErr(path, err)
+	}
+	p.reset()
+	p.startSyncer()
+	return p, nil
+}
+
+// openErr names path in an error from Open that does not already.
+func openErr(path string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return &fs.PathError{Op: "open", Path: path, Err: err}
+}
+
+// load reads the meta page and the free list, or sets up a new file, and
+// maps the file.
+func (p *Pager) load(o Options) error {
+	fi, err := p.fp.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() == 0 || p.uncommitted(fi.Size()) {
+		// A new file: nothing is written until the first commit. One
+		// holding pages of a first commit that never got to write the
+		// meta page is just as empty; its pages get overwritten.
+		if !validPageSize(o.pageSize()) {
+			return ErrPageSize
+		}
+		p.pageSize = o.pageSize()
+		if o.encrypted() {
+			if err = p.newSalt(); err != nil {
+				return err
+			}
+		}
+		if err = p.setPageSource(o); err != nil {
+			return err
+		}
+		p.npages = 1 // the meta page
+		p.newFile = true
+		return nil // mapped once the first commit has written something
+	}
+	m, slot, ok := p.readMeta(fi.Size())
+	switch {
+	case !ok && p.keyErr != nil:
+		if !o.encrypted() {
+			return fmt.Errorf("%w: file is encrypted", ErrKey)
+		}
+		return p.keyErr
+	case !ok && p.otherVersion():
+		return ErrVersion
+	case !ok:
+		return ErrBadFile
+	case m.aead == nil && o.encrypted():
+		return fmt.Errorf("%w: file is not encrypted", ErrKey)
+	case m.compressor != "" && (p.comp == nil || p.comp.Name() != m.compressor):
+		return fmt.Errorf("%w: pages are compressed with %q", ErrCompress, m.compressor)
+	}
+	p.commit, p.root, p.npages, p.pageSize = m.commit, m.root, m.npages, m.pageSize
+	if err = p.setPageSource(o); err != nil {
+		return err
+	}
+	p.latest, p.taken, p.durable = m, m.commit, m.commit
+	p.metaSlot, p.metaSeen = slot, true
+	if err = p.mm.extend(int(p.npages) * p.pageSize); err != nil {
+		return err
+	}
+	return p.loadFreeList(m.freeList)
+}
+
+// reset drops the commit in progress and sets up the next one, making the
+// held pages reusable that no open snapshot can read and no crash can
+// bring back.
+func (p *Pager) reset() {
+	p.mu.Lock()
+	oldest := min(p.commit, p.durable)
+	for c := range p.readers {
+		oldest = min(oldest, c)
+	}
+	p.mu.Unlock()
+	// A snapshot of commit c, and the file after a crash that leaves
+	// commit c, read pages freed after c.
+	for len(p.held) > 0 && p.held[0].commit <= oldest {
+		p.free = append(p.free, p.held[0].pages...)
+		p.held = p.held[1:]
+	}
+	p.pending = nil
+	p.updates = make(map[uint64][]byte)
+	p.dirty.Store(0)
+	p.avail = append([]uint64(nil), p.free...)
+	p.freed = nil
+	p.ReleaseSavepoints()
+	p.freePages.Store(int64(p.FreePages()))
+}
+
+// setPageSource sets up how p reads its pages, once it knows its page size
+// and key.
+func (p *Pager) setPageSource(o Options) error {
+	p.usable = p.pageSize
+	if p.aead != nil {
+		p.usable -= reserve
+		if p.usable < btree.MinPageSize {
+			return ErrPageSize
+		}
+	}
+	p.mm = newPageSource(p.fp, o, p.aead)
+	return nil
+}
+
+// meta returns the meta of a commit of p.
+func (p *Pager) meta(commit, root, npages, freeList uint64) meta {
+	m := meta{commit: commit, root: root, npages: npages, freeList: freeList, pageSize: p.pageSize, salt: p.salt, aead: p.aead}
+	if p.comp != nil {
+		m.compressor = p.comp.Name()
+	}
+	return m
+}
+
+// Rollback drops the pages allocated and freed since the last commit. The
+// file is not touched; a tree built on them must be reset to Root.
+func (p *Pager) Rollback() { p.reset() }
+
+// PageSize returns the size of the tree's pages: the page size of the file,
+// less what encryption takes of each.
+func (p *Pager) PageSize() int { return p.usable }
+
+// Root returns the root page of the last commit; zero means an empty tree.
+func (p *Pager) Root() uint64 { return p.root }
+
+// Tree returns a tree over p, as of the last commit.
+func (p *Pager) Tree() *btree.BTree {
+	return &btree.BTree{Root: p.root, Pager: p, PageSize: p.usable}
+}
+
+// Page returns the page at ptr. A committed page that fails its checksum
+// panics with a *btree.CorruptError naming it, which package kv recovers
+// into an error; see Options.ContinueOnError for reading on instead.
+func (p *Pager) Page(ptr uint64) []byte {
+	if page, ok := p.updates[ptr]; ok {
+		return page
+	}
+	if ptr >= p.npages {
+		i := ptr - p.npages
+		if i >= uint64(len(p.pending)) || p.pending[i] == nil {
+			panic("pager: bad page pointer")
+		}
+		return p.pending[i]
+	}
+	return p.page(ptr)
+}
+
+// Alloc keeps page in memory until the next commit writes it out, over a
+// free page if there is one, else at the end of the file.
+func (p *Pager) Alloc(page []byte) uint64 {
+	if len(page) != p.usable {
+		panic("pager: page of the wrong size")
+	}
+	p.dirty.Add(1)
+	if n := len(p.avail); n > 0 {
+		ptr := p.avail[n-1]
+		p.avail = p.avail[:n-1]
+		p.set(ptr, page)
+		p.note(undo{op: undoReuse, ptr: ptr})
+		return ptr
+	}
+	p.pending = append(p.pending, page)
+	p.note(undo{op: undoAppend})
+	return p.npages + uint64(len(p.pending)-1)
+}
+
+// set makes page the content of ptr, a page the last commit does not use.
+func (p *Pager) set(ptr uint64, page []byte) {
+	if ptr >= p.npages {
+		p.pending[ptr-p.npages] = page
+	} else {
+		p.updates[ptr] = page
+	}
+}
+
+// Free releases the page at ptr. A page allocated since the last commit
+// can be reused right away; one the last commit uses only after the next.
+func (p *Pager) Free(ptr uint64) {
+	if _, ok := p.updates[ptr]; ok || ptr >= p.npages {
+		p.note(undo{op: undoFree, ptr: ptr, page: p.Page(ptr)})
+		p.dirty.Add(-1)
+		p.set(ptr, nil)
+		delete(p.updates, ptr)
+		p.avail = append(p.avail, ptr)
+		return
+	}
+	p.freed = append(p.freed, ptr)
+	p.note(undo{op: undoRelease})
+}
+
+// FreePages returns the number of pages on the free list of the last
+// commit, which later commits can reuse.
+func (p *Pager) FreePages() int {
+	n := len(p.free)
+	for _, h := range p.held {
+		n += len(h.pages)
+	}
+	return n
+}
+
+// Pages returns the number of pages in the file as of the last commit, the
+// meta page included.
+func (p *Pager) Pages() uint64 { return p.npages }
+
+// Commit writes the pages allocated since the last commit, at the end of
+// the file or over free pages, records the new free list and makes root
+// the root of the file's tree. When the commit is synced, and so durable,
+// depends on the Sync option; under SyncAlways it is before Commit returns.
+// Either way, snapshots taken after Commit see it.
+//
+// If Commit fails, the pages allocated since the last commit are dropped
+// and the file still holds the last commit; a tree built on them must be
+// reset to Root. A failure once the meta page is being written leaves it
+// unknown which commit the disk holds, so p refuses further commits with
+// ErrFailed; reopening settles it.
+func (p *Pager) Commit(root uint64) error {
+	if p.closed {
+		return ErrClosed
+	}
+	if p.readOnly {
+		return ErrReadOnly
+	}
+	if err := p.failed(); err != nil {
+		return err
+	}
+	defer p.reset()
+	head := p.buildFreeList()
+	for i, page := range p.pending {
+		ptr := p.npages + uint64(i)
+		if page == nil {
+			// A page allocated and freed again. It goes on the free list,
+			// but must still be in the file: Commit never truncates, as
+			// a mapped file cannot shrink on Windows.
+			page = make([]byte, p.pageSize)
+		} else {
+			page = p.stored(ptr, page)
+		}
+		if i == len(p.pending)-1 && len(page) < p.pageSize {
+			// The last page is written whole, compressed or not, for
+			// the file to reach its end: a mapping faults past it.
+			page = append(page, make([]byte, p.pageSize-len(page))...)
+		}
+		if _, err := p.fp.WriteAt(page, int64(ptr)*int64(p.pageSize)); err != nil {
+			return err
+		}
+	}
+	c, _ := p.mm.(*cache)
+	for ptr, page := range p.updates {
+		page = p.stored(ptr, page)
+		if c != nil {
+			// No snapshot reads a reused page (see reset), so it can
+			// go before it changes.
+			c.forget(ptr)
+		}
+		if _, err := p.fp.WriteAt(page, int64(ptr)*int64(p.pageSize)); err != nil {
+			return err
+		}
+	}
+	p.writes.Add(uint64(len(p.pending) + len(p.updates)))
+	npages := p.npages + uint64(len(p.pending))
+	m := p.meta(p.commit+1, root, npages, head)
+	switch p.policy {
+	case SyncAlways:
+		if err := p.flush(m); err != nil {
+			return err
+		}
+	case SyncOff:
+		p.flushMu.Lock()
+		err := p.writeMeta(m)
+		p.flushMu.Unlock()
+		if err != nil {
+			return p.fail(err)
+		}
+	}
+	// The new pages are read back through the mapping from now on. Mapping
+	// them only now keeps the file from growing (as it does on Windows)
+	// before it has a meta page.
+	if err := p.mm.extend(int(npages) * p.pageSize); err != nil {
+		return p.fail(err)
+	}
+	p.mu.Lock()
+	// Under SyncBatch and SyncInterval, the meta page of the last commit
+	// is never written unless a flush took it before this one replaced
+	// it. The pages of its free list are then free at once: reading the
+	// free list is all they were kept for.
+	skipped := (p.policy == SyncBatch || p.policy == SyncInterval) && p.taken < p.commit
+	p.commit, p.root, p.latest = m.commit, root, m
+	if p.policy == SyncOff {
+		p.durable = m.commit // as durable as it gets
+	}
+	p.mu.Unlock()
+	held := p.nextHeld
+	if skipped {
+		held = held[:len(p.freed)]
+		p.nextAvail = append(p.nextAvail, p.freeChain...)
+	}
+	p.npages = npages
+	p.free, p.freeChain = p.nextAvail, p.nextChain
+	p.held = append(p.held, heldPages{m.commit, held})
+	if p.policy == SyncBatch {
+		select {
+		case p.kick <- struct{}{}:
+		default: // a sync is already due
+		}
+	}
+	return nil
+}
+
+// LastCommit returns the number of the last commit; 0 for a new file. It
+// is safe to call from any goroutine.
+func (p *Pager) LastCommit() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.commit
+}
+
+// Close syncs the commits not synced yet, then unmaps and closes the file.
+// Pages allocated since the last commit are dropped.
+func (p *Pager) Close() error {
+	if p.closed {
+		return ErrClosed
+	}
+	p.closed = true
+	p.reset()
+	err := p.stopSyncer()
+	if merr := p.mm.close(); err == nil {
+		err = merr
+	}
+	if cerr := p.fp.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
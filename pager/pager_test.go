@@ -0,0 +1,205 @@
+package pager_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/pager"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// key returns the i-th key of the tests.
+func key(i int) []byte { return fmt.Appendf(nil, "key%06d", i) }
+
+// update sets keys [from, to) of p's tree to val and commits it.
+func update(tb testing.TB, p *pager.Pager, from, to int, val string) {
+	tb.Helper()
+	tree := p.Tree()
+	for i := from; i < to; i++ {
+		if err := tree.Insert(key(i), []byte(val)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	if err := p.Commit(tree.Root); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// contents returns the key-values of tree, failing the test if it does not
+// pass Check.
+func contents(tb testing.TB, tree *btree.BTree) map[string]string {
+	tb.Helper()
+	if _, err := tree.Check(nil); err != nil {
+		tb.Fatal(err)
+	}
+	m := map[string]string{}
+	for k, v := range tree.All() {
+		m[string(k)] = string(v)
+	}
+	return m
+}
+
+// holds fails the test if tree does not hold keys [0, n), all set to val.
+func holds(tb testing.TB, tree *btree.BTree, n int, val string) {
+	tb.Helper()
+	m := contents(tb, tree)
+	if len(m) != n {
+		tb.Fatalf("tree holds %d keys, want %d", len(m), n)
+	}
+	for i := range n {
+		if v, ok := m[string(key(i))]; !ok || v != val {
+			tb.Fatalf("%s = %q, %v; want %q", key(i), v, ok, val)
+		}
+	}
+}
+
+func TestReopen(t *testing.T) {
+	for name, o := range map[string]pager.Options{
+		"mmap":           {PageSize: 512},
+		"ReadAt":         {PageSize: 512, NoMmap: true},
+		"ReadAt uncache": {PageSize: 512, NoMmap: true, CacheSize: -1},
+		"vfs.Mem":        {PageSize: 1024, FS: &vfs.Mem{}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "db")
+			if o.FS != nil {
+				path = "db"
+			}
+			p, err := o.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.LastCommit() != 0 || p.Root() != 0 {
+				t.Errorf("new file at commit %d, root %d", p.LastCommit(), p.Root())
+			}
+			for i := range 5 {
+				update(t, p, i*400, (i+1)*400, "v")
+			}
+			if p.LastCommit() != 5 {
+				t.Errorf("LastCommit = %d after 5 commits", p.LastCommit())
+			}
+			pages, size := p.Pages(), p.PageSize()
+			if err = p.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err = p.Close(); err != pager.ErrClosed {
+				t.Errorf("second Close: %v, want ErrClosed", err)
+			}
+
+			// The file keeps its page size, whatever the options say.
+			o.PageSize = 4096
+			if p, err = o.Open(path); err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+			if p.PageSize() != size || p.Pages() != pages || p.LastCommit() != 5 {
+				t.Errorf("reopened with page size %d, %d pages, commit %d; want %d, %d, 5", p.PageSize(), p.Pages(), p.LastCommit(), size, pages)
+			}
+			holds(t, p.Tree(), 2000, "v")
+			fsys := o.FS
+			if fsys == nil {
+				fsys = vfs.OS{}
+			}
+			if fi, err := fsys.Stat(path); err != nil || fi.Size() != int64(pages)*int64(size) {
+				t.Errorf("file of %v bytes, %v; want %d pages", fi.Size(), err, pages)
+			}
+			update(t, p, 0, 2000, "w")
+			holds(t, p.Tree(), 2000, "w")
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	p, err := pager.Options{PageSize: 512}.Open(pager.Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	update(t, p, 0, 500, "v")
+	tree := p.Tree()
+	for i := range 1000 {
+		tree.Insert(key(i), []byte("gone"))
+	}
+	p.Rollback()
+	holds(t, p.Tree(), 500, "v")
+	// The pages of the dropped update are there to use again.
+	update(t, p, 0, 500, "w")
+	holds(t, p.Tree(), 500, "w")
+}
+
+func TestOpenErrors(t *testing.T) {
+	d := t.TempDir()
+	if _, err := (pager.Options{PageSize: 1000}).Open(filepath.Join(d, "odd")); !errors.Is(err, pager.ErrPageSize) {
+		t.Errorf("page size 1000: %v, want ErrPageSize", err)
+	}
+	junk := filepath.Join(d, "junk")
+	if err := os.WriteFile(junk, bytes.Repeat([]byte("not a database "), 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := pager.Open(junk)
+	if !errors.Is(err, pager.ErrBadFile) {
+		t.Errorf("file of text: %v, want ErrBadFile", err)
+	}
+	var pe *os.PathError
+	if !errors.As(err, &pe) || pe.Path != junk {
+		t.Errorf("error %v does not name the file", err)
+	}
+	future := filepath.Join(d, "future")
+	if err = os.WriteFile(future, append([]byte("go-database pg9\x00"), make([]byte, 8192)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pager.Open(future); !errors.Is(err, pager.ErrVersion) {
+		t.Errorf("file of a later version: %v, want ErrVersion", err)
+	}
+	if _, err = (pager.Options{ReadOnly: true}).Open(filepath.Join(d, "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("read-only open of a missing file: %v", err)
+	}
+}
+
+func TestFirstCommitInterrupted(t *testing.T) {
+	// A file with pages but no meta page yet, from a first commit that
+	// never finished, opens as a new one.
+	path := filepath.Join(t.TempDir(), "db")
+	if err := os.WriteFile(path, make([]byte, 3*512), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := pager.Options{PageSize: 512}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if p.LastCommit() != 0 || p.Root() != 0 || p.Pages() != 1 {
+		t.Errorf("commit %d, root %d, %d pages; want a new file", p.LastCommit(), p.Root(), p.Pages())
+	}
+	update(t, p, 0, 10, "v")
+	holds(t, p.Tree(), 10, "v")
+}
+
+func TestMemoryDatabases(t *testing.T) {
+	// Each opens a database of its own, that starts empty.
+	a, err := pager.Options{PageSize: 512}.Open(pager.Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	update(t, a, 0, 1000, "a")
+	b, err := pager.Open(pager.Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if b.Root() != 0 || b.LastCommit() != 0 {
+		t.Errorf("second database in memory at commit %d, root %d", b.LastCommit(), b.Root())
+	}
+	update(t, b, 0, 10, "b")
+	holds(t, a.Tree(), 1000, "a")
+	holds(t, b.Tree(), 10, "b")
+	if _, err = a.Verify(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,127 @@
+package pager
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/vfs"
+)
+
+// Every page but the meta page carries a checksum in bytes 4 to 8, which
+// the tree's pages and the free list leave to the pager: the CRC32C of the
+// page's number and of the rest of the page. Commit seals each page it
+// writes, and the committed pages are checked as they are read, so that a
+// flipped bit, or a write that landed on the wrong page, is reported
+// rather than decoded.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func checksum(ptr uint64, page []byte) uint32 {
+	var num [8]byte
+	binary.LittleEndian.PutUint64(num[:], ptr)
+	crc := crc32.Update(0, castagnoli, num[:])
+	crc = crc32.Update(crc, castagnoli, page[:4])
+	return crc32.Update(crc, castagnoli, page[8:])
+}
+
+// seal sets the checksum of page, to be written at ptr.
+func seal(ptr uint64, page []byte) {
+	binary.LittleEndian.PutUint32(page[4:], checksum(ptr, page))
+}
+
+// checkPage returns a *btree.CorruptError if page, read from ptr, fails
+// its checksum.
+func checkPage(ptr uint64, page []byte) error {
+	want, got := binary.LittleEndian.Uint32(page[4:]), checksum(ptr, page)
+	if want != got {
+		return &btree.CorruptError{Page: ptr, Reason: fmt.Sprintf("checksum is %08x, page holds %08x", got, want)}
+	}
+	return nil
+}
+
+// page returns the committed page at ptr, checked. A damaged page panics
+// with its *btree.CorruptError or, if p continues on errors, reads as an
+// empty leaf.
+func (p *Pager) page(ptr uint64) []byte {
+	page, err := p.readPage(ptr)
+	if err != nil {
+		if p.continueOnError {
+			return btree.EmptyLeaf(p.usable)
+		}
+		panic(err)
+	}
+	return page
+}
+
+// readPage returns the committed page at ptr, or a *btree.CorruptError if
+// it fails its checksum or cannot be decompressed.
+func (p *Pager) readPage(ptr uint64) ([]byte, error) {
+	p.reads.Add(1)
+	page, err := p.mm.page(ptr, p.pageSize)
+	if err == nil {
+		err = checkPage(ptr, page)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// pageSource reads the committed pages of a file: through a memory mapping
+// where the system has one (see mmap_unix.go), or with ReadAt.
+type pageSource interface {
+	// extend makes sure the first size bytes of the file can be read.
+	extend(size int) error
+	// page returns page ptr, which must be within them, or a
+	// *btree.CorruptError if it cannot be decoded.
+	page(ptr uint64, pageSize int) ([]byte, error)
+	close() error
+}
+
+// newPageSource returns the page source for fp. Only an *os.File can be
+// mapped; a file from another vfs.FileSystem, or any under
+// Options.NoMmap, is read with ReadAt, through a cache (see cache.go).
+// Pages that are decompressed or decrypted go through the cache too,
+// mapped or not: that costs more than reading them.
+func newPageSource(fp vfs.File, o Options, aead cipher.AEAD) pageSource {
+	var src pageSource = &readAt{fp: fp}
+	if f, ok := fp.(*os.File); ok && !o.NoMmap {
+		src = mapFile(f, o.ReadOnly)
+	}
+	_, cached := src.(*readAt)
+	switch {
+	case o.Compressor != nil:
+		src, cached = &inflate{src: src, comp: o.Compressor}, true
+	case aead != nil:
+		src, cached = &decrypt{src: src, aead: aead}, true
+	}
+	if cached && o.CacheSize >= 0 {
+		size := o.CacheSize
+		if size == 0 {
+			size = DefaultCacheSize
+		}
+		return newCache(src, o.Eviction, size)
+	}
+	return src
+}
+
+// readAt reads every page from the file when asked for.
+type readAt struct {
+	fp io.ReaderAt
+}
+
+func (r *readAt) extend(size int) error { return nil }
+
+func (r *readAt) page(ptr uint64, pageSize int) ([]byte, error) {
+	page := make([]byte, pageSize)
+	if _, err := r.fp.ReadAt(page, int64(ptr)*int64(pageSize)); err != nil {
+		panic("pager: reading page: " + err.Error())
+	}
+	return page, nil
+}
+
+func (r *readAt) close() error { return nil }
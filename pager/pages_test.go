@@ -0,0 +1,51 @@
+package pager_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/pager"
+)
+
+func TestMisplacedPage(t *testing.T) {
+	// A sound page written over another fails the checksum there: it
+	// covers the page's number.
+	path := filepath.Join(t.TempDir(), "db")
+	p, err := pager.Options{PageSize: 512}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(t, p, 0, 500, "v")
+	var pages []uint64
+	p.Tree().Check(func(ptr uint64) error { pages = append(pages, ptr); return nil })
+	p.Close()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, to := pages[len(pages)-2], pages[len(pages)-1]
+	copy(b[to*512:(to+1)*512], b[from*512:(from+1)*512])
+	if err = os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, err = pager.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	_, err = p.Verify()
+	var ce *btree.CorruptError
+	if !errors.As(err, &ce) || ce.Page != to {
+		t.Errorf("Verify = %v, want page %d corrupt", err, to)
+	}
+	defer func() {
+		r := recover()
+		if ce, ok := r.(*btree.CorruptError); !ok || ce.Page != to || !errors.Is(ce, pager.ErrCorrupt) {
+			t.Errorf("reading the page panicked with %v, want its *btree.CorruptError", r)
+		}
+	}()
+	p.Page(to)
+}
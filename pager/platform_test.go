@@ -0,0 +1,81 @@
+package pager_test
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/pager"
+)
+
+func TestNewFileSyncsDir(t *testing.T) {
+	dir := t.TempDir()
+	rec := &dbtest.RecordingFS{}
+	p, err := pager.Options{FS: rec}.Open(filepath.Join(dir, "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	dirSyncs := func() (n int) {
+		for _, s := range rec.Syncs() {
+			if s.Dir {
+				n++
+			}
+		}
+		return n
+	}
+	update(t, p, 0, 10, "v")
+	// Windows has no directory fsync; its renames and new files are
+	// written through instead.
+	want := 1
+	if runtime.GOOS == "windows" {
+		want = 0
+	}
+	if n := dirSyncs(); n != want {
+		t.Errorf("first commit of a new file synced its directory %d times, want %d", n, want)
+	}
+	update(t, p, 0, 10, "w")
+	if n := dirSyncs(); n != want {
+		t.Errorf("a later commit synced the directory again")
+	}
+}
+
+func TestMappingGrows(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes a file larger than the first mapping")
+	}
+	path := filepath.Join(t.TempDir(), "db")
+	p, err := pager.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	update(t, p, 0, 10, "small")
+	// Grow the file past the first chunk of the mapping, with values on
+	// overflow pages that straddle the chunks.
+	tree := p.Tree()
+	val := func(i int) []byte { return bytes.Repeat(fmt.Appendf(nil, "%07d", i), 1<<17) }
+	for i := range 80 {
+		if err = tree.Insert(fmt.Appendf(nil, "big%02d", i), val(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = p.Commit(tree.Root); err != nil {
+		t.Fatal(err)
+	}
+	if size := p.Pages() * uint64(p.PageSize()); size <= 64<<20 {
+		t.Fatalf("file of %d bytes does not outgrow the first mapping", size)
+	}
+	tree = p.Tree()
+	for i := range 80 {
+		if got, ok := tree.Get(fmt.Appendf(nil, "big%02d", i)); !ok || !bytes.Equal(got, val(i)) {
+			t.Fatalf("value %d of %d bytes read back wrong", i, len(val(i)))
+		}
+	}
+	if _, err = tree.Check(nil); err != nil {
+		t.Fatal(err)
+	}
+}
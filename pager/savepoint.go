@@ -0,0 +1,71 @@
+package pager
+
+// A savepoint is a mark in the commit in progress that RollbackTo can go
+// back to, undoing the allocations and frees after it. The tree never
+// modifies a page, so the pages of the tree as of the mark are intact: all
+// that changes is which pointers hold which pages, and which are free.
+// From the first Savepoint on, each Alloc and Free notes what it changed
+// in an undo log, which RollbackTo replays backwards.
+
+// undo notes what an Alloc or Free changed.
+type undo struct {
+	op   undoOp
+	ptr  uint64
+	page []byte // of undoFree: the page freed
+}
+
+type undoOp int
+
+const (
+	undoAppend  undoOp = iota // Alloc appended a page
+	undoReuse                 // Alloc took ptr off avail
+	undoFree                  // Free put ptr, a page of the commit in progress, on avail
+	undoRelease               // Free put ptr, a page of the last commit, on freed
+)
+
+// Savepoint returns a mark of the commit in progress for RollbackTo. The
+// marks are good until the commit, the rollback or ReleaseSavepoints.
+func (p *Pager) Savepoint() int {
+	p.logging = true
+	return len(p.undo)
+}
+
+// RollbackTo undoes the allocations and frees since the Savepoint that
+// returned mark, which stays good, as do those before it. A tree built on
+// them must be reset to its root as of the mark.
+func (p *Pager) RollbackTo(mark int) {
+	for i := len(p.undo) - 1; i >= mark; i-- {
+		u := p.undo[i]
+		switch u.op {
+		case undoAppend:
+			p.pending = p.pending[:len(p.pending)-1]
+			p.dirty.Add(-1)
+		case undoReuse:
+			p.set(u.ptr, nil)
+			delete(p.updates, u.ptr)
+			p.avail = append(p.avail, u.ptr)
+			p.dirty.Add(-1)
+		case undoFree:
+			p.avail = p.avail[:len(p.avail)-1]
+			p.set(u.ptr, u.page)
+			p.dirty.Add(1)
+		case undoRelease:
+			p.freed = p.freed[:len(p.freed)-1]
+		}
+		p.undo[i] = undo{}
+	}
+	p.undo = p.undo[:mark]
+}
+
+// ReleaseSavepoints drops the marks of Savepoint, keeping what came after
+// them, and stops the undo log.
+func (p *Pager) ReleaseSavepoints() {
+	p.undo, p.logging = nil, false
+}
+
+// note adds u to the undo log, if there is a savepoint.
+func (p *Pager) note(u undo) {
+	if p.logging {
+		p.undo = append(p.undo, u)
+	}
+}
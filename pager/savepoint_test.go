@@ -0,0 +1,59 @@
+package pager_test
+
+import (
+	"testing"
+
+	"github.com/adcondev/go-database/pager"
+)
+
+func TestSavepoint(t *testing.T) {
+	// Two pagers make the same commits, but one also makes updates it then
+	// rolls back to a savepoint: they end with the same pages.
+	var ps [2]*pager.Pager
+	for i := range ps {
+		p, err := pager.Options{PageSize: 512}.Open(pager.Memory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Close()
+		update(t, p, 0, 500, "v")
+		update(t, p, 0, 500, "w") // for a free list to reuse
+		ps[i] = p
+	}
+	p := ps[1]
+	tree := p.Tree()
+	for i := range 500 {
+		tree.Insert(key(i), []byte("a"))
+	}
+	dirty := p.Stats().Dirty
+	mark, root := p.Savepoint(), tree.Root
+	for range 2 {
+		// Reuses, appends and frees pages, those of the last commit and
+		// those of this one.
+		for i := range 1000 {
+			tree.Insert(key(i), []byte("gone"))
+		}
+		for i := range 800 {
+			tree.Delete(key(i))
+		}
+		p.RollbackTo(mark)
+		tree.Root = root
+		holds(t, tree, 500, "a")
+		if d := p.Stats().Dirty; d != dirty {
+			t.Errorf("%d dirty pages after RollbackTo, want %d", d, dirty)
+		}
+	}
+	p.ReleaseSavepoints()
+	if err := p.Commit(tree.Root); err != nil {
+		t.Fatal(err)
+	}
+	update(t, ps[0], 0, 500, "a")
+	holds(t, p.Tree(), 500, "a")
+	want, got := ps[0].Stats(), p.Stats()
+	if got.Pages != want.Pages || got.FreePages != want.FreePages {
+		t.Errorf("%d pages, %d free after the rollback; want %d, %d", got.Pages, got.FreePages, want.Pages, want.FreePages)
+	}
+	if _, err := p.Verify(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,52 @@
+package pager
+
+// Snapshot is a read-only view of a commit, safe to use from any goroutine
+// while the writer builds and commits the next ones. It implements
+// btree.Pager for reading; Alloc and Free panic.
+type Snapshot struct {
+	p        *Pager
+	commit   uint64
+	root     uint64
+	npages   uint64 // pages in the file as of the commit
+	released bool
+}
+
+// Snapshot returns a view of the last commit. Until it is released, the
+// pages it can read are not reused. It must be released before p is
+// closed.
+func (p *Pager) Snapshot() *Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readers[p.commit]++
+	return &Snapshot{p: p, commit: p.commit, root: p.root, npages: max(p.latest.npages, 1)}
+}
+
+// Commit returns the number of the commit s views. Commits are numbered
+// from 1; a new file is at commit 0.
+func (s *Snapshot) Commit() uint64 { return s.commit }
+
+// Root returns the root page of the commit's tree; zero means empty.
+func (s *Snapshot) Root() uint64 { return s.root }
+
+// Page returns the committed page at ptr. A damaged page panics, as with
+// Pager.Page.
+func (s *Snapshot) Page(ptr uint64) []byte { return s.p.page(ptr) }
+
+func (s *Snapshot) Alloc(page []byte) uint64 { panic("pager: Alloc on a snapshot") }
+func (s *Snapshot) Free(ptr uint64)          { panic("pager: Free on a snapshot") }
+
+// Release ends the snapshot. Its pages may then be reused by the next
+// commits: only read them on if another snapshot of the same commit is
+// open. Releasing it again does nothing.
+func (s *Snapshot) Release() {
+	p := s.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s.released {
+		return
+	}
+	s.released = true
+	if p.readers[s.commit]--; p.readers[s.commit] == 0 {
+		delete(p.readers, s.commit)
+	}
+}
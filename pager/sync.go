@@ -0,0 +1,229 @@
+package pager
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/adcondev/go-database/fileio"
+)
+
+// SyncPolicy says when Commit makes a commit durable.
+type SyncPolicy int
+
+const (
+	// SyncAlways syncs every commit before Commit returns.
+	SyncAlways SyncPolicy = iota
+
+	// SyncBatch syncs in the background, at most SyncDelay after a
+	// commit, so that the commits made meanwhile share one sync (group
+	// commit). WaitSynced waits for a commit's sync.
+	SyncBatch
+
+	// SyncInterval syncs in the background every SyncDelay. A crash loses
+	// the commits since the last sync.
+	SyncInterval
+
+	// SyncOff writes the meta page without syncing and leaves the rest to
+	// the operating system, which is as fast as it is unsafe: a crash can
+	// lose any number of commits or, with SingleSync, the file.
+	SyncOff
+)
+
+func (s SyncPolicy) String() string {
+	switch s {
+	case SyncAlways:
+		return "always"
+	case SyncBatch:
+		return "batch"
+	case SyncInterval:
+		return "interval"
+	case SyncOff:
+		return "off"
+	}
+	return "unknown"
+}
+
+func (o Options) syncDelay() time.Duration {
+	switch {
+	case o.SyncDelay > 0:
+		return o.SyncDelay
+	case o.Sync == SyncInterval:
+		return time.Second
+	}
+	return 10 * time.Millisecond
+}
+
+// flush makes commit m, which must be the last one written, durable unless
+// a later flush already did. A failure is sticky: see fail.
+func (p *Pager) flush(m meta) error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+	if err := p.failed(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	done := m.commit <= p.durable
+	p.mu.Unlock()
+	if done {
+		return nil
+	}
+	if p.durability == CopyOnWrite {
+		// The pages must be on disk before anything points to them.
+		p.syncs.Add(1)
+		if err := p.fp.Sync(); err != nil {
+			return p.fail(err)
+		}
+	}
+	if err := p.writeMeta(m); err != nil {
+		return p.fail(err)
+	}
+	p.syncs.Add(1)
+	if err := p.fp.Sync(); err != nil {
+		return p.fail(err)
+	}
+	if p.newFile {
+		// The file itself is only durable once its directory is synced.
+		if err := (fileio.Options{FS: p.fs}).SyncDir(filepath.Dir(p.path)); err != nil {
+			return p.fail(err)
+		}
+		p.newFile = false
+	}
+	p.mu.Lock()
+	p.durable = max(p.durable, m.commit)
+	p.synced.Broadcast()
+	p.mu.Unlock()
+	return nil
+}
+
+// flushLatest flushes the last commit.
+func (p *Pager) flushLatest() error {
+	p.mu.Lock()
+	m := p.latest
+	p.taken = max(p.taken, m.commit)
+	p.mu.Unlock()
+	return p.flush(m)
+}
+
+// fail records err as the reason p can no longer tell what is on disk.
+// A failed sync cannot simply be retried: the operating system may have
+// dropped the dirty pages it could not write. It returns err.
+func (p *Pager) fail(err error) error {
+	p.mu.Lock()
+	if p.syncErr == nil {
+		p.syncErr = err
+	}
+	p.synced.Broadcast()
+	p.mu.Unlock()
+	return err
+}
+
+// failed returns ErrFailed once a write or sync has failed midway.
+func (p *Pager) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.syncErr != nil {
+		return ErrFailed
+	}
+	return nil
+}
+
+// syncOff fsyncs the file written under SyncOff, and its directory if it
+// is new.
+func (p *Pager) syncOff() error {
+	p.flushMu.Lock()
+	defer p.flushMu.Unlock()
+	if p.readOnly || !p.metaSeen || p.failed() != nil {
+		return nil
+	}
+	p.syncs.Add(1)
+	if err := p.fp.Sync(); err != nil {
+		return err
+	}
+	if p.newFile {
+		if err := (fileio.Options{FS: p.fs}).SyncDir(filepath.Dir(p.path)); err != nil {
+			return err
+		}
+		p.newFile = false
+	}
+	return nil
+}
+
+// WaitSynced waits until commit c is durable. It returns ErrFailed if a
+// sync failed first, and ErrClosed if p was closed without syncing c.
+// Under SyncInterval it may wait for up to SyncDelay; under SyncAlways or
+// SyncOff it returns at once for any commit made.
+func (p *Pager) WaitSynced(c uint64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.durable < c && p.syncErr == nil && !p.stopped {
+		p.synced.Wait()
+	}
+	switch {
+	case p.durable >= c:
+		return nil
+	case p.syncErr != nil:
+		return ErrFailed
+	}
+	return ErrClosed
+}
+
+// startSyncer starts the background syncs of SyncBatch and SyncInterval.
+func (p *Pager) startSyncer() {
+	if p.readOnly || p.policy != SyncBatch && p.policy != SyncInterval {
+		return
+	}
+	p.kick = make(chan struct{}, 1)
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.syncer()
+}
+
+func (p *Pager) syncer() {
+	defer close(p.done)
+	var tick <-chan time.Time
+	if p.policy == SyncInterval {
+		t := time.NewTicker(p.delay)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-tick:
+		case <-p.kick:
+			// Give the commits following this one time to join its sync.
+			t := time.NewTimer(p.delay)
+			select {
+			case <-p.stop:
+				t.Stop()
+				return // Close flushes
+			case <-t.C:
+			}
+		}
+		p.flushLatest() // a failure is sticky and wakes the waiters
+	}
+}
+
+// stopSyncer stops the background syncs, flushes the commits not synced
+// yet and wakes any WaitSynced left waiting.
+func (p *Pager) stopSyncer() error {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+	}
+	var err error
+	switch p.policy {
+	case SyncBatch, SyncInterval:
+		err = p.flushLatest()
+	case SyncOff:
+		// The commits wrote their meta page already; the fsync is all
+		// that is left.
+		err = p.syncOff()
+	}
+	p.mu.Lock()
+	p.stopped = true
+	p.synced.Broadcast()
+	p.mu.Unlock()
+	return err
+}
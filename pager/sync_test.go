@@ -0,0 +1,121 @@
+package pager_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/pager"
+)
+
+// fileSyncs returns how many of the fsyncs rec saw were of files.
+func fileSyncs(rec *dbtest.RecordingFS) int {
+	n := 0
+	for _, s := range rec.Syncs() {
+		if !s.Dir {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSyncPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		o pager.Options
+		// fsyncs made by 10 commits, and by the Close after them
+		commits, close int
+	}{
+		{pager.Options{}, 20, 0},
+		{pager.Options{Durability: pager.SingleSync}, 10, 0},
+		{pager.Options{Sync: pager.SyncInterval, SyncDelay: time.Hour}, 0, 2},
+		{pager.Options{Sync: pager.SyncOff}, 0, 1},
+	} {
+		t.Run(tc.o.Sync.String(), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "db")
+			rec := &dbtest.RecordingFS{}
+			tc.o.FS = rec
+			p, err := tc.o.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range 10 {
+				update(t, p, 0, 10*(i+1), "v")
+			}
+			if n := fileSyncs(rec); n != tc.commits {
+				t.Errorf("10 commits made %d fsyncs, want %d", n, tc.commits)
+			}
+			// Whatever the policy, a commit is durable once WaitSynced
+			// for it returns. Under SyncInterval, that is after Close.
+			if tc.o.Sync != pager.SyncInterval {
+				if err = p.WaitSynced(p.LastCommit()); err != nil {
+					t.Error(err)
+				}
+			}
+			rec.Reset()
+			if err = p.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if n := fileSyncs(rec); n != tc.close {
+				t.Errorf("Close made %d fsyncs, want %d", n, tc.close)
+			}
+			if p, err = pager.Open(path); err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+			if p.LastCommit() != 10 {
+				t.Errorf("reopened at commit %d, want 10", p.LastCommit())
+			}
+			holds(t, p.Tree(), 100, "v")
+		})
+	}
+}
+
+func TestSyncBatch(t *testing.T) {
+	rec := &dbtest.RecordingFS{}
+	p, err := pager.Options{FS: rec, Sync: pager.SyncBatch, SyncDelay: 50 * time.Millisecond}.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for i := range 10 {
+		update(t, p, 0, 10*(i+1), "v")
+	}
+	if n := fileSyncs(rec); n > 2 {
+		t.Errorf("commits made %d fsyncs before the batch was due", n)
+	}
+	start := time.Now()
+	if err = p.WaitSynced(p.LastCommit()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("WaitSynced took more than 5s")
+	}
+	// The 10 commits shared a sync or two, of their pages and the meta
+	// page each.
+	if n := fileSyncs(rec); n == 0 || n > 4 {
+		t.Errorf("10 commits in one batch made %d fsyncs", n)
+	}
+	if err = p.WaitSynced(1); err != nil {
+		t.Errorf("WaitSynced of an earlier commit: %v", err)
+	}
+}
+
+func TestSyncedAfterClose(t *testing.T) {
+	p, err := pager.Options{Sync: pager.SyncInterval, SyncDelay: time.Hour}.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(t, p, 0, 10, "v")
+	c := p.LastCommit()
+	waited := make(chan error)
+	go func() { waited <- p.WaitSynced(c) }()
+	p.Close()
+	// Close syncs the commit, which wakes the wait.
+	if err = <-waited; err != nil {
+		t.Errorf("WaitSynced across Close: %v", err)
+	}
+	if err = p.WaitSynced(c + 1); err != pager.ErrClosed {
+		t.Errorf("WaitSynced of a commit never made: %v, want ErrClosed", err)
+	}
+}
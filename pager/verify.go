@@ -0,0 +1,123 @@
+package pager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adcondev/go-database/btree"
+)
+
+// VerifyStats describes the file Verify checked.
+type VerifyStats struct {
+	Commit    uint64
+	PageSize  int
+	Pages     uint64 // in the file, the meta page included
+	FreePages int    // listed on the free list
+	ListPages int    // holding the free list
+	Tree      btree.CheckStats
+}
+
+// What Verify found a page to be.
+const (
+	pageUnseen = iota
+	pageMeta
+	pageList
+	pageFree
+	pageTree
+)
+
+// Verify checks the file as of the last commit, as a crash would leave it
+// if that commit is synced: its meta page, its free list, its tree (see
+// btree.BTree.Check) and the checksums of their pages, and that every page
+// is exactly one of the meta page, a page of the tree, a page of the free
+// list or a free page. It must not run while the next commit is being
+// built.
+//
+// Verify does not stop at the first problem. It returns them all, joined,
+// each a *btree.CorruptError naming its page, along with statistics on the
+// file.
+func (p *Pager) Verify() (VerifyStats, error) {
+	if p.closed {
+		return VerifyStats{}, ErrClosed
+	}
+	p.mu.Lock()
+	m, durable := p.latest, p.durable
+	p.mu.Unlock()
+	stats := VerifyStats{Commit: p.commit, PageSize: p.pageSize, Pages: p.npages}
+	var errs []error
+	fail := func(ptr uint64, format string, args ...any) {
+		errs = append(errs, &btree.CorruptError{Page: ptr, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	if fi, err := p.fp.Stat(); err != nil {
+		return stats, err
+	} else if dm, _, ok := p.readMeta(fi.Size()); ok && dm.commit < durable {
+		fail(0, "meta page holds commit %d, older than commit %d, which was synced", dm.commit, durable)
+	} else if !ok && durable > 0 {
+		fail(0, "no valid meta slot")
+	}
+
+	owner := make([]byte, p.npages)
+	owner[0] = pageMeta
+	free, chain, err := p.readFreeList(m.freeList)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, ptr := range chain {
+		if owner[ptr] != pageUnseen {
+			fail(ptr, "holds the free list twice over")
+		}
+		owner[ptr] = pageList
+	}
+	for _, ptr := range free {
+		switch owner[ptr] {
+		case pageMeta:
+			fail(ptr, "meta page on the free list")
+		case pageList:
+			fail(ptr, "holds the free list and is on it")
+		case pageFree:
+			fail(ptr, "on the free list twice")
+		}
+		owner[ptr] = pageFree
+	}
+	stats.FreePages, stats.ListPages = len(free), len(chain)
+
+	tree := btree.BTree{Root: p.root, Pager: p, PageSize: p.usable}
+	stats.Tree, err = tree.Check(func(ptr uint64) error {
+		if ptr == 0 || ptr >= p.npages {
+			return errOutside(ptr)
+		}
+		switch owner[ptr] {
+		case pageTree:
+			return errTwice
+		case pageList:
+			fail(ptr, "in the tree and holding the free list")
+		case pageFree:
+			fail(ptr, "in the tree and on the free list")
+		}
+		owner[ptr] = pageTree
+		_, err := p.readPage(ptr)
+		return err
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// A page that could not be read, or a free list cut short, hides the
+	// pages it leads to: only report leaks when nothing explains them.
+	if len(errs) > 0 {
+		return stats, errors.Join(errs...)
+	}
+	for ptr, o := range owner {
+		if o == pageUnseen {
+			fail(uint64(ptr), "neither in the tree nor free: leaked")
+		}
+	}
+	return stats, errors.Join(errs...)
+}
+
+func errOutside(ptr uint64) error {
+	return fmt.Errorf("child pointer to page %d, outside the file", ptr)
+}
+
+var errTwice = errors.New("reached twice in the tree")
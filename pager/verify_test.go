@@ -0,0 +1,104 @@
+package pager_test
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/pager"
+)
+
+// problems returns the *btree.CorruptError of err, failing the test if
+// one of them is not.
+func problems(tb testing.TB, err error) []*btree.CorruptError {
+	tb.Helper()
+	var errs []error
+	if j, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = j.Unwrap()
+	} else if err != nil {
+		errs = []error{err}
+	}
+	var ces []*btree.CorruptError
+	for _, e := range errs {
+		if j, ok := e.(interface{ Unwrap() []error }); ok {
+			ces = append(ces, problems(tb, errors.Join(j.Unwrap()...))...)
+			continue
+		}
+		var ce *btree.CorruptError
+		if !errors.As(e, &ce) {
+			tb.Fatalf("%v is not a *btree.CorruptError", e)
+		}
+		ces = append(ces, ce)
+	}
+	return ces
+}
+
+func TestVerify(t *testing.T) {
+	p, err := pager.Options{PageSize: 512}.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, err = p.Verify(); err != nil {
+		t.Errorf("Verify of a new file: %v", err)
+	}
+	for i := range 10 {
+		update(t, p, 0, 100*(i+1), "v")
+	}
+	stats, err := p.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Commit != 10 || stats.PageSize != 512 || stats.Pages != p.Pages() || stats.FreePages != p.FreePages() {
+		t.Errorf("stats %+v", stats)
+	}
+	// Every page is accounted for.
+	if n := 1 + uint64(stats.Tree.Nodes+stats.Tree.Overflow+stats.FreePages+stats.ListPages); n != stats.Pages {
+		t.Errorf("meta page, %d tree pages, %d free and %d of the free list make %d, not the %d of the file",
+			stats.Tree.Nodes+stats.Tree.Overflow, stats.FreePages, stats.ListPages, n, stats.Pages)
+	}
+}
+
+func TestVerifyLeak(t *testing.T) {
+	p, err := pager.Options{PageSize: 512}.Open(pager.Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	update(t, p, 0, 100, "v")
+	// A page committed that the tree does not reach.
+	leaked := p.Alloc(btree.EmptyLeaf(p.PageSize()))
+	if err = p.Commit(p.Root()); err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Verify()
+	ces := problems(t, err)
+	if len(ces) != 1 || ces[0].Page != leaked || !strings.Contains(ces[0].Reason, "leaked") {
+		t.Errorf("Verify = %v, want page %d leaked", err, leaked)
+	}
+}
+
+func TestVerifyFreeInTree(t *testing.T) {
+	p, err := pager.Options{PageSize: 512}.Open(pager.Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	update(t, p, 0, 100, "v")
+	// The root freed, but still the root.
+	root := p.Root()
+	p.Free(root)
+	if err = p.Commit(root); err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Verify()
+	found := false
+	for _, ce := range problems(t, err) {
+		found = found || strings.Contains(ce.Reason, "free")
+	}
+	if !found {
+		t.Errorf("Verify = %v, want a page both in the tree and free", err)
+	}
+}
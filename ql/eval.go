@@ -0,0 +1,247 @@
+package ql
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+
+	"github.com/adcondev/go-database/table"
+)
+
+// A value is an int64, a string or a []byte, as in a row, or a bool, the
+// result of a condition.
+
+// scope is what expressions of a statement see: the columns of its table
+// and the arguments of the statement.
+type scope struct {
+	t    *table.Table
+	cols map[string]int // column positions by name
+	args []any
+}
+
+func newScope(t *table.Table, args []any) *scope {
+	s := &scope{t: t, cols: make(map[string]int), args: args}
+	for i, c := range t.Columns {
+		s.cols[c.Name] = i
+	}
+	return s
+}
+
+// column returns the position of the column called name.
+func (s *scope) column(name string) (int, error) {
+	i, ok := s.cols[name]
+	if !ok {
+		return 0, fmt.Errorf("%w %q in %s", ErrNoColumn, name, s.t.Name)
+	}
+	return i, nil
+}
+
+// resolve checks that the columns e refers to exist.
+func (s *scope) resolve(e expr) error {
+	switch e := e.(type) {
+	case *colRef:
+		_, err := s.column(e.name)
+		return err
+	case *binary:
+		if err := s.resolve(e.l); err != nil {
+			return err
+		}
+		return s.resolve(e.r)
+	case *notExpr:
+		return s.resolve(e.e)
+	case *negExpr:
+		return s.resolve(e.e)
+	}
+	return nil
+}
+
+// constant reports whether e refers to no column, so has the same value
+// for every row.
+func constant(e expr) bool {
+	switch e := e.(type) {
+	case *colRef:
+		return false
+	case *binary:
+		return constant(e.l) && constant(e.r)
+	case *notExpr:
+		return constant(e.e)
+	case *negExpr:
+		return constant(e.e)
+	}
+	return true
+}
+
+// eval returns the value of e for row, which is nil if e is constant.
+func (s *scope) eval(e expr, row table.Row) (any, error) {
+	switch e := e.(type) {
+	case *literal:
+		return e.val, nil
+	case *param:
+		return s.args[e.n], nil
+	case *colRef:
+		i, err := s.column(e.name)
+		if err != nil {
+			return nil, err
+		}
+		return row[i], nil
+	case *notExpr:
+		b, err := s.cond(e.e, row)
+		return !b, err
+	case *negExpr:
+		v, err := s.eval(e.e, row)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := v.(int64)
+		if !ok {
+			return nil, fmt.Errorf("%w: -%s", ErrType, typeName(v))
+		}
+		return -n, nil
+	case *binary:
+		return s.binary(e, row)
+	}
+	panic(fmt.Sprintf("ql: unknown expression %T", e))
+}
+
+func (s *scope) binary(e *binary, row table.Row) (any, error) {
+	switch e.op {
+	case "AND", "OR":
+		l, err := s.cond(e.l, row)
+		if err != nil || l == (e.op == "OR") {
+			return l, err
+		}
+		return s.cond(e.r, row)
+	}
+	l, err := s.eval(e.l, row)
+	if err != nil {
+		return nil, err
+	}
+	r, err := s.eval(e.r, row)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		return test(e.op, c), nil
+	}
+	a, aok := l.(int64)
+	b, bok := r.(int64)
+	if !aok || !bok {
+		return nil, fmt.Errorf("%w: %s %s %s", ErrType, typeName(l), e.op, typeName(r))
+	}
+	switch e.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	}
+	if b == 0 {
+		return nil, ErrDivide
+	}
+	return a / b, nil
+}
+
+// cond returns the value of the condition e for row.
+func (s *scope) cond(e expr, row table.Row) (bool, error) {
+	v, err := s.eval(e, row)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("%w: %s as a condition", ErrType, typeName(v))
+	}
+	return b, nil
+}
+
+// match reports whether row passes the condition where, which may be nil.
+func (s *scope) match(where expr, row table.Row) (bool, error) {
+	if where == nil {
+		return true, nil
+	}
+	return s.cond(where, row)
+}
+
+// compare compares two values: two ints, or two of strings and []bytes,
+// which compare by their bytes.
+func compare(a, b any) (int, error) {
+	switch a := a.(type) {
+	case int64:
+		if b, ok := b.(int64); ok {
+			return cmp.Compare(a, b), nil
+		}
+	case string, []byte:
+		if bb, ok := text(b); ok {
+			ab, _ := text(a)
+			return bytes.Compare(ab, bb), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: comparing %s with %s", ErrType, typeName(a), typeName(b))
+}
+
+// test reports whether a comparison that gave c passes op.
+func test(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func text(v any) ([]byte, bool) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), true
+	case []byte:
+		return v, true
+	}
+	return nil, false
+}
+
+// coerce converts v to a value for a column of type typ: strings and
+// []bytes convert to each other, nothing else does.
+func coerce(v any, typ table.Type) (any, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, typ == table.Int
+	case string:
+		if typ == table.Bytes {
+			return []byte(v), true
+		}
+		return v, typ == table.String
+	case []byte:
+		if typ == table.String {
+			return string(v), true
+		}
+		return v, typ == table.Bytes
+	}
+	return nil, false
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case int64:
+		return "int"
+	case string:
+		return "string"
+	case []byte:
+		return "bytes"
+	case bool:
+		return "condition"
+	}
+	return fmt.Sprintf("%T", v)
+}
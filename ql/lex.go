@@ -0,0 +1,143 @@
+package ql
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A token is a lexical unit of a statement.
+type token struct {
+	kind tokenKind
+	text string // as written, but keywords upper-cased
+	val  any    // the value of a number, string or blob
+	pos  int    // byte offset in the statement
+}
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokIdent            // a name, or a keyword
+	tokNumber           // an integer
+	tokString           // 'text', with '' for a quote
+	tokBlob             // x'hex'
+	tokParam            // ?
+	tokPunct            // an operator or punctuation
+)
+
+// keywords are the words that cannot be names.
+var keywords = map[string]bool{
+	"ADD": true, "ALTER": true, "AND": true, "ASC": true, "BY": true,
+	"COLUMN": true, "CREATE": true, "DEFAULT": true, "DELETE": true,
+	"DESC": true, "DROP": true, "FROM": true, "INDEX": true, "INSERT": true,
+	"INTO": true, "KEY": true, "LIMIT": true, "NOT": true, "ON": true,
+	"OR": true, "ORDER": true, "PRIMARY": true, "RELEASE": true,
+	"ROLLBACK": true, "SAVEPOINT": true, "SELECT": true, "SET": true,
+	"TABLE": true, "TO": true, "UNIQUE": true, "UPDATE": true,
+	"VALUES": true, "WHERE": true,
+}
+
+// punctuation is every operator and punctuation mark, longest first.
+var punctuation = []string{"<=", ">=", "<>", "!=", "(", ")", ",", ";", "*", "=", "<", ">", "+", "-", "/"}
+
+// lex splits src into tokens, ending with a tokEOF.
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; ; {
+		for i < len(src) && strings.ContainsRune(" \t\r\n", rune(src[i])) {
+			i++
+		}
+		if strings.HasPrefix(src[i:], "--") {
+			// A comment, to the end of the line.
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		if i == len(src) {
+			return append(toks, token{kind: tokEOF, pos: i}), nil
+		}
+		tok, size, err := lexToken(src, i)
+		if err != nil {
+			return nil, err
+		}
+		toks = append(toks, tok)
+		i += size
+	}
+}
+
+// lexToken reads the token at src[i:], which is not blank, and returns it
+// and the size it takes in src.
+func lexToken(src string, i int) (token, int, error) {
+	c := src[i]
+	switch {
+	case (c == 'x' || c == 'X') && i+1 < len(src) && src[i+1] == '\'':
+		s, size, err := lexQuoted(src, i+1)
+		if err != nil {
+			return token{}, 0, err
+		}
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return token{}, 0, &SyntaxError{Offset: i, Msg: "bad hex in blob"}
+		}
+		return token{kind: tokBlob, text: src[i : i+1+size], val: b, pos: i}, 1 + size, nil
+	case isLetter(c):
+		j := i
+		for j < len(src) && (isLetter(src[j]) || isDigit(src[j])) {
+			j++
+		}
+		text := src[i:j]
+		if up := strings.ToUpper(text); keywords[up] {
+			text = up
+		}
+		return token{kind: tokIdent, text: text, pos: i}, j - i, nil
+	case isDigit(c):
+		j := i
+		for j < len(src) && isDigit(src[j]) {
+			j++
+		}
+		n, err := strconv.ParseInt(src[i:j], 10, 64)
+		if err != nil {
+			return token{}, 0, &SyntaxError{Offset: i, Msg: "integer out of range"}
+		}
+		return token{kind: tokNumber, text: src[i:j], val: n, pos: i}, j - i, nil
+	case c == '\'':
+		s, size, err := lexQuoted(src, i)
+		if err != nil {
+			return token{}, 0, err
+		}
+		return token{kind: tokString, text: src[i : i+size], val: s, pos: i}, size, nil
+	case c == '?':
+		return token{kind: tokParam, text: "?", pos: i}, 1, nil
+	}
+	for _, p := range punctuation {
+		if strings.HasPrefix(src[i:], p) {
+			return token{kind: tokPunct, text: p, pos: i}, len(p), nil
+		}
+	}
+	return token{}, 0, &SyntaxError{Offset: i, Msg: fmt.Sprintf("unexpected %q", c)}
+}
+
+// lexQuoted reads the quoted string at src[i:] and returns it and the
+// size it takes in the source.
+func lexQuoted(src string, i int) (string, int, error) {
+	var b strings.Builder
+	for j := i + 1; j < len(src); j++ {
+		if src[j] != '\'' {
+			b.WriteByte(src[j])
+			continue
+		}
+		if j+1 < len(src) && src[j+1] == '\'' {
+			b.WriteByte('\'')
+			j++
+			continue
+		}
+		return b.String(), j + 1 - i, nil
+	}
+	return "", 0, &SyntaxError{Offset: i, Msg: "unterminated string"}
+}
+
+func isLetter(c byte) bool { return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+func isDigit(c byte) bool  { return '0' <= c && c <= '9' }
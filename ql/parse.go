@@ -0,0 +1,668 @@
+package ql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adcondev/go-database/table"
+)
+
+// SyntaxError is a statement that does not parse, with where it goes
+// wrong.
+type SyntaxError struct {
+	Offset int // in bytes, from the start of the statement
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("ql: syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// The statements, as parsed.
+type (
+	createTable struct{ schema table.Schema }
+
+	dropTable struct{ name string }
+
+	addColumn struct {
+		table string
+		col   table.Column
+		def   expr
+	}
+
+	dropColumn struct{ table, col string }
+
+	createIndex struct {
+		table string
+		index table.Index
+	}
+
+	dropIndex struct{ table, name string }
+
+	savepointStmt  struct{ name string }
+	releaseStmt    struct{ name string }
+	rollbackToStmt struct{ name string }
+
+	insertStmt struct {
+		table string
+		cols  []string // nil: every column, in order
+		rows  [][]expr
+	}
+
+	selectStmt struct {
+		table string
+		cols  []string // nil: *
+		where expr     // nil: every row
+		order []orderBy
+		limit expr // nil: no limit
+	}
+
+	updateStmt struct {
+		table string
+		set   []assignment
+		where expr
+	}
+
+	deleteStmt struct {
+		table string
+		where expr
+	}
+)
+
+type orderBy struct {
+	col  string
+	desc bool
+}
+
+type assignment struct {
+	col string
+	val expr
+}
+
+// The expressions, as parsed.
+type (
+	expr interface{}
+
+	literal struct{ val any } // int64, string or []byte
+	param   struct{ n int }   // the n-th ?, from 0
+	colRef  struct {
+		name string
+		pos  int // in the statement, for errors
+	}
+	binary struct {
+		op   string // an operator, or AND or OR
+		l, r expr
+	}
+	notExpr struct{ e expr }
+	negExpr struct{ e expr }
+)
+
+// parser parses a statement from its tokens.
+type parser struct {
+	toks    []token
+	i       int
+	nparams int
+}
+
+// parse parses the single statement in src, which may end with a
+// semicolon.
+func parse(src string) (any, int, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, 0, err
+	}
+	p := &parser{toks: toks}
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, 0, err
+	}
+	p.accept(";")
+	if p.peek().kind != tokEOF {
+		return nil, 0, p.errorf("unexpected %s after the statement", p.describe())
+	}
+	return stmt, p.nparams, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	tok := p.toks[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+// accept moves past the next token if it is the keyword or punctuation
+// text, and reports whether it was.
+func (p *parser) accept(text string) bool {
+	tok := p.peek()
+	if (tok.kind == tokIdent || tok.kind == tokPunct) && tok.text == text {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// expect moves past the keyword or punctuation text, or fails.
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %s, found %s", text, p.describe())
+	}
+	return nil
+}
+
+// name reads a name, which may not be a keyword.
+func (p *parser) name(what string) (string, error) {
+	tok := p.peek()
+	if tok.kind != tokIdent || keywords[tok.text] {
+		return "", p.errorf("expected %s, found %s", what, p.describe())
+	}
+	p.i++
+	return tok.text, nil
+}
+
+// names reads a parenthesized list of names.
+func (p *parser) names(what string) ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.name(what)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.accept(",") {
+			return names, p.expect(")")
+		}
+	}
+}
+
+// describe describes the next token, for errors.
+func (p *parser) describe() string {
+	if tok := p.peek(); tok.kind != tokEOF {
+		return fmt.Sprintf("%q", tok.text)
+	}
+	return "end of statement"
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{Offset: p.peek().pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) statement() (any, error) {
+	switch {
+	case p.accept("CREATE"):
+		switch {
+		case p.accept("UNIQUE"):
+			if err := p.expect("INDEX"); err != nil {
+				return nil, err
+			}
+			return p.createIndex(true)
+		case p.accept("INDEX"):
+			return p.createIndex(false)
+		}
+		return p.createTable()
+	case p.accept("DROP"):
+		if p.accept("INDEX") {
+			return p.dropIndex()
+		}
+		if err := p.expect("TABLE"); err != nil {
+			return nil, err
+		}
+		name, err := p.name("table name")
+		return &dropTable{name: name}, err
+	case p.accept("ALTER"):
+		return p.alterTable()
+	case p.accept("SAVEPOINT"):
+		name, err := p.name("savepoint name")
+		return &savepointStmt{name: name}, err
+	case p.accept("RELEASE"):
+		p.accept("SAVEPOINT")
+		name, err := p.name("savepoint name")
+		return &releaseStmt{name: name}, err
+	case p.accept("ROLLBACK"):
+		if err := p.expect("TO"); err != nil {
+			return nil, err
+		}
+		p.accept("SAVEPOINT")
+		name, err := p.name("savepoint name")
+		return &rollbackToStmt{name: name}, err
+	case p.accept("INSERT"):
+		return p.insert()
+	case p.accept("SELECT"):
+		return p.selectStmt()
+	case p.accept("UPDATE"):
+		return p.update()
+	case p.accept("DELETE"):
+		return p.delete()
+	}
+	return nil, p.errorf("expected a statement, found %s", p.describe())
+}
+
+// columnTypes are the type names of CREATE TABLE.
+var columnTypes = map[string]table.Type{
+	"INT": table.Int, "INTEGER": table.Int, "BIGINT": table.Int,
+	"TEXT": table.String, "STRING": table.String, "VARCHAR": table.String,
+	"BLOB": table.Bytes, "BYTES": table.Bytes,
+}
+
+// createTable parses
+//
+//	CREATE TABLE name (
+//		column type [PRIMARY KEY | UNIQUE], ...
+//		[, PRIMARY KEY (column, ...)]
+//		[, [UNIQUE] INDEX name (column, ...)] ...
+//	)
+//
+// where a UNIQUE column gets a unique index called after it.
+func (p *parser) createTable() (any, error) {
+	if err := p.expect("TABLE"); err != nil {
+		return nil, err
+	}
+	name, err := p.name("table name")
+	if err != nil {
+		return nil, err
+	}
+	s := table.Schema{Name: name}
+	if err = p.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("PRIMARY"):
+			if err = p.expect("KEY"); err != nil {
+				return nil, err
+			}
+			if s.PrimaryKey != nil {
+				return nil, p.errorf("second primary key")
+			}
+			if s.PrimaryKey, err = p.names("column name"); err != nil {
+				return nil, err
+			}
+		case p.accept("UNIQUE"):
+			if err = p.expect("INDEX"); err != nil {
+				return nil, err
+			}
+			if err = p.index(&s, true); err != nil {
+				return nil, err
+			}
+		case p.accept("INDEX"):
+			if err = p.index(&s, false); err != nil {
+				return nil, err
+			}
+		default:
+			if err = p.column(&s); err != nil {
+				return nil, err
+			}
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err = p.expect(")"); err != nil {
+		return nil, err
+	}
+	return &createTable{schema: s}, nil
+}
+
+// column parses a column of CREATE TABLE into s.
+func (p *parser) column(s *table.Schema) error {
+	name, err := p.name("column name")
+	if err != nil {
+		return err
+	}
+	typ, err := p.columnType()
+	if err != nil {
+		return err
+	}
+	s.Columns = append(s.Columns, table.Column{Name: name, Type: typ})
+	switch {
+	case p.accept("PRIMARY"):
+		if err = p.expect("KEY"); err != nil {
+			return err
+		}
+		if s.PrimaryKey != nil {
+			return p.errorf("second primary key")
+		}
+		s.PrimaryKey = []string{name}
+	case p.accept("UNIQUE"):
+		s.Indexes = append(s.Indexes, table.Index{Name: name, Columns: []string{name}, Unique: true})
+	}
+	return nil
+}
+
+// columnType parses a column type.
+func (p *parser) columnType() (table.Type, error) {
+	tok := p.peek()
+	typ, ok := columnTypes[strings.ToUpper(tok.text)]
+	if tok.kind != tokIdent || !ok {
+		return 0, p.errorf("expected a column type, found %s", p.describe())
+	}
+	p.i++
+	return typ, nil
+}
+
+// alterTable parses
+//
+//	ALTER TABLE name ADD [COLUMN] column type DEFAULT expr
+//	ALTER TABLE name DROP [COLUMN] column
+func (p *parser) alterTable() (any, error) {
+	if err := p.expect("TABLE"); err != nil {
+		return nil, err
+	}
+	name, err := p.name("table name")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.accept("ADD"):
+		p.accept("COLUMN")
+		stmt := &addColumn{table: name}
+		if stmt.col.Name, err = p.name("column name"); err != nil {
+			return nil, err
+		}
+		if stmt.col.Type, err = p.columnType(); err != nil {
+			return nil, err
+		}
+		// There is no NULL for the rows to have instead.
+		if err = p.expect("DEFAULT"); err != nil {
+			return nil, err
+		}
+		stmt.def, err = p.expr()
+		return stmt, err
+	case p.accept("DROP"):
+		p.accept("COLUMN")
+		col, err := p.name("column name")
+		return &dropColumn{table: name, col: col}, err
+	}
+	return nil, p.errorf("expected ADD or DROP, found %s", p.describe())
+}
+
+// createIndex parses, after CREATE [UNIQUE] INDEX,
+//
+//	name ON table (column, ...)
+func (p *parser) createIndex(unique bool) (any, error) {
+	name, err := p.name("index name")
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect("ON"); err != nil {
+		return nil, err
+	}
+	stmt := &createIndex{index: table.Index{Name: name, Unique: unique}}
+	if stmt.table, err = p.name("table name"); err != nil {
+		return nil, err
+	}
+	stmt.index.Columns, err = p.names("column name")
+	return stmt, err
+}
+
+// dropIndex parses, after DROP INDEX, name ON table.
+func (p *parser) dropIndex() (any, error) {
+	name, err := p.name("index name")
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect("ON"); err != nil {
+		return nil, err
+	}
+	stmt := &dropIndex{name: name}
+	stmt.table, err = p.name("table name")
+	return stmt, err
+}
+
+// index parses an INDEX of CREATE TABLE into s.
+func (p *parser) index(s *table.Schema, unique bool) error {
+	name, err := p.name("index name")
+	if err != nil {
+		return err
+	}
+	cols, err := p.names("column name")
+	if err != nil {
+		return err
+	}
+	s.Indexes = append(s.Indexes, table.Index{Name: name, Columns: cols, Unique: unique})
+	return nil
+}
+
+// insert parses INSERT INTO name [(column, ...)] VALUES (expr, ...), ...
+func (p *parser) insert() (any, error) {
+	if err := p.expect("INTO"); err != nil {
+		return nil, err
+	}
+	var s insertStmt
+	var err error
+	if s.table, err = p.name("table name"); err != nil {
+		return nil, err
+	}
+	if p.peek().text == "(" {
+		if s.cols, err = p.names("column name"); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expect("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		if err = p.expect("("); err != nil {
+			return nil, err
+		}
+		var row []expr
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, e)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err = p.expect(")"); err != nil {
+			return nil, err
+		}
+		s.rows = append(s.rows, row)
+		if !p.accept(",") {
+			return &s, nil
+		}
+	}
+}
+
+// selectStmt parses
+//
+//	SELECT * | column, ... FROM name [WHERE expr]
+//		[ORDER BY column [ASC | DESC], ...] [LIMIT expr]
+func (p *parser) selectStmt() (any, error) {
+	var s selectStmt
+	if !p.accept("*") {
+		for {
+			name, err := p.name("column name")
+			if err != nil {
+				return nil, err
+			}
+			s.cols = append(s.cols, name)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	var err error
+	if err = p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	if s.table, err = p.name("table name"); err != nil {
+		return nil, err
+	}
+	if s.where, err = p.where(); err != nil {
+		return nil, err
+	}
+	if p.accept("ORDER") {
+		if err = p.expect("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			var o orderBy
+			if o.col, err = p.name("column name"); err != nil {
+				return nil, err
+			}
+			if p.accept("DESC") {
+				o.desc = true
+			} else {
+				p.accept("ASC")
+			}
+			s.order = append(s.order, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("LIMIT") {
+		if s.limit, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+// update parses UPDATE name SET column = expr, ... [WHERE expr]
+func (p *parser) update() (any, error) {
+	var s updateStmt
+	var err error
+	if s.table, err = p.name("table name"); err != nil {
+		return nil, err
+	}
+	if err = p.expect("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		var a assignment
+		if a.col, err = p.name("column name"); err != nil {
+			return nil, err
+		}
+		if err = p.expect("="); err != nil {
+			return nil, err
+		}
+		if a.val, err = p.expr(); err != nil {
+			return nil, err
+		}
+		s.set = append(s.set, a)
+		if !p.accept(",") {
+			break
+		}
+	}
+	s.where, err = p.where()
+	return &s, err
+}
+
+// delete parses DELETE FROM name [WHERE expr]
+func (p *parser) delete() (any, error) {
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	var s deleteStmt
+	var err error
+	if s.table, err = p.name("table name"); err != nil {
+		return nil, err
+	}
+	s.where, err = p.where()
+	return &s, err
+}
+
+// where parses an optional WHERE clause.
+func (p *parser) where() (expr, error) {
+	if !p.accept("WHERE") {
+		return nil, nil
+	}
+	return p.expr()
+}
+
+// The operators by precedence, loosest first.
+var precedence = [][]string{
+	{"OR"},
+	{"AND"},
+	{"=", "!=", "<>", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+func (p *parser) expr() (expr, error) { return p.binary(0) }
+
+// binary parses an expression of operators of the given precedence level
+// and tighter. NOT binds tighter than AND, looser than comparisons.
+func (p *parser) binary(level int) (expr, error) {
+	if level == len(precedence) {
+		return p.unary()
+	}
+	operand := func() (expr, error) {
+		if level == 2 && p.accept("NOT") {
+			e, err := p.binary(level)
+			return &notExpr{e}, err
+		}
+		return p.binary(level + 1)
+	}
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op := ""
+		for _, o := range precedence[level] {
+			if tok.text == o && (tok.kind == tokPunct || tok.kind == tokIdent) {
+				op = o
+			}
+		}
+		if op == "" {
+			return l, nil
+		}
+		p.i++
+		if op == "<>" {
+			op = "!="
+		}
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if level == 2 {
+			// Comparisons do not chain.
+			return &binary{op: op, l: l, r: r}, nil
+		}
+		l = &binary{op: op, l: l, r: r}
+	}
+}
+
+// unary parses a literal, a ?, a column, a negation or a parenthesized
+// expression.
+func (p *parser) unary() (expr, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokNumber, tok.kind == tokString, tok.kind == tokBlob:
+		p.i++
+		return &literal{tok.val}, nil
+	case tok.kind == tokParam:
+		p.i++
+		p.nparams++
+		return &param{p.nparams - 1}, nil
+	case tok.kind == tokIdent && !keywords[tok.text]:
+		p.i++
+		return &colRef{name: tok.text, pos: tok.pos}, nil
+	case p.accept("-"):
+		e, err := p.unary()
+		if lit, ok := e.(*literal); ok {
+			if n, ok := lit.val.(int64); ok {
+				return &literal{-n}, nil
+			}
+		}
+		return &negExpr{e}, err
+	case p.accept("("):
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+	return nil, p.errorf("expected an expression, found %s", p.describe())
+}
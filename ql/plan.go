@@ -0,0 +1,134 @@
+package ql
+
+import (
+	"github.com/adcondev/go-database/table"
+)
+
+// The planner picks how to find the rows a WHERE clause selects. It looks
+// at the terms of the clause, the conditions joined by AND, and takes those
+// that compare a column to a constant. The primary key or an index whose
+// first columns the terms fix with =, and whose next column they bound,
+// narrows the scan to a table.Range of it; the one with the most columns
+// fixed, then bounded, wins, the primary key on a tie. WHERE as a whole
+// still filters every row the scan finds, so the terms the plan leaves out,
+// and the ones it uses, hold either way.
+
+// term is a comparison of a column with a constant.
+type term struct {
+	col int
+	op  string
+	val any // coerced to the column's type
+}
+
+// plan is how to find rows: by a range of the primary key if index is "",
+// else of the index called index.
+type plan struct {
+	index string
+	r     table.Range
+}
+
+// terms returns the terms of where that the planner can use.
+func (s *scope) terms(where expr) ([]term, error) {
+	var terms []term
+	var walk func(e expr) error
+	walk = func(e expr) error {
+		b, ok := e.(*binary)
+		if !ok {
+			return nil
+		}
+		if b.op == "AND" {
+			if err := walk(b.l); err != nil {
+				return err
+			}
+			return walk(b.r)
+		}
+		col, val, op := b.l, b.r, b.op
+		if _, ok := col.(*colRef); !ok {
+			col, val, op = b.r, b.l, flip[b.op]
+		}
+		c, ok := col.(*colRef)
+		if !ok || op == "" || op == "!=" || !constant(val) {
+			return nil
+		}
+		i, err := s.column(c.name)
+		if err != nil {
+			return err
+		}
+		v, err := s.eval(val, nil)
+		if err != nil {
+			return err
+		}
+		// A constant the column cannot hold makes an error of WHERE,
+		// for every row; leave it to that.
+		if v, ok := coerce(v, s.t.Columns[i].Type); ok {
+			terms = append(terms, term{col: i, op: op, val: v})
+		}
+		return nil
+	}
+	if where == nil {
+		return nil, nil
+	}
+	return terms, walk(where)
+}
+
+// flip maps a comparison to the one with its operands swapped, and the
+// other operators to "".
+var flip = map[string]string{"=": "=", "!=": "!=", "<": ">", "<=": ">=", ">": "<", ">=": "<="}
+
+// plan returns the plan for where.
+func (s *scope) plan(where expr) (plan, error) {
+	terms, err := s.terms(where)
+	if err != nil {
+		return plan{}, err
+	}
+	best, score := plan{}, 0
+	try := func(index string, names []string) {
+		p, n := s.narrow(names, terms)
+		if n > score {
+			p.index = index
+			best, score = p, n
+		}
+	}
+	try("", s.t.PrimaryKey)
+	for _, x := range s.t.Indexes {
+		try(x.Name, x.Columns)
+	}
+	return best, nil
+}
+
+// narrow returns the range of the columns names that terms narrow the
+// rows to, and a score of how much it narrows them: 2 for each column
+// fixed, and 1 for a bounded one.
+func (s *scope) narrow(names []string, terms []term) (plan, int) {
+	var p plan
+	find := func(col int, ops ...string) (term, bool) {
+		for _, t := range terms {
+			for _, op := range ops {
+				if t.col == col && t.op == op {
+					return t, true
+				}
+			}
+		}
+		return term{}, false
+	}
+	for _, name := range names {
+		col := s.cols[name]
+		if t, ok := find(col, "="); ok {
+			p.r.Eq = append(p.r.Eq, t.val)
+			continue
+		}
+		lo, hasLo := find(col, ">", ">=")
+		hi, hasHi := find(col, "<", "<=")
+		if hasLo {
+			p.r.Lo, p.r.LoExclusive = lo.val, lo.op == ">"
+		}
+		if hasHi {
+			p.r.Hi, p.r.HiInclusive = hi.val, hi.op == "<="
+		}
+		if hasLo || hasHi {
+			return p, 2*len(p.r.Eq) + 1
+		}
+		break
+	}
+	return p, 2 * len(p.r.Eq)
+}
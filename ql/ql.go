@@ -0,0 +1,474 @@
+// Package ql runs a small dialect of SQL against the tables of package
+// table.
+//
+// The statements are
+//
+//	CREATE TABLE name (column type [PRIMARY KEY | UNIQUE], ...
+//		[, PRIMARY KEY (column, ...)] [, [UNIQUE] INDEX name (column, ...)] ...)
+//	DROP TABLE name
+//	ALTER TABLE name ADD [COLUMN] column type DEFAULT expr
+//	ALTER TABLE name DROP [COLUMN] column
+//	CREATE [UNIQUE] INDEX name ON table (column, ...)
+//	DROP INDEX name ON table
+//	SAVEPOINT name
+//	RELEASE [SAVEPOINT] name
+//	ROLLBACK TO [SAVEPOINT] name
+//	INSERT INTO name [(column, ...)] VALUES (expr, ...), ...
+//	SELECT * | column, ... FROM name [WHERE expr]
+//		[ORDER BY column [ASC | DESC], ...] [LIMIT expr]
+//	UPDATE name SET column = expr, ... [WHERE expr]
+//	DELETE FROM name [WHERE expr]
+//
+// The types are INT (also INTEGER and BIGINT), TEXT (STRING, VARCHAR) and
+// BLOB (BYTES), for table.Int, table.String and table.Bytes. There is no
+// NULL: an INSERT gives every column a value. Expressions have integers,
+// 'strings' (doubling a quote inside), x'hex' blobs, columns, ? for an
+// argument, the comparisons = != <> < <= > >=, AND, OR, NOT, and integer
+// + - * /. Keywords are not case-sensitive; names are.
+//
+// A WHERE clause that fixes the first columns of the primary key or of an
+// index, or bounds one, runs as a scan of just that range (see plan.go);
+// any other scans the whole table. A statement runs in the kv.Tx it is
+// given, with the others of the transaction. One that fails, on a
+// duplicate key say, undoes what it did, under a savepoint of the
+// transaction, and the others stand. SAVEPOINT, RELEASE and ROLLBACK TO
+// are those of kv.Tx.Savepoint, Release and RollbackTo.
+//
+// ALTER TABLE and CREATE INDEX only start their change of the table, as
+// table.AddColumn, DropColumn and CreateIndex do: once the transaction
+// commits, table.Complete takes the rows through it, in transactions of
+// its own (see Stmt.SchemaChange). DROP INDEX is done at once.
+package ql
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/table"
+)
+
+var (
+	ErrArgs     = errors.New("ql: wrong number of arguments")
+	ErrNoColumn = errors.New("ql: no such column")
+	ErrType     = errors.New("ql: value of the wrong type")
+	ErrDivide   = errors.New("ql: division by zero")
+)
+
+// Stmt is a parsed statement, which can run any number of times.
+type Stmt struct {
+	stmt    any
+	nparams int
+}
+
+// Parse parses the statement query, which may end with a semicolon. It
+// fails with a *SyntaxError if query is not a statement.
+func Parse(query string) (*Stmt, error) {
+	stmt, n, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{stmt: stmt, nparams: n}, nil
+}
+
+// NumParams returns the number of ? in the statement, which is the number
+// of arguments Exec takes.
+func (s *Stmt) NumParams() int { return s.nparams }
+
+// ReadOnly reports whether the statement only reads, which a SELECT does.
+func (s *Stmt) ReadOnly() bool {
+	_, ok := s.stmt.(*selectStmt)
+	return ok
+}
+
+// SchemaChange returns the name of the table whose schema the statement
+// starts to change, an ALTER TABLE or CREATE INDEX, for table.Complete to
+// take on after the commit; "" for any other statement.
+func (s *Stmt) SchemaChange() string {
+	switch stmt := s.stmt.(type) {
+	case *addColumn:
+		return stmt.table
+	case *dropColumn:
+		return stmt.table
+	case *createIndex:
+		return stmt.table
+	}
+	return ""
+}
+
+// Result is the result of a statement.
+type Result struct {
+	Columns      []string    // of Rows
+	Rows         []table.Row // for a SELECT
+	RowsAffected int64       // for an INSERT, UPDATE or DELETE
+}
+
+// Exec runs the statement in tx, with args for its ?s in order. An
+// argument is an int, an int64, a string or a []byte.
+func (s *Stmt) Exec(tx *kv.Tx, args ...any) (*Result, error) {
+	if len(args) != s.nparams {
+		return nil, fmt.Errorf("%w: %d for %d", ErrArgs, len(args), s.nparams)
+	}
+	vals := make([]any, len(args))
+	for i, a := range args {
+		switch a := a.(type) {
+		case int:
+			vals[i] = int64(a)
+		case int64, string, []byte:
+			vals[i] = a
+		default:
+			return nil, fmt.Errorf("%w: argument %d is a %T", ErrType, i+1, a)
+		}
+	}
+	switch stmt := s.stmt.(type) {
+	case *savepointStmt:
+		return &Result{}, tx.Savepoint(stmt.name)
+	case *releaseStmt:
+		return &Result{}, tx.Release(stmt.name)
+	case *rollbackToStmt:
+		return &Result{}, tx.RollbackTo(stmt.name)
+	}
+	if s.ReadOnly() || !tx.Writable() {
+		return s.exec(tx, vals)
+	}
+	if err := tx.Savepoint(stmtSavepoint); err != nil {
+		return nil, err
+	}
+	res, err := s.exec(tx, vals)
+	if err != nil {
+		tx.RollbackTo(stmtSavepoint)
+	}
+	tx.Release(stmtSavepoint)
+	return res, err
+}
+
+// stmtSavepoint is the savepoint Exec undoes a failed statement to, named
+// so as not to be one of a SAVEPOINT.
+const stmtSavepoint = "\x00ql"
+
+// exec runs the statement in tx with vals.
+func (s *Stmt) exec(tx *kv.Tx, vals []any) (*Result, error) {
+	switch stmt := s.stmt.(type) {
+	case *createTable:
+		_, err := table.Create(tx, stmt.schema)
+		return &Result{}, err
+	case *dropTable:
+		return &Result{}, table.Drop(tx, stmt.name)
+	case *addColumn:
+		return stmt.exec(tx, vals)
+	case *dropColumn:
+		return &Result{}, table.DropColumn(tx, stmt.table, stmt.col)
+	case *createIndex:
+		return &Result{}, table.CreateIndex(tx, stmt.table, stmt.index)
+	case *dropIndex:
+		return &Result{}, table.DropIndex(tx, stmt.table, stmt.name)
+	case *insertStmt:
+		return stmt.exec(tx, vals)
+	case *selectStmt:
+		return stmt.exec(tx, vals)
+	case *updateStmt:
+		return stmt.exec(tx, vals)
+	case *deleteStmt:
+		return stmt.exec(tx, vals)
+	}
+	panic(fmt.Sprintf("ql: unknown statement %T", s.stmt))
+}
+
+// Exec parses query and runs it in tx with args.
+func Exec(tx *kv.Tx, query string, args ...any) (*Result, error) {
+	s, err := Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return s.Exec(tx, args...)
+}
+
+// open opens the table called name, for a statement with args.
+func open(tx *kv.Tx, name string, args []any) (*scope, error) {
+	t, err := table.Open(tx, name)
+	if err != nil {
+		return nil, err
+	}
+	return newScope(t, args), nil
+}
+
+func (stmt *insertStmt) exec(tx *kv.Tx, args []any) (*Result, error) {
+	s, err := open(tx, stmt.table, args)
+	if err != nil {
+		return nil, err
+	}
+	// cols[j] is the position of the j-th value of a row.
+	var cols []int
+	if stmt.cols == nil {
+		for i := range s.t.Columns {
+			cols = append(cols, i)
+		}
+	} else {
+		for _, name := range stmt.cols {
+			i, err := s.column(name)
+			if err != nil {
+				return nil, err
+			}
+			if slices.Contains(cols, i) {
+				return nil, fmt.Errorf("ql: column %q twice in INSERT", name)
+			}
+			cols = append(cols, i)
+		}
+		if len(cols) != len(s.t.Columns) {
+			return nil, fmt.Errorf("ql: INSERT into %s gives %d of its %d columns", s.t.Name, len(cols), len(s.t.Columns))
+		}
+	}
+	res := &Result{}
+	for _, exprs := range stmt.rows {
+		if len(exprs) != len(cols) {
+			return nil, fmt.Errorf("ql: %d values for %d columns in INSERT", len(exprs), len(cols))
+		}
+		row := make(table.Row, len(cols))
+		for j, e := range exprs {
+			if !constant(e) {
+				return nil, fmt.Errorf("ql: column in the VALUES of INSERT")
+			}
+			if row[cols[j]], err = s.value(e, nil, cols[j]); err != nil {
+				return nil, err
+			}
+		}
+		if err = s.t.Insert(tx, row); err != nil {
+			return nil, err
+		}
+		res.RowsAffected++
+	}
+	return res, nil
+}
+
+func (stmt *addColumn) exec(tx *kv.Tx, args []any) (*Result, error) {
+	s, err := open(tx, stmt.table, args)
+	if err != nil {
+		return nil, err
+	}
+	if !constant(stmt.def) {
+		return nil, fmt.Errorf("ql: column in the DEFAULT of ALTER TABLE")
+	}
+	v, err := s.eval(stmt.def, nil)
+	if err != nil {
+		return nil, err
+	}
+	def, ok := coerce(v, stmt.col.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s for column %q of %s", ErrType, typeName(v), stmt.col.Name, stmt.col.Type)
+	}
+	return &Result{}, table.AddColumn(tx, stmt.table, stmt.col, def)
+}
+
+// value returns the value of e for row, for column i.
+func (s *scope) value(e expr, row table.Row, i int) (any, error) {
+	v, err := s.eval(e, row)
+	if err != nil {
+		return nil, err
+	}
+	c, ok := coerce(v, s.t.Columns[i].Type)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s for column %q of %s", ErrType, typeName(v), s.t.Columns[i].Name, s.t.Columns[i].Type)
+	}
+	return c, nil
+}
+
+// scan calls fn with the rows that match where, until fn returns false.
+// fn must not update the transaction.
+func (s *scope) scan(tx *kv.Tx, where expr, fn func(row table.Row) bool) error {
+	if err := s.resolve(where); err != nil {
+		return err
+	}
+	p, err := s.plan(where)
+	if err != nil {
+		return err
+	}
+	var ferr error
+	each := func(row table.Row) bool {
+		var ok bool
+		if ok, ferr = s.match(where, row); ferr != nil {
+			return false
+		}
+		return !ok || fn(row)
+	}
+	if p.index == "" {
+		err = s.t.ScanRange(tx, p.r, each)
+	} else {
+		err = s.t.ScanIndex(tx, p.index, p.r, each)
+	}
+	if err != nil {
+		return err
+	}
+	return ferr
+}
+
+// rows returns the rows that match where.
+func (s *scope) rows(tx *kv.Tx, where expr) ([]table.Row, error) {
+	var rows []table.Row
+	err := s.scan(tx, where, func(row table.Row) bool {
+		rows = append(rows, row)
+		return true
+	})
+	return rows, err
+}
+
+func (stmt *selectStmt) exec(tx *kv.Tx, args []any) (*Result, error) {
+	s, err := open(tx, stmt.table, args)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{}
+	var cols []int
+	if stmt.cols == nil {
+		for i, c := range s.t.Columns {
+			res.Columns = append(res.Columns, c.Name)
+			cols = append(cols, i)
+		}
+	} else {
+		for _, name := range stmt.cols {
+			i, err := s.column(name)
+			if err != nil {
+				return nil, err
+			}
+			res.Columns = append(res.Columns, name)
+			cols = append(cols, i)
+		}
+	}
+	order := make([]int, len(stmt.order))
+	for j, o := range stmt.order {
+		if order[j], err = s.column(o.col); err != nil {
+			return nil, err
+		}
+	}
+	limit := int64(-1)
+	if stmt.limit != nil {
+		if !constant(stmt.limit) {
+			return nil, fmt.Errorf("ql: column in LIMIT")
+		}
+		v, err := s.eval(stmt.limit, nil)
+		if err != nil {
+			return nil, err
+		}
+		n, ok := v.(int64)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("%w: LIMIT of %v", ErrType, v)
+		}
+		limit = n
+	}
+	var rows []table.Row
+	if limit != 0 {
+		// Without ORDER BY, the scan can stop at the limit.
+		err = s.scan(tx, stmt.where, func(row table.Row) bool {
+			rows = append(rows, row)
+			return len(stmt.order) > 0 || int64(len(rows)) != limit
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(stmt.order) > 0 {
+		slices.SortStableFunc(rows, func(a, b table.Row) int {
+			for j, o := range stmt.order {
+				// The values of a column have its type, so compare.
+				c, _ := compare(a[order[j]], b[order[j]])
+				if o.desc {
+					c = -c
+				}
+				if c != 0 {
+					return c
+				}
+			}
+			return 0
+		})
+		if limit >= 0 && int64(len(rows)) > limit {
+			rows = rows[:limit]
+		}
+	}
+	for _, row := range rows {
+		out := make(table.Row, len(cols))
+		for j, i := range cols {
+			out[j] = row[i]
+		}
+		res.Rows = append(res.Rows, out)
+	}
+	return res, nil
+}
+
+func (stmt *updateStmt) exec(tx *kv.Tx, args []any) (*Result, error) {
+	s, err := open(tx, stmt.table, args)
+	if err != nil {
+		return nil, err
+	}
+	set := make([]int, len(stmt.set))
+	for j, a := range stmt.set {
+		if set[j], err = s.column(a.col); err != nil {
+			return nil, err
+		}
+		if err = s.resolve(a.val); err != nil {
+			return nil, err
+		}
+	}
+	rows, err := s.rows(tx, stmt.where)
+	if err != nil {
+		return nil, err
+	}
+	// A row whose primary key changes is a new row. They all go before the
+	// first comes back, so that keys can shift over each other, as with
+	// SET id = id + 1.
+	var moved []table.Row
+	for _, row := range rows {
+		updated := slices.Clone(row)
+		for j, a := range stmt.set {
+			if updated[set[j]], err = s.value(a.val, row, set[j]); err != nil {
+				return nil, err
+			}
+		}
+		same := true
+		for _, name := range s.t.PrimaryKey {
+			if c, _ := compare(row[s.cols[name]], updated[s.cols[name]]); c != 0 {
+				same = false
+			}
+		}
+		if same {
+			err = s.t.Update(tx, updated)
+		} else {
+			_, err = s.t.Delete(tx, s.key(row)...)
+			moved = append(moved, updated)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, row := range moved {
+		if err = s.t.Insert(tx, row); err != nil {
+			return nil, err
+		}
+	}
+	return &Result{RowsAffected: int64(len(rows))}, nil
+}
+
+func (stmt *deleteStmt) exec(tx *kv.Tx, args []any) (*Result, error) {
+	s, err := open(tx, stmt.table, args)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.rows(tx, stmt.where)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if _, err = s.t.Delete(tx, s.key(row)...); err != nil {
+			return nil, err
+		}
+	}
+	return &Result{RowsAffected: int64(len(rows))}, nil
+}
+
+// key returns the values of the primary key of row.
+func (s *scope) key(row table.Row) []any {
+	vals := make([]any, len(s.t.PrimaryKey))
+	for j, name := range s.t.PrimaryKey {
+		vals[j] = row[s.cols[name]]
+	}
+	return vals
+}
@@ -0,0 +1,450 @@
+package ql_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/ql"
+	"github.com/adcondev/go-database/table"
+)
+
+// open opens a new database for a test, which closes it at the end, and
+// runs the statements setup in it.
+func open(tb testing.TB, setup ...string) *kv.DB {
+	tb.Helper()
+	db, err := kv.Open(filepath.Join(tb.TempDir(), "db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	for _, q := range setup {
+		mustExec(tb, db, q)
+	}
+	return db
+}
+
+// exec runs query with args in a transaction of its own, committed if the
+// statement succeeds.
+func exec(db *kv.DB, query string, args ...any) (*ql.Result, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	res, err := ql.Exec(tx, query, args...)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return res, tx.Commit()
+}
+
+// mustExec is exec, failing the test on an error.
+func mustExec(tb testing.TB, db *kv.DB, query string, args ...any) *ql.Result {
+	tb.Helper()
+	res, err := exec(db, query, args...)
+	if err != nil {
+		tb.Fatalf("%s: %v", query, err)
+	}
+	return res
+}
+
+// rows returns the rows of a SELECT, fmt'd for comparing.
+func rows(tb testing.TB, db *kv.DB, query string, args ...any) string {
+	tb.Helper()
+	return fmt.Sprint(mustExec(tb, db, query, args...).Rows)
+}
+
+const people = `CREATE TABLE people (
+	id INT PRIMARY KEY,
+	name TEXT,
+	email VARCHAR UNIQUE,
+	age INTEGER,
+	photo BLOB,
+	INDEX by_age (age)
+)`
+
+const somePeople = `INSERT INTO people VALUES
+	(1, 'Ann', 'ann@x', 31, x'00ff'),
+	(2, 'Bob', 'bob@x', 25, x''),
+	(3, 'Cy', 'cy@x', 40, x'01'),
+	(4, 'Di', 'di@x', 25, x'02')`
+
+func TestSelect(t *testing.T) {
+	db := open(t, people)
+	if res := mustExec(t, db, somePeople); res.RowsAffected != 4 {
+		t.Errorf("INSERT of 4 rows affected %d", res.RowsAffected)
+	}
+	for _, tc := range []struct{ query, want string }{
+		{"SELECT * FROM people WHERE id = 1", "[[1 Ann ann@x 31 [0 255]]]"},
+		{"SELECT name, age FROM people", "[[Ann 31] [Bob 25] [Cy 40] [Di 25]]"},
+		{"SELECT name FROM people WHERE age = 25", "[[Bob] [Di]]"},
+		{"SELECT name FROM people WHERE age > 25 AND age <= 40", "[[Ann] [Cy]]"},
+		{"SELECT name FROM people WHERE email = 'cy@x'", "[[Cy]]"},
+		{"SELECT name FROM people WHERE name != 'Ann' AND NOT age = 25", "[[Cy]]"},
+		{"SELECT name FROM people WHERE age < 30 OR id = 3", "[[Bob] [Cy] [Di]]"},
+		{"SELECT name FROM people ORDER BY age DESC, name", "[[Cy] [Ann] [Bob] [Di]]"},
+		{"SELECT name FROM people ORDER BY name DESC LIMIT 2", "[[Di] [Cy]]"},
+		{"SELECT name FROM people WHERE 30 < age", "[[Ann] [Cy]]"},
+		{"SELECT id FROM people WHERE id * 2 + 1 = 7", "[[3]]"},
+		{"SELECT id FROM people WHERE photo = x'01'", "[[3]]"},
+		{"SELECT id FROM people WHERE age = 99", "[]"},
+		{"select id from people where ID = 1", ""},
+	} {
+		if tc.want == "" {
+			if _, err := exec(db, tc.query); !errors.Is(err, ql.ErrNoColumn) {
+				t.Errorf("%s: %v, want ErrNoColumn", tc.query, err)
+			}
+			continue
+		}
+		if got := rows(t, db, tc.query); got != tc.want {
+			t.Errorf("%s = %s, want %s", tc.query, got, tc.want)
+		}
+	}
+	res := mustExec(t, db, "SELECT age, name FROM people LIMIT 1")
+	if !reflect.DeepEqual(res.Columns, []string{"age", "name"}) {
+		t.Errorf("columns %q", res.Columns)
+	}
+	if res = mustExec(t, db, "SELECT * FROM people LIMIT 0"); len(res.Rows) != 0 || len(res.Columns) != 5 {
+		t.Errorf("SELECT * LIMIT 0 = %q, %v", res.Columns, res.Rows)
+	}
+}
+
+func TestUpdateDelete(t *testing.T) {
+	db := open(t, people, somePeople)
+	if res := mustExec(t, db, "UPDATE people SET age = age + 1, name = 'B' WHERE age = 25"); res.RowsAffected != 2 {
+		t.Errorf("UPDATE of 2 rows affected %d", res.RowsAffected)
+	}
+	if got := rows(t, db, "SELECT id, name FROM people WHERE age = 26"); got != "[[2 B] [4 B]]" {
+		t.Errorf("rows after UPDATE = %s", got)
+	}
+	// An update of the primary key moves the row.
+	mustExec(t, db, "UPDATE people SET id = 10 WHERE id = 1")
+	if got := rows(t, db, "SELECT id FROM people"); got != "[[2] [3] [4] [10]]" {
+		t.Errorf("ids after moving row 1 = %s", got)
+	}
+	if res := mustExec(t, db, "DELETE FROM people WHERE age > 30"); res.RowsAffected != 2 {
+		t.Errorf("DELETE of 2 rows affected %d", res.RowsAffected)
+	}
+	if got := rows(t, db, "SELECT id FROM people WHERE age > 0"); got != "[[2] [4]]" {
+		t.Errorf("rows after DELETE = %s", got)
+	}
+	if res := mustExec(t, db, "DELETE FROM people"); res.RowsAffected != 2 {
+		t.Errorf("DELETE of the rest affected %d", res.RowsAffected)
+	}
+	mustExec(t, db, "DROP TABLE people")
+	if _, err := exec(db, "SELECT * FROM people"); !errors.Is(err, table.ErrNoTable) {
+		t.Errorf("SELECT after DROP TABLE: %v, want ErrNoTable", err)
+	}
+}
+
+func TestFailedStatement(t *testing.T) {
+	db := open(t, people, somePeople)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err = ql.Exec(tx, "INSERT INTO people VALUES (5, 'Ed', 'ed@x', 50, x'')"); err != nil {
+		t.Fatal(err)
+	}
+	// The second row fails the statement, and the first goes with it.
+	_, err = ql.Exec(tx, "INSERT INTO people VALUES (6, 'Fy', 'fy@x', 1, x''), (7, 'Gus', 'ann@x', 1, x'')")
+	if !errors.Is(err, table.ErrUnique) {
+		t.Fatalf("INSERT of an email taken: %v, want ErrUnique", err)
+	}
+	if _, err = ql.Exec(tx, "UPDATE people SET id = 1 WHERE id = 2"); !errors.Is(err, table.ErrRowExists) {
+		t.Fatalf("UPDATE onto a primary key taken: %v, want ErrRowExists", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := rows(t, db, "SELECT id FROM people"); got != "[[1] [2] [3] [4] [5]]" {
+		t.Errorf("rows after the failed statements = %s", got)
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	db := open(t, people, somePeople)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, q := range []string{
+		"SAVEPOINT a",
+		"DELETE FROM people WHERE id = 1",
+		"SAVEPOINT b",
+		"UPDATE people SET age = 0",
+		"ROLLBACK TO SAVEPOINT b",
+		"INSERT INTO people VALUES (5, 'Ed', 'ed@x', 50, x'')",
+		"RELEASE b",
+		"SAVEPOINT c",
+		"DELETE FROM people",
+		"ROLLBACK TO c",
+		// A failed statement undoes itself alone, and c stands.
+		"INSERT INTO people VALUES (6, 'Fy', 'fy@x', 1, x''), (7, 'Gus', 'ed@x', 1, x'')",
+		"DELETE FROM people WHERE id = 2",
+		"ROLLBACK TO c",
+		"RELEASE SAVEPOINT a",
+	} {
+		if _, err = ql.Exec(tx, q); err != nil && !errors.Is(err, table.ErrUnique) {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := rows(t, db, "SELECT id, age FROM people"); got != "[[2 25] [3 40] [4 25] [5 50]]" {
+		t.Errorf("rows after the savepoints = %s", got)
+	}
+
+	if _, err = exec(db, "RELEASE a"); !errors.Is(err, kv.ErrNoSavepoint) {
+		t.Errorf("RELEASE of no savepoint: %v, want ErrNoSavepoint", err)
+	}
+	ro, err := db.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Rollback()
+	if _, err = ql.Exec(ro, "SAVEPOINT a"); !errors.Is(err, kv.ErrReadOnly) {
+		t.Errorf("SAVEPOINT in a read transaction: %v, want ErrReadOnly", err)
+	}
+	for _, q := range []string{"SAVEPOINT", "RELEASE", "ROLLBACK", "ROLLBACK a", "ROLLBACK TO"} {
+		var se *ql.SyntaxError
+		if _, err := ql.Parse(q); !errors.As(err, &se) {
+			t.Errorf("Parse(%s): %v, want a SyntaxError", q, err)
+		}
+	}
+}
+
+func TestAlter(t *testing.T) {
+	db := open(t, people, somePeople)
+	for q, change := range map[string]string{
+		"ALTER TABLE people ADD COLUMN city TEXT DEFAULT 'Oslo'": "people",
+		"ALTER TABLE people DROP photo":                          "people",
+		"CREATE UNIQUE INDEX by_name ON people (name)":           "people",
+		"DROP INDEX by_age ON people":                            "",
+		"SELECT * FROM people":                                   "",
+	} {
+		s, err := ql.Parse(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.SchemaChange(); got != change {
+			t.Errorf("SchemaChange of %s = %q, want %q", q, got, change)
+		}
+	}
+	// Each runs its change to the end before the next starts.
+	for _, s := range []struct {
+		q    string
+		args []any
+	}{
+		{"ALTER TABLE people ADD COLUMN city TEXT DEFAULT 'Oslo'", nil},
+		{"ALTER TABLE people ADD n INT DEFAULT 2 * ?", []any{int64(21)}},
+		{"ALTER TABLE people DROP COLUMN photo", nil},
+		{"CREATE UNIQUE INDEX by_name ON people (name)", nil},
+	} {
+		mustExec(t, db, s.q, s.args...)
+		if err := table.Complete(db, "people"); err != nil {
+			t.Fatalf("%s: %v", s.q, err)
+		}
+	}
+	mustExec(t, db, "DROP INDEX by_age ON people")
+	mustExec(t, db, "INSERT INTO people VALUES (5, 'Ed', 'ed@x', 50, 'Rome', 1)")
+	want := "[[1 Ann ann@x 31 Oslo 42] [2 Bob bob@x 25 Oslo 42] [3 Cy cy@x 40 Oslo 42] [4 Di di@x 25 Oslo 42] [5 Ed ed@x 50 Rome 1]]"
+	if got := rows(t, db, "SELECT * FROM people"); got != want {
+		t.Errorf("rows after the changes\n%s\nwant\n%s", got, want)
+	}
+	if _, err := exec(db, "INSERT INTO people VALUES (6, 'Ed', 'ed2@x', 1, '', 0)"); !errors.Is(err, table.ErrUnique) {
+		t.Errorf("INSERT of a name taken: %v, want ErrUnique", err)
+	}
+	tx, err := db.BeginRead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	p, err := table.Open(tx, "people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(p.Indexes) != "[{email [email] true} {by_name [name] true}]" {
+		t.Errorf("indexes after the changes: %v", p.Indexes)
+	}
+}
+
+func TestAlterErrors(t *testing.T) {
+	db := open(t, people)
+	for q, want := range map[string]error{
+		"ALTER TABLE people ADD city TEXT DEFAULT name": nil,
+		"ALTER TABLE people ADD n INT DEFAULT 'x'":      ql.ErrType,
+		"ALTER TABLE people DROP id":                    table.ErrSchema,
+		"ALTER TABLE none DROP id":                      table.ErrNoTable,
+		"CREATE INDEX by_x ON people (x)":               table.ErrSchema,
+		"DROP INDEX by_x ON people":                     table.ErrNoIndex,
+	} {
+		_, err := exec(db, q)
+		if err == nil || want != nil && !errors.Is(err, want) {
+			t.Errorf("%s: %v, want %v", q, err, want)
+		}
+	}
+	for _, q := range []string{
+		"ALTER TABLE people ADD n INT",
+		"ALTER TABLE people RENAME TO p",
+		"CREATE INDEX by_x people (x)",
+		"DROP INDEX by_age",
+	} {
+		var se *ql.SyntaxError
+		if _, err := ql.Parse(q); !errors.As(err, &se) {
+			t.Errorf("Parse(%s): %v, want a SyntaxError", q, err)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	db := open(t, people)
+	s, err := ql.Parse("INSERT INTO people (photo, age, email, name, id) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.NumParams() != 5 || s.ReadOnly() {
+		t.Errorf("NumParams = %d, ReadOnly = %v", s.NumParams(), s.ReadOnly())
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Exec(tx, []byte{1}, 20, "a@x", "A", int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Exec(tx, []byte{1}, 20, "b@x", "B"); !errors.Is(err, ql.ErrArgs) {
+		t.Errorf("Exec with an argument short: %v, want ErrArgs", err)
+	}
+	if _, err = s.Exec(tx, []byte{1}, 20, "b@x", "B", 2.5); !errors.Is(err, ql.ErrType) {
+		t.Errorf("Exec with a float: %v, want ErrType", err)
+	}
+	if _, err = s.Exec(tx, []byte{1}, "20", "b@x", "B", 2); !errors.Is(err, ql.ErrType) {
+		t.Errorf("Exec with a string for an INT: %v, want ErrType", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := rows(t, db, "SELECT name FROM people WHERE age = ? AND email = ?", 20, "a@x"); got != "[[A]]" {
+		t.Errorf("SELECT with arguments = %s", got)
+	}
+	if s, _ = ql.Parse("SELECT * FROM people;"); !s.ReadOnly() || s.NumParams() != 0 {
+		t.Errorf("SELECT: NumParams = %d, ReadOnly = %v", s.NumParams(), s.ReadOnly())
+	}
+}
+
+func TestExpressions(t *testing.T) {
+	db := open(t, "CREATE TABLE t (k INT PRIMARY KEY, s TEXT)", "INSERT INTO t VALUES (1, 'it''s')")
+	for _, tc := range []struct{ where, want string }{
+		{"s = 'it''s'", "[[1]]"},
+		{"1 + 2 * 3 = 7", "[[1]]"},
+		{"(1 + 2) * 3 = 9", "[[1]]"},
+		{"7 / 2 = 3 AND -7 / 2 = -3", "[[1]]"},
+		{"k - -1 = 2", "[[1]]"},
+		{"NOT (k = 1 OR k = 2)", "[]"},
+		{"k <> 1", "[]"},
+		{"s < 'j' AND s >= 'it'", "[[1]]"},
+	} {
+		if got := rows(t, db, "SELECT k FROM t WHERE "+tc.where); got != tc.want {
+			t.Errorf("WHERE %s = %s, want %s", tc.where, got, tc.want)
+		}
+	}
+	for _, tc := range []struct {
+		where string
+		want  error
+	}{
+		{"k / 0 = 1", ql.ErrDivide},
+		{"k = 'one'", ql.ErrType},
+		{"s + 1 = 2", ql.ErrType},
+		{"k", ql.ErrType},
+		{"nope = 1", ql.ErrNoColumn},
+	} {
+		if _, err := exec(db, "SELECT k FROM t WHERE "+tc.where); !errors.Is(err, tc.want) {
+			t.Errorf("WHERE %s: %v, want %v", tc.where, err, tc.want)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	for _, tc := range []struct {
+		query  string
+		offset int
+	}{
+		{"", 0},
+		{"SELEC * FROM t", 0},
+		{"SELECT * FROM", 13},
+		{"SELECT * FROM t WHERE", 21},
+		{"SELECT * FROM t LIMIT", 21},
+		{"INSERT INTO t VALUES (1, 'open", 25},
+		{"CREATE TABLE t (a FLOAT)", 18},
+		{"SELECT * FROM t; SELECT", 17},
+		{"SELECT * FROM t WHERE a = 1 +", 29},
+		{"UPDATE t SET a WHERE a = 1", 15},
+	} {
+		_, err := ql.Parse(tc.query)
+		var se *ql.SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("Parse(%q): %v, want a SyntaxError", tc.query, err)
+		} else if se.Offset != tc.offset {
+			t.Errorf("Parse(%q): %v, want it at offset %d", tc.query, err, tc.offset)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	db := open(t, people)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ql.Parse("INSERT INTO people VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5000 {
+		if _, err = s.Exec(tx, i, fmt.Sprint("p", i), fmt.Sprintf("p%d@x", i), i%1000, make([]byte, 200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// reads returns how many pages the query reads, and its rows.
+	reads := func(query string) (uint64, string) {
+		tx, err := db.BeginRead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		before := db.Stats().Reads
+		res, err := ql.Exec(tx, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db.Stats().Reads - before, fmt.Sprint(res.Rows)
+	}
+	full, _ := reads("SELECT id FROM people WHERE name = 'p77'")
+	for _, tc := range []struct{ query, want string }{
+		{"SELECT id FROM people WHERE id = 4321", "[[4321]]"},
+		{"SELECT id FROM people WHERE id >= 4998", "[[4998] [4999]]"},
+		{"SELECT id FROM people WHERE id > 10 AND id < 13", "[[11] [12]]"},
+		{"SELECT id FROM people WHERE email = 'p77@x'", "[[77]]"},
+		{"SELECT id FROM people WHERE 99 = age AND id < 3000", "[[99] [1099] [2099]]"},
+		{"SELECT id FROM people WHERE id < 3000 AND age = 99 AND age > 98", "[[99] [1099] [2099]]"},
+	} {
+		n, got := reads(tc.query)
+		if got != tc.want {
+			t.Errorf("%s = %s, want %s", tc.query, got, tc.want)
+		}
+		if n*5 > full {
+			t.Errorf("%s read %d pages, a full scan %d", tc.query, n, full)
+		}
+	}
+}
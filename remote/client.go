@@ -0,0 +1,236 @@
+package remote
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// scanBatch is how many key-values Scan asks the server for at a time.
+const scanBatch = 1000
+
+// Client is a connection to a server. Its methods are safe for concurrent
+// use, but run one at a time. While a Tx of the client is open, its own
+// Get, Set, Del, Scan and Begin fail with ErrTxOpen: statements of the
+// connection run in the transaction, so they go through the Tx.
+type Client struct {
+	mu   sync.Mutex // held by a call
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	tx   *Tx   // the transaction open, if any
+	err  error // what broke the connection
+}
+
+// Dial connects to the server at the TCP address addr.
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient returns a client of the server at the other end of conn.
+func NewClient(conn net.Conn) *Client {
+	return &Client{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+// call sends a request from tx, nil for the client itself, and returns the
+// fields of the response, or the error it stands for.
+func (c *Client) call(tx *Tx, op byte, fields ...[]byte) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.err != nil:
+		return nil, c.err
+	case tx != nil && tx.done:
+		return nil, kv.ErrTxClosed
+	case tx == nil && c.tx != nil:
+		return nil, ErrTxOpen
+	}
+	code, out, err := c.roundTrip(op, fields)
+	if err != nil {
+		// The reply may never come, or come late: the connection is
+		// out of step for good.
+		c.err = err
+		c.conn.Close()
+		return nil, err
+	}
+	switch op {
+	case opBegin:
+		if code == codeOK {
+			c.tx = &Tx{c: c, writable: fields[0][0] == 1}
+		}
+	case opCommit, opRollback:
+		// Either ends the transaction on the server, success or not.
+		tx.done, c.tx = true, nil
+	}
+	if code == codeOK {
+		return out, nil
+	}
+	if err, ok := codeErrors[code]; ok {
+		return nil, err
+	}
+	if code == codeErr && len(out) == 1 {
+		return nil, fmt.Errorf("%w: %s", ErrServer, out[0])
+	}
+	return nil, fmt.Errorf("%w: response code %d", ErrProtocol, code)
+}
+
+func (c *Client) roundTrip(op byte, fields [][]byte) (byte, [][]byte, error) {
+	if err := writeMessage(c.w, maxMessage, op, fields...); err != nil {
+		return 0, nil, err
+	}
+	if err := c.w.Flush(); err != nil {
+		return 0, nil, err
+	}
+	return readMessage(c.r, maxMessage)
+}
+
+// fields checks that a response has n fields.
+func fields(out [][]byte, n int) error {
+	if len(out) != n {
+		return fmt.Errorf("%w: %d fields, not %d", ErrProtocol, len(out), n)
+	}
+	return nil
+}
+
+// Close closes the connection. The server rolls back a transaction left
+// open.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = kv.ErrClosed
+	}
+	return c.conn.Close()
+}
+
+// Get returns the value stored under key, as kv.DB.Get does.
+func (c *Client) Get(key []byte) ([]byte, error) { return get(c, nil, key) }
+
+// Set stores val under key, as kv.DB.Set does.
+func (c *Client) Set(key, val []byte) error { return set(c, nil, key, val) }
+
+// Del removes key and reports whether it was there, as kv.DB.Del does.
+func (c *Client) Del(key []byte) (bool, error) { return del(c, nil, key) }
+
+// Scan calls fn with the key-values in [lo, hi) in order, as kv.DB.Scan
+// does, until fn returns false. It fetches them a batch at a time, and
+// each batch reads the last commit then: outside a transaction, a scan
+// that runs alongside updates may see some and not others.
+func (c *Client) Scan(lo, hi []byte, fn func(key, val []byte) bool) error {
+	return scan(c, nil, lo, hi, fn)
+}
+
+// Begin starts a write transaction on the server; see kv.DB.Begin.
+func (c *Client) Begin() (*Tx, error) { return c.begin(true) }
+
+// BeginRead starts a read transaction on the server; see kv.DB.BeginRead.
+func (c *Client) BeginRead() (*Tx, error) { return c.begin(false) }
+
+func (c *Client) begin(writable bool) (*Tx, error) {
+	if _, err := c.call(nil, opBegin, flag(writable)); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tx, nil
+}
+
+// Tx is a transaction on the server, as kv.Tx is; its methods run their
+// kv.Tx counterparts there. A Tx must be ended, or the client closed: a
+// write transaction holds off the writers of every other connection.
+type Tx struct {
+	c        *Client
+	writable bool
+	done     bool
+}
+
+// Writable reports whether tx is a write transaction.
+func (tx *Tx) Writable() bool { return tx.writable }
+
+// Get is kv.Tx.Get.
+func (tx *Tx) Get(key []byte) ([]byte, error) { return get(tx.c, tx, key) }
+
+// Set is kv.Tx.Set.
+func (tx *Tx) Set(key, val []byte) error { return set(tx.c, tx, key, val) }
+
+// Del is kv.Tx.Del.
+func (tx *Tx) Del(key []byte) (bool, error) { return del(tx.c, tx, key) }
+
+// Scan is Client.Scan within the transaction, which reads one commit
+// throughout.
+func (tx *Tx) Scan(lo, hi []byte, fn func(key, val []byte) bool) error {
+	return scan(tx.c, tx, lo, hi, fn)
+}
+
+// Commit is kv.Tx.Commit. Whether it succeeds or not, the transaction is
+// over, unless the connection broke on the way.
+func (tx *Tx) Commit() error {
+	_, err := tx.c.call(tx, opCommit)
+	return err
+}
+
+// Rollback is kv.Tx.Rollback.
+func (tx *Tx) Rollback() error {
+	_, err := tx.c.call(tx, opRollback)
+	return err
+}
+
+func get(c *Client, tx *Tx, key []byte) ([]byte, error) {
+	out, err := c.call(tx, opGet, key)
+	if err == nil {
+		err = fields(out, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out[0], nil
+}
+
+func set(c *Client, tx *Tx, key, val []byte) error {
+	if val == nil {
+		val = []byte{}
+	}
+	_, err := c.call(tx, opSet, key, val)
+	return err
+}
+
+func del(c *Client, tx *Tx, key []byte) (bool, error) {
+	out, err := c.call(tx, opDel, key)
+	if err == nil {
+		err = fields(out, 1)
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(out[0]) == 1 && out[0][0] == 1, nil
+}
+
+func scan(c *Client, tx *Tx, lo, hi []byte, fn func(key, val []byte) bool) error {
+	for {
+		out, err := c.call(tx, opScan, lo, hi, uvarint(scanBatch))
+		if err != nil {
+			return err
+		}
+		if len(out)%2 != 1 || len(out[0]) != 1 {
+			return fmt.Errorf("%w: a scan of %d fields", ErrProtocol, len(out))
+		}
+		more, kvs := out[0][0] == 1, out[1:]
+		for i := 0; i < len(kvs); i += 2 {
+			if !fn(kvs[i], kvs[i+1]) {
+				return nil
+			}
+		}
+		if !more || len(kvs) == 0 {
+			return nil
+		}
+		// Go on after the last key: the least key greater than it.
+		lo = append(kvs[len(kvs)-2], 0)
+	}
+}
@@ -0,0 +1,160 @@
+// Package remote serves a kv.DB over the network (Serve), for command
+// godb-server, and is the client of such a server (Dial), so that other
+// processes and machines can share one database: a database file has a
+// single writing process, which the server is.
+//
+// A client is a connection, and a connection runs one thing at a time:
+// Get, Set, Del and Scan, each in a transaction of its own, or a
+// transaction begun with Begin or BeginRead, which they run in until it
+// ends. A connection that drops rolls its transaction back. As with
+// kv.DB.Begin, one write transaction is open at a time, across every
+// connection, and Begin waits for it to end.
+//
+// The protocol is messages, both ways, of
+//
+//	| length | body |
+//	|   4B   |      |
+//
+// with the length big-endian. The body of a request is an op, the body of
+// a response a code (see codes), and either is followed by fields, each
+//
+//	| len(field)+1 | field |
+//	|   uvarint    |       |
+//
+// where a length of 0, with nothing after it, is a nil field. The fields
+// of each op are in server.go.
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/adcondev/go-database/btree"
+	"github.com/adcondev/go-database/kv"
+)
+
+var (
+	// ErrServer wraps the errors that come back from the server and are
+	// not one of the kv errors it passes on as such (see codes).
+	ErrServer = errors.New("remote: server error")
+
+	ErrTxOpen   = errors.New("remote: a transaction is open on the connection")
+	ErrProtocol = errors.New("remote: protocol violation")
+)
+
+const (
+	opGet = iota + 1
+	opSet
+	opDel
+	opScan
+	opBegin
+	opCommit
+	opRollback
+)
+
+// The codes of responses. Those past codeErr stand for the kv error of
+// codeErrors, which the client returns as it is.
+const (
+	codeOK = iota
+	codeErr
+	codeNotFound
+	codeReadOnly
+	codeTxClosed
+	codeClosed
+)
+
+var codeErrors = map[byte]error{
+	codeNotFound: kv.ErrKeyNotFound,
+	codeReadOnly: kv.ErrReadOnly,
+	codeTxClosed: kv.ErrTxClosed,
+	codeClosed:   kv.ErrClosed,
+}
+
+// maxMessage bounds the length of a message: room for the largest value
+// kv takes by default, and its key. A server takes requests only up to
+// Options.MaxMessage.
+const maxMessage = btree.DefaultValueLimit + 1<<16
+
+// errTooLarge is what writeMessage fails with on a message over maxMessage.
+var errTooLarge = fmt.Errorf("%w: message too large", ErrProtocol)
+
+// writeMessage writes a message of head and fields to w, unflushed, if it
+// is no longer than max.
+func writeMessage(w *bufio.Writer, max int, head byte, fields ...[]byte) error {
+	n := 1
+	for _, f := range fields {
+		n += binary.MaxVarintLen64 + len(f)
+	}
+	body := make([]byte, 4, 4+n)
+	body = append(body, head)
+	for _, f := range fields {
+		if f == nil {
+			body = append(body, 0)
+			continue
+		}
+		body = binary.AppendUvarint(body, uint64(len(f))+1)
+		body = append(body, f...)
+	}
+	if len(body)-4 > max {
+		return fmt.Errorf("%w: %d bytes", errTooLarge, len(body)-4)
+	}
+	binary.BigEndian.PutUint32(body, uint32(len(body)-4))
+	_, err := w.Write(body)
+	return err
+}
+
+// readMessage reads a message of up to max bytes from r and returns its
+// head and fields.
+func readMessage(r *bufio.Reader, max int) (byte, [][]byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(n[:])
+	if size == 0 || uint64(size) > uint64(max) {
+		return 0, nil, fmt.Errorf("%w: a message of %d bytes", ErrProtocol, size)
+	}
+	// The buffer grows as the bytes come in, not to the length the other
+	// end claims: the client of a server need not be trusted.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(size)); err != nil {
+		return 0, nil, unexpected(err)
+	}
+	body := buf.Bytes()
+	head, rest := body[0], body[1:]
+	var fields [][]byte
+	for len(rest) > 0 {
+		l, k := binary.Uvarint(rest)
+		if k <= 0 || l > uint64(len(rest)-k)+1 {
+			return 0, nil, fmt.Errorf("%w: a field cut short", ErrProtocol)
+		}
+		rest = rest[k:]
+		if l == 0 {
+			fields = append(fields, nil)
+			continue
+		}
+		fields = append(fields, rest[:l-1:l-1])
+		rest = rest[l-1:]
+	}
+	return head, fields, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func uvarint(n uint64) []byte { return binary.AppendUvarint(nil, n) }
+
+func flag(b bool) []byte {
+	if b {
+		return []byte{1}
+	}
+	return []byte{0}
+}
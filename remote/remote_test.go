@@ -0,0 +1,284 @@
+package remote_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/remote"
+)
+
+// serve serves a new database with o on a port of the loopback interface,
+// until the test ends, and returns it and the address.
+func serve(tb testing.TB, o remote.Options) (*kv.DB, string) {
+	tb.Helper()
+	db, err := kv.Open(filepath.Join(tb.TempDir(), "db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { l.Close() })
+	go o.Serve(l, db)
+	return db, l.Addr().String()
+}
+
+// dial returns a client of the server at addr, closed at the end of the
+// test.
+func dial(tb testing.TB, addr string) *remote.Client {
+	tb.Helper()
+	c, err := remote.Dial(addr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { c.Close() })
+	return c
+}
+
+// scanAll returns the keys that scan, of a client or a Tx, finds in
+// [lo, hi); an empty hi goes to the end.
+func scanAll(tb testing.TB, scan func(lo, hi []byte, fn func(k, v []byte) bool) error, lo, hi string) []string {
+	tb.Helper()
+	var keys []string
+	var hiKey []byte
+	if hi != "" {
+		hiKey = []byte(hi)
+	}
+	if err := scan([]byte(lo), hiKey, func(k, v []byte) bool {
+		keys = append(keys, string(k))
+		return true
+	}); err != nil {
+		tb.Fatal(err)
+	}
+	return keys
+}
+
+func TestClient(t *testing.T) {
+	_, addr := serve(t, remote.Options{})
+	c := dial(t, addr)
+	if err := c.Set([]byte("k"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set([]byte("empty"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get([]byte("k")); err != nil || string(v) != "v" {
+		t.Errorf("Get(k) = %q, %v", v, err)
+	}
+	if v, err := c.Get([]byte("empty")); err != nil || v == nil || len(v) != 0 {
+		t.Errorf("Get(empty) = %#v, %v; want an empty value", v, err)
+	}
+	if _, err := c.Get([]byte("nope")); err != kv.ErrKeyNotFound {
+		t.Errorf("Get of a missing key: %v, want ErrKeyNotFound", err)
+	}
+	for _, want := range []bool{true, false} {
+		if deleted, err := c.Del([]byte("k")); deleted != want || err != nil {
+			t.Errorf("Del(k) = %v, %v; want %v", deleted, err, want)
+		}
+	}
+	// Other errors of the server come back as ErrServer.
+	if err := c.Set([]byte{}, []byte("v")); !errors.Is(err, remote.ErrServer) {
+		t.Errorf("Set of an empty key: %v, want ErrServer", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get([]byte("k")); err != kv.ErrClosed {
+		t.Errorf("Get after Close: %v, want ErrClosed", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	db, addr := serve(t, remote.Options{})
+	// More than the client asks for at a time.
+	var want []string
+	tx, _ := db.Begin()
+	for i := range 2500 {
+		k := fmt.Sprintf("k%04d", i)
+		tx.Set([]byte(k), []byte("v"))
+		want = append(want, k)
+	}
+	tx.Set([]byte("other"), nil)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	c := dial(t, addr)
+	if got := scanAll(t, c.Scan, "k", "l"); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Scan returned %d keys, want %d", len(got), len(want))
+	}
+	if got := scanAll(t, c.Scan, "k2499", ""); fmt.Sprint(got) != "[k2499 other]" {
+		t.Errorf("Scan to the end = %v", got)
+	}
+	n := 0
+	if err := c.Scan(nil, nil, func(k, v []byte) bool { n++; return n < 1500 }); err != nil || n != 1500 {
+		t.Errorf("Scan stopped after %d keys, %v; want 1500", n, err)
+	}
+}
+
+func TestTx(t *testing.T) {
+	_, addr := serve(t, remote.Options{})
+	c, other := dial(t, addr), dial(t, addr)
+	tx, err := c.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Writable() {
+		t.Error("Begin gave a read transaction")
+	}
+	if _, err = c.Get([]byte("a")); err != remote.ErrTxOpen {
+		t.Errorf("Client.Get with a transaction open: %v, want ErrTxOpen", err)
+	}
+	if _, err = c.Begin(); err != remote.ErrTxOpen {
+		t.Errorf("second Begin: %v, want ErrTxOpen", err)
+	}
+	tx.Set([]byte("a"), []byte("1"))
+	tx.Set([]byte("b"), []byte("2"))
+	if v, err := tx.Get([]byte("a")); err != nil || string(v) != "1" {
+		t.Errorf("tx.Get(a) = %q, %v", v, err)
+	}
+	if got := scanAll(t, tx.Scan, "", ""); fmt.Sprint(got) != "[a b]" {
+		t.Errorf("tx.Scan = %v", got)
+	}
+	if _, err = other.Get([]byte("a")); err != kv.ErrKeyNotFound {
+		t.Errorf("Get of an uncommitted key from another connection: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != kv.ErrTxClosed {
+		t.Errorf("second Commit: %v, want ErrTxClosed", err)
+	}
+	if v, err := other.Get([]byte("a")); err != nil || string(v) != "1" {
+		t.Errorf("Get(a) after Commit = %q, %v", v, err)
+	}
+
+	// A rolled back transaction leaves nothing, and a read one takes no
+	// updates.
+	if tx, err = c.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	tx.Del([]byte("a"))
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if tx, err = c.BeginRead(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Set([]byte("c"), nil); err != kv.ErrReadOnly {
+		t.Errorf("Set in a read transaction: %v, want ErrReadOnly", err)
+	}
+	if v, err := tx.Get([]byte("a")); err != nil || string(v) != "1" {
+		t.Errorf("Get(a) after the rollback = %q, %v", v, err)
+	}
+	tx.Rollback()
+
+	// A connection that drops with a write transaction open lets the
+	// others write.
+	if _, err = c.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	done := make(chan error, 1)
+	go func() { done <- other.Set([]byte("after"), nil) }()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the transaction of a closed connection holds off the writers")
+	}
+}
+
+func TestMaxMessage(t *testing.T) {
+	db, addr := serve(t, remote.Options{MaxMessage: 1024})
+	db.Set([]byte("large"), bytes.Repeat([]byte("v"), 2000))
+	for i := range 20 {
+		db.Set(fmt.Appendf(nil, "k%02d", i), bytes.Repeat([]byte("v"), 300))
+	}
+	c := dial(t, addr)
+	// A response too large comes back as an error.
+	if _, err := c.Get([]byte("large")); !errors.Is(err, remote.ErrServer) {
+		t.Errorf("Get of a value over MaxMessage: %v, want ErrServer", err)
+	}
+	// Scan fits each response within it.
+	if got := scanAll(t, c.Scan, "k", "l"); len(got) != 20 {
+		t.Errorf("Scan returned %d keys, want 20", len(got))
+	}
+	// A request too large breaks the connection.
+	if err := c.Set([]byte("k"), bytes.Repeat([]byte("v"), 2000)); err == nil {
+		t.Error("Set of a value over MaxMessage succeeded")
+	}
+	if _, err := c.Get([]byte("k00")); err == nil {
+		t.Error("Get after the connection broke succeeded")
+	}
+	if v, err := dial(t, addr).Get([]byte("k00")); err != nil || len(v) != 300 {
+		t.Errorf("Get on a new connection = %d bytes, %v", len(v), err)
+	}
+}
+
+// message returns a message of the protocol: the body, after its length.
+func message(body ...byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(body))), body...)
+}
+
+func TestProtocol(t *testing.T) {
+	db, err := kv.Open(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for name, tc := range map[string]struct {
+		req  []byte
+		resp bool // whether the server responds and goes on
+	}{
+		"unknown op":      {message(99), true},
+		"too few fields":  {message(1), true},
+		"empty message":   {message(), false},
+		"field cut short": {message(1, 10, 'k'), false},
+		"claims 1 GiB":    {binary.BigEndian.AppendUint32(nil, 1<<30), false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			served := make(chan error, 1)
+			go func() { served <- remote.ServeConn(server, db) }()
+			client.SetDeadline(time.Now().Add(5 * time.Second))
+			if _, err := client.Write(tc.req); err != nil {
+				t.Fatal(err)
+			}
+			if !tc.resp {
+				if err := <-served; !errors.Is(err, remote.ErrProtocol) {
+					t.Errorf("ServeConn = %v, want ErrProtocol", err)
+				}
+				return
+			}
+			var n [4]byte
+			if _, err := io.ReadFull(client, n[:]); err != nil {
+				t.Fatal(err)
+			}
+			resp := make([]byte, binary.BigEndian.Uint32(n[:]))
+			if _, err := io.ReadFull(client, resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp[0] != 1 || !strings.Contains(string(resp), "protocol violation") {
+				t.Errorf("response %q, want an error", resp)
+			}
+			client.Close()
+			if err := <-served; err != io.EOF {
+				t.Errorf("ServeConn after the client hung up = %v, want EOF", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// The requests and what the server responds to them with, on success:
+//
+//	opGet key              → value
+//	opSet key value        → nothing
+//	opDel key              → deleted, 1 byte
+//	opScan lo hi limit     → more, 1 byte, then key, value, ...
+//	opBegin writable       → nothing
+//	opCommit, opRollback   → nothing
+//
+// A nil hi has Scan go to the end of the keys; limit is a uvarint, and the
+// server sends at most that many key-values, fewer if they would run over
+// scanBytes or the largest message, with more set if there are others
+// after them; it sends one at least. The flags are 1 for true and 0 for
+// false.
+
+// scanBytes is about how many bytes of key-values a Scan response holds at
+// most.
+const scanBytes = 1 << 20
+
+// DefaultMaxMessage is the MaxMessage of the zero Options.
+const DefaultMaxMessage = 4 << 20
+
+// Options tunes how a server serves. The zero value is what Serve uses.
+type Options struct {
+	// MaxMessage is the length of the longest message the server takes,
+	// and sends, in bytes: it bounds what a request can make the server
+	// read, the key and value of a Set among them, and what Get and Scan
+	// can return. A request longer than that breaks the connection; a
+	// response, such as a larger value, comes back as an error. Zero means
+	// DefaultMaxMessage; the most is about btree.DefaultValueLimit.
+	MaxMessage int
+}
+
+func (o Options) maxMessage() int {
+	if o.MaxMessage <= 0 {
+		return DefaultMaxMessage
+	}
+	return min(o.MaxMessage, maxMessage)
+}
+
+// Serve accepts connections on l and serves db on each, until accepting
+// fails; see ServeConn.
+func Serve(l net.Listener, db *kv.DB) error {
+	return Options{}.Serve(l, db)
+}
+
+// ServeConn serves db on conn until the client hangs up or breaks the
+// protocol, then rolls back the transaction left open, if any, and closes
+// conn.
+func ServeConn(conn net.Conn, db *kv.DB) error {
+	return Options{}.ServeConn(conn, db)
+}
+
+// Serve is Serve honouring the options in o.
+func (o Options) Serve(l net.Listener, db *kv.DB) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go o.ServeConn(conn, db)
+	}
+}
+
+// ServeConn is ServeConn honouring the options in o.
+func (o Options) ServeConn(conn net.Conn, db *kv.DB) error {
+	s := &session{db: db, max: o.maxMessage()}
+	defer conn.Close()
+	defer s.end()
+	r, w := bufio.NewReader(conn), bufio.NewWriter(conn)
+	for {
+		op, fields, err := readMessage(r, s.max)
+		if err != nil {
+			return err
+		}
+		out, err := s.do(op, fields)
+		code := byte(codeOK)
+		if err != nil {
+			code, out = codeErr, [][]byte{[]byte(err.Error())}
+			for c, e := range codeErrors {
+				if errors.Is(err, e) {
+					code, out = c, nil
+				}
+			}
+		}
+		err = writeMessage(w, s.max, code, out...)
+		if errors.Is(err, errTooLarge) {
+			err = writeMessage(w, s.max, codeErr, []byte(err.Error()))
+		}
+		if err != nil {
+			return err
+		}
+		if err = w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// session is what a connection is up to: the transaction it has open.
+type session struct {
+	db  *kv.DB
+	max int // Options.MaxMessage
+	tx  *kv.Tx
+}
+
+// arity is how many fields each op takes.
+var arity = map[byte]int{
+	opGet:      1,
+	opSet:      2,
+	opDel:      1,
+	opScan:     3,
+	opBegin:    1,
+	opCommit:   0,
+	opRollback: 0,
+}
+
+// do runs a request and returns the fields of its response.
+func (s *session) do(op byte, f [][]byte) ([][]byte, error) {
+	if n, ok := arity[op]; !ok || n != len(f) {
+		return nil, ErrProtocol
+	}
+	switch op {
+	case opGet:
+		var val []byte
+		var err error
+		if s.tx != nil {
+			val, err = s.tx.Get(f[0])
+		} else {
+			val, err = s.db.Get(f[0])
+		}
+		return [][]byte{val}, err
+	case opSet:
+		if s.tx != nil {
+			return nil, s.tx.Set(f[0], f[1])
+		}
+		return nil, s.db.Set(f[0], f[1])
+	case opDel:
+		var deleted bool
+		var err error
+		if s.tx != nil {
+			deleted, err = s.tx.Del(f[0])
+		} else {
+			deleted, err = s.db.Del(f[0])
+		}
+		return [][]byte{flag(deleted)}, err
+	case opScan:
+		return s.scan(f[0], f[1], f[2])
+	case opBegin:
+		if s.tx != nil {
+			return nil, ErrTxOpen
+		}
+		var err error
+		if bytes.Equal(f[0], flag(true)) {
+			s.tx, err = s.db.Begin()
+		} else {
+			s.tx, err = s.db.BeginRead()
+		}
+		return nil, err
+	case opCommit, opRollback:
+		if s.tx == nil {
+			return nil, kv.ErrTxClosed
+		}
+		tx := s.tx
+		s.tx = nil
+		if op == opCommit {
+			return nil, tx.Commit()
+		}
+		return nil, tx.Rollback()
+	}
+	panic("unreachable")
+}
+
+func (s *session) scan(lo, hi, limit []byte) ([][]byte, error) {
+	max, k := binary.Uvarint(limit)
+	if k <= 0 || max == 0 {
+		return nil, ErrProtocol
+	}
+	out := [][]byte{flag(false)}
+	// The response is the code and the flag, then the pairs with the
+	// lengths of their fields.
+	budget := min(scanBytes, s.max-1-2)
+	size := 0
+	fn := func(key, val []byte) bool {
+		n := 2*binary.MaxVarintLen64 + len(key) + len(val)
+		if pairs := uint64(len(out)-1) / 2; pairs == max || pairs > 0 && size+n > budget {
+			out[0] = flag(true)
+			return false
+		}
+		out = append(out, bytes.Clone(key), bytes.Clone(val))
+		size += n
+		return true
+	}
+	var err error
+	if s.tx != nil {
+		err = s.tx.Scan(lo, hi, fn)
+	} else {
+		err = s.db.Scan(lo, hi, fn)
+	}
+	return out, err
+}
+
+// end rolls back the transaction left open.
+func (s *session) end() {
+	if s.tx != nil {
+		s.tx.Rollback()
+	}
+}
@@ -0,0 +1,385 @@
+package table
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// A schema change of a table with rows in it goes in two parts, so that
+// no transaction has to rewrite the table whole. AddColumn, DropColumn
+// and CreateIndex change the catalog entry of the table to the new schema,
+// with a note of the change under way; then each call of Step takes the
+// next batch of rows, in primary-key order, to their new form, and moves a
+// cursor in the note past them. The last step drops the note. In between,
+// the rows before the cursor are in the new form and the others in the
+// old one, and the table reads and writes each in its own:
+//
+//   - adding a column, a row without it has the default, and every row
+//     written has it;
+//   - dropping a column, the rows after the cursor keep it, with a zero
+//     for every row written there, and the schema is without it at once;
+//   - creating an index, the rows before the cursor have entries, which
+//     Insert, Update and Delete keep, and the index is in the schema only
+//     once it has them all.
+//
+// A table has one change under way at most, and a change in the columns
+// makes the tables opened before it fail with ErrChanged.
+
+var (
+	ErrBusy    = errors.New("table: another schema change of the table is under way")
+	ErrChanged = errors.New("table: columns changed since the table was opened")
+)
+
+// The kinds of change of catalogChange.
+const (
+	addColumn   = "addColumn"
+	dropColumn  = "dropColumn"
+	createIndex = "createIndex"
+)
+
+// catalogChange is what the catalog holds of a schema change under way.
+type catalogChange struct {
+	Kind   string `json:"kind"`
+	Column column `json:"column"` // added or dropped
+
+	Default  []byte `json:"default,omitempty"`  // of the column added, value-encoded
+	Position int    `json:"position,omitempty"` // of the column dropped, in the old schema
+
+	Index *catalogIndex `json:"index,omitempty"` // being created
+
+	// Cursor is the primary key, encoded, of the first row the change
+	// has not done.
+	Cursor []byte `json:"cursor,omitempty"`
+}
+
+// change is a schema change under way.
+type change struct {
+	catalogChange
+	old   *Table // of a drop: the table with the column, no index
+	index *index // being created
+}
+
+// newChange returns the change c of t, as the catalog has it.
+func (t *Table) newChange(c catalogChange) (*change, error) {
+	ch := &change{catalogChange: c}
+	switch c.Kind {
+	case addColumn:
+		last := t.Columns[len(t.Columns)-1]
+		if last.Name != c.Column.Name || slices.Contains(t.key, len(t.Columns)-1) {
+			return nil, fmt.Errorf("column %q added is not the last of the table", c.Column.Name)
+		}
+		if _, rest, err := readValue(c.Default, last.Type); err != nil || len(rest) > 0 {
+			return nil, fmt.Errorf("bad default of column %q", c.Column.Name)
+		}
+	case dropColumn:
+		if c.Position < 0 || c.Position > len(t.Columns) {
+			return nil, fmt.Errorf("column %q dropped at %d", c.Column.Name, c.Position)
+		}
+		s := t.Schema
+		s.Columns = slices.Insert(slices.Clone(t.Columns), c.Position, c.Column.column())
+		s.Indexes = nil
+		var err error
+		if ch.old, err = newTable(t.id, s); err != nil {
+			return nil, err
+		}
+	case createIndex:
+		if c.Index == nil {
+			return nil, errors.New("no index created")
+		}
+		s := t.Schema
+		s.Indexes = append(slices.Clone(t.Indexes), Index{Name: c.Index.Name, Columns: c.Index.Columns, Unique: c.Index.Unique})
+		n, err := newTable(t.id, s)
+		if err != nil {
+			return nil, err
+		}
+		ch.index = n.indexes[len(n.indexes)-1]
+		ch.index.id = c.Index.ID
+		ch.index.pre = t.indexPrefix(ch.index.id)
+	default:
+		return nil, fmt.Errorf("unknown schema change %q", c.Kind)
+	}
+	return ch, nil
+}
+
+// current reports whether the row at key is in the form of the schema of
+// t: whether there is no change under way or it has done the row.
+func (t *Table) current(key []byte) bool {
+	return t.change == nil || bytes.Compare(key[len(t.pre):], t.change.Cursor) < 0
+}
+
+// indexesOf returns the indexes that have an entry for the row at key:
+// those of the schema, and the one being created if it has done the row.
+func (t *Table) indexesOf(key []byte) []*index {
+	if t.change == nil || t.change.index == nil || !t.current(key) {
+		return t.indexes
+	}
+	return append(slices.Clip(t.indexes), t.change.index)
+}
+
+// zero returns the zero value of a column of type typ.
+func zero(typ Type) any {
+	switch typ {
+	case Int:
+		return int64(0)
+	case Bytes:
+		return []byte{}
+	}
+	return ""
+}
+
+// alter opens the table called name for a new schema change.
+func alter(tx *kv.Tx, name string) (*Table, error) {
+	t, err := Open(tx, name)
+	if err != nil {
+		return nil, err
+	}
+	if t.change != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBusy, t.SchemaChange())
+	}
+	return t, nil
+}
+
+// AddColumn adds the column c, after the others, to the table called
+// name. Every row has the value def for it, until it is set otherwise.
+// The rows get it from Step.
+func AddColumn(tx *kv.Tx, name string, c Column, def any) error {
+	t, err := alter(tx, name)
+	if err != nil {
+		return err
+	}
+	s := t.Schema
+	s.Columns = append(slices.Clone(t.Columns), c)
+	n, err := newTable(t.id, s)
+	if err != nil {
+		return err
+	}
+	if err = n.check(len(s.Columns)-1, def); err != nil {
+		return err
+	}
+	e := t.entry()
+	e.Columns = append(e.Columns, column{Name: c.Name, Type: c.Type.String()})
+	e.Change = &catalogChange{Kind: addColumn, Column: e.Columns[len(e.Columns)-1], Default: appendValue(nil, def)}
+	_, err = e.save(tx, name)
+	return err
+}
+
+// DropColumn drops the column called column of the table called name,
+// which is in neither its primary key nor an index. The rows lose it in
+// Step.
+func DropColumn(tx *kv.Tx, name, column string) error {
+	t, err := alter(tx, name)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(t.Columns, func(c Column) bool { return c.Name == column })
+	switch {
+	case i < 0:
+		return fmt.Errorf("%w: %s has no column %q", ErrSchema, name, column)
+	case slices.Contains(t.PrimaryKey, column):
+		return fmt.Errorf("%w: column %q is in the primary key", ErrSchema, column)
+	}
+	for _, x := range t.Indexes {
+		if slices.Contains(x.Columns, column) {
+			return fmt.Errorf("%w: column %q is in index %q; drop the index first", ErrSchema, column, x.Name)
+		}
+	}
+	e := t.entry()
+	e.Change = &catalogChange{Kind: dropColumn, Column: e.Columns[i], Position: i}
+	e.Columns = slices.Delete(e.Columns, i, i+1)
+	_, err = e.save(tx, name)
+	return err
+}
+
+// CreateIndex creates the index x of the table called name. Step fills it
+// in, and it is in the schema, for Lookup and ScanIndex, once that is
+// done. If x is unique and two rows have the same values, the step that
+// finds them fails with ErrUnique.
+func CreateIndex(tx *kv.Tx, name string, x Index) error {
+	t, err := alter(tx, name)
+	if err != nil {
+		return err
+	}
+	s := t.Schema
+	s.Indexes = append(slices.Clone(t.Indexes), x)
+	if _, err = newTable(t.id, s); err != nil {
+		return err
+	}
+	id := uint16(1)
+	for _, y := range t.indexes {
+		id = max(id, y.id+1)
+	}
+	e := t.entry()
+	e.Change = &catalogChange{Kind: createIndex, Index: &catalogIndex{ID: id, Name: x.Name, Columns: x.Columns, Unique: x.Unique}}
+	_, err = e.save(tx, name)
+	return err
+}
+
+// DropIndex drops the index called xname of the table called name, and
+// its entries, at once. It can drop the index being created, which ends
+// that change.
+func DropIndex(tx *kv.Tx, name, xname string) error {
+	t, err := Open(tx, name)
+	if err != nil {
+		return err
+	}
+	e := t.entry()
+	var x *index
+	if c := t.change; c != nil && c.index != nil && c.index.Name == xname {
+		x, e.Change = c.index, nil
+	} else if x, err = t.index(xname); err != nil {
+		return err
+	} else {
+		e.Indexes = slices.DeleteFunc(e.Indexes, func(y catalogIndex) bool { return y.ID == x.id })
+	}
+	if err = deleteRange(tx, x.pre, prefixEnd(x.pre)); err != nil {
+		return err
+	}
+	_, err = e.save(tx, name)
+	return err
+}
+
+// SchemaChange describes the schema change of t under way, such as "add
+// column c"; "" if there is none.
+func (t *Table) SchemaChange() string {
+	if t.change == nil {
+		return ""
+	}
+	switch c := t.change; c.Kind {
+	case addColumn:
+		return fmt.Sprintf("add column %s", c.Column.Name)
+	case dropColumn:
+		return fmt.Sprintf("drop column %s", c.Column.Name)
+	}
+	return fmt.Sprintf("create index %s", t.change.index.Name)
+}
+
+// Changes returns the names of the tables with a schema change under way,
+// in order.
+func Changes(tx *kv.Tx) ([]string, error) {
+	var names []string
+	err := scanCatalog(tx, func(name string, e catalogEntry) {
+		if e.Change != nil {
+			names = append(names, name)
+		}
+	})
+	return names, err
+}
+
+// Step takes the next batch of rows of the table called name through its
+// schema change, and reports whether the change is done, or there was
+// none. Each step is a transaction's worth of work of its own: between
+// them the table is in use as it is.
+func Step(tx *kv.Tx, name string) (done bool, err error) {
+	t, err := Open(tx, name)
+	if err != nil || t.change == nil {
+		return true, err
+	}
+	c := t.change
+	lo := append(bytes.Clone(t.pre), c.Cursor...)
+	// The rows come after the index entries; see index.go.
+	if rows := append(bytes.Clone(t.pre), indexTag+1); bytes.Compare(lo, rows) < 0 {
+		lo = rows
+	}
+	keys, vals, err := collect(tx, lo, prefixEnd(t.pre))
+	if err != nil {
+		return false, err
+	}
+	for i, key := range keys {
+		row, err := t.decode(key, vals[i])
+		if err != nil {
+			return false, err
+		}
+		if c.index != nil {
+			ekey, eval := c.index.entry(row, key[len(t.pre):])
+			if err = c.index.claim(tx, ekey); err != nil {
+				return false, err
+			}
+			err = tx.Set(ekey, eval)
+		} else {
+			err = tx.Set(key, t.value(row))
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	e := t.entry()
+	done = len(keys) < batchSize
+	switch {
+	case !done:
+		e.Change.Cursor = append(keys[len(keys)-1][len(t.pre):], 0)
+	case c.index != nil:
+		e.Indexes, e.Change = append(e.Indexes, *c.Index), nil
+	default:
+		e.Change = nil
+	}
+	_, err = e.save(tx, name)
+	return done, err
+}
+
+// Complete runs the schema change of the table called name to the end,
+// each Step in a transaction of its own, and returns once it is done.
+// Should a step of a unique index fail with ErrUnique, Complete drops the
+// index and returns the error. Any other failure leaves the change under
+// way, for Complete to take on again.
+func Complete(db *kv.DB, name string) error {
+	for {
+		var done bool
+		err := update(db, func(tx *kv.Tx) (err error) {
+			done, err = Step(tx, name)
+			return err
+		})
+		if errors.Is(err, ErrUnique) {
+			if derr := update(db, func(tx *kv.Tx) error { return abandon(tx, name) }); derr != nil {
+				return errors.Join(err, derr)
+			}
+		}
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// CompleteAll runs every schema change under way in db to the end, as
+// Complete does, such as those a crash left.
+func CompleteAll(db *kv.DB) error {
+	tx, err := db.BeginRead()
+	if err != nil {
+		return err
+	}
+	names, err := Changes(tx)
+	tx.Rollback()
+	for _, name := range names {
+		if err != nil {
+			break
+		}
+		err = Complete(db, name)
+	}
+	return err
+}
+
+// abandon drops the index the table called name is creating, if it is.
+func abandon(tx *kv.Tx, name string) error {
+	t, err := Open(tx, name)
+	if err != nil || t.change == nil || t.change.index == nil {
+		return err
+	}
+	return DropIndex(tx, name, t.change.index.Name)
+}
+
+// update runs fn in a write transaction of db, which it commits if fn
+// returns nil and rolls back otherwise.
+func update(db *kv.DB, fn func(tx *kv.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,399 @@
+package table_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/table"
+)
+
+// withPeople returns a database whose people table holds rows 0 to n-1,
+// named by their id mod 10, in more than one batch of Step.
+func withPeople(tb testing.TB, n int) *kv.DB {
+	tb.Helper()
+	db := open(tb)
+	update(tb, db, func(tx *kv.Tx) error {
+		p, err := table.Create(tx, people)
+		if err != nil {
+			return err
+		}
+		for i := range n {
+			if err = p.Insert(tx, table.Row{int64(i), fmt.Sprint("n", i%10), []byte{byte(i)}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return db
+}
+
+// step runs a Step of the change of the people table in a transaction of
+// its own, and returns whether it was the last.
+func step(tb testing.TB, db *kv.DB) (done bool) {
+	tb.Helper()
+	update(tb, db, func(tx *kv.Tx) (err error) {
+		done, err = table.Step(tx, "people")
+		return err
+	})
+	return done
+}
+
+// get returns the row of people with id, failing the test if there is
+// none.
+func get(tb testing.TB, db *kv.DB, id int64) table.Row {
+	tb.Helper()
+	var row table.Row
+	view(tb, db, func(tx *kv.Tx) error {
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return err
+		}
+		row, err = p.Get(tx, id)
+		return err
+	})
+	return row
+}
+
+func TestAddColumn(t *testing.T) {
+	db := withPeople(t, 2500)
+	var old *table.Table
+	view(t, db, func(tx *kv.Tx) (err error) {
+		old, err = table.Open(tx, "people")
+		return err
+	})
+	update(t, db, func(tx *kv.Tx) error {
+		return table.AddColumn(tx, "people", table.Column{Name: "age", Type: table.Int}, int64(7))
+	})
+	// Every row has the column at once, the default until it is set.
+	if row := get(t, db, 2000); fmt.Sprint(row) != "[2000 n0 [208] 7]" {
+		t.Errorf("row 2000 before a step: %v", row)
+	}
+	view(t, db, func(tx *kv.Tx) error {
+		if _, err := old.Get(tx, int64(1)); !errors.Is(err, table.ErrChanged) {
+			t.Errorf("Get of a table opened before the change: %v, want ErrChanged", err)
+		}
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return err
+		}
+		if c := p.SchemaChange(); c != "add column age" {
+			t.Errorf("SchemaChange = %q", c)
+		}
+		if names, err := table.Changes(tx); err != nil || fmt.Sprint(names) != "[people]" {
+			t.Errorf("Changes = %v, %v", names, err)
+		}
+		return nil
+	})
+	update(t, db, func(tx *kv.Tx) error {
+		err := table.DropColumn(tx, "people", "photo")
+		if !errors.Is(err, table.ErrBusy) {
+			t.Errorf("a second change: %v, want ErrBusy", err)
+		}
+		return nil
+	})
+
+	if step(t, db) {
+		t.Fatal("the first step of 2500 rows was the last")
+	}
+	// Rows written on either side of the cursor.
+	update(t, db, func(tx *kv.Tx) error {
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return err
+		}
+		if err = p.Update(tx, table.Row{int64(10), "early", []byte{}, int64(1)}); err != nil {
+			return err
+		}
+		if err = p.Update(tx, table.Row{int64(2400), "late", []byte{}, int64(2)}); err != nil {
+			return err
+		}
+		return p.Insert(tx, table.Row{int64(3000), "new", []byte{}, int64(3)})
+	})
+	n := 2
+	for !step(t, db) {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("%d steps of 2501 rows, want 3", n)
+	}
+	for id, want := range map[int64]string{
+		0: "[0 n0 [0] 7]", 10: "[10 early [] 1]", 1999: "[1999 n9 [207] 7]",
+		2400: "[2400 late [] 2]", 3000: "[3000 new [] 3]",
+	} {
+		if row := get(t, db, id); fmt.Sprint(row) != want {
+			t.Errorf("row %d = %v, want %s", id, row, want)
+		}
+	}
+	view(t, db, func(tx *kv.Tx) error {
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return err
+		}
+		if c := p.SchemaChange(); c != "" {
+			t.Errorf("SchemaChange after the last step = %q", c)
+		}
+		rs, err := rows(tx, p)
+		if len(rs) != 2501 || err != nil {
+			t.Errorf("%d rows, %v; want 2501", len(rs), err)
+		}
+		return err
+	})
+	if done := step(t, db); !done {
+		t.Error("Step without a change under way is not done")
+	}
+}
+
+func TestAddColumnErrors(t *testing.T) {
+	db := withPeople(t, 1)
+	update(t, db, func(tx *kv.Tx) error {
+		for name, tc := range map[string]struct {
+			c   table.Column
+			def any
+			err error
+		}{
+			"a default of another type": {table.Column{Name: "age", Type: table.Int}, "7", table.ErrType},
+			"a name taken":              {table.Column{Name: "name", Type: table.String}, "", table.ErrSchema},
+			"no type":                   {table.Column{Name: "age"}, int64(0), table.ErrSchema},
+		} {
+			if err := table.AddColumn(tx, "people", tc.c, tc.def); !errors.Is(err, tc.err) {
+				t.Errorf("AddColumn of %s: %v, want %v", name, err, tc.err)
+			}
+		}
+		if err := table.AddColumn(tx, "none", table.Column{Name: "a", Type: table.Int}, int64(0)); err != table.ErrNoTable {
+			t.Errorf("AddColumn to no table: %v, want ErrNoTable", err)
+		}
+		return nil
+	})
+}
+
+func TestDropColumn(t *testing.T) {
+	db := withPeople(t, 2500)
+	update(t, db, func(tx *kv.Tx) error {
+		return table.DropColumn(tx, "people", "name")
+	})
+	if row := get(t, db, 2000); fmt.Sprint(row) != "[2000 [208]]" {
+		t.Errorf("row 2000 before a step: %v", row)
+	}
+	step(t, db)
+	update(t, db, func(tx *kv.Tx) error {
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return err
+		}
+		if err = p.Update(tx, table.Row{int64(2400), []byte("late")}); err != nil {
+			return err
+		}
+		if _, err = p.Delete(tx, int64(5)); err != nil {
+			return err
+		}
+		return p.Insert(tx, table.Row{int64(3000), []byte("new")})
+	})
+	if err := table.Complete(db, "people"); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[int64]string{0: "[0 [0]]", 2400: "[2400 [108 97 116 101]]", 3000: "[3000 [110 101 119]]"} {
+		if row := get(t, db, id); fmt.Sprint(row) != want {
+			t.Errorf("row %d = %v, want %s", id, row, want)
+		}
+	}
+	view(t, db, func(tx *kv.Tx) error {
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return err
+		}
+		if _, err = p.Get(tx, int64(5)); err != table.ErrNotFound {
+			t.Errorf("Get of the deleted row: %v", err)
+		}
+		rs, err := rows(tx, p)
+		if len(rs) != 2500 || err != nil {
+			t.Errorf("%d rows, %v; want 2500", len(rs), err)
+		}
+		return err
+	})
+}
+
+func TestDropColumnErrors(t *testing.T) {
+	db, _ := withUsers(t)
+	update(t, db, func(tx *kv.Tx) error {
+		for column, why := range map[string]string{"id": "in the primary key", "email": "in an index", "none": "not there"} {
+			if err := table.DropColumn(tx, "users", column); !errors.Is(err, table.ErrSchema) {
+				t.Errorf("DropColumn of a column %s: %v, want ErrSchema", why, err)
+			}
+		}
+		return nil
+	})
+}
+
+func TestCreateIndex(t *testing.T) {
+	db := withPeople(t, 2500)
+	lookup := func(tx *kv.Tx, name string) ([]int64, error) {
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return nil, err
+		}
+		var got []int64
+		err = p.Lookup(tx, "by_name", []any{name}, func(row table.Row) bool {
+			got = append(got, row[0].(int64))
+			return true
+		})
+		return got, err
+	}
+	update(t, db, func(tx *kv.Tx) error {
+		return table.CreateIndex(tx, "people", table.Index{Name: "by_name", Columns: []string{"name"}})
+	})
+	step(t, db)
+	// Not in the schema until it has every row; its entries kept up
+	// meanwhile on either side of the cursor.
+	update(t, db, func(tx *kv.Tx) error {
+		if _, err := lookup(tx, "n3"); !errors.Is(err, table.ErrNoIndex) {
+			t.Errorf("Lookup before the index is done: %v, want ErrNoIndex", err)
+		}
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return err
+		}
+		if err = p.Update(tx, table.Row{int64(3), "moved", []byte{}}); err != nil {
+			return err
+		}
+		if _, err = p.Delete(tx, int64(13)); err != nil {
+			return err
+		}
+		if err = p.Update(tx, table.Row{int64(2003), "moved", []byte{}}); err != nil {
+			return err
+		}
+		return p.Insert(tx, table.Row{int64(3000), "n3", []byte{}})
+	})
+	if err := table.Complete(db, "people"); err != nil {
+		t.Fatal(err)
+	}
+	view(t, db, func(tx *kv.Tx) error {
+		got, err := lookup(tx, "n3")
+		if err != nil {
+			return err
+		}
+		// Rows 3, 13 and 2003 gone, 3000 in.
+		if len(got) != 248 || got[0] != 23 || got[len(got)-1] != 3000 {
+			t.Errorf("Lookup(n3) = %d rows, from %v", len(got), got[:min(len(got), 3)])
+		}
+		if got, err = lookup(tx, "moved"); fmt.Sprint(got) != "[3 2003]" {
+			t.Errorf("Lookup(moved) = %v, %v", got, err)
+		}
+		return err
+	})
+}
+
+func TestCreateUniqueIndex(t *testing.T) {
+	// Rows 0 and 2010 have the same name, in different batches.
+	db := withPeople(t, 0)
+	update(t, db, func(tx *kv.Tx) error {
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return err
+		}
+		for i := range 2500 {
+			name := fmt.Sprint(i)
+			if i == 2010 {
+				name = "0"
+			}
+			if err = p.Insert(tx, table.Row{int64(i), name, []byte{}}); err != nil {
+				return err
+			}
+		}
+		return table.CreateIndex(tx, "people", table.Index{Name: "by_name", Columns: []string{"name"}, Unique: true})
+	})
+	if err := table.Complete(db, "people"); !errors.Is(err, table.ErrUnique) {
+		t.Errorf("Complete of a unique index of duplicates: %v, want ErrUnique", err)
+	}
+	// The index is dropped, and with it the change.
+	view(t, db, func(tx *kv.Tx) error {
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return err
+		}
+		if c := p.SchemaChange(); c != "" || len(p.Indexes) != 0 {
+			t.Errorf("after the failed index: change %q, indexes %v", c, p.Indexes)
+		}
+		return nil
+	})
+	update(t, db, func(tx *kv.Tx) error {
+		return table.CreateIndex(tx, "people", table.Index{Name: "by_name", Columns: []string{"name"}})
+	})
+	if err := table.Complete(db, "people"); err != nil {
+		t.Errorf("Complete of the index again, not unique: %v", err)
+	}
+}
+
+func TestCreateIndexErrors(t *testing.T) {
+	db, _ := withUsers(t)
+	update(t, db, func(tx *kv.Tx) error {
+		for name, x := range map[string]table.Index{
+			"a name taken":   {Name: "by_email", Columns: []string{"age"}},
+			"no column":      {Name: "x"},
+			"no such column": {Name: "x", Columns: []string{"none"}},
+		} {
+			if err := table.CreateIndex(tx, "users", x); !errors.Is(err, table.ErrSchema) {
+				t.Errorf("CreateIndex of %s: %v, want ErrSchema", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+func TestDropIndex(t *testing.T) {
+	db, _ := withUsers(t, table.Row{int64(1), "a@x", "Oslo", int64(30)})
+	update(t, db, func(tx *kv.Tx) error {
+		if err := table.DropIndex(tx, "users", "by_email"); err != nil {
+			return err
+		}
+		if err := table.DropIndex(tx, "users", "by_email"); !errors.Is(err, table.ErrNoIndex) {
+			t.Errorf("second DropIndex: %v, want ErrNoIndex", err)
+		}
+		// Of the index being created, it ends the change.
+		if err := table.CreateIndex(tx, "users", table.Index{Name: "by_age", Columns: []string{"age"}}); err != nil {
+			return err
+		}
+		if err := table.DropIndex(tx, "users", "by_age"); err != nil {
+			return err
+		}
+		u, err := table.Open(tx, "users")
+		if err != nil {
+			return err
+		}
+		if c := u.SchemaChange(); c != "" || len(u.Indexes) != 1 {
+			t.Errorf("after the drops: change %q, indexes %v", c, u.Indexes)
+		}
+		// The email is free again.
+		return u.Insert(tx, table.Row{int64(2), "a@x", "Rome", int64(40)})
+	})
+}
+
+func TestCompleteAll(t *testing.T) {
+	db := withPeople(t, 1500)
+	update(t, db, func(tx *kv.Tx) error {
+		if _, err := table.Create(tx, users); err != nil {
+			return err
+		}
+		if err := table.AddColumn(tx, "people", table.Column{Name: "age", Type: table.Int}, int64(1)); err != nil {
+			return err
+		}
+		return table.CreateIndex(tx, "users", table.Index{Name: "by_age", Columns: []string{"age"}})
+	})
+	if err := table.CompleteAll(db); err != nil {
+		t.Fatal(err)
+	}
+	view(t, db, func(tx *kv.Tx) error {
+		if names, err := table.Changes(tx); err != nil || len(names) != 0 {
+			t.Errorf("Changes after CompleteAll = %v, %v", names, err)
+		}
+		u, err := table.Open(tx, "users")
+		if err == nil && len(u.Indexes) != 3 {
+			t.Errorf("indexes of users %v, want by_age too", u.Indexes)
+		}
+		return err
+	})
+	if row := get(t, db, 1499); fmt.Sprint(row) != "[1499 n9 [219] 1]" {
+		t.Errorf("row 1499 = %v", row)
+	}
+}
@@ -0,0 +1,165 @@
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// The entries of an index go under the prefix of its table, then indexTag
+// and the index's ID, 2 bytes big-endian. The keys of rows go on from the
+// table's prefix with a tag byte above indexTag (see key.go), so the two do
+// not mix, and the rows come after the index entries. An entry is, for a
+// row,
+//
+//   - in a unique index, the key-encoded values of the index's columns,
+//     with the encoded primary key of the row as its value;
+//   - in any other, the same followed by the encoded primary key, with an
+//     empty value.
+//
+// Either way the entries sort by the values of the index's columns, then
+// by primary key.
+const indexTag = 0x01
+
+// index is an index of a table.
+type index struct {
+	Index
+	id   uint16
+	cols []int  // the indexed columns, in index order
+	pre  []byte // what the keys of its entries start with
+}
+
+func (t *Table) indexPrefix(id uint16) []byte {
+	return binary.BigEndian.AppendUint16(append(bytes.Clone(t.pre), indexTag), id)
+}
+
+// entry returns the key-value of the entry of row, whose primary key
+// encodes as pk, in x.
+func (x *index) entry(row Row, pk []byte) (key, val []byte) {
+	key = bytes.Clone(x.pre)
+	for _, i := range x.cols {
+		key = appendKey(key, row[i])
+	}
+	if x.Unique {
+		return key, pk
+	}
+	return append(key, pk...), nil
+}
+
+// catalog returns the catalog entry of x.
+func (x *index) catalog() catalogIndex {
+	return catalogIndex{ID: x.id, Name: x.Name, Columns: x.Columns, Unique: x.Unique}
+}
+
+// claim fails with ErrUnique if x is unique and already has an entry at
+// key, which is for another row.
+func (x *index) claim(tx *kv.Tx, key []byte) error {
+	if !x.Unique {
+		return nil
+	}
+	if _, err := tx.Get(key); err == nil {
+		return fmt.Errorf("%w %q", ErrUnique, x.Name)
+	} else if !errors.Is(err, kv.ErrKeyNotFound) {
+		return err
+	}
+	return nil
+}
+
+// index returns the index called name.
+func (t *Table) index(name string) (*index, error) {
+	for _, x := range t.indexes {
+		if x.Name == name {
+			return x, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q in %s", ErrNoIndex, name, t.Name)
+}
+
+// Lookup calls fn with every row whose columns of the index called name
+// have the values of vals, in the order of the index, until fn returns
+// false. vals may give only the first columns of the index, which then
+// matches the rows on those. fn must not update the transaction.
+func (t *Table) Lookup(tx *kv.Tx, name string, vals []any, fn func(row Row) bool) error {
+	return t.ScanIndex(tx, name, Range{Eq: vals}, fn)
+}
+
+// ScanIndex calls fn with every row of r, on the columns of the index
+// called name, in the order of the index, until fn returns false. So
+// Range{Lo: int64(18), Hi: int64(65)} on an index of ages gets the rows
+// with an age from 18 to 64. fn must not update the transaction.
+func (t *Table) ScanIndex(tx *kv.Tx, name string, r Range, fn func(row Row) bool) error {
+	t, err := t.fresh(tx)
+	if err != nil {
+		return err
+	}
+	x, err := t.index(name)
+	if err != nil {
+		return err
+	}
+	lo, hi, err := t.keys(x.pre, x.cols, r)
+	if err != nil {
+		return err
+	}
+	return t.scanIndex(tx, x, lo, hi, fn)
+}
+
+// scanIndex calls fn with the rows of the entries of x in [lo, hi).
+func (t *Table) scanIndex(tx *kv.Tx, x *index, lo, hi []byte, fn func(row Row) bool) error {
+	for {
+		keys, vals, err := collect(tx, lo, hi)
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+		for i, key := range keys {
+			pk := vals[i]
+			if !x.Unique {
+				if pk, err = x.primaryKey(t, key); err != nil {
+					return err
+				}
+			}
+			row, err := t.get(tx, append(bytes.Clone(t.pre), pk...))
+			if errors.Is(err, ErrNotFound) {
+				return fmt.Errorf("table: entry %q of index %q of %s for a missing row", key, x.Name, t.Name)
+			} else if err != nil {
+				return err
+			}
+			if !fn(row) {
+				return nil
+			}
+		}
+		if len(keys) < batchSize {
+			return nil
+		}
+		lo = append(keys[len(keys)-1], 0)
+	}
+}
+
+// primaryKey returns the encoded primary key at the end of key, an entry
+// of x, which is not unique.
+func (x *index) primaryKey(t *Table, key []byte) ([]byte, error) {
+	rest := key[len(x.pre):]
+	for _, i := range x.cols {
+		var err error
+		if _, rest, err = readKey(rest, t.Columns[i].Type); err != nil {
+			return nil, fmt.Errorf("table: entry %q of index %q of %s: %v", key, x.Name, t.Name, err)
+		}
+	}
+	return rest, nil
+}
+
+// prefixEnd returns the first key after all the keys starting with prefix,
+// or nil if there is none.
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for len(end) > 0 && end[len(end)-1] == 0xff {
+		end = end[:len(end)-1]
+	}
+	if len(end) == 0 {
+		return nil
+	}
+	end[len(end)-1]++
+	return end
+}
@@ -0,0 +1,160 @@
+package table_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/table"
+)
+
+var users = table.Schema{
+	Name: "users",
+	Columns: []table.Column{
+		{Name: "id", Type: table.Int},
+		{Name: "email", Type: table.String},
+		{Name: "city", Type: table.String},
+		{Name: "age", Type: table.Int},
+	},
+	PrimaryKey: []string{"id"},
+	Indexes: []table.Index{
+		{Name: "by_email", Columns: []string{"email"}, Unique: true},
+		{Name: "by_city_age", Columns: []string{"city", "age"}},
+	},
+}
+
+// ids returns the primary keys of the rows fn finds, in the order found.
+func ids(tb testing.TB, fn func(func(table.Row) bool) error) []int64 {
+	tb.Helper()
+	var got []int64
+	if err := fn(func(row table.Row) bool {
+		got = append(got, row[0].(int64))
+		return true
+	}); err != nil {
+		tb.Fatal(err)
+	}
+	return got
+}
+
+// withUsers returns a database whose users table holds the given rows.
+func withUsers(tb testing.TB, rs ...table.Row) (*kv.DB, *table.Table) {
+	db := open(tb)
+	var u *table.Table
+	update(tb, db, func(tx *kv.Tx) (err error) {
+		if u, err = table.Create(tx, users); err != nil {
+			return err
+		}
+		for _, r := range rs {
+			if err = u.Insert(tx, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return db, u
+}
+
+func TestIndexes(t *testing.T) {
+	db, u := withUsers(t,
+		table.Row{int64(1), "a@x", "Oslo", int64(30)},
+		table.Row{int64(2), "b@x", "Lima", int64(25)},
+		table.Row{int64(3), "c@x", "Oslo", int64(20)},
+		table.Row{int64(4), "d@x", "Oslo", int64(30)},
+	)
+	view(t, db, func(tx *kv.Tx) error {
+		if got := ids(t, func(fn func(table.Row) bool) error {
+			return u.Lookup(tx, "by_email", []any{"c@x"}, fn)
+		}); !slices.Equal(got, []int64{3}) {
+			t.Errorf("Lookup by email c@x = %v", got)
+		}
+		// By the first column alone, then in the order of the second, then
+		// of the primary key.
+		if got := ids(t, func(fn func(table.Row) bool) error {
+			return u.Lookup(tx, "by_city_age", []any{"Oslo"}, fn)
+		}); !slices.Equal(got, []int64{3, 1, 4}) {
+			t.Errorf("Lookup by city Oslo = %v", got)
+		}
+		if got := ids(t, func(fn func(table.Row) bool) error {
+			return u.ScanIndex(tx, "by_city_age", table.Range{Eq: []any{"Oslo"}, Lo: int64(25)}, fn)
+		}); !slices.Equal(got, []int64{1, 4}) {
+			t.Errorf("ScanIndex of Oslo from 25 = %v", got)
+		}
+		if got := ids(t, func(fn func(table.Row) bool) error {
+			return u.ScanIndex(tx, "by_email", table.Range{}, fn)
+		}); !slices.Equal(got, []int64{1, 2, 3, 4}) {
+			t.Errorf("ScanIndex of every email = %v", got)
+		}
+		if err := u.Lookup(tx, "none", []any{"x"}, nil); !errors.Is(err, table.ErrNoIndex) {
+			t.Errorf("Lookup in a missing index: %v, want ErrNoIndex", err)
+		}
+		if err := u.Lookup(tx, "by_email", []any{int64(1)}, nil); !errors.Is(err, table.ErrType) {
+			t.Errorf("Lookup of an int in a string index: %v, want ErrType", err)
+		}
+		return nil
+	})
+
+	// Updates and deletes move the entries.
+	update(t, db, func(tx *kv.Tx) error {
+		if err := u.Update(tx, table.Row{int64(1), "a@x", "Lima", int64(30)}); err != nil {
+			return err
+		}
+		_, err := u.Delete(tx, int64(3))
+		return err
+	})
+	view(t, db, func(tx *kv.Tx) error {
+		if got := ids(t, func(fn func(table.Row) bool) error {
+			return u.Lookup(tx, "by_city_age", []any{"Oslo"}, fn)
+		}); !slices.Equal(got, []int64{4}) {
+			t.Errorf("Lookup by city Oslo after the updates = %v", got)
+		}
+		if got := ids(t, func(fn func(table.Row) bool) error {
+			return u.Lookup(tx, "by_city_age", []any{"Lima"}, fn)
+		}); !slices.Equal(got, []int64{2, 1}) {
+			t.Errorf("Lookup by city Lima after the updates = %v", got)
+		}
+		if got := ids(t, func(fn func(table.Row) bool) error {
+			return u.Lookup(tx, "by_email", []any{"c@x"}, fn)
+		}); len(got) != 0 {
+			t.Errorf("Lookup of a deleted row's email = %v", got)
+		}
+		return nil
+	})
+}
+
+func TestUnique(t *testing.T) {
+	db, u := withUsers(t,
+		table.Row{int64(1), "a@x", "Oslo", int64(30)},
+		table.Row{int64(2), "b@x", "Lima", int64(25)},
+	)
+	update(t, db, func(tx *kv.Tx) error {
+		if err := u.Insert(tx, table.Row{int64(3), "a@x", "Rome", int64(40)}); !errors.Is(err, table.ErrUnique) {
+			t.Errorf("Insert of an email taken: %v, want ErrUnique", err)
+		}
+		if err := u.Update(tx, table.Row{int64(2), "a@x", "Lima", int64(25)}); !errors.Is(err, table.ErrUnique) {
+			t.Errorf("Update to an email taken: %v, want ErrUnique", err)
+		}
+		// A row keeps its own value, and a value let go is free.
+		if err := u.Update(tx, table.Row{int64(1), "a@x", "Rome", int64(31)}); err != nil {
+			return err
+		}
+		if err := u.Update(tx, table.Row{int64(2), "c@x", "Lima", int64(25)}); err != nil {
+			return err
+		}
+		return u.Insert(tx, table.Row{int64(3), "b@x", "Rome", int64(40)})
+	})
+	view(t, db, func(tx *kv.Tx) error {
+		// The failed updates left no entries behind.
+		if got := ids(t, func(fn func(table.Row) bool) error {
+			return u.ScanIndex(tx, "by_email", table.Range{}, fn)
+		}); !slices.Equal(got, []int64{1, 3, 2}) {
+			t.Errorf("rows by email = %v", got)
+		}
+		if got := ids(t, func(fn func(table.Row) bool) error {
+			return u.Lookup(tx, "by_city_age", []any{"Rome"}, fn)
+		}); !slices.Equal(got, []int64{1, 3}) {
+			t.Errorf("rows in Rome = %v", got)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/adcondev/go-database/codec"
+)
+
+// The columns of a primary key are encoded one after the other with
+// package codec, as a tuple: comparing two encodings byte by byte then
+// compares the values, column by column, and no encoding is a prefix of
+// another.
+//
+// The other columns of a row, in its value, are each a tag byte, the same
+// as codec's, then an int64 as a varint, or bytes and strings as their
+// length as a uvarint and their bytes.
+const (
+	tagInt    = 0x10
+	tagBytes  = 0x20
+	tagString = 0x21
+)
+
+var (
+	errTrailing = errors.New("bytes left over")
+	errEncoding = errors.New("bad encoding")
+)
+
+var typeTags = map[Type]byte{Int: tagInt, Bytes: tagBytes, String: tagString}
+
+// appendKey appends the key encoding of v, an int64, []byte or string.
+func appendKey(b []byte, v any) []byte {
+	switch v.(type) {
+	case int64, []byte, string:
+		b, _ = codec.Append(b, v)
+		return b
+	}
+	panic("table: bad value type")
+}
+
+// readKey reads a key-encoded value of type t off the start of b and
+// returns it and the rest of b.
+func readKey(b []byte, t Type) (any, []byte, error) {
+	if len(b) == 0 || b[0] != typeTags[t] {
+		return nil, nil, errEncoding
+	}
+	v, rest, err := codec.Next(b)
+	if err != nil {
+		return nil, nil, errEncoding
+	}
+	return v, rest, nil
+}
+
+// appendValue appends the value encoding of v, an int64, []byte or string.
+func appendValue(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case int64:
+		return binary.AppendVarint(append(b, tagInt), v)
+	case []byte:
+		b = binary.AppendUvarint(append(b, tagBytes), uint64(len(v)))
+		return append(b, v...)
+	case string:
+		b = binary.AppendUvarint(append(b, tagString), uint64(len(v)))
+		return append(b, v...)
+	}
+	panic("table: bad value type")
+}
+
+// readValue reads a value-encoded value of type t off the start of b and
+// returns it and the rest of b.
+func readValue(b []byte, t Type) (any, []byte, error) {
+	if len(b) == 0 || b[0] != typeTags[t] {
+		return nil, nil, errEncoding
+	}
+	b = b[1:]
+	if t == Int {
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			return nil, nil, errEncoding
+		}
+		return v, b[n:], nil
+	}
+	size, n := binary.Uvarint(b)
+	if n <= 0 || size > uint64(len(b)-n) {
+		return nil, nil, errEncoding
+	}
+	s, rest := b[n:n+int(size)], b[n+int(size):]
+	if t == String {
+		return string(s), rest, nil
+	}
+	return bytes.Clone(s), rest, nil
+}
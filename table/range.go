@@ -0,0 +1,94 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+// Range selects rows by the values of the columns of an index, or of the
+// primary key: those whose first columns have the values of Eq and, if Lo
+// or Hi is set, whose next column comes from Lo, included, up to Hi, not
+// included. The zero Range selects every row.
+type Range struct {
+	Eq     []any
+	Lo, Hi any // nil: no bound
+
+	LoExclusive bool // leave out the rows at Lo
+	HiInclusive bool // take in the rows at Hi
+}
+
+// keys returns the range of keys, after pre, that holds the entries of r
+// for the columns cols, which are key-encoded in order.
+func (t *Table) keys(pre []byte, cols []int, r Range) (lo, hi []byte, err error) {
+	n := len(r.Eq)
+	if r.Lo != nil || r.Hi != nil {
+		n++
+	}
+	if n > len(cols) {
+		return nil, nil, fmt.Errorf("%w: range on %d columns of %d", ErrType, n, len(cols))
+	}
+	base := bytes.Clone(pre)
+	for j, v := range r.Eq {
+		if err := t.check(cols[j], v); err != nil {
+			return nil, nil, err
+		}
+		base = appendKey(base, v)
+	}
+	// The key encoding is prefix-free: the keys whose next column has the
+	// value v are those starting with base and v encoded, all before
+	// prefixEnd of that.
+	bound := func(v any, past bool) ([]byte, error) {
+		if err := t.check(cols[len(r.Eq)], v); err != nil {
+			return nil, err
+		}
+		key := appendKey(bytes.Clone(base), v)
+		if past {
+			key = prefixEnd(key)
+		}
+		return key, nil
+	}
+	lo, hi = base, prefixEnd(base)
+	if r.Lo != nil {
+		if lo, err = bound(r.Lo, r.LoExclusive); err != nil {
+			return nil, nil, err
+		}
+	}
+	if r.Hi != nil {
+		if hi, err = bound(r.Hi, r.HiInclusive); err != nil {
+			return nil, nil, err
+		}
+	}
+	return lo, hi, nil
+}
+
+// ScanRange calls fn with every row of r, on the columns of the primary
+// key, in primary-key order, until fn returns false. fn must not update
+// the transaction.
+func (t *Table) ScanRange(tx *kv.Tx, r Range, fn func(row Row) bool) error {
+	t, err := t.fresh(tx)
+	if err != nil {
+		return err
+	}
+	lo, hi, err := t.keys(t.pre, t.key, r)
+	if err != nil {
+		return err
+	}
+	// The rows come after the index entries; see index.go.
+	if rows := append(bytes.Clone(t.pre), indexTag+1); bytes.Compare(lo, rows) < 0 {
+		lo = rows
+	}
+	var derr error
+	err = tx.Scan(lo, hi, func(key, val []byte) bool {
+		var row Row
+		if row, derr = t.decode(key, val); derr != nil {
+			return false
+		}
+		return fn(row)
+	})
+	if err != nil {
+		return err
+	}
+	return derr
+}
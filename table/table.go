@@ -0,0 +1,683 @@
+// Package table stores tables of rows with typed columns in a kv.DB.
+//
+// A table has a schema (Schema): named columns of type Int, Bytes or
+// String, some of which make up its primary key. Each row is one key-value
+// of the database: the key is the table's prefix followed by the primary
+// key's columns, encoded so that keys sort in the order of the columns'
+// values (see key.go), and the value holds the other columns. A full scan
+// is then a range scan of the keys, in primary-key order.
+//
+// A table can have secondary indexes (Index) on other columns, for
+// looking rows up by them (Lookup, ScanIndex). Each row has an entry in
+// every index, which Insert, Update and Delete keep up to date in the
+// same transaction as the row; see index.go.
+//
+// Every operation takes the kv.Tx it runs in, so that updates to several
+// rows, and tables, commit together. The schemas are kept in the database
+// too, in a catalog, so Open finds a table again after a restart. All the
+// keys the package writes start with the bytes 0x00 't'; the database can
+// hold other keys beside them.
+//
+// The schema of a table with rows in it can change, a batch of rows at a
+// time, while the database is in use: AddColumn, DropColumn and
+// CreateIndex change the catalog at once, and Step, or Complete, the rows
+// after; see alter.go.
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/adcondev/go-database/kv"
+)
+
+var (
+	ErrNoTable   = errors.New("table: no such table")
+	ErrExists    = errors.New("table: table already exists")
+	ErrSchema    = errors.New("table: invalid schema")
+	ErrType      = errors.New("table: value does not match the column")
+	ErrNotFound  = errors.New("table: no row with that primary key")
+	ErrRowExists = errors.New("table: row with that primary key already exists")
+	ErrNoIndex   = errors.New("table: no such index")
+	ErrUnique    = errors.New("table: row would duplicate a value of a unique index")
+)
+
+// Type is the type of a column.
+type Type int
+
+const (
+	Int    Type = iota + 1 // int64
+	Bytes                  // []byte
+	String                 // string
+)
+
+var typeNames = map[Type]string{Int: "int64", Bytes: "bytes", String: "string"}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Column is a column of a table.
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Schema describes a table.
+type Schema struct {
+	Name    string
+	Columns []Column
+
+	// PrimaryKey names the columns that make up the primary key, in the
+	// order rows are sorted by. No two rows have the same values for all
+	// of them.
+	PrimaryKey []string
+
+	Indexes []Index
+}
+
+// Index is a secondary index of a table: the rows sorted by the values of
+// some of its columns.
+type Index struct {
+	Name    string
+	Columns []string
+
+	// Unique keeps two rows from having the same values for all the
+	// columns of the index.
+	Unique bool
+}
+
+// Row is the values of a row, one per column in the order of the schema:
+// an int64 for an Int column, a []byte for Bytes, a string for String.
+type Row []any
+
+// Table is a table of a database, as its schema stood when Create or Open
+// returned it. Its methods go by the catalog of the transaction they run
+// in, though: once a schema change has changed the columns, they fail with
+// ErrChanged, and the table must be opened again.
+type Table struct {
+	Schema
+	id      uint32
+	key     []int  // the columns of the primary key, in key order
+	val     []int  // the other columns, in schema order
+	pre     []byte // what the keys of its rows and index entries start with
+	indexes []*index
+	change  *change // under way, if any; see alter.go
+	raw     []byte  // its catalog entry
+}
+
+// The catalog holds the schema of every table, as JSON, under
+// catalogPrefix followed by the table's name. The rows of a table go under
+// keyPrefix followed by its ID, which is never 0, as 4 bytes big-endian,
+// and its index entries after the same prefix (see index.go).
+const keyPrefix = "\x00t"
+
+var catalogPrefix = tablePrefix(0)
+
+func tablePrefix(id uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte(keyPrefix), id)
+}
+
+// catalogEntry is what the catalog holds for a table.
+type catalogEntry struct {
+	ID         uint32         `json:"id"`
+	Columns    []column       `json:"columns"`
+	PrimaryKey []string       `json:"primaryKey"`
+	Indexes    []catalogIndex `json:"indexes,omitempty"`
+	Change     *catalogChange `json:"change,omitempty"`
+}
+
+type catalogIndex struct {
+	ID      uint16   `json:"id"`
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique,omitempty"`
+}
+
+type column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Create creates the table s describes, which must not exist yet, and
+// returns it.
+func Create(tx *kv.Tx, s Schema) (*Table, error) {
+	if _, err := newTable(0, s); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Get(catalogKey(s.Name)); err == nil {
+		return nil, ErrExists
+	} else if !errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, err
+	}
+	// Tables are numbered in order of creation.
+	var last uint32
+	err := scanCatalog(tx, func(_ string, e catalogEntry) {
+		last = max(last, e.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTable(last+1, s)
+	if err != nil {
+		return nil, err
+	}
+	if t.raw, err = t.entry().save(tx, s.Name); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Open returns the table called name, or ErrNoTable.
+func Open(tx *kv.Tx, name string) (*Table, error) {
+	data, err := tx.Get(catalogKey(name))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, ErrNoTable
+	} else if err != nil {
+		return nil, err
+	}
+	return load(name, data)
+}
+
+// load returns the table called name whose catalog entry is data.
+func load(name string, data []byte) (*Table, error) {
+	e, err := parseCatalogEntry(name, data)
+	if err != nil {
+		return nil, err
+	}
+	t, err := e.table(name)
+	if err != nil {
+		return nil, err
+	}
+	t.raw = data
+	return t, nil
+}
+
+// fresh returns the table t is as the catalog of tx has it: t itself,
+// unless a schema change, or a step of one, came after t was read. It
+// fails with ErrChanged if the columns have changed since.
+func (t *Table) fresh(tx *kv.Tx) (*Table, error) {
+	data, err := tx.Get(catalogKey(t.Name))
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, ErrNoTable
+	} else if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(data, t.raw) {
+		return t, nil
+	}
+	n, err := load(t.Name, data)
+	if err != nil {
+		return nil, err
+	}
+	if n.id != t.id || !slices.Equal(n.Columns, t.Columns) {
+		return nil, fmt.Errorf("%w: %s", ErrChanged, t.Name)
+	}
+	return n, nil
+}
+
+// Tables returns the names of the tables, in order.
+func Tables(tx *kv.Tx) ([]string, error) {
+	var names []string
+	err := tx.Scan(catalogPrefix, tablePrefix(1), func(key, _ []byte) bool {
+		names = append(names, string(key[len(catalogPrefix):]))
+		return true
+	})
+	return names, err
+}
+
+// Drop deletes the table called name and all its rows.
+func Drop(tx *kv.Tx, name string) error {
+	t, err := Open(tx, name)
+	if err != nil {
+		return err
+	}
+	if err = deleteRange(tx, t.pre, tablePrefix(t.id+1)); err != nil {
+		return err
+	}
+	_, err = tx.Del(catalogKey(name))
+	return err
+}
+
+// deleteRange deletes the keys in [lo, hi), a batch at a time.
+func deleteRange(tx *kv.Tx, lo, hi []byte) error {
+	for {
+		keys, _, err := collect(tx, lo, hi)
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+		for _, key := range keys {
+			if _, err = tx.Del(key); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// batchSize is how many key-values collect returns at most.
+const batchSize = 1000
+
+// collect returns copies of the first batchSize key-values in [lo, hi). A
+// scan must not update, or read, the transaction it runs in, so what
+// needs to do either for each key scans a batch at a time.
+func collect(tx *kv.Tx, lo, hi []byte) (keys, vals [][]byte, err error) {
+	err = tx.Scan(lo, hi, func(key, val []byte) bool {
+		keys = append(keys, bytes.Clone(key))
+		vals = append(vals, bytes.Clone(val))
+		return len(keys) < batchSize
+	})
+	return keys, vals, err
+}
+
+func catalogKey(name string) []byte {
+	return append(bytes.Clone(catalogPrefix), name...)
+}
+
+// scanCatalog calls fn with every table of the catalog: its name and its
+// entry.
+func scanCatalog(tx *kv.Tx, fn func(name string, e catalogEntry)) error {
+	var perr error
+	err := tx.Scan(catalogPrefix, tablePrefix(1), func(key, val []byte) bool {
+		name := string(key[len(catalogPrefix):])
+		var e catalogEntry
+		if e, perr = parseCatalogEntry(name, val); perr != nil {
+			return false
+		}
+		fn(name, e)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return perr
+}
+
+func parseCatalogEntry(name string, data []byte) (catalogEntry, error) {
+	var e catalogEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, fmt.Errorf("table: catalog entry of %q: %v", name, err)
+	}
+	return e, nil
+}
+
+// save sets the catalog entry of the table called name to e, and returns
+// it encoded.
+func (e catalogEntry) save(tx *kv.Tx, name string) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return data, tx.Set(catalogKey(name), data)
+}
+
+// entry returns the catalog entry of t.
+func (t *Table) entry() catalogEntry {
+	e := catalogEntry{ID: t.id, PrimaryKey: t.PrimaryKey}
+	for _, c := range t.Columns {
+		e.Columns = append(e.Columns, column{Name: c.Name, Type: c.Type.String()})
+	}
+	for _, x := range t.indexes {
+		e.Indexes = append(e.Indexes, x.catalog())
+	}
+	if t.change != nil {
+		c := t.change.catalogChange
+		e.Change = &c
+	}
+	return e
+}
+
+// table returns the table the entry describes.
+func (e catalogEntry) table(name string) (*Table, error) {
+	s := Schema{Name: name, PrimaryKey: e.PrimaryKey}
+	for _, c := range e.Columns {
+		s.Columns = append(s.Columns, c.column())
+	}
+	for _, x := range e.Indexes {
+		s.Indexes = append(s.Indexes, Index{Name: x.Name, Columns: x.Columns, Unique: x.Unique})
+	}
+	t, err := newTable(e.ID, s)
+	if err != nil {
+		return nil, err
+	}
+	for i, x := range t.indexes {
+		x.id = e.Indexes[i].ID
+		x.pre = t.indexPrefix(x.id)
+	}
+	if e.Change != nil {
+		if t.change, err = t.newChange(*e.Change); err != nil {
+			return nil, fmt.Errorf("table: catalog entry of %q: %v", name, err)
+		}
+	}
+	return t, nil
+}
+
+// column returns the Column c describes; of type 0 if its type is
+// unknown, which newTable rejects.
+func (c column) column() Column {
+	col := Column{Name: c.Name}
+	for t, tn := range typeNames {
+		if tn == c.Type {
+			col.Type = t
+		}
+	}
+	return col
+}
+
+// newTable checks s and returns the table it describes, with the given ID.
+// Its indexes are numbered from 1 in order.
+func newTable(id uint32, s Schema) (*Table, error) {
+	bad := func(format string, args ...any) (*Table, error) {
+		return nil, fmt.Errorf("%w: %s", ErrSchema, fmt.Sprintf(format, args...))
+	}
+	if s.Name == "" {
+		return bad("no table name")
+	}
+	if len(s.Columns) == 0 {
+		return bad("no columns")
+	}
+	pos := make(map[string]int)
+	for i, c := range s.Columns {
+		switch {
+		case c.Name == "":
+			return bad("column %d has no name", i)
+		case typeNames[c.Type] == "":
+			return bad("column %q of unknown type", c.Name)
+		}
+		if _, dup := pos[c.Name]; dup {
+			return bad("two columns called %q", c.Name)
+		}
+		pos[c.Name] = i
+	}
+	// columns returns the positions of the columns names lists, for what.
+	columns := func(names []string, what string) ([]int, error) {
+		if len(names) == 0 {
+			return nil, fmt.Errorf("%w: no columns in %s", ErrSchema, what)
+		}
+		seen := make(map[int]bool)
+		var cols []int
+		for _, name := range names {
+			i, ok := pos[name]
+			switch {
+			case !ok:
+				return nil, fmt.Errorf("%w: column %q of %s is not a column", ErrSchema, name, what)
+			case seen[i]:
+				return nil, fmt.Errorf("%w: column %q twice in %s", ErrSchema, name, what)
+			}
+			seen[i] = true
+			cols = append(cols, i)
+		}
+		return cols, nil
+	}
+	t := &Table{Schema: s, id: id, pre: tablePrefix(id)}
+	var err error
+	if t.key, err = columns(s.PrimaryKey, "the primary key"); err != nil {
+		return nil, err
+	}
+	for i := range s.Columns {
+		if !slices.Contains(t.key, i) {
+			t.val = append(t.val, i)
+		}
+	}
+	names := make(map[string]bool)
+	for i, x := range s.Indexes {
+		if x.Name == "" {
+			return bad("index %d has no name", i)
+		}
+		if names[x.Name] {
+			return bad("two indexes called %q", x.Name)
+		}
+		names[x.Name] = true
+		cols, err := columns(x.Columns, fmt.Sprintf("index %q", x.Name))
+		if err != nil {
+			return nil, err
+		}
+		id := uint16(i + 1)
+		t.indexes = append(t.indexes, &index{Index: x, id: id, cols: cols, pre: t.indexPrefix(id)})
+	}
+	return t, nil
+}
+
+// check reports whether v fits column i.
+func (t *Table) check(i int, v any) error {
+	ok := false
+	switch v.(type) {
+	case int64:
+		ok = t.Columns[i].Type == Int
+	case []byte:
+		ok = t.Columns[i].Type == Bytes
+	case string:
+		ok = t.Columns[i].Type == String
+	}
+	if !ok {
+		return fmt.Errorf("%w: column %q holds %s, not %T", ErrType, t.Columns[i].Name, t.Columns[i].Type, v)
+	}
+	return nil
+}
+
+// encode returns the key-value of row.
+func (t *Table) encode(row Row) (key, val []byte, err error) {
+	if len(row) != len(t.Columns) {
+		return nil, nil, fmt.Errorf("%w: %d values for %d columns", ErrType, len(row), len(t.Columns))
+	}
+	for i, v := range row {
+		if err := t.check(i, v); err != nil {
+			return nil, nil, err
+		}
+	}
+	key = bytes.Clone(t.pre)
+	for _, i := range t.key {
+		key = appendKey(key, row[i])
+	}
+	if c := t.change; c != nil && c.old != nil && !t.current(key) {
+		// The drop is still to rewrite the row: it keeps the old layout,
+		// with a zero for the column.
+		old := slices.Insert(slices.Clone(row), c.Position, zero(c.old.Columns[c.Position].Type))
+		return key, c.old.value(old), nil
+	}
+	return key, t.value(row), nil
+}
+
+// value returns the value of the key-value of row.
+func (t *Table) value(row Row) []byte {
+	var val []byte
+	for _, i := range t.val {
+		val = appendValue(val, row[i])
+	}
+	return val
+}
+
+// primaryKey returns the key of the row whose primary key has the values
+// of pk.
+func (t *Table) primaryKey(pk []any) ([]byte, error) {
+	if len(pk) != len(t.key) {
+		return nil, fmt.Errorf("%w: %d values for a primary key of %d columns", ErrType, len(pk), len(t.key))
+	}
+	key := bytes.Clone(t.pre)
+	for j, i := range t.key {
+		if err := t.check(i, pk[j]); err != nil {
+			return nil, err
+		}
+		key = appendKey(key, pk[j])
+	}
+	return key, nil
+}
+
+// decode returns the row stored as (key, val).
+func (t *Table) decode(key, val []byte) (Row, error) {
+	if c := t.change; c != nil && c.old != nil && !t.current(key) {
+		row, err := c.old.decode(key, val)
+		if err != nil {
+			return nil, err
+		}
+		return slices.Delete(row, c.Position, c.Position+1), nil
+	}
+	row := make(Row, len(t.Columns))
+	rest := key[len(t.pre):]
+	var err error
+	for _, i := range t.key {
+		if row[i], rest, err = readKey(rest, t.Columns[i].Type); err != nil {
+			return nil, t.corrupt(key, err)
+		}
+	}
+	for _, i := range t.val {
+		if c := t.change; len(val) == 0 && c != nil && c.Kind == addColumn && i == len(t.Columns)-1 {
+			// A row from before the column was added: every value takes
+			// a byte or more, so it has none left for it.
+			val = c.Default
+		}
+		if row[i], val, err = readValue(val, t.Columns[i].Type); err != nil {
+			return nil, t.corrupt(key, err)
+		}
+	}
+	if len(rest) > 0 || len(val) > 0 {
+		return nil, t.corrupt(key, errTrailing)
+	}
+	return row, nil
+}
+
+func (t *Table) corrupt(key []byte, err error) error {
+	return fmt.Errorf("table: row %q of %s: %v", key, t.Name, err)
+}
+
+// get returns the row at key, or ErrNotFound.
+func (t *Table) get(tx *kv.Tx, key []byte) (Row, error) {
+	val, err := tx.Get(key)
+	if errors.Is(err, kv.ErrKeyNotFound) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return t.decode(key, val)
+}
+
+// Insert adds row, failing with ErrRowExists if there is a row with the
+// same primary key, or ErrUnique if a unique index has a row with the same
+// values already.
+func (t *Table) Insert(tx *kv.Tx, row Row) error {
+	t, err := t.fresh(tx)
+	if err != nil {
+		return err
+	}
+	key, val, err := t.encode(row)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Get(key); err == nil {
+		return ErrRowExists
+	} else if !errors.Is(err, kv.ErrKeyNotFound) {
+		return err
+	}
+	pk := key[len(t.pre):]
+	indexes := t.indexesOf(key)
+	for _, x := range indexes {
+		ekey, _ := x.entry(row, pk)
+		if err = x.claim(tx, ekey); err != nil {
+			return err
+		}
+	}
+	for _, x := range indexes {
+		if err = tx.Set(x.entry(row, pk)); err != nil {
+			return err
+		}
+	}
+	return tx.Set(key, val)
+}
+
+// Update replaces the row with the primary key of row, failing with
+// ErrNotFound if there is none, or ErrUnique if a unique index has another
+// row with the new values.
+func (t *Table) Update(tx *kv.Tx, row Row) error {
+	t, err := t.fresh(tx)
+	if err != nil {
+		return err
+	}
+	key, val, err := t.encode(row)
+	if err != nil {
+		return err
+	}
+	old, err := t.get(tx, key)
+	if err != nil {
+		return err
+	}
+	// Only the entries of the indexes whose columns change move.
+	pk := key[len(t.pre):]
+	var moved []*index
+	for _, x := range t.indexesOf(key) {
+		okey, _ := x.entry(old, pk)
+		nkey, _ := x.entry(row, pk)
+		if bytes.Equal(okey, nkey) {
+			continue
+		}
+		if err = x.claim(tx, nkey); err != nil {
+			return err
+		}
+		moved = append(moved, x)
+	}
+	for _, x := range moved {
+		okey, _ := x.entry(old, pk)
+		if _, err = tx.Del(okey); err != nil {
+			return err
+		}
+		if err = tx.Set(x.entry(row, pk)); err != nil {
+			return err
+		}
+	}
+	return tx.Set(key, val)
+}
+
+// Get returns the row whose primary key has the values of pk, in the
+// order of Schema.PrimaryKey, or ErrNotFound.
+func (t *Table) Get(tx *kv.Tx, pk ...any) (Row, error) {
+	t, err := t.fresh(tx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := t.primaryKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	return t.get(tx, key)
+}
+
+// Delete deletes the row whose primary key has the values of pk and
+// reports whether there was one.
+func (t *Table) Delete(tx *kv.Tx, pk ...any) (bool, error) {
+	t, err := t.fresh(tx)
+	if err != nil {
+		return false, err
+	}
+	key, err := t.primaryKey(pk)
+	if err != nil {
+		return false, err
+	}
+	indexes := t.indexesOf(key)
+	if len(indexes) == 0 {
+		return tx.Del(key)
+	}
+	old, err := t.get(tx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	for _, x := range indexes {
+		ekey, _ := x.entry(old, key[len(t.pre):])
+		if _, err = tx.Del(ekey); err != nil {
+			return false, err
+		}
+	}
+	return tx.Del(key)
+}
+
+// Scan calls fn with every row in primary-key order, until fn returns
+// false. fn must not update the transaction.
+func (t *Table) Scan(tx *kv.Tx, fn func(row Row) bool) error {
+	return t.ScanRange(tx, Range{}, fn)
+}
@@ -0,0 +1,346 @@
+package table_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/adcondev/go-database/kv"
+	"github.com/adcondev/go-database/table"
+)
+
+// open opens a new database for a test, which closes it at the end.
+func open(tb testing.TB) *kv.DB {
+	tb.Helper()
+	db, err := kv.Open(filepath.Join(tb.TempDir(), "db"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
+
+// update runs fn in a write transaction of db and commits it, failing the
+// test on an error.
+func update(tb testing.TB, db *kv.DB, fn func(tx *kv.Tx) error) {
+	tb.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		tb.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// view runs fn in a read transaction of db, failing the test on an error.
+func view(tb testing.TB, db *kv.DB, fn func(tx *kv.Tx) error) {
+	tb.Helper()
+	tx, err := db.BeginRead()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err = fn(tx); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// rows returns every row of t, in primary-key order.
+func rows(tx *kv.Tx, t *table.Table) ([]table.Row, error) {
+	var rs []table.Row
+	err := t.Scan(tx, func(row table.Row) bool {
+		rs = append(rs, row)
+		return true
+	})
+	return rs, err
+}
+
+var people = table.Schema{
+	Name: "people",
+	Columns: []table.Column{
+		{Name: "id", Type: table.Int},
+		{Name: "name", Type: table.String},
+		{Name: "photo", Type: table.Bytes},
+	},
+	PrimaryKey: []string{"id"},
+}
+
+func TestCreateOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	db, err := kv.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update(t, db, func(tx *kv.Tx) error {
+		if _, err := table.Open(tx, "people"); !errors.Is(err, table.ErrNoTable) {
+			t.Errorf("Open before Create: %v, want ErrNoTable", err)
+		}
+		if _, err := table.Create(tx, people); err != nil {
+			return err
+		}
+		if _, err := table.Create(tx, people); !errors.Is(err, table.ErrExists) {
+			t.Errorf("Create twice: %v, want ErrExists", err)
+		}
+		s := people
+		s.Name = "animals"
+		_, err := table.Create(tx, s)
+		return err
+	})
+	// Keys of the database beside the tables' do not get in their way.
+	if err = db.Set([]byte("other"), []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db, err = kv.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	view(t, db, func(tx *kv.Tx) error {
+		names, err := table.Tables(tx)
+		if err != nil {
+			return err
+		}
+		if !slices.Equal(names, []string{"animals", "people"}) {
+			t.Errorf("Tables = %q", names)
+		}
+		p, err := table.Open(tx, "people")
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(p.Schema, people) {
+			t.Errorf("schema after reopening = %+v, want %+v", p.Schema, people)
+		}
+		return nil
+	})
+}
+
+func TestSchemaErrors(t *testing.T) {
+	db := open(t)
+	cols := []table.Column{{Name: "a", Type: table.Int}, {Name: "b", Type: table.String}}
+	for _, s := range []table.Schema{
+		{Columns: cols, PrimaryKey: []string{"a"}},
+		{Name: "t", PrimaryKey: []string{"a"}},
+		{Name: "t", Columns: []table.Column{{Type: table.Int}}, PrimaryKey: []string{""}},
+		{Name: "t", Columns: []table.Column{{Name: "a", Type: 9}}, PrimaryKey: []string{"a"}},
+		{Name: "t", Columns: []table.Column{{Name: "a", Type: table.Int}, {Name: "a", Type: table.Int}}, PrimaryKey: []string{"a"}},
+		{Name: "t", Columns: cols},
+		{Name: "t", Columns: cols, PrimaryKey: []string{"c"}},
+		{Name: "t", Columns: cols, PrimaryKey: []string{"a", "a"}},
+		{Name: "t", Columns: cols, PrimaryKey: []string{"a"}, Indexes: []table.Index{{Columns: []string{"b"}}}},
+		{Name: "t", Columns: cols, PrimaryKey: []string{"a"}, Indexes: []table.Index{{Name: "x"}}},
+		{Name: "t", Columns: cols, PrimaryKey: []string{"a"}, Indexes: []table.Index{{Name: "x", Columns: []string{"b"}}, {Name: "x", Columns: []string{"a"}}}},
+	} {
+		update(t, db, func(tx *kv.Tx) error {
+			if _, err := table.Create(tx, s); !errors.Is(err, table.ErrSchema) {
+				t.Errorf("Create(%+v): %v, want ErrSchema", s, err)
+			}
+			return nil
+		})
+	}
+	view(t, db, func(tx *kv.Tx) error {
+		if names, err := table.Tables(tx); err != nil || len(names) != 0 {
+			t.Errorf("failed creates left tables %q, %v", names, err)
+		}
+		return nil
+	})
+}
+
+func TestRows(t *testing.T) {
+	db := open(t)
+	var p *table.Table
+	update(t, db, func(tx *kv.Tx) (err error) {
+		p, err = table.Create(tx, people)
+		return err
+	})
+	update(t, db, func(tx *kv.Tx) error {
+		for i := range int64(10) {
+			if err := p.Insert(tx, table.Row{i, fmt.Sprint("p", i), []byte{byte(i)}}); err != nil {
+				return err
+			}
+		}
+		if err := p.Insert(tx, table.Row{int64(3), "again", []byte{}}); !errors.Is(err, table.ErrRowExists) {
+			t.Errorf("Insert of a primary key taken: %v, want ErrRowExists", err)
+		}
+		if err := p.Update(tx, table.Row{int64(3), "three", []byte("x")}); err != nil {
+			return err
+		}
+		if err := p.Update(tx, table.Row{int64(99), "none", []byte{}}); !errors.Is(err, table.ErrNotFound) {
+			t.Errorf("Update of a missing row: %v, want ErrNotFound", err)
+		}
+		if ok, err := p.Delete(tx, int64(5)); !ok || err != nil {
+			t.Errorf("Delete of row 5 = %v, %v", ok, err)
+		}
+		if ok, err := p.Delete(tx, int64(5)); ok || err != nil {
+			t.Errorf("second Delete of row 5 = %v, %v; want false", ok, err)
+		}
+		return nil
+	})
+	view(t, db, func(tx *kv.Tx) error {
+		row, err := p.Get(tx, int64(3))
+		if err != nil {
+			return err
+		}
+		if want := (table.Row{int64(3), "three", []byte("x")}); !reflect.DeepEqual(row, want) {
+			t.Errorf("row 3 = %v, want %v", row, want)
+		}
+		if _, err = p.Get(tx, int64(5)); !errors.Is(err, table.ErrNotFound) {
+			t.Errorf("Get of a deleted row: %v, want ErrNotFound", err)
+		}
+		rs, err := rows(tx, p)
+		if err != nil {
+			return err
+		}
+		var ids []int64
+		for _, r := range rs {
+			ids = append(ids, r[0].(int64))
+		}
+		if !slices.Equal(ids, []int64{0, 1, 2, 3, 4, 6, 7, 8, 9}) {
+			t.Errorf("Scan gave rows %v", ids)
+		}
+		return nil
+	})
+}
+
+func TestTypeErrors(t *testing.T) {
+	db := open(t)
+	update(t, db, func(tx *kv.Tx) error {
+		p, err := table.Create(tx, people)
+		if err != nil {
+			return err
+		}
+		for _, row := range []table.Row{
+			{int64(1), "a"},
+			{int64(1), "a", []byte{}, int64(2)},
+			{1, "a", []byte{}},
+			{int64(1), []byte("a"), []byte{}},
+			{int64(1), "a", nil},
+		} {
+			if err := p.Insert(tx, row); !errors.Is(err, table.ErrType) {
+				t.Errorf("Insert(%#v): %v, want ErrType", row, err)
+			}
+		}
+		if _, err := p.Get(tx, "1"); !errors.Is(err, table.ErrType) {
+			t.Errorf("Get by a string of an Int key: %v, want ErrType", err)
+		}
+		if _, err := p.Get(tx); !errors.Is(err, table.ErrType) {
+			t.Errorf("Get with no key: %v, want ErrType", err)
+		}
+		return nil
+	})
+}
+
+func TestKeyOrder(t *testing.T) {
+	db := open(t)
+	s := table.Schema{
+		Name: "t",
+		Columns: []table.Column{
+			{Name: "v", Type: table.String},
+			{Name: "b", Type: table.Bytes},
+			{Name: "i", Type: table.Int},
+		},
+		PrimaryKey: []string{"i", "b"},
+	}
+	ints := []int64{-1 << 63, -300, -1, 0, 1, 255, 256, 1<<63 - 1}
+	bs := [][]byte{{}, {0}, {0, 0}, {0, 1}, {1}, []byte("a"), []byte("a\x00b"), {0xff}}
+	var want []string
+	update(t, db, func(tx *kv.Tx) error {
+		tt, err := table.Create(tx, s)
+		if err != nil {
+			return err
+		}
+		// Insert in reverse, to be sure the order is the keys'.
+		for _, i := range slices.Backward(ints) {
+			for _, b := range slices.Backward(bs) {
+				if err = tt.Insert(tx, table.Row{fmt.Sprint(i, b), b, i}); err != nil {
+					return err
+				}
+			}
+		}
+		for _, i := range ints {
+			for _, b := range bs {
+				want = append(want, fmt.Sprint(i, b))
+			}
+		}
+		return nil
+	})
+	view(t, db, func(tx *kv.Tx) error {
+		tt, err := table.Open(tx, "t")
+		if err != nil {
+			return err
+		}
+		rs, err := rows(tx, tt)
+		if err != nil {
+			return err
+		}
+		var got []string
+		for _, r := range rs {
+			got = append(got, r[0].(string))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Scan order\n%q\nwant\n%q", got, want)
+		}
+		if row, err := tt.Get(tx, int64(-300), []byte("a\x00b")); err != nil || row[0] != "-300 [97 0 98]" {
+			t.Errorf("Get(-300, a\\x00b) = %v, %v", row, err)
+		}
+		return nil
+	})
+}
+
+func TestDrop(t *testing.T) {
+	db := open(t)
+	update(t, db, func(tx *kv.Tx) error {
+		for _, name := range []string{"a", "b"} {
+			s := people
+			s.Name = name
+			tt, err := table.Create(tx, s)
+			if err != nil {
+				return err
+			}
+			// More than a batch of the deletes.
+			for i := range int64(2500) {
+				if err = tt.Insert(tx, table.Row{i, name, []byte{}}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	update(t, db, func(tx *kv.Tx) error {
+		if err := table.Drop(tx, "a"); err != nil {
+			return err
+		}
+		if err := table.Drop(tx, "a"); !errors.Is(err, table.ErrNoTable) {
+			t.Errorf("Drop twice: %v, want ErrNoTable", err)
+		}
+		return nil
+	})
+	view(t, db, func(tx *kv.Tx) error {
+		n := 0
+		if err := tx.Scan(nil, nil, func(key, val []byte) bool { n++; return true }); err != nil {
+			return err
+		}
+		// The rows of b and its catalog entry.
+		if n != 2501 {
+			t.Errorf("database holds %d keys after the drop, want 2501", n)
+		}
+		b, err := table.Open(tx, "b")
+		if err != nil {
+			return err
+		}
+		if rs, err := rows(tx, b); err != nil || len(rs) != 2500 {
+			t.Errorf("b has %d rows, %v", len(rs), err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,330 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Mem is a file system held in memory, for databases that need not outlive
+// the process and for tests. Files are byte slices that Sync leaves alone
+// and that go away with the Mem. Directories exist once MkdirAll makes
+// them, and "." and "/" always do; files can be made in any of them. The
+// zero Mem is empty and ready to use, and its methods are safe for
+// concurrent use.
+type Mem struct {
+	mu    sync.Mutex
+	files map[string]*memData
+	dirs  map[string]bool
+}
+
+// memData is the content of a file, shared by the files that open it.
+type memData struct {
+	mu      sync.RWMutex
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (m *Mem) isDir(name string) bool {
+	return name == "." || name == "/" || m.dirs[name]
+}
+
+func (m *Mem) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if m.isDir(name) {
+		if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+		}
+		return &memFile{name: name, dir: true}, nil
+	}
+	d := m.files[name]
+	switch {
+	case d == nil && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case d != nil && flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case d == nil:
+		d = &memData{mode: perm & fs.ModePerm, modTime: time.Now()}
+		if m.files == nil {
+			m.files = make(map[string]*memData)
+		}
+		m.files[name] = d
+	}
+	f := &memFile{name: name, d: d, flag: flag}
+	if flag&os.O_TRUNC != 0 && f.writable() {
+		f.Truncate(0)
+	}
+	return f, nil
+}
+
+func (m *Mem) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for path = filepath.Clean(path); !m.isDir(path); path = filepath.Dir(path) {
+		if m.files[path] != nil {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: errors.New("not a directory")}
+		}
+		if m.dirs == nil {
+			m.dirs = make(map[string]bool)
+		}
+		m.dirs[path] = true
+	}
+	return nil
+}
+
+func (m *Mem) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if m.isDir(name) {
+		return memInfo{name: filepath.Base(name), mode: fs.ModeDir | 0o775}, nil
+	}
+	d := m.files[name]
+	if d == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return d.info(name), nil
+}
+
+// Lstat is Stat: there are no symbolic links.
+func (m *Mem) Lstat(name string) (fs.FileInfo, error) { return m.Stat(name) }
+
+func (m *Mem) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	d := m.files[oldpath]
+	switch {
+	case d == nil:
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	case m.isDir(newpath):
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errors.New("is a directory")}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = d
+	return nil
+}
+
+func (m *Mem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		for other := range m.files {
+			if filepath.Dir(other) == name {
+				return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+			}
+		}
+		delete(m.dirs, name)
+		return nil
+	}
+	if m.files[name] == nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (d *memData) info(name string) fs.FileInfo {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return memInfo{name: filepath.Base(name), size: int64(len(d.data)), mode: d.mode, modTime: d.modTime}
+}
+
+// memFile is an open file of a Mem, or directory if dir is set. Its
+// offset is its own; its content is shared.
+type memFile struct {
+	name   string
+	d      *memData
+	dir    bool
+	flag   int
+	off    int64
+	closed bool
+}
+
+func (f *memFile) writable() bool { return f.flag&(os.O_WRONLY|os.O_RDWR) != 0 }
+
+// check returns the error of op on f, if f is closed or a directory, or
+// op writes and f is not open for writing.
+func (f *memFile) check(op string, write bool) error {
+	var err error
+	switch {
+	case f.closed:
+		err = fs.ErrClosed
+	case f.dir:
+		err = errors.New("is a directory")
+	case write && !f.writable():
+		err = errors.New("file not open for writing")
+	default:
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: f.name, Err: err}
+}
+
+func (f *memFile) Name() string { return f.name }
+
+func (f *memFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.New("negative offset")}
+	}
+	f.d.mu.RLock()
+	defer f.d.mu.RUnlock()
+	if off >= int64(len(f.d.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.d.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.flag&os.O_APPEND != 0 {
+		if err := f.check("write", true); err != nil {
+			return 0, err
+		}
+		f.d.mu.RLock()
+		f.off = int64(len(f.d.data))
+		f.d.mu.RUnlock()
+	}
+	n, err := f.WriteAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: errors.New("negative offset")}
+	}
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	if end := off + int64(len(p)); end > int64(len(f.d.data)) {
+		f.d.data = resize(f.d.data, end)
+	}
+	copy(f.d.data[off:], p)
+	f.d.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek", false); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		f.d.mu.RLock()
+		offset += int64(len(f.d.data))
+		f.d.mu.RUnlock()
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errors.New("negative offset")}
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: errors.New("negative size")}
+	}
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+	f.d.data = resize(f.d.data, size)
+	f.d.modTime = time.Now()
+	return nil
+}
+
+// resize returns b grown, with zeros, or cut to size.
+func resize(b []byte, size int64) []byte {
+	if size <= int64(len(b)) {
+		return b[:size]
+	}
+	if size <= int64(cap(b)) {
+		n := len(b)
+		b = b[:size]
+		clear(b[n:])
+		return b
+	}
+	return append(b, make([]byte, size-int64(len(b)))...)
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.dir {
+		return memInfo{name: filepath.Base(f.name), mode: fs.ModeDir | 0o775}, nil
+	}
+	return f.d.info(f.name), nil
+}
+
+func (f *memFile) Chmod(mode fs.FileMode) error {
+	if f.closed {
+		return &fs.PathError{Op: "chmod", Path: f.name, Err: fs.ErrClosed}
+	}
+	if !f.dir {
+		f.d.mu.Lock()
+		f.d.mode = mode & fs.ModePerm
+		f.d.mu.Unlock()
+	}
+	return nil
+}
+
+// Sync does nothing: there is no disk to reach.
+func (f *memFile) Sync() error {
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// memInfo is the fs.FileInfo of a file of a Mem.
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (fi memInfo) Name() string       { return fi.name }
+func (fi memInfo) Size() int64        { return fi.size }
+func (fi memInfo) Mode() fs.FileMode  { return fi.mode }
+func (fi memInfo) ModTime() time.Time { return fi.modTime }
+func (fi memInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi memInfo) Sys() any           { return nil }
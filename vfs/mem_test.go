@@ -0,0 +1,175 @@
+package vfs_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// script runs the same file operations through fsys, in dir, and returns
+// a line for each of what it saw, for comparing file systems.
+func script(fsys vfs.FileSystem, dir string) []string {
+	var log []string
+	note := func(format string, args ...any) { log = append(log, fmt.Sprintf(format, args...)) }
+	name := filepath.Join(dir, "f")
+
+	_, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	note("open missing: %v", errors.Is(err, fs.ErrNotExist))
+	f, err := fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return append(log, err.Error())
+	}
+	_, err = fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	note("exclusive again: %v", errors.Is(err, fs.ErrExist))
+	n, err := f.Write([]byte("hello, world"))
+	note("write: %d %v", n, err)
+	n, err = f.WriteAt([]byte("HELLO"), 0)
+	note("write at: %d %v", n, err)
+	// Past the end, leaving a hole of zeros.
+	n, err = f.WriteAt([]byte("!"), 15)
+	note("write past the end: %d %v", n, err)
+	off, err := f.Seek(-4, io.SeekEnd)
+	note("seek: %d %v", off, err)
+	b := make([]byte, 10)
+	n, err = f.Read(b)
+	note("read: %q %v", b[:n], err)
+	n, err = f.Read(b)
+	note("read at the end: %d %v", n, err)
+	n, err = f.ReadAt(b, 10)
+	note("read at: %q %v", b[:n], err)
+
+	// A second file of the same name sees the writes.
+	g, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return append(log, err.Error())
+	}
+	data, err := io.ReadAll(g)
+	note("other file: %q %v", data, err)
+	_, err = g.Write([]byte("x"))
+	note("write to a read-only file fails: %v", err != nil)
+	note("truncate: %v", f.Truncate(5))
+	fi, err := g.Stat()
+	note("size after truncate: %d %v", fi.Size(), err)
+	note("close: %v", g.Close())
+	_, err = g.Read(b)
+	note("read after close: %v", errors.Is(err, fs.ErrClosed))
+	note("close again fails: %v", g.Close() != nil)
+
+	a, err := fsys.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return append(log, err.Error())
+	}
+	a.Write([]byte("+1"))
+	a.Write([]byte("+2"))
+	a.Close()
+	t, err := fsys.OpenFile(name, os.O_RDWR|os.O_TRUNC, 0)
+	if err != nil {
+		return append(log, err.Error())
+	}
+	t.Close()
+	fi, err = fsys.Stat(name)
+	note("size after O_TRUNC: %d %v", fi.Size(), err)
+	f.Close()
+
+	other := filepath.Join(dir, "g")
+	note("rename: %v", fsys.Rename(name, other))
+	_, err = fsys.Stat(name)
+	note("old name gone: %v", errors.Is(err, fs.ErrNotExist))
+	sub := filepath.Join(dir, "a", "b")
+	note("mkdir: %v", fsys.MkdirAll(sub, 0o755))
+	fi, err = fsys.Stat(sub)
+	note("dir: %v %v", fi.IsDir(), err)
+	note("rename into the dir: %v", fsys.Rename(other, filepath.Join(sub, "g")))
+	note("remove a full dir fails: %v", fsys.Remove(sub) != nil)
+	note("remove: %v", fsys.Remove(filepath.Join(sub, "g")))
+	note("remove again: %v", errors.Is(fsys.Remove(filepath.Join(sub, "g")), fs.ErrNotExist))
+	note("remove the empty dir: %v", fsys.Remove(sub))
+	return log
+}
+
+func TestMemLikeOS(t *testing.T) {
+	mem := script(&vfs.Mem{}, "/tmp/db")
+	disk := script(vfs.OS{}, t.TempDir())
+	for i := range max(len(mem), len(disk)) {
+		var m, d string
+		if i < len(mem) {
+			m = mem[i]
+		}
+		if i < len(disk) {
+			d = disk[i]
+		}
+		if m != d {
+			t.Errorf("Mem: %s\n OS: %s", m, d)
+		}
+	}
+}
+
+func TestMemModes(t *testing.T) {
+	var m vfs.Mem
+	f, err := m.OpenFile("f", os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if fi, err := m.Stat("f"); err != nil || fi.Mode() != 0o600 || fi.Name() != "f" {
+		t.Errorf("Stat = %v, %v", fi, err)
+	}
+	if err = f.Chmod(0o644); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := m.Lstat("./f"); err != nil || fi.Mode() != 0o644 {
+		t.Errorf("mode after Chmod = %v, %v", fi.Mode(), err)
+	}
+	// The directories that always exist open as such, read-only.
+	for _, dir := range []string{".", "/"} {
+		d, err := m.OpenFile(dir, os.O_RDONLY, 0)
+		if err != nil {
+			t.Errorf("open %s: %v", dir, err)
+			continue
+		}
+		if err = d.Sync(); err != nil {
+			t.Errorf("sync of %s: %v", dir, err)
+		}
+		d.Close()
+		if _, err = m.OpenFile(dir, os.O_RDWR, 0); err == nil {
+			t.Errorf("%s opened for writing", dir)
+		}
+	}
+	if err = m.MkdirAll("f/sub", 0o755); err == nil {
+		t.Error("MkdirAll through a file")
+	}
+}
+
+func TestMemConcurrent(t *testing.T) {
+	var m vfs.Mem
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			name := fmt.Sprint("f", i%2)
+			f, err := m.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o644)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer f.Close()
+			for j := range 100 {
+				f.WriteAt([]byte{byte(j)}, int64(i*100+j))
+				f.ReadAt(make([]byte, 10), int64(j))
+				m.Stat(name)
+			}
+		})
+	}
+	wg.Wait()
+	for i := range 2 {
+		if fi, err := m.Stat(fmt.Sprint("f", i)); err != nil || fi.Size() != int64(700+i*100) {
+			t.Errorf("f%d: %v, %v", i, fi, err)
+		}
+	}
+}
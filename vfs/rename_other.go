@@ -0,0 +1,7 @@
+//go:build !windows
+
+package vfs
+
+import "os"
+
+func rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
@@ -0,0 +1,36 @@
+//go:build windows
+
+package vfs
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procMoveFileExW = syscall.NewLazyDLL("kernel32.dll").NewProc("MoveFileExW")
+
+const (
+	movefileReplaceExisting = 0x1
+	movefileWriteThrough    = 0x8
+)
+
+// rename is os.Rename, asking MoveFileEx to write the move through to disk
+// before returning. Windows cannot fsync a directory, so this is what makes
+// a rename durable there.
+func rename(oldpath, newpath string) error {
+	from, err := syscall.UTF16PtrFromString(oldpath)
+	if err != nil {
+		return err
+	}
+	to, err := syscall.UTF16PtrFromString(newpath)
+	if err != nil {
+		return err
+	}
+	r, _, err := procMoveFileExW.Call(uintptr(unsafe.Pointer(from)), uintptr(unsafe.Pointer(to)),
+		movefileReplaceExisting|movefileWriteThrough)
+	if r == 0 {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Package vfs is the slice of the operating system's file API that the save
+// and load functions, the log and the pager go through. Swapping it lets
+// tests (and package dbtest) inject failures, simulate crashes or watch
+// exactly which calls a save makes, and Mem keeps files in memory.
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+)
+
+// File is an open file, as returned by FileSystem.OpenFile.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	io.ReaderAt
+	io.WriterAt
+	Name() string
+	Stat() (fs.FileInfo, error)
+	Chmod(mode fs.FileMode) error
+	Sync() error
+	Truncate(size int64) error
+}
+
+// FileSystem is what the save functions need from a file system. Paths are
+// operating-system paths, as with package os.
+type FileSystem interface {
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	MkdirAll(path string, perm fs.FileMode) error
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+}
+
+// OS is the real file system, backed by package os.
+type OS struct{}
+
+func (OS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	fp, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err // keep the interface nil, not a nil *os.File
+	}
+	return fp, nil
+}
+
+func (OS) MkdirAll(path string, perm fs.FileMode) error { return os.MkdirAll(path, perm) }
+func (OS) Stat(name string) (fs.FileInfo, error)        { return os.Stat(name) }
+func (OS) Lstat(name string) (fs.FileInfo, error)       { return os.Lstat(name) }
+func (OS) Rename(oldpath, newpath string) error         { return rename(oldpath, newpath) }
+func (OS) Remove(name string) error                     { return os.Remove(name) }
+
+// ReadFile is os.ReadFile over fsys.
+func ReadFile(fsys FileSystem, name string) ([]byte, error) {
+	fp, err := fsys.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return io.ReadAll(fp)
+}
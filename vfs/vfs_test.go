@@ -0,0 +1,42 @@
+package vfs_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+func TestOSRenameReplaces(t *testing.T) {
+	d := t.TempDir()
+	from, to := filepath.Join(d, "from"), filepath.Join(d, "to")
+	for name, data := range map[string]string{from: "new", to: "old"} {
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := (vfs.OS{}).Rename(from, to); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := vfs.ReadFile(vfs.OS{}, to); err != nil || string(b) != "new" {
+		t.Errorf("target holds %q, %v after the rename", b, err)
+	}
+	if _, err := os.Stat(from); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("source still there: %v", err)
+	}
+
+	err := (vfs.OS{}).Rename(from, to)
+	var le *os.LinkError
+	if !errors.As(err, &le) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("rename of a missing file: %#v, want a *LinkError of ErrNotExist", err)
+	}
+}
+
+func TestOSOpenFileNil(t *testing.T) {
+	fp, err := (vfs.OS{}).OpenFile(filepath.Join(t.TempDir(), "missing"), os.O_RDONLY, 0)
+	if err == nil || fp != nil {
+		t.Errorf("open of a missing file = %v, %v; want a nil File", fp, err)
+	}
+}
@@ -0,0 +1,368 @@
+// Package wal is an append-only log of checksummed records: the write-ahead
+// log a store appends its changes to before applying them in place.
+//
+// Each record is framed as
+//
+//	len u32 LE | crc32 IEEE of len and payload u32 LE | payload
+//
+// The checksum covers the length too, so that a tail of zeros, which file
+// systems can leave after a crash, does not pass for empty records.
+//
+// Appending never touches bytes already in the log, so a crash can only
+// damage its tail: a record that was half written, or written but never
+// synced and partly lost. Open finds the first record that does not check
+// out and truncates the log there, keeping every record before it.
+//
+// A log opened with Options.Key has its payloads encrypted with AES-GCM,
+// as
+//
+//	nonce (12 bytes, random) | encrypted payload | tag (16 bytes)
+//
+// with the record's offset authenticated along with it, so that a record
+// moved elsewhere in the log fails as one changed does. The checksum is
+// that of the encrypted payload: a torn tail is told apart without the
+// key. A record that checks out but fails authentication is the sign of a
+// wrong key, not of a crash, unless it is the last one and follows one
+// that opened with the key: then it is taken as torn, as is one too short
+// to be sealed.
+package wal
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/adcondev/go-database/vfs"
+)
+
+// headerSize is the size of a record's length and checksum.
+const headerSize = 8
+
+// MaxRecordSize is the largest payload a record can carry. Recovery also
+// takes a larger length, encryption aside, as a sign of a torn tail.
+const MaxRecordSize = 64 << 20
+
+// An encrypted payload carries its nonce and tag, sealSize bytes in all.
+const (
+	nonceSize = 12
+	sealSize  = nonceSize + 16
+)
+
+var (
+	ErrClosed   = errors.New("wal: log is closed")
+	ErrTooLarge = errors.New("wal: record larger than MaxRecordSize")
+	ErrBroken   = errors.New("wal: log tail could not be repaired after a failed append")
+	ErrKey      = errors.New("wal: record fails authentication; wrong key")
+
+	errTorn = errors.New("wal: torn record")
+)
+
+// Options tunes how a log is opened. The zero value is what Open uses.
+type Options struct {
+	// FS is the file system the log lives on; nil means vfs.OS.
+	FS vfs.FileSystem
+
+	// Mode is the permission of a newly created log; zero means 0664.
+	Mode os.FileMode
+
+	// Key, if set, encrypts the payloads with AES-GCM: AES-128, AES-192
+	// or AES-256 for a key of 16, 24 or 32 bytes. A log must be opened
+	// with the key it was written with; Open fails with ErrKey otherwise,
+	// unless the log is empty.
+	Key []byte
+}
+
+// cipher returns the AEAD of o.Key, or nil if there is none.
+func (o Options) cipher() (cipher.AEAD, error) {
+	if o.Key == nil {
+		return nil, nil
+	}
+	block, err := aes.NewCipher(o.Key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (o Options) fs() vfs.FileSystem {
+	if o.FS == nil {
+		return vfs.OS{}
+	}
+	return o.FS
+}
+
+func (o Options) mode() os.FileMode {
+	if o.Mode == 0 {
+		return 0664
+	}
+	return o.Mode.Perm()
+}
+
+// Log is an open write-ahead log. Its methods are safe for concurrent use.
+type Log struct {
+	fs   vfs.FileSystem
+	name string
+
+	aead cipher.AEAD // nil if the log is not encrypted
+
+	mu     sync.Mutex
+	fp     vfs.File
+	size   int64 // bytes of whole records; the file ends here
+	err    error // set once the tail is in an unknown state
+	closed bool
+}
+
+// Open opens the log at path, creating it if needed, and truncates any torn
+// tail left by a crash. Appends go after the last intact record.
+func Open(path string) (*Log, error) {
+	return Options{}.Open(path)
+}
+
+// Open is Open honouring the options in o.
+func (o Options) Open(path string) (*Log, error) {
+	aead, err := o.cipher()
+	if err != nil {
+		return nil, err
+	}
+	fsys := o.fs()
+	fp, err := fsys.OpenFile(path, os.O_RDWR|os.O_CREATE, o.mode())
+	if err != nil {
+		return nil, err
+	}
+	var check func(off int64, payload []byte) error
+	opened, failed := false, int64(-1)
+	if aead != nil {
+		// A wrong key must not look torn: a record that fails to open is
+		// only cut if the key has opened an earlier one and no intact
+		// record follows it.
+		check = func(off int64, payload []byte) error {
+			if failed >= 0 {
+				return ErrKey
+			}
+			if len(payload) < sealSize {
+				return errTorn
+			}
+			if _, err := open(aead, off, payload); err != nil {
+				if !opened {
+					return err
+				}
+				failed = off
+			}
+			opened = true
+			return nil
+		}
+	}
+	size, err := scan(fp, -1, check)
+	if err != nil {
+		fp.Close()
+		return nil, err
+	}
+	if failed >= 0 {
+		size = failed
+	}
+	if err = repair(fp, size); err != nil {
+		fp.Close()
+		return nil, err
+	}
+	return &Log{fs: fsys, name: path, aead: aead, fp: fp, size: size}, nil
+}
+
+// seal returns rec encrypted, for a record at off.
+func seal(aead cipher.AEAD, off int64, rec []byte) []byte {
+	nonce := make([]byte, nonceSize, nonceSize+len(rec)+sealSize)
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, rec, binary.LittleEndian.AppendUint64(nil, uint64(off)))
+}
+
+// open returns the payload of the encrypted record at off.
+func open(aead cipher.AEAD, off int64, payload []byte) ([]byte, error) {
+	if len(payload) < sealSize {
+		return nil, ErrKey
+	}
+	rec, err := aead.Open(nil, payload[:nonceSize], payload[nonceSize:], binary.LittleEndian.AppendUint64(nil, uint64(off)))
+	if err != nil {
+		return nil, ErrKey
+	}
+	return rec, nil
+}
+
+// repair cuts fp down to size if it is longer, syncs the cut, and leaves
+// the offset at size for the next append.
+func repair(fp vfs.File, size int64) error {
+	fi, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() > size {
+		if err = fp.Truncate(size); err != nil {
+			return err
+		}
+		// Make the cut stick: an append landing after stale bytes that
+		// reappear on the next crash would be lost along with them.
+		if err = fp.Sync(); err != nil {
+			return err
+		}
+	}
+	_, err = fp.Seek(size, io.SeekStart)
+	return err
+}
+
+// scan reads records from the start of r, handing each payload and its
+// offset to fn when fn is not nil, and returns the offset just past the
+// last intact record.
+// limit, when not negative, stops it at that offset. Errors other than a
+// torn or corrupt record, fn's included, are returned as they are, but
+// for errTorn, with which fn has scan stop before the record.
+func scan(r io.Reader, limit int64, fn func(off int64, payload []byte) error) (int64, error) {
+	br := bufio.NewReader(r)
+	var off int64
+	var hdr [headerSize]byte
+	for limit < 0 || off < limit {
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			return off, tornOr(err)
+		}
+		n := binary.LittleEndian.Uint32(hdr[0:4])
+		sum := binary.LittleEndian.Uint32(hdr[4:8])
+		if n > MaxRecordSize+sealSize {
+			return off, nil
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return off, tornOr(err)
+		}
+		if checksum(hdr[0:4], payload) != sum {
+			return off, nil
+		}
+		if fn != nil {
+			if err := fn(off, payload); err == errTorn {
+				return off, nil
+			} else if err != nil {
+				return off, err
+			}
+		}
+		off += headerSize + int64(n)
+	}
+	return off, nil
+}
+
+// checksum returns the checksum of a record of length n, encoded, and
+// payload.
+func checksum(n, payload []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(n), crc32.IEEETable, payload)
+}
+
+// tornOr swallows the errors a record cut short by the end of the file
+// produces, which only mean the tail is torn.
+func tornOr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+// Append adds rec to the end of the log and returns its offset, which
+// identifies the record. The record is not durable until Sync returns.
+func (l *Log) Append(rec []byte) (int64, error) {
+	if len(rec) > MaxRecordSize {
+		return 0, ErrTooLarge
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.usable(); err != nil {
+		return 0, err
+	}
+	off := l.size
+	if l.aead != nil {
+		rec = seal(l.aead, off, rec)
+	}
+	buf := make([]byte, headerSize+len(rec))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(rec)))
+	binary.LittleEndian.PutUint32(buf[4:8], checksum(buf[0:4], rec))
+	copy(buf[headerSize:], rec)
+
+	if _, err := l.fp.Write(buf); err != nil {
+		// Don't leave a partial record for the next append to follow:
+		// recovery would stop at it and drop everything after.
+		if repair(l.fp, off) != nil {
+			l.err = ErrBroken
+		}
+		return 0, err
+	}
+	l.size += int64(len(buf))
+	return off, nil
+}
+
+// Sync makes every record appended so far durable.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.usable(); err != nil {
+		return err
+	}
+	return l.fp.Sync()
+}
+
+// Size returns the length of the log in bytes, which is also the offset
+// the next record will get.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// Replay calls fn with the payload of every record in the log, oldest
+// first, stopping at the first error fn returns. It reads through its own
+// file handle and sees the records appended before it was called, synced
+// or not; appends made while it runs are safe but not replayed. fn may
+// keep the payload.
+func (l *Log) Replay(fn func(rec []byte) error) error {
+	l.mu.Lock()
+	if err := l.usable(); err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	size := l.size
+	l.mu.Unlock()
+
+	fp, err := l.fs.OpenFile(l.name, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	_, err = scan(fp, size, func(off int64, payload []byte) error {
+		if l.aead != nil {
+			var err error
+			if payload, err = open(l.aead, off, payload); err != nil {
+				return err
+			}
+		}
+		return fn(payload)
+	})
+	return err
+}
+
+// Close closes the log without syncing it.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return ErrClosed
+	}
+	l.closed = true
+	return l.fp.Close()
+}
+
+// usable returns why the log can't take calls, if it can't. l.mu is held.
+func (l *Log) usable() error {
+	if l.closed {
+		return ErrClosed
+	}
+	return l.err
+}
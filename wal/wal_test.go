@@ -0,0 +1,345 @@
+package wal_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adcondev/go-database/dbtest"
+	"github.com/adcondev/go-database/vfs"
+	"github.com/adcondev/go-database/wal"
+)
+
+// records returns n records of different lengths, an empty one among them.
+func records(n int) [][]byte {
+	recs := make([][]byte, n)
+	for i := range recs {
+		recs[i] = bytes.Repeat([]byte{byte('a' + i%26)}, i*37%300)
+	}
+	return recs
+}
+
+// replay returns the records of l.
+func replay(t *testing.T, l *wal.Log) [][]byte {
+	t.Helper()
+	var got [][]byte
+	if err := l.Replay(func(rec []byte) error {
+		got = append(got, rec)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func equal(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// appendAll appends recs to a new log at path and closes it, returning the
+// offsets it gave them.
+func appendAll(t *testing.T, o wal.Options, path string, recs [][]byte) []int64 {
+	t.Helper()
+	l, err := o.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	var offs []int64
+	for _, rec := range recs {
+		off, err := l.Append(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offs = append(offs, off)
+	}
+	if err = l.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	return offs
+}
+
+func TestAppendReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	recs := records(20)
+	offs := appendAll(t, wal.Options{}, path, recs)
+	if offs[0] != 0 {
+		t.Errorf("first record at %d, want 0", offs[0])
+	}
+	for i := 1; i < len(offs); i++ {
+		if want := offs[i-1] + 8 + int64(len(recs[i-1])); offs[i] != want {
+			t.Errorf("record %d at %d, want %d", i, offs[i], want)
+		}
+	}
+
+	l, err := wal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if got := replay(t, l); !equal(got, recs) {
+		t.Fatalf("replayed %d records, want the %d appended", len(got), len(recs))
+	}
+	// Appends after a reopen go on from the end.
+	size := l.Size()
+	if off, err := l.Append([]byte("more")); err != nil || off != size {
+		t.Errorf("Append after reopen = %d, %v; want %d", off, err, size)
+	}
+	if got := replay(t, l); !equal(got, append(recs, []byte("more"))) {
+		t.Error("replay after the append does not end with it")
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = l.Replay(func([]byte) error {
+		if n++; n == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 3 {
+		t.Errorf("Replay stopped with %v after %d records, want fn's error after 3", err, n)
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	dir := t.TempDir()
+	recs := records(5)
+	good := filepath.Join(dir, "good")
+	appendAll(t, wal.Options{}, good, recs)
+	whole, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := append([]byte{}, whole...)
+	last := len(whole) - (8 + len(recs[4]))
+
+	for name, content := range map[string][]byte{
+		"cut in the header":  whole[:last+5],
+		"cut in the payload": whole[:len(whole)-1],
+		"zeros":              append(whole[:last:last], make([]byte, 4096)...),
+		"garbage":            append(whole[:last:last], []byte("\xff\xff\xff\x7fjunk")...),
+		"flipped payload":    append(extra[:len(extra)-1:len(extra)-1], extra[len(extra)-1]^1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			l, err := wal.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			if l.Size() != int64(last) {
+				t.Errorf("Size %d after recovery, want %d", l.Size(), last)
+			}
+			if got := replay(t, l); !equal(got, recs[:4]) {
+				t.Errorf("replayed %d records, want the 4 intact", len(got))
+			}
+			if fi, _ := os.Stat(path); fi.Size() != int64(last) {
+				t.Errorf("file of %d bytes after recovery, want the tail cut at %d", fi.Size(), last)
+			}
+			if _, err = l.Append([]byte("after")); err != nil {
+				t.Fatal(err)
+			}
+			if got := replay(t, l); !equal(got, append(recs[:4:4], []byte("after"))) {
+				t.Error("the record appended after recovery does not follow the intact ones")
+			}
+		})
+	}
+}
+
+func TestZeroTailOfEmptyRecords(t *testing.T) {
+	// An empty record has a checksum of its own, so a run of zeros after
+	// it is still torn.
+	path := filepath.Join(t.TempDir(), "log")
+	appendAll(t, wal.Options{}, path, [][]byte{{}, {}})
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 64))
+	f.Close()
+	l, err := wal.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if l.Size() != 16 || len(replay(t, l)) != 2 {
+		t.Errorf("Size %d, %d records; want the two empty ones alone", l.Size(), len(replay(t, l)))
+	}
+}
+
+func TestAppendErrors(t *testing.T) {
+	l, err := wal.Options{FS: &vfs.Mem{}}.Open("log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.Append(make([]byte, wal.MaxRecordSize+1)); err != wal.ErrTooLarge {
+		t.Errorf("Append of an oversized record: %v, want ErrTooLarge", err)
+	}
+	if err = l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = l.Append(nil); err != wal.ErrClosed {
+		t.Errorf("Append after Close: %v, want ErrClosed", err)
+	}
+	if err = l.Close(); err != wal.ErrClosed {
+		t.Errorf("second Close: %v, want ErrClosed", err)
+	}
+}
+
+func TestFailedAppendLeavesNoPartialRecord(t *testing.T) {
+	fsys := &dbtest.FaultyFS{FS: &vfs.Mem{}, FailAt: map[dbtest.Op]int{dbtest.OpWrite: 2}, Short: true}
+	l, err := wal.Options{FS: fsys}.Open("log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := range 3 {
+		_, err := l.Append(fmt.Appendf(nil, "record %d", i))
+		if (err != nil) != (i == 1) {
+			t.Fatalf("append %d: %v", i, err)
+		}
+	}
+	if got := replay(t, l); !equal(got, [][]byte{[]byte("record 0"), []byte("record 2")}) {
+		t.Errorf("replayed %q, want the appends that succeeded", got)
+	}
+}
+
+func TestCrash(t *testing.T) {
+	recs := records(8)
+	for seed := range uint64(20) {
+		mem := &vfs.Mem{}
+		fsys := &dbtest.CrashFS{FS: mem, Rand: newRand(seed)}
+		l, err := wal.Options{FS: fsys}.Open("log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, rec := range recs {
+			if _, err = l.Append(rec); err != nil {
+				t.Fatal(err)
+			}
+			if i == 3 {
+				if err = l.Sync(); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		fsys.Crash()
+		l.Close()
+
+		l, err = wal.Options{FS: mem}.Open("log")
+		if err != nil {
+			t.Fatalf("seed %d: reopen after the crash: %v", seed, err)
+		}
+		got := replay(t, l)
+		l.Close()
+		// The synced records survive, and the rest only as a prefix.
+		if len(got) < 4 || !equal(got, recs[:len(got)]) {
+			t.Errorf("seed %d: %d records after the crash, not a prefix of the appends holding the 4 synced", seed, len(got))
+		}
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	recs := append(records(9), []byte("the secret record"))
+	key, other := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	path := filepath.Join(dir, "log")
+	offs := appendAll(t, wal.Options{Key: key}, path, recs)
+	whole, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(whole, []byte("secret")) {
+		t.Error("the log holds a record in the clear")
+	}
+	l, err := wal.Options{Key: key}.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := replay(t, l); !equal(got, recs) {
+		t.Errorf("replayed %d records, want the %d appended", len(got), len(recs))
+	}
+	l.Close()
+	if _, err = (wal.Options{Key: other}).Open(path); !errors.Is(err, wal.ErrKey) {
+		t.Errorf("open with another key: %v, want ErrKey", err)
+	}
+	if fi, _ := os.Stat(path); fi.Size() != int64(len(whole)) {
+		t.Errorf("open with another key cut the log to %d bytes of %d", fi.Size(), len(whole))
+	}
+
+	// A log of the same records with the other key has them at the same
+	// offsets, for swapping in records that check out but do not open.
+	otherPath := filepath.Join(dir, "other")
+	appendAll(t, wal.Options{Key: other}, otherPath, recs)
+	foreign, err := os.ReadFile(otherPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped := func(i int) []byte {
+		b := bytes.Clone(whole)
+		end := int64(len(b))
+		if i+1 < len(offs) {
+			end = offs[i+1]
+		}
+		copy(b[offs[i]:end], foreign[offs[i]:end])
+		return b
+	}
+	last := offs[len(offs)-1]
+	// A record that checks out, too short to hold a nonce and a tag.
+	short := []byte{4, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4}
+	binary.LittleEndian.PutUint32(short[4:], crc32.Update(crc32.ChecksumIEEE(short[:4]), crc32.IEEETable, short[8:]))
+	for name, tc := range map[string]struct {
+		content []byte
+		size    int64 // after recovery, or -1 for ErrKey
+	}{
+		"zeros":                {append(whole[:last:last], make([]byte, 100)...), last},
+		"short record":         {append(whole[:last:last], short...), last},
+		"last fails to open":   {swapped(len(offs) - 1), last},
+		"middle fails to open": {swapped(2), -1},
+		"first fails to open":  {swapped(0), -1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, tc.content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			l, err := wal.Options{Key: key}.Open(path)
+			if tc.size < 0 {
+				if !errors.Is(err, wal.ErrKey) {
+					t.Errorf("Open = %v, want ErrKey", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer l.Close()
+			if l.Size() != tc.size {
+				t.Errorf("Size %d after recovery, want %d", l.Size(), tc.size)
+			}
+			if got := replay(t, l); !equal(got, recs[:len(recs)-1]) {
+				t.Errorf("replayed %d records, want the %d before the last", len(got), len(recs)-1)
+			}
+		})
+	}
+}
+
+func newRand(seed uint64) *rand.Rand { return rand.New(rand.NewPCG(seed, 1)) }